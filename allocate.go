@@ -0,0 +1,185 @@
+package libxfat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// allocator hands out clusters during one write operation. Bits change in an
+// in-memory copy of the bitmap and reach the image on flush.
+type allocator struct {
+	e      *ExFAT
+	bitmap *allocationBitmap
+	dirty  map[uint32]bool
+}
+
+func (e *ExFAT) newAllocator() (*allocator, error) {
+	bitmap, err := e.loadBitmap()
+	if err != nil {
+		return nil, err
+	}
+	return &allocator{e: e, bitmap: bitmap, dirty: map[uint32]bool{}}, nil
+}
+
+// isFree reports whether cluster can be allocated. Clusters past the end of
+// a short bitmap have no bit to record the allocation in, so they never are.
+func (a *allocator) isFree(cluster uint32) bool {
+	return a.e.vbr.isValidCluster(cluster) && cluster-uint32(FIRST_CLUSTER_NUMBER) < a.bitmap.covered() && !a.bitmap.isAllocated(cluster)
+}
+
+// freeRuns returns the free runs isFree accepts, in heap order.
+func (a *allocator) freeRuns() []Run {
+	end := a.bitmap.covered() + uint32(FIRST_CLUSTER_NUMBER)
+	var runs []Run
+	for _, run := range a.bitmap.freeRuns() {
+		if run.Start >= end {
+			break
+		}
+		if run.End() > end {
+			run.Length = end - run.Start
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// set marks cluster allocated or free.
+func (a *allocator) set(cluster uint32, allocated bool) error {
+	index := cluster - uint32(FIRST_CLUSTER_NUMBER)
+	if uint64(cluster) < FIRST_CLUSTER_NUMBER || index >= a.bitmap.covered() {
+		return fmt.Errorf("%w: cluster %d has no bit in the allocation bitmap", ErrInvalidCluster, cluster)
+	}
+	if allocated {
+		a.bitmap.bits[index/8] |= 1 << (index % 8)
+	} else {
+		a.bitmap.bits[index/8] &^= 1 << (index % 8)
+	}
+	a.dirty[index/8] = true
+	return nil
+}
+
+// next picks the cluster to follow prev: the one right after it when free,
+// otherwise the start of the largest free run. A zero prev starts a new
+// allocation. The cluster is marked allocated.
+func (a *allocator) next(prev uint32) (uint32, error) {
+	cluster := prev + 1
+	if prev == 0 || !a.isFree(cluster) {
+		runs := a.freeRuns()
+		if len(runs) == 0 {
+			return 0, ErrVolumeFull
+		}
+		cluster = largestRun(runs).Start
+	}
+	return cluster, a.set(cluster, true)
+}
+
+// flush writes the changed bitmap bytes back and refreshes PercentInUse.
+func (a *allocator) flush() error {
+	if len(a.dirty) == 0 {
+		return nil
+	}
+	v := &a.e.vbr
+	runs, err := v.getClusterRuns(v.bitmapEntry)
+	if err != nil {
+		return err
+	}
+
+	indices := make([]uint32, 0, len(a.dirty))
+	for index := range a.dirty {
+		indices = append(indices, index)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	for _, index := range indices {
+		off, ok := runsByteOffset(v, runs, uint64(index))
+		if !ok {
+			return fmt.Errorf("%w: bitmap byte %d outside the bitmap", ErrInvalidCluster, index)
+		}
+		if err := v.writeAt(a.bitmap.bits[index:index+1], off); err != nil {
+			return err
+		}
+	}
+	a.dirty = map[uint32]bool{}
+	return a.e.writePercentInUse(a.bitmap.allocatedCount())
+}
+
+// claim flushes the bitmap, then runs write to store the records that use
+// the newly allocated clusters. The bitmap goes first, so an interrupted
+// write leaves lost clusters rather than an entry pointing at free ones.
+func (a *allocator) claim(write func() error) error {
+	if err := a.flush(); err != nil {
+		return err
+	}
+	return write()
+}
+
+// writePercentInUse records the share of allocated clusters in the main boot
+// sector. A volume that reports it as unknown keeps doing so. The field is
+// left out of the boot checksum, so the checksum sector stays valid.
+func (e *ExFAT) writePercentInUse(allocated uint32) error {
+	if e.vbr.percentInUse == PERCENT_IN_USE_UNKNOWN {
+		return nil
+	}
+	percent := byte(uint64(allocated) * 100 / uint64(e.vbr.nbClusters))
+	if err := e.vbr.writeAt([]byte{percent}, e.vbr.vbrStart+EXFAT_PERCENT_USE_OFFSET); err != nil {
+		return err
+	}
+	e.vbr.percentInUse = percent
+	return nil
+}
+
+// writeVolumeFlags stores flags in the main boot sector. Like PercentInUse
+// they are left out of the boot checksum.
+func (e *ExFAT) writeVolumeFlags(flags VolumeFlags) error {
+	var raw [2]byte
+	binary.LittleEndian.PutUint16(raw[:], uint16(flags))
+	if err := e.vbr.writeAt(raw[:], e.vbr.vbrStart+EXFAT_VOLUME_FLAGS_OFFSET); err != nil {
+		return err
+	}
+	e.vbr.volumeFlags = flags
+	return nil
+}
+
+// writeFatEntry stores value for cluster in every FAT of the volume.
+func (v *VBR) writeFatEntry(cluster, value uint32) error {
+	if uint64(cluster) >= v.fatEntryCount() {
+		return fmt.Errorf("cluster out of fat: %d", cluster)
+	}
+	var raw [4]byte
+	binary.LittleEndian.PutUint32(raw[:], value)
+	fatBytes := uint64(v.fatSize) * uint64(v.sectorSize)
+	for i := uint64(0); i < max(uint64(v.nbFats), 1); i++ {
+		if err := v.writeAt(raw[:], v.firstFat+i*fatBytes+uint64(cluster)*4); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeChain links runs into one FAT chain ending with an end-of-chain mark.
+func (v *VBR) writeChain(runs []Run) error {
+	for i, run := range runs {
+		for cluster := run.Start; cluster < run.End(); cluster++ {
+			next := cluster + 1
+			if cluster == run.End()-1 {
+				next = EXFAT_EOF_END
+				if i+1 < len(runs) {
+					next = runs[i+1].Start
+				}
+			}
+			if err := v.writeFatEntry(cluster, next); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// appendCluster adds cluster to runs, growing the last run when contiguous.
+func appendCluster(runs []Run, cluster uint32) []Run {
+	if n := len(runs); n > 0 && runs[n-1].End() == cluster {
+		runs[n-1].Length++
+		return runs
+	}
+	return append(runs, Run{Start: cluster, Length: 1})
+}
@@ -0,0 +1,339 @@
+package libxfat
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BadClusterPolicy decides what reads do when a file's data reaches a cluster
+// the FAT marks bad (0x0FFFFFF7).
+type BadClusterPolicy int
+
+const (
+	// BAD_CLUSTER_FAIL: the read fails with ErrBadCluster. This is the
+	// default.
+	BAD_CLUSTER_FAIL BadClusterPolicy = iota
+	// BAD_CLUSTER_ZERO_FILL: the bad cluster is replaced by zeros and the
+	// read goes on. A FAT chain is lost past a bad cluster, so the rest of a
+	// chained file is zero-filled as well.
+	BAD_CLUSTER_ZERO_FILL
+	// BAD_CLUSTER_PARTIAL: the read stops at the bad cluster and returns
+	// what came before it.
+	BAD_CLUSTER_PARTIAL
+)
+
+var badClusterPolicyNames = map[BadClusterPolicy]string{
+	BAD_CLUSTER_FAIL:      "fail",
+	BAD_CLUSTER_ZERO_FILL: "zero-fill",
+	BAD_CLUSTER_PARTIAL:   "partial",
+}
+
+func (p BadClusterPolicy) String() string {
+	if name, ok := badClusterPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("policy(%d)", int(p))
+}
+
+func (p BadClusterPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// SetBadClusterPolicy sets how file and directory reads handle bad clusters.
+// Structure walks such as Check and BuildClusterMap always report them. The
+// FAT entries of a NoFatChain allocation carry no meaning, so reads of such
+// files never consult them; GetBadClusters lists any marker found there.
+func (e *ExFAT) SetBadClusterPolicy(policy BadClusterPolicy) {
+	e.vbr.badClusterPolicy = policy
+}
+
+// GetBadClusterPolicy returns the policy in effect.
+func (e *ExFAT) GetBadClusterPolicy() BadClusterPolicy {
+	return e.vbr.badClusterPolicy
+}
+
+// DamageKind says why a byte range of a file could not be read.
+type DamageKind int
+
+const (
+	// DAMAGE_BAD_CLUSTER: the range sits in a cluster the FAT marks bad.
+	DAMAGE_BAD_CLUSTER DamageKind = iota + 1
+	// DAMAGE_CHAIN_LOST: the range follows a bad cluster in a FAT chain, so
+	// where it is stored is unknown.
+	DAMAGE_CHAIN_LOST
+)
+
+var damageKindNames = map[DamageKind]string{
+	DAMAGE_BAD_CLUSTER: "bad-cluster",
+	DAMAGE_CHAIN_LOST:  "chain-lost",
+}
+
+func (k DamageKind) String() string {
+	if name, ok := damageKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("damage(%d)", int(k))
+}
+
+func (k DamageKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// DamagedRange is a byte range of a file, relative to its start, that could
+// not be read. Cluster is the bad cluster responsible.
+type DamagedRange struct {
+	Kind    DamageKind
+	Offset  uint64
+	Length  uint64
+	Cluster uint32
+}
+
+// ExtractionReport describes one extraction. Written counts the bytes written
+// to the destination, zero fill included. Partial is set when the
+// BAD_CLUSTER_PARTIAL policy stopped the extraction at the first damaged
+// range.
+type ExtractionReport struct {
+	Written uint64
+	Partial bool
+	Damaged []DamagedRange
+}
+
+// BadCluster is a cluster the FAT marks bad. Allocated is its bit in the
+// allocation bitmap.
+type BadCluster struct {
+	Cluster   uint32
+	Offset    uint64
+	Allocated bool
+}
+
+// BadClusterInventory lists every cluster the FAT marks bad, also as runs,
+// with how many of them the bitmap marks allocated and free.
+type BadClusterInventory struct {
+	Clusters  []BadCluster
+	Runs      []Run
+	Allocated uint32
+	Free      uint32
+}
+
+// GetBadClusters reads the whole FAT and lists the clusters marked bad,
+// cross-checked against the allocation bitmap. Markers inside NoFatChain
+// allocations, which file reads ignore, show up here as allocated.
+func (e *ExFAT) GetBadClusters() (BadClusterInventory, error) {
+	bitmap, err := e.loadBitmap()
+	if err != nil {
+		return BadClusterInventory{}, err
+	}
+
+	var inventory BadClusterInventory
+	start := uint32(FIRST_CLUSTER_NUMBER)
+	err = e.vbr.scanFatEntries(Run{Start: start, Length: e.vbr.nbClusters}, func(cluster, value uint32) {
+		if value != EXFAT_BAD_CLUSTER {
+			return
+		}
+		bad := BadCluster{Cluster: cluster, Offset: e.vbr.getClusterOffset(cluster), Allocated: bitmap.isAllocated(cluster)}
+		if bad.Allocated {
+			inventory.Allocated++
+		} else {
+			inventory.Free++
+		}
+		inventory.Clusters = append(inventory.Clusters, bad)
+		if n := len(inventory.Runs); n > 0 && inventory.Runs[n-1].End() == cluster {
+			inventory.Runs[n-1].Length++
+		} else {
+			inventory.Runs = append(inventory.Runs, Run{Start: cluster, Length: 1})
+		}
+	})
+	if err != nil {
+		return BadClusterInventory{}, err
+	}
+	return inventory, nil
+}
+
+// fatEntryCount returns the number of entries one FAT can hold.
+func (v *VBR) fatEntryCount() uint64 {
+	return (uint64(v.fatSize) * uint64(v.sectorSize)) / 4
+}
+
+// fatScanChunk is the number of FAT entries read at once.
+const fatScanChunk = 1 << 16
+
+// scanFatEntries reads the FAT entries of the clusters in run, in chunks, and
+// hands every masked value to fn.
+func (v *VBR) scanFatEntries(run Run, fn func(cluster, value uint32)) error {
+	if run.Length == 0 {
+		return nil
+	}
+	if uint64(run.End()) > v.fatEntryCount() {
+		return fmt.Errorf("cluster out of fat: %d", run.End()-1)
+	}
+
+	buf := make([]byte, 4*fatScanChunk)
+	for cluster := run.Start; cluster < run.End(); {
+		count := run.End() - cluster
+		if count > fatScanChunk {
+			count = fatScanChunk
+		}
+		chunk := buf[:4*count]
+		if _, err := v.dimage.ReadAt(chunk, int64(v.firstFat)+int64(cluster)*4); err != nil {
+			return err
+		}
+		for i := uint32(0); i < count; i++ {
+			fn(cluster+i, unpackLELong(chunk[4*i:4*i+4])&EXFAT_CLUSTER_MASK)
+		}
+		cluster += count
+	}
+	return nil
+}
+
+// walkEntryData hands the runs holding entry's data, in file order, to data
+// along with how many of their bytes belong to the file, applying the bad
+// cluster policy on the way. Zero-filled ranges are handed to hole. The
+// returned ranges list what could not be read; partial is set when the
+// policy stopped the walk.
+func (v *VBR) walkEntryData(entry Entry, data func(run Run, size uint64) error, hole func(cluster uint32, size uint64) error) (damage []DamagedRange, partial bool, err error) {
+	if entry.dataLen == 0 {
+		return nil, false, nil
+	}
+
+	remaining := entry.dataLen
+	offset := uint64(0)
+	emit := func(run Run) error {
+		size := uint64(run.Length) * v.clusterSize
+		if size > remaining {
+			size = remaining
+		}
+		if size == 0 {
+			return nil
+		}
+		remaining -= size
+		offset += size
+		return data(run, size)
+	}
+	// bad handles a bad cluster at the current offset; with lost set the
+	// rest of the file goes with it.
+	bad := func(cluster uint32, lost bool) error {
+		if remaining == 0 {
+			return nil
+		}
+		if v.badClusterPolicy == BAD_CLUSTER_FAIL {
+			return fmt.Errorf("%w: %d", ErrBadCluster, cluster)
+		}
+
+		size := v.clusterSize
+		if size > remaining {
+			size = remaining
+		}
+		ranges := []DamagedRange{{Kind: DAMAGE_BAD_CLUSTER, Offset: offset, Length: size, Cluster: cluster}}
+		if lost && remaining > size {
+			ranges = append(ranges, DamagedRange{Kind: DAMAGE_CHAIN_LOST, Offset: offset + size, Length: remaining - size, Cluster: cluster})
+		}
+		damage = append(damage, ranges...)
+		if v.badClusterPolicy == BAD_CLUSTER_PARTIAL {
+			partial = true
+			return errStopClusterWalk
+		}
+
+		for _, r := range ranges {
+			if err := hole(cluster, r.Length); err != nil {
+				return err
+			}
+			remaining -= r.Length
+			offset += r.Length
+		}
+		if lost {
+			return errStopClusterWalk
+		}
+		return nil
+	}
+	// split emits a run of a FAT chain around the clusters its FAT entries
+	// mark bad. Clusters past the end of an undersized FAT are taken as good.
+	split := func(run Run) error {
+		var bads []uint32
+		marked := run
+		if fatEntries := v.fatEntryCount(); uint64(marked.End()) > fatEntries {
+			marked.Length = uint32(max(fatEntries, uint64(marked.Start)) - uint64(marked.Start))
+		}
+		if err := v.scanFatEntries(marked, func(cluster, value uint32) {
+			if value == EXFAT_BAD_CLUSTER {
+				bads = append(bads, cluster)
+			}
+		}); err != nil {
+			return err
+		}
+		start := run.Start
+		for _, cluster := range bads {
+			if cluster > start {
+				if err := emit(Run{Start: start, Length: cluster - start}); err != nil {
+					return err
+				}
+			}
+			if err := bad(cluster, false); err != nil {
+				return err
+			}
+			start = cluster + 1
+		}
+		if start < run.End() {
+			return emit(Run{Start: start, Length: run.End() - start})
+		}
+		return nil
+	}
+
+	sizeInClusters, _ := v.size2Clusters(entry.dataLen)
+	if entry.noFatChain {
+		run, cerr := v.contiguousRun(entry.entryCluster, sizeInClusters)
+		if run.Length > 0 {
+			err = emit(run)
+		}
+		if err == nil {
+			err = cerr
+		}
+	} else {
+		// The walk reports a bad cluster only after handing over the run
+		// that ends with it, so every run is held back one step.
+		var pending Run
+		var emitErr error
+		err = v.walkChainRuns(entry.entryCluster, sizeInClusters, func(run Run) error {
+			if pending.Length > 0 {
+				if emitErr = emit(pending); emitErr != nil {
+					return emitErr
+				}
+			}
+			pending = run
+			return nil
+		})
+		switch {
+		case emitErr != nil:
+			err = emitErr
+		case pending.Length == 0:
+		case errors.Is(err, ErrBadCluster):
+			last := pending.End() - 1
+			if err = emit(Run{Start: pending.Start, Length: pending.Length - 1}); err == nil {
+				err = bad(last, true)
+			}
+		case err != nil:
+			if eerr := emit(pending); eerr != nil {
+				err = eerr
+			}
+		default:
+			// The walk stopped at DataLength without reading the entry of
+			// the last cluster.
+			last := pending.End() - 1
+			if err = emit(Run{Start: pending.Start, Length: pending.Length - 1}); err == nil {
+				err = split(Run{Start: last, Length: 1})
+			}
+		}
+	}
+
+	if errors.Is(err, errStopClusterWalk) {
+		err = nil
+	}
+	return damage, partial, err
+}
+
+// zeroReader reads zeros forever.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,74 @@
+package libxfat
+
+import (
+	"errors"
+	"testing"
+)
+
+type entryDataWalk struct {
+	runs    []Run
+	holes   uint64
+	damage  []DamagedRange
+	partial bool
+	err     error
+}
+
+func walkTestEntryData(vbr *VBR, entry Entry) entryDataWalk {
+	var walk entryDataWalk
+	walk.damage, walk.partial, walk.err = vbr.walkEntryData(entry, func(run Run, size uint64) error {
+		walk.runs = append(walk.runs, run)
+		return nil
+	}, func(_ uint32, size uint64) error {
+		walk.holes += size
+		return nil
+	})
+	return walk
+}
+
+func TestWalkEntryDataBadClusterInChain(t *testing.T) {
+	vbr := newTestVBRWithFAT(t, map[uint32]uint32{
+		2: 3,
+		3: EXFAT_BAD_CLUSTER,
+	})
+	vbr.clusterSize = 512
+	entry := Entry{entryCluster: 2, dataLen: 4 * 512}
+	wantDamage := []DamagedRange{
+		{Kind: DAMAGE_BAD_CLUSTER, Offset: 512, Length: 512, Cluster: 3},
+		{Kind: DAMAGE_CHAIN_LOST, Offset: 1024, Length: 1024, Cluster: 3},
+	}
+
+	walk := walkTestEntryData(&vbr, entry)
+	if !errors.Is(walk.err, ErrBadCluster) || len(walk.runs) != 1 {
+		t.Fatalf("fail policy = %+v, want ErrBadCluster after one run", walk)
+	}
+
+	vbr.badClusterPolicy = BAD_CLUSTER_ZERO_FILL
+	walk = walkTestEntryData(&vbr, entry)
+	if walk.err != nil || walk.partial || walk.holes != 3*512 || len(walk.runs) != 1 || walk.runs[0] != (Run{Start: 2, Length: 1}) {
+		t.Fatalf("zero-fill policy = %+v, want run {2 1} and 1536 zeroed bytes", walk)
+	}
+	if len(walk.damage) != 2 || walk.damage[0] != wantDamage[0] || walk.damage[1] != wantDamage[1] {
+		t.Fatalf("damage = %+v, want %+v", walk.damage, wantDamage)
+	}
+
+	vbr.badClusterPolicy = BAD_CLUSTER_PARTIAL
+	walk = walkTestEntryData(&vbr, entry)
+	if walk.err != nil || !walk.partial || walk.holes != 0 || len(walk.runs) != 1 || len(walk.damage) != 2 {
+		t.Fatalf("partial policy = %+v, want one run then stop", walk)
+	}
+}
+
+func TestWalkEntryDataIgnoresFatOfContiguousFile(t *testing.T) {
+	vbr := newTestVBRWithFAT(t, map[uint32]uint32{
+		3: EXFAT_BAD_CLUSTER,
+	})
+	vbr.clusterSize = 512
+
+	walk := walkTestEntryData(&vbr, Entry{entryCluster: 2, dataLen: 3*512 - 10, noFatChain: true})
+	if walk.err != nil || len(walk.runs) != 1 || walk.runs[0] != (Run{Start: 2, Length: 3}) {
+		t.Fatalf("walk = %+v, want run {2 3}", walk)
+	}
+	if walk.holes != 0 || len(walk.damage) != 0 {
+		t.Fatalf("damage = %+v, want none", walk.damage)
+	}
+}
@@ -0,0 +1,99 @@
+package libxfat
+
+import (
+	"errors"
+	"io"
+)
+
+// allocationBitmap is an in-memory copy of the allocation bitmap, trimmed to
+// the clusters the volume actually has.
+type allocationBitmap struct {
+	bits       []byte
+	nbClusters uint32
+}
+
+func (b *allocationBitmap) isAllocated(cluster uint32) bool {
+	if uint64(cluster) < FIRST_CLUSTER_NUMBER {
+		return false
+	}
+	index := cluster - uint32(FIRST_CLUSTER_NUMBER)
+	if index >= b.nbClusters || int(index/8) >= len(b.bits) {
+		return false
+	}
+	return b.bits[index/8]&(1<<(index%8)) != 0
+}
+
+// covered returns the number of clusters the bitmap has a bit for: all of
+// them, unless its data is shorter than the heap.
+func (b *allocationBitmap) covered() uint32 {
+	if uint64(len(b.bits))*8 < uint64(b.nbClusters) {
+		return uint32(len(b.bits)) * 8
+	}
+	return b.nbClusters
+}
+
+// allocatedCount counts set bits for the clusters the volume has, ignoring
+// the padding bits of the last byte and anything past it.
+func (b *allocationBitmap) allocatedCount() uint32 {
+	full := int(b.nbClusters / 8)
+	if full > len(b.bits) {
+		full = len(b.bits)
+	}
+	count := countBitmap(b.bits[:full])
+	for index := uint32(full) * 8; index < b.nbClusters; index++ {
+		if b.isAllocated(index + uint32(FIRST_CLUSTER_NUMBER)) {
+			count++
+		}
+	}
+	return count
+}
+
+// freeRuns returns the runs of clusters marked free, in heap order.
+func (b *allocationBitmap) freeRuns() []Run {
+	var runs []Run
+	var run Run
+	for index := uint32(0); index < b.nbClusters; index++ {
+		if index%8 == 0 && int(index/8) < len(b.bits) && b.bits[index/8] == 0xff && index+8 <= b.nbClusters {
+			if run.Length > 0 {
+				runs = append(runs, run)
+				run = Run{}
+			}
+			index += 7
+			continue
+		}
+
+		cluster := index + uint32(FIRST_CLUSTER_NUMBER)
+		if b.isAllocated(cluster) {
+			if run.Length > 0 {
+				runs = append(runs, run)
+				run = Run{}
+			}
+			continue
+		}
+		if run.Length == 0 {
+			run.Start = cluster
+		}
+		run.Length++
+	}
+	if run.Length > 0 {
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// loadBitmap reads the allocation bitmap into memory.
+func (e *ExFAT) loadBitmap() (*allocationBitmap, error) {
+	if err := e.ensureBitmapEntry(); err != nil {
+		return nil, err
+	}
+
+	bitmap := &allocationBitmap{nbClusters: e.vbr.nbClusters}
+	err := e.vbr.visitEntryData(e.vbr.bitmapEntry, func(_ uint32, chunk []byte) error {
+		bitmap.bits = append(bitmap.bits, chunk...)
+		return nil
+	})
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, ErrEOF) {
+		return nil, err
+	}
+	return bitmap, nil
+}
@@ -0,0 +1,72 @@
+package libxfat
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAllocationBitmapIgnoresPaddingBits(t *testing.T) {
+	bitmap := allocationBitmap{bits: []byte{0xff, 0xff}, nbClusters: 10}
+
+	if got := bitmap.allocatedCount(); got != 10 {
+		t.Fatalf("allocatedCount() = %d, want 10", got)
+	}
+	if runs := bitmap.freeRuns(); len(runs) != 0 {
+		t.Fatalf("freeRuns() = %v, want none", runs)
+	}
+}
+
+func TestAllocationBitmapFreeRunsAcrossBytes(t *testing.T) {
+	bitmap := allocationBitmap{bits: []byte{0x3f, 0xff, 0x0e}, nbClusters: 22}
+
+	runs := bitmap.freeRuns()
+	want := []Run{{Start: 8, Length: 2}, {Start: 18, Length: 1}, {Start: 22, Length: 2}}
+	if len(runs) != len(want) {
+		t.Fatalf("freeRuns() = %v, want %v", runs, want)
+	}
+	for i := range want {
+		if runs[i] != want[i] {
+			t.Fatalf("freeRuns() = %v, want %v", runs, want)
+		}
+	}
+}
+
+func TestFreeSpaceRegionsSplitRuns(t *testing.T) {
+	regions := freeSpaceRegions([]Run{{Start: 4, Length: 6}}, 10, 3)
+
+	want := []FreeSpaceRegion{
+		{Start: 2, Length: 3, Free: 1},
+		{Start: 5, Length: 3, Free: 3},
+		{Start: 8, Length: 4, Free: 2},
+	}
+	for i := range want {
+		if regions[i] != want[i] {
+			t.Fatalf("freeSpaceRegions() = %v, want %v", regions, want)
+		}
+	}
+}
+
+func TestAllocatorSkipsClustersPastShortBitmap(t *testing.T) {
+	e := &ExFAT{}
+	e.vbr.nbClusters = 64
+	// The bitmap data ends after cluster 9; 5-9 are free.
+	a := &allocator{e: e, bitmap: &allocationBitmap{bits: []byte{0x07}, nbClusters: 64}, dirty: map[uint32]bool{}}
+
+	if a.isFree(10) {
+		t.Fatal("isFree(10) = true past the end of the bitmap")
+	}
+	if runs := a.freeRuns(); len(runs) != 1 || runs[0] != (Run{Start: 5, Length: 5}) {
+		t.Fatalf("freeRuns() = %v, want clusters 5-9", runs)
+	}
+	for want := uint32(5); want <= 9; want++ {
+		if cluster, err := a.next(want - 1); err != nil || cluster != want {
+			t.Fatalf("next(%d) = %d, %v, want %d", want-1, cluster, err, want)
+		}
+	}
+	if _, err := a.next(9); !errors.Is(err, ErrVolumeFull) {
+		t.Fatalf("next(9) error = %v, want ErrVolumeFull", err)
+	}
+	if err := a.set(10, true); !errors.Is(err, ErrInvalidCluster) {
+		t.Fatalf("set(10) error = %v, want ErrInvalidCluster", err)
+	}
+}
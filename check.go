@@ -0,0 +1,470 @@
+package libxfat
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Severity ranks how much a consistency finding undermines trust in the
+// volume.
+type Severity int
+
+const (
+	SEVERITY_INFO Severity = iota
+	SEVERITY_WARNING
+	SEVERITY_ERROR
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SEVERITY_INFO:
+		return "info"
+	case SEVERITY_WARNING:
+		return "warning"
+	case SEVERITY_ERROR:
+		return "error"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// FindingKind identifies one class of consistency problem.
+type FindingKind int
+
+const (
+	// FINDING_LOST_CLUSTERS: a run of clusters marked allocated in the bitmap
+	// that no file, directory or metadata structure owns.
+	FINDING_LOST_CLUSTERS FindingKind = iota + 1
+	// FINDING_CROSS_LINKED: clusters claimed by two owners.
+	FINDING_CROSS_LINKED
+	// FINDING_CHAIN_TOO_SHORT: fewer clusters than DataLength needs.
+	FINDING_CHAIN_TOO_SHORT
+	// FINDING_CHAIN_TOO_LONG: more clusters than DataLength needs.
+	FINDING_CHAIN_TOO_LONG
+	// FINDING_FREE_CLUSTER_IN_CHAIN: owned clusters marked free in the bitmap.
+	FINDING_FREE_CLUSTER_IN_CHAIN
+	// FINDING_BAD_CLUSTER_IN_CHAIN: the chain reaches a bad cluster marker.
+	FINDING_BAD_CLUSTER_IN_CHAIN
+	// FINDING_CHAIN_BROKEN: a FAT entry points outside the cluster heap, or
+	// the FAT could not be read.
+	FINDING_CHAIN_BROKEN
+	// FINDING_CHAIN_LOOP: the chain revisits one of its own clusters.
+	FINDING_CHAIN_LOOP
+	// FINDING_RUN_OUTSIDE_HEAP: a NoFatChain allocation leaves the heap.
+	FINDING_RUN_OUTSIDE_HEAP
+	// FINDING_UNREADABLE_DIRECTORY: a directory could not be read.
+	FINDING_UNREADABLE_DIRECTORY
+	// FINDING_MALFORMED_ENTRY_SET: a directory holds a damaged entry set.
+	FINDING_MALFORMED_ENTRY_SET
+	// FINDING_NAME_HASH_MISMATCH: the NameHash of an entry set does not match
+	// its up-cased name, so drivers fail to look the entry up.
+	FINDING_NAME_HASH_MISMATCH
+)
+
+var findingKindNames = map[FindingKind]string{
+	FINDING_LOST_CLUSTERS:         "lost-clusters",
+	FINDING_CROSS_LINKED:          "cross-linked",
+	FINDING_CHAIN_TOO_SHORT:       "chain-too-short",
+	FINDING_CHAIN_TOO_LONG:        "chain-too-long",
+	FINDING_FREE_CLUSTER_IN_CHAIN: "free-cluster-in-chain",
+	FINDING_BAD_CLUSTER_IN_CHAIN:  "bad-cluster-in-chain",
+	FINDING_CHAIN_BROKEN:          "chain-broken",
+	FINDING_CHAIN_LOOP:            "chain-loop",
+	FINDING_RUN_OUTSIDE_HEAP:      "run-outside-heap",
+	FINDING_UNREADABLE_DIRECTORY:  "unreadable-directory",
+	FINDING_MALFORMED_ENTRY_SET:   "malformed-entry-set",
+	FINDING_NAME_HASH_MISMATCH:    "name-hash-mismatch",
+}
+
+func (k FindingKind) String() string {
+	if name, ok := findingKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("finding(%d)", int(k))
+}
+
+func (k FindingKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Finding is one consistency problem. Cluster is the first cluster involved
+// and Count the number of clusters affected, when that applies. Offset is the
+// absolute image offset of a damaged entry set, RecordOffsets those of the
+// records read for it and Diagnostic what was wrong with it.
+type Finding struct {
+	Kind          FindingKind
+	Severity      Severity
+	Path          string
+	Cluster       uint32
+	Count         uint32
+	Offset        uint64
+	RecordOffsets []uint64       `json:",omitempty"`
+	Diagnostic    DiagnosticKind `json:",omitempty"`
+	Expected      uint64
+	Actual        uint64
+	Message       string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s %s %s: %s", f.Severity, f.Kind, f.Path, f.Message)
+}
+
+// CheckReport is the result of Check.
+type CheckReport struct {
+	Findings          []Finding
+	Files             int
+	Directories       int
+	AllocatedClusters uint32
+	OwnedClusters     uint32
+}
+
+// Count returns the number of findings with the given severity.
+func (r CheckReport) Count(severity Severity) int {
+	count := 0
+	for _, finding := range r.Findings {
+		if finding.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// OK reports whether the check found no errors.
+func (r CheckReport) OK() bool {
+	return r.Count(SEVERITY_ERROR) == 0
+}
+
+// checker holds the state of one Check run. owners maps a cluster index to
+// the 1-based index of its first owner in ownerPaths.
+type checker struct {
+	e          *ExFAT
+	bitmap     *allocationBitmap
+	upcase     upcaseTable
+	owners     []uint32
+	ownerPaths []string
+	report     CheckReport
+}
+
+// Check walks the whole directory tree and cross-checks every allocation
+// against the FAT and the allocation bitmap without modifying the image. It
+// reports lost and cross-linked clusters, chains that are too short or too
+// long for their DataLength, chains through free or bad clusters, broken and
+// looping chains, NoFatChain runs that leave the heap, damaged directories and
+// wrong NameHashes. Salvage mode is ignored while checking.
+func (e *ExFAT) Check() (CheckReport, error) {
+	c, err := e.check()
+	if err != nil {
+		return CheckReport{}, err
+	}
+	return c.report, nil
+}
+
+// check runs a full consistency check and keeps the ownership it built.
+func (e *ExFAT) check() (*checker, error) {
+	salvage := e.salvage
+	e.salvage = false
+	defer func() { e.salvage = salvage }()
+
+	bitmap, err := e.loadBitmap()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &checker{
+		e:      e,
+		bitmap: bitmap,
+		owners: make([]uint32, e.vbr.nbClusters),
+	}
+	// Without a usable up-case table NameHashes are not checked.
+	c.upcase, _ = e.loadUpcaseTable()
+	c.report.AllocatedClusters = bitmap.allocatedCount()
+
+	root := Entry{entryCluster: e.vbr.rootDirCluster, entryAttr: ENTRY_ATTR_DIR_MASK}
+	c.checkAllocation("/", root, false)
+
+	err = e.walkTree(c.visit, c.visitDir)
+	if err != nil {
+		return nil, err
+	}
+
+	c.findLostClusters()
+	return c, nil
+}
+
+// isOwned reports whether the check found an owner for cluster.
+func (c *checker) isOwned(cluster uint32) bool {
+	return c.owners[cluster-uint32(FIRST_CLUSTER_NUMBER)] != 0
+}
+
+func (c *checker) add(finding Finding) {
+	c.report.Findings = append(c.report.Findings, finding)
+}
+
+func (c *checker) visit(entry Entry) error {
+	switch {
+	case entry.IsVirtualEntry() || entry.IsDeleted():
+		return nil
+	case entry.IsBitmapUpcase():
+		c.checkAllocation(entry.Path(), entry, true)
+	case entry.IsValid() && !entry.IsSpecialFile():
+		if entry.IsDir() {
+			c.report.Directories++
+		} else {
+			c.report.Files++
+		}
+		c.checkAllocation(entry.Path(), entry, true)
+		c.checkNameHash(entry)
+	}
+	return nil
+}
+
+// checkNameHash compares the NameHash stored in the stream record with the
+// hash of the entry's up-cased name.
+func (c *checker) checkNameHash(entry Entry) {
+	if c.upcase == nil || len(entry.recordOffsets) < 2 {
+		return
+	}
+	var stream [EXFAT_DIRRECORD_SIZE]byte
+	if err := readFullAt(c.e.vbr.dimage, stream[:], int64(entry.recordOffsets[1])); err != nil {
+		return
+	}
+	actual := binary.LittleEndian.Uint16(stream[4:6])
+	expected := c.upcase.nameHash(entryNameUnits(entry))
+	if actual == expected {
+		return
+	}
+	c.add(Finding{
+		Kind:     FINDING_NAME_HASH_MISMATCH,
+		Severity: SEVERITY_ERROR,
+		Path:     entry.Path(),
+		Cluster:  entry.entryCluster,
+		Offset:   entry.recordOffsets[0],
+		Expected: uint64(expected),
+		Actual:   uint64(actual),
+		Message:  fmt.Sprintf("NameHash is %#04x, the name hashes to %#04x", actual, expected),
+	})
+}
+
+// unreadableDirectory is the finding for a directory that could not be read.
+func unreadableDirectory(dir Entry, err error) Finding {
+	return Finding{
+		Kind:     FINDING_UNREADABLE_DIRECTORY,
+		Severity: SEVERITY_ERROR,
+		Path:     dir.Path(),
+		Cluster:  dir.entryCluster,
+		Message:  err.Error(),
+	}
+}
+
+func (c *checker) visitDir(dir Entry, diagnostics []Diagnostic, err error) error {
+	if err != nil {
+		c.add(unreadableDirectory(dir, err))
+	}
+	for _, diagnostic := range diagnostics {
+		severity := SEVERITY_ERROR
+		if diagnostic.Kind == DIAG_ORPHAN_STREAM || diagnostic.Kind == DIAG_ORPHAN_NAME {
+			severity = SEVERITY_WARNING
+		}
+		c.add(Finding{
+			Kind:          FINDING_MALFORMED_ENTRY_SET,
+			Severity:      severity,
+			Path:          diagnostic.Directory,
+			Cluster:       diagnostic.DirCluster,
+			Offset:        diagnostic.Offset,
+			RecordOffsets: diagnostic.RecordOffsets,
+			Diagnostic:    diagnostic.Kind,
+			Expected:      diagnostic.Expected,
+			Actual:        diagnostic.Actual,
+			Message:       diagnostic.String(),
+		})
+	}
+	return nil
+}
+
+// checkAllocation resolves the clusters of one owner, reports chain damage
+// and claims the clusters for the ownership and bitmap cross-checks.
+func (c *checker) checkAllocation(path string, entry Entry, checkLength bool) {
+	v := &c.e.vbr
+	if checkLength && entry.dataLen == 0 {
+		return
+	}
+	expected, _ := v.size2Clusters(entry.dataLen)
+
+	var runs []Run
+	if entry.noFatChain {
+		run, err := v.contiguousRun(entry.entryCluster, expected)
+		if err != nil {
+			heapEnd := uint64(v.nbClusters) + FIRST_CLUSTER_NUMBER
+			first := uint64(entry.entryCluster)
+			c.add(Finding{
+				Kind:     FINDING_RUN_OUTSIDE_HEAP,
+				Severity: SEVERITY_ERROR,
+				Path:     path,
+				Cluster:  entry.entryCluster,
+				Count:    uint32(expected),
+				Expected: heapEnd,
+				Actual:   first + expected,
+				Message:  fmt.Sprintf("contiguous run %d+%d leaves the cluster heap", first, expected),
+			})
+		}
+		if run.Length > 0 {
+			runs = []Run{run}
+		}
+	} else {
+		trace := v.traceChain(entry.entryCluster)
+		runs = trace.runs
+		c.checkChainEnd(path, entry, trace)
+		if checkLength {
+			c.checkChainLength(path, entry, trace.count, expected, trace)
+		}
+	}
+
+	c.claim(path, runs)
+}
+
+func (c *checker) checkChainEnd(path string, entry Entry, trace chainTrace) {
+	finding := Finding{Path: path, Cluster: entry.entryCluster, Severity: SEVERITY_ERROR, Actual: uint64(trace.next)}
+	if len(trace.runs) > 0 {
+		finding.Cluster = trace.runs[len(trace.runs)-1].End() - 1
+	}
+	switch trace.end {
+	case chainEndEOF:
+		return
+	case chainEndBad:
+		finding.Kind = FINDING_BAD_CLUSTER_IN_CHAIN
+		finding.Message = fmt.Sprintf("cluster %d is marked bad in the FAT", finding.Cluster)
+	case chainEndInvalid:
+		finding.Kind = FINDING_CHAIN_BROKEN
+		finding.Message = fmt.Sprintf("FAT entry of cluster %d points to invalid cluster %#x", finding.Cluster, trace.next)
+	case chainEndLoop:
+		finding.Kind = FINDING_CHAIN_LOOP
+		finding.Message = fmt.Sprintf("chain returns to cluster %d", trace.next)
+	case chainEndError:
+		finding.Kind = FINDING_CHAIN_BROKEN
+		finding.Message = trace.err.Error()
+	}
+	c.add(finding)
+}
+
+func (c *checker) checkChainLength(path string, entry Entry, actual, expected uint64, trace chainTrace) {
+	if actual == expected {
+		return
+	}
+	finding := Finding{
+		Path:     path,
+		Cluster:  entry.entryCluster,
+		Expected: expected,
+		Actual:   actual,
+	}
+	if actual < expected {
+		finding.Kind = FINDING_CHAIN_TOO_SHORT
+		finding.Severity = SEVERITY_ERROR
+		finding.Message = fmt.Sprintf("chain has %d clusters, DataLength needs %d", actual, expected)
+		if trace.end != chainEndEOF {
+			// The broken end has already been reported; the length only
+			// adds context.
+			finding.Severity = SEVERITY_WARNING
+		}
+	} else {
+		finding.Kind = FINDING_CHAIN_TOO_LONG
+		finding.Severity = SEVERITY_WARNING
+		finding.Message = fmt.Sprintf("chain has %d clusters, DataLength needs only %d", actual, expected)
+	}
+	c.add(finding)
+}
+
+// claim records path as the owner of runs and reports clusters that are
+// free in the bitmap or already owned by something else.
+func (c *checker) claim(path string, runs []Run) {
+	if len(runs) == 0 {
+		return
+	}
+	c.ownerPaths = append(c.ownerPaths, path)
+	owner := uint32(len(c.ownerPaths))
+
+	type sharedClusters struct {
+		first, count uint32
+	}
+	var free, firstFree uint32
+	crossed := map[uint32]*sharedClusters{}
+	var crossOrder []uint32
+	for _, run := range runs {
+		for cluster := run.Start; cluster < run.End(); cluster++ {
+			index := cluster - uint32(FIRST_CLUSTER_NUMBER)
+			if !c.bitmap.isAllocated(cluster) {
+				if free == 0 {
+					firstFree = cluster
+				}
+				free++
+			}
+			switch previous := c.owners[index]; {
+			case previous == 0:
+				c.owners[index] = owner
+				c.report.OwnedClusters++
+			case previous != owner:
+				shared, ok := crossed[previous]
+				if !ok {
+					shared = &sharedClusters{first: cluster}
+					crossed[previous] = shared
+					crossOrder = append(crossOrder, previous)
+				}
+				shared.count++
+			}
+		}
+	}
+
+	if free > 0 {
+		c.add(Finding{
+			Kind:     FINDING_FREE_CLUSTER_IN_CHAIN,
+			Severity: SEVERITY_ERROR,
+			Path:     path,
+			Cluster:  firstFree,
+			Count:    free,
+			Message:  fmt.Sprintf("%d owned clusters are free in the bitmap, first %d", free, firstFree),
+		})
+	}
+	for _, previous := range crossOrder {
+		shared := crossed[previous]
+		c.add(Finding{
+			Kind:     FINDING_CROSS_LINKED,
+			Severity: SEVERITY_ERROR,
+			Path:     path,
+			Cluster:  shared.first,
+			Count:    shared.count,
+			Message:  fmt.Sprintf("%d clusters also owned by %s, first %d", shared.count, c.ownerPaths[previous-1], shared.first),
+		})
+	}
+}
+
+func (c *checker) findLostClusters() {
+	var start, length uint32
+	flush := func() {
+		if length == 0 {
+			return
+		}
+		c.add(Finding{
+			Kind:     FINDING_LOST_CLUSTERS,
+			Severity: SEVERITY_WARNING,
+			Cluster:  start,
+			Count:    length,
+			Message:  fmt.Sprintf("clusters %d-%d are allocated but not owned", start, start+length-1),
+		})
+		length = 0
+	}
+
+	for index := range c.owners {
+		cluster := uint32(index) + uint32(FIRST_CLUSTER_NUMBER)
+		if c.owners[index] == 0 && c.bitmap.isAllocated(cluster) {
+			if length == 0 {
+				start = cluster
+			}
+			length++
+			continue
+		}
+		flush()
+	}
+	flush()
+}
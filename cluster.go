@@ -34,45 +34,27 @@ func (v *VBR) readClusters(cluster uint32, nbcluster uint64) ([]byte, error) {
 		return nil, fmt.Errorf("out of range: cluster=%d count=%d", cluster, nbcluster)
 	}
 
-	offset := v.getClusterOffset(cluster)
-	_, err := v.dimage.Seek(int64(offset), io.SeekStart)
-	if err != nil {
-		return nil, err
-	}
-
 	clusterdata := make([]byte, v.clusterSize*nbcluster)
-	_, err = io.ReadFull(v.dimage, clusterdata)
+	err := readFullAt(v.dimage, clusterdata, int64(v.getClusterOffset(cluster)))
 
 	return clusterdata, err
 }
 
-func (v *VBR) nextCluster(cluster uint32) (uint32, error) {
-	if !v.isValidCluster(cluster) {
-		return 0, fmt.Errorf("%w: %d", ErrInvalidCluster, cluster)
-	}
-
+// fatEntry returns the raw (masked) FAT value stored for cluster.
+func (v *VBR) fatEntry(cluster uint32) (uint32, error) {
 	fatEntries := (uint64(v.fatSize) * uint64(v.sectorSize)) / 4
 	if uint64(cluster) >= fatEntries {
 		return 0, fmt.Errorf("cluster out of fat: %d", cluster)
 	}
 
 	offset := int64(v.firstFat) + (int64(cluster) * 4)
-	_, err := v.dimage.Seek(offset, io.SeekStart)
-	if err != nil {
-		return 0, err
-	}
-
 	data := make([]byte, 4)
-	_, err = io.ReadFull(v.dimage, data)
+	err := readFullAt(v.dimage, data, offset)
 	if err != nil {
 		return 0, err
 	}
 
-	nextCluster := unpackLELong(data) & EXFAT_CLUSTER_MASK
-	if nextCluster == EXFAT_BAD_CLUSTER {
-		return 0, ErrBadCluster
-	}
-	return nextCluster, nil
+	return unpackLELong(data) & EXFAT_CLUSTER_MASK, nil
 }
 
 func (v *VBR) readClusterInto(cluster uint32, buf []byte) error {
@@ -83,111 +65,72 @@ func (v *VBR) readClusterInto(cluster uint32, buf []byte) error {
 		return fmt.Errorf("%w: %d", ErrInvalidCluster, cluster)
 	}
 
-	offset := v.getClusterOffset(cluster)
-	_, err := v.dimage.Seek(int64(offset), io.SeekStart)
-	if err != nil {
-		return err
-	}
-
-	_, err = io.ReadFull(v.dimage, buf)
-	return err
+	return readFullAt(v.dimage, buf, int64(v.getClusterOffset(cluster)))
 }
 
-func (v *VBR) visitContiguousClusters(start uint32, count uint64, visitor func(cluster uint32, data []byte) error) error {
-	if count == 0 {
-		return nil
-	}
-
-	buf := make([]byte, v.clusterSize)
-	cluster := start
-	for i := uint64(0); i < count; i++ {
+// visitRun reads the clusters of run one at a time into a shared buffer.
+func (v *VBR) visitRun(run Run, buf []byte, visitor func(cluster uint32, data []byte) error) error {
+	for i := uint32(0); i < run.Length; i++ {
+		cluster := run.Start + i
 		if err := v.readClusterInto(cluster, buf); err != nil {
 			return err
 		}
 		if err := visitor(cluster, buf); err != nil {
 			return err
 		}
-		cluster++
 	}
-
 	return nil
 }
 
 func (v *VBR) visitFatChain(start uint32, visitor func(cluster uint32, data []byte) error) error {
-	if !v.isValidCluster(start) {
-		return fmt.Errorf("%w: %d", ErrInvalidCluster, start)
-	}
-
 	buf := make([]byte, v.clusterSize)
-	seen := make(map[uint32]struct{})
-	cluster := start
-	visited := uint32(0)
-
-	for {
-		if !v.isValidCluster(cluster) {
-			return fmt.Errorf("%w: %d", ErrInvalidCluster, cluster)
-		}
-		if _, ok := seen[cluster]; ok {
-			return ErrClusterChainLoop
-		}
-		seen[cluster] = struct{}{}
-		if visited >= v.nbClusters {
-			return ErrClusterChainLoop
-		}
-
-		if err := v.readClusterInto(cluster, buf); err != nil {
-			return err
-		}
-		if err := visitor(cluster, buf); err != nil {
-			return err
-		}
-
-		nextCluster, err := v.nextCluster(cluster)
-		if err != nil {
-			return err
-		}
-		visited++
-		if nextCluster >= EXFAT_EOF_START && nextCluster <= EXFAT_EOF_END {
-			return nil
-		}
-		cluster = nextCluster
-	}
+	return v.walkChainRuns(start, 0, func(run Run) error {
+		return v.visitRun(run, buf, visitor)
+	})
 }
 
+// visitEntryData hands visitor the data of entry cluster by cluster, trimmed
+// to DataLength. Bad clusters follow the bad cluster policy; zero-filled
+// ranges arrive as zeroed chunks carrying the bad cluster's number.
 func (v *VBR) visitEntryData(entry Entry, visitor func(cluster uint32, data []byte) error) error {
 	if entry.dataLen == 0 {
 		return nil
 	}
 
-	remaining := entry.dataLen
-	visitChunk := func(cluster uint32, data []byte) error {
-		chunk := data
-		if uint64(len(chunk)) > remaining {
-			chunk = chunk[:remaining]
-		}
-		remaining -= uint64(len(chunk))
-		if err := visitor(cluster, chunk); err != nil {
-			return err
-		}
-		if remaining == 0 {
-			return errStopClusterWalk
-		}
-		return nil
-	}
-
-	if entry.noFatChain {
-		sizeInClusters, _ := v.size2Clusters(entry.dataLen)
-		err := v.visitContiguousClusters(entry.entryCluster, sizeInClusters, visitChunk)
+	buf := make([]byte, v.clusterSize)
+	_, _, err := v.walkEntryData(entry, func(run Run, size uint64) error {
+		err := v.visitRun(run, buf, func(cluster uint32, data []byte) error {
+			chunk := data
+			if uint64(len(chunk)) > size {
+				chunk = chunk[:size]
+			}
+			size -= uint64(len(chunk))
+			if err := visitor(cluster, chunk); err != nil {
+				return err
+			}
+			if size == 0 {
+				return errStopClusterWalk
+			}
+			return nil
+		})
 		if errors.Is(err, errStopClusterWalk) {
 			return nil
 		}
 		return err
-	}
-
-	err := v.visitFatChain(entry.entryCluster, visitChunk)
-	if errors.Is(err, errStopClusterWalk) {
+	}, func(cluster uint32, size uint64) error {
+		clear(buf)
+		for size > 0 {
+			chunk := buf
+			if uint64(len(chunk)) > size {
+				chunk = chunk[:size]
+			}
+			size -= uint64(len(chunk))
+			if err := visitor(cluster, chunk); err != nil {
+				return err
+			}
+		}
 		return nil
-	}
+	})
 	return err
 }
 
@@ -200,35 +143,27 @@ func (v *VBR) size2Clusters(size uint64) (uint64, uint32) {
 	return sizeInClusters, uint32(remainder)
 }
 
-func (v *VBR) extractEntryContent(entry Entry, dstpath string) error {
+// extractEntryContent copies the entry data run by run straight from the
+// image, applying the bad cluster policy.
+func (v *VBR) extractEntryContent(entry Entry, dstpath string) (ExtractionReport, error) {
 	dstfile, err := os.Create(dstpath)
 	if err != nil {
-		return err
+		return ExtractionReport{}, err
 	}
 	defer dstfile.Close()
 
-	if !entry.noFatChain {
-		return v.extractFatChainedContent(entry, dstfile)
-	}
-
-	return v.extractContiguesContent(entry, dstfile)
-}
-
-func (v *VBR) extractContiguesContent(entry Entry, dstfile *os.File) error {
-	entryClusterOffset := v.getClusterOffset(entry.entryCluster)
-	_, err := v.dimage.Seek(int64(entryClusterOffset), io.SeekStart)
-	if err != nil {
+	var report ExtractionReport
+	report.Damaged, report.Partial, err = v.walkEntryData(entry, func(run Run, size uint64) error {
+		section := io.NewSectionReader(v.dimage, int64(v.getClusterOffset(run.Start)), int64(size))
+		n, err := io.CopyN(dstfile, section, int64(size))
+		report.Written += uint64(n)
 		return err
-	}
-	_, err = io.CopyN(dstfile, v.dimage, int64(entry.dataLen))
-	return err
-}
-
-func (v *VBR) extractFatChainedContent(entry Entry, dstfile *os.File) error {
-	return v.visitEntryData(entry, func(_ uint32, chunk []byte) error {
-		_, err := dstfile.Write(chunk)
+	}, func(_ uint32, size uint64) error {
+		n, err := io.CopyN(dstfile, zeroReader{}, int64(size))
+		report.Written += uint64(n)
 		return err
 	})
+	return report, err
 }
 
 func (v *VBR) getClusterList(entry Entry) ([]uint32, uint64, error) {
@@ -236,14 +171,15 @@ func (v *VBR) getClusterList(entry Entry) ([]uint32, uint64, error) {
 		return nil, 0, nil
 	}
 
-	sizeInClusters, remainder := v.size2Clusters(entry.dataLen)
-	clusterList := getRange(entry.entryCluster, sizeInClusters)
+	runs, err := v.getClusterRuns(entry)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	var err error
-	if !entry.noFatChain {
-		clusterList, err = v.getChainedClusterList(entry.entryCluster)
-		if err != nil {
-			return nil, 0, err
+	clusterList := make([]uint32, 0, runsClusterCount(runs))
+	for _, run := range runs {
+		for i := uint32(0); i < run.Length; i++ {
+			clusterList = append(clusterList, run.Start+i)
 		}
 	}
 
@@ -253,6 +189,7 @@ func (v *VBR) getClusterList(entry Entry) ([]uint32, uint64, error) {
 		return nil, 0, err
 	}
 
+	_, remainder := v.size2Clusters(entry.dataLen)
 	filetail := v.clusterSize
 	if remainder > 0 {
 		filetail = uint64(remainder)
@@ -261,22 +198,18 @@ func (v *VBR) getClusterList(entry Entry) ([]uint32, uint64, error) {
 	return clusterList, filetail, nil
 }
 
-func (v *VBR) getChainedClusterList(cluster uint32) ([]uint32, error) {
-	var clusterList []uint32
-	err := v.visitFatChain(cluster, func(cluster uint32, _ []byte) error {
-		clusterList = append(clusterList, cluster)
-		return nil
-	})
-	if err != nil {
-		return nil, err
+func (v *VBR) countClusters(entry Entry) (int, error) {
+	if entry.dataLen == 0 {
+		return 0, nil
+	}
+	if entry.noFatChain {
+		sizeInClusters, _ := v.size2Clusters(entry.dataLen)
+		return int(sizeInClusters), nil
 	}
-	return clusterList, nil
-}
 
-func (v *VBR) countChainedClusters(cluster uint32) (int, error) {
 	count := 0
-	err := v.visitFatChain(cluster, func(uint32, []byte) error {
-		count++
+	err := v.walkChainRuns(entry.entryCluster, 0, func(run Run) error {
+		count += int(run.Length)
 		return nil
 	})
 	if err != nil {
@@ -285,13 +218,35 @@ func (v *VBR) countChainedClusters(cluster uint32) (int, error) {
 	return count, nil
 }
 
-func (v *VBR) countClusters(entry Entry) (int, error) {
-	if entry.dataLen == 0 {
-		return 0, nil
-	}
-	if entry.noFatChain {
-		sizeInClusters, _ := v.size2Clusters(entry.dataLen)
-		return int(sizeInClusters), nil
-	}
-	return v.countChainedClusters(entry.entryCluster)
+// chainEnd describes how a FAT chain walk finished.
+type chainEnd int
+
+const (
+	chainEndEOF chainEnd = iota
+	chainEndBad
+	chainEndInvalid
+	chainEndLoop
+	chainEndError
+)
+
+// chainTrace is the result of following a FAT chain without aborting on
+// damage. next holds the FAT value that ended a damaged chain.
+type chainTrace struct {
+	runs  []Run
+	count uint64
+	end   chainEnd
+	next  uint32
+	err   error
+}
+
+// traceChain follows the FAT from start and records where and why the chain
+// ends instead of failing on the first problem.
+func (v *VBR) traceChain(start uint32) chainTrace {
+	var runs []Run
+	trace := v.followChain(start, 0, func(run Run) error {
+		runs = append(runs, run)
+		return nil
+	})
+	trace.runs = runs
+	return trace
 }
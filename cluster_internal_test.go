@@ -16,29 +16,53 @@ func TestCountBitmapHandlesTailBytes(t *testing.T) {
 	}
 }
 
-func TestGetChainedClusterListAcceptsEOFRange(t *testing.T) {
+func TestGetClusterRunsAcceptsEOFRange(t *testing.T) {
 	vbr := newTestVBRWithFAT(t, map[uint32]uint32{
 		2: EXFAT_EOF_START,
 	})
 
-	chain, err := vbr.getChainedClusterList(2)
+	runs, err := vbr.getClusterRuns(Entry{entryCluster: 2, dataLen: 1})
 	if err != nil {
-		t.Fatalf("getChainedClusterList() error = %v", err)
+		t.Fatalf("getClusterRuns() error = %v", err)
 	}
-	if len(chain) != 1 || chain[0] != 2 {
-		t.Fatalf("getChainedClusterList() = %v, want [2]", chain)
+	if len(runs) != 1 || runs[0] != (Run{Start: 2, Length: 1}) {
+		t.Fatalf("getClusterRuns() = %v, want [{2 1}]", runs)
 	}
 }
 
-func TestGetChainedClusterListDetectsLoop(t *testing.T) {
+func TestGetClusterRunsDetectsLoop(t *testing.T) {
 	vbr := newTestVBRWithFAT(t, map[uint32]uint32{
 		2: 3,
 		3: 2,
 	})
 
-	_, err := vbr.getChainedClusterList(2)
+	_, err := vbr.getClusterRuns(Entry{entryCluster: 2, dataLen: 1})
 	if !errors.Is(err, ErrClusterChainLoop) {
-		t.Fatalf("getChainedClusterList() error = %v, want ErrClusterChainLoop", err)
+		t.Fatalf("getClusterRuns() error = %v, want ErrClusterChainLoop", err)
+	}
+}
+
+func TestTraceChainDetectsLoopIntoEarlierRun(t *testing.T) {
+	// 2-3, 6, 4 then back into the middle of the first run.
+	vbr := newTestVBRWithFAT(t, map[uint32]uint32{
+		2: 3,
+		3: 6,
+		6: 4,
+		4: 3,
+	})
+
+	trace := vbr.traceChain(2)
+	if trace.end != chainEndLoop || trace.next != 3 || trace.count != 4 {
+		t.Fatalf("traceChain() = %+v, want a loop to 3 after 4 clusters", trace)
+	}
+	want := []Run{{Start: 2, Length: 2}, {Start: 6, Length: 1}, {Start: 4, Length: 1}}
+	if len(trace.runs) != len(want) {
+		t.Fatalf("traceChain() runs = %v, want %v", trace.runs, want)
+	}
+	for i := range want {
+		if trace.runs[i] != want[i] {
+			t.Fatalf("traceChain() runs = %v, want %v", trace.runs, want)
+		}
 	}
 }
 
@@ -58,6 +82,57 @@ func TestGetClusterListZeroLength(t *testing.T) {
 	}
 }
 
+func TestGetClusterRunsMergesConsecutiveClusters(t *testing.T) {
+	vbr := newTestVBRWithFAT(t, map[uint32]uint32{
+		2: 3,
+		3: 4,
+		4: 7,
+		7: 8,
+		8: EXFAT_EOF_END,
+	})
+	vbr.clusterSize = 512
+
+	runs, err := vbr.getClusterRuns(Entry{entryCluster: 2, dataLen: 5 * 512})
+	if err != nil {
+		t.Fatalf("getClusterRuns() error = %v", err)
+	}
+	want := []Run{{Start: 2, Length: 3}, {Start: 7, Length: 2}}
+	if len(runs) != len(want) || runs[0] != want[0] || runs[1] != want[1] {
+		t.Fatalf("getClusterRuns() = %v, want %v", runs, want)
+	}
+}
+
+func TestGetClusterRunsDetectsLoopIntoRun(t *testing.T) {
+	vbr := newTestVBRWithFAT(t, map[uint32]uint32{
+		2: 3,
+		3: 4,
+		4: 3,
+	})
+	vbr.clusterSize = 512
+
+	_, err := vbr.getClusterRuns(Entry{entryCluster: 2, dataLen: 512})
+	if !errors.Is(err, ErrClusterChainLoop) {
+		t.Fatalf("getClusterRuns() error = %v, want ErrClusterChainLoop", err)
+	}
+}
+
+func TestGetClusterRunsNoFatChain(t *testing.T) {
+	vbr := VBR{clusterSize: 512, nbClusters: 8}
+
+	runs, err := vbr.getClusterRuns(Entry{entryCluster: 3, dataLen: 1500, noFatChain: true})
+	if err != nil {
+		t.Fatalf("getClusterRuns() error = %v", err)
+	}
+	if len(runs) != 1 || runs[0] != (Run{Start: 3, Length: 3}) {
+		t.Fatalf("getClusterRuns() = %v, want [{3 3}]", runs)
+	}
+
+	_, err = vbr.getClusterRuns(Entry{entryCluster: 8, dataLen: 1500, noFatChain: true})
+	if !errors.Is(err, ErrInvalidCluster) {
+		t.Fatalf("getClusterRuns() error = %v, want ErrInvalidCluster", err)
+	}
+}
+
 func newTestVBRWithFAT(t *testing.T, entries map[uint32]uint32) VBR {
 	t.Helper()
 
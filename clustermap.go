@@ -0,0 +1,305 @@
+package libxfat
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ClusterState says whether anything claims a cluster.
+type ClusterState int
+
+const (
+	// CLUSTER_OWNED: a live file, directory or metadata structure owns the
+	// cluster.
+	CLUSTER_OWNED ClusterState = iota
+	// CLUSTER_UNOWNED: the bitmap marks the cluster allocated but no live
+	// owner claims it.
+	CLUSTER_UNOWNED
+	// CLUSTER_UNALLOCATED: the bitmap marks the cluster free and no live
+	// owner claims it. Deleted entries may still point at it.
+	CLUSTER_UNALLOCATED
+)
+
+func (s ClusterState) String() string {
+	switch s {
+	case CLUSTER_OWNED:
+		return "owned"
+	case CLUSTER_UNOWNED:
+		return "unowned"
+	case CLUSTER_UNALLOCATED:
+		return "unallocated"
+	}
+	return fmt.Sprintf("state(%d)", int(s))
+}
+
+func (s ClusterState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ClusterClaim is one entry that points at a cluster. Offset is the byte
+// offset of the cluster (or of the looked-up image offset) within the
+// entry's data.
+type ClusterClaim struct {
+	Entry    Entry
+	Path     string
+	Offset   uint64
+	Deleted  bool
+	Metadata bool
+}
+
+// ClusterOwnership answers "who owns cluster N". Claims lists live owners
+// first, then deleted entries whose allocation covers the cluster.
+type ClusterOwnership struct {
+	Cluster   uint32
+	Allocated bool
+	State     ClusterState
+	Claims    []ClusterClaim
+}
+
+// Owner returns the first live claim, if any.
+func (o ClusterOwnership) Owner() (ClusterClaim, bool) {
+	for _, claim := range o.Claims {
+		if !claim.Deleted {
+			return claim, true
+		}
+	}
+	return ClusterClaim{}, false
+}
+
+type clusterOwner struct {
+	entry    Entry
+	path     string
+	deleted  bool
+	metadata bool
+}
+
+// ownerExtent is a run of clusters owned by one owner. fileOffset is the
+// byte offset of start within the owner's data.
+type ownerExtent struct {
+	start      uint32
+	length     uint32
+	owner      int
+	fileOffset uint64
+}
+
+// ClusterMap resolves clusters to their owners. Build it once with
+// BuildClusterMap and query it as often as needed; it does not track later
+// changes to the image.
+type ClusterMap struct {
+	bitmap        *allocationBitmap
+	clusterSize   uint64
+	nbClusters    uint32
+	dataAreaStart uint64
+	owners        []clusterOwner
+	extents       []ownerExtent
+	// maxEnd[i] is the largest extent end among extents[:i+1], so a lookup
+	// can stop scanning back once no earlier extent reaches the cluster.
+	maxEnd []uint64
+}
+
+// BuildClusterMap walks the whole tree and records which entry owns every
+// cluster: live files and directories, the root directory, $BitMap and
+// $UpCase, deleted entries still listed in live directories, and orphaned
+// entry sets recovered from unallocated clusters. Deleted entries with a FAT
+// chain that no longer leads anywhere are assumed to be contiguous, as TSK
+// does. Salvage mode is ignored while building the map.
+func (e *ExFAT) BuildClusterMap() (*ClusterMap, error) {
+	salvage := e.salvage
+	e.salvage = false
+	defer func() { e.salvage = salvage }()
+
+	bitmap, err := e.loadBitmap()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &ClusterMap{
+		bitmap:        bitmap,
+		clusterSize:   e.vbr.clusterSize,
+		nbClusters:    e.vbr.nbClusters,
+		dataAreaStart: e.vbr.dataAreaStart,
+	}
+
+	root := Entry{entryCluster: e.vbr.rootDirCluster, entryAttr: ENTRY_ATTR_DIR_MASK}
+	m.add(clusterOwner{entry: root, path: "/", metadata: true}, e.vbr.traceChain(root.entryCluster).runs)
+
+	err = e.walkTree(func(entry Entry) error {
+		switch {
+		case entry.IsVirtualEntry():
+		case entry.IsBitmapUpcase():
+			m.add(clusterOwner{entry: entry, path: entry.Path(), metadata: true}, e.ownedRuns(entry))
+		case entry.IsValid() && !entry.IsSpecialFile():
+			m.add(clusterOwner{entry: entry, path: entry.Path()}, e.ownedRuns(entry))
+		case entry.IsDeleted():
+			m.add(clusterOwner{entry: entry, path: entry.Path(), deleted: true}, e.ownedRuns(entry))
+		}
+		return nil
+	}, func(Entry, []Diagnostic, error) error {
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	orphans, err := e.RecoverDeletedEntries()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range orphans {
+		m.add(clusterOwner{entry: entry, path: entry.Path(), deleted: true}, e.ownedRuns(entry))
+	}
+
+	m.index()
+	return m, nil
+}
+
+// ClusterOwner resolves one cluster. It builds the cluster map on first use
+// and reuses it afterwards; call BuildClusterMap directly for a fresh view.
+func (e *ExFAT) ClusterOwner(cluster uint32) (ClusterOwnership, error) {
+	if e.clusterMap == nil {
+		m, err := e.BuildClusterMap()
+		if err != nil {
+			return ClusterOwnership{}, err
+		}
+		e.clusterMap = m
+	}
+	return e.clusterMap.Owner(cluster)
+}
+
+// ClusterOwnerAt resolves the cluster holding an absolute image offset, such
+// as a keyword hit. Claim offsets include the position within the cluster.
+func (e *ExFAT) ClusterOwnerAt(offset uint64) (ClusterOwnership, error) {
+	if e.clusterMap == nil {
+		m, err := e.BuildClusterMap()
+		if err != nil {
+			return ClusterOwnership{}, err
+		}
+		e.clusterMap = m
+	}
+	return e.clusterMap.OwnerAt(offset)
+}
+
+// ownedRuns lists the runs an entry points at. Live entries follow their FAT
+// chain as far as it goes; deleted entries fall back to a contiguous run when
+// their chain is gone or does not match their size.
+func (e *ExFAT) ownedRuns(entry Entry) []Run {
+	v := &e.vbr
+	if entry.dataLen == 0 || !v.isValidCluster(entry.entryCluster) {
+		return nil
+	}
+	count, _ := v.size2Clusters(entry.dataLen)
+
+	if !entry.noFatChain {
+		trace := v.traceChain(entry.entryCluster)
+		if !entry.IsDeleted() || (trace.end == chainEndEOF && trace.count == count) {
+			return trace.runs
+		}
+	}
+
+	run, _ := v.contiguousRun(entry.entryCluster, count)
+	return []Run{run}
+}
+
+// add records owner for runs, keeping their order in the file to compute
+// byte offsets.
+func (m *ClusterMap) add(owner clusterOwner, runs []Run) {
+	if len(runs) == 0 {
+		return
+	}
+	m.owners = append(m.owners, owner)
+	id := len(m.owners) - 1
+
+	var fileOffset uint64
+	for _, run := range runs {
+		m.extents = append(m.extents, ownerExtent{
+			start:      run.Start,
+			length:     run.Length,
+			owner:      id,
+			fileOffset: fileOffset,
+		})
+		fileOffset += uint64(run.Length) * m.clusterSize
+	}
+}
+
+func (m *ClusterMap) index() {
+	sort.SliceStable(m.extents, func(i, j int) bool {
+		return m.extents[i].start < m.extents[j].start
+	})
+	m.maxEnd = make([]uint64, len(m.extents))
+	var maxEnd uint64
+	for i, extent := range m.extents {
+		end := uint64(extent.start) + uint64(extent.length)
+		if end > maxEnd {
+			maxEnd = end
+		}
+		m.maxEnd[i] = maxEnd
+	}
+}
+
+// Owner resolves one cluster.
+func (m *ClusterMap) Owner(cluster uint32) (ClusterOwnership, error) {
+	if uint64(cluster) < FIRST_CLUSTER_NUMBER || uint64(cluster) >= uint64(m.nbClusters)+FIRST_CLUSTER_NUMBER {
+		return ClusterOwnership{}, fmt.Errorf("%w: %d", ErrInvalidCluster, cluster)
+	}
+
+	ownership := ClusterOwnership{
+		Cluster:   cluster,
+		Allocated: m.bitmap.isAllocated(cluster),
+	}
+
+	var live, deleted []ClusterClaim
+	i := sort.Search(len(m.extents), func(i int) bool {
+		return m.extents[i].start > cluster
+	}) - 1
+	for ; i >= 0 && m.maxEnd[i] > uint64(cluster); i-- {
+		extent := m.extents[i]
+		if uint64(cluster) >= uint64(extent.start)+uint64(extent.length) {
+			continue
+		}
+		owner := m.owners[extent.owner]
+		claim := ClusterClaim{
+			Entry:    owner.entry,
+			Path:     owner.path,
+			Offset:   extent.fileOffset + uint64(cluster-extent.start)*m.clusterSize,
+			Deleted:  owner.deleted,
+			Metadata: owner.metadata,
+		}
+		if owner.deleted {
+			deleted = append([]ClusterClaim{claim}, deleted...)
+		} else {
+			live = append([]ClusterClaim{claim}, live...)
+		}
+	}
+	ownership.Claims = append(live, deleted...)
+
+	switch {
+	case len(live) > 0:
+		ownership.State = CLUSTER_OWNED
+	case ownership.Allocated:
+		ownership.State = CLUSTER_UNOWNED
+	default:
+		ownership.State = CLUSTER_UNALLOCATED
+	}
+	return ownership, nil
+}
+
+// OwnerAt resolves the cluster holding an absolute image offset.
+func (m *ClusterMap) OwnerAt(offset uint64) (ClusterOwnership, error) {
+	if offset < m.dataAreaStart {
+		return ClusterOwnership{}, fmt.Errorf("%w: offset %d is before the cluster heap", ErrInvalidCluster, offset)
+	}
+	index := (offset - m.dataAreaStart) / m.clusterSize
+	if index >= uint64(m.nbClusters) {
+		return ClusterOwnership{}, fmt.Errorf("%w: offset %d is past the cluster heap", ErrInvalidCluster, offset)
+	}
+
+	ownership, err := m.Owner(uint32(index + FIRST_CLUSTER_NUMBER))
+	if err != nil {
+		return ClusterOwnership{}, err
+	}
+	within := (offset - m.dataAreaStart) % m.clusterSize
+	for i := range ownership.Claims {
+		ownership.Claims[i].Offset += within
+	}
+	return ownership, nil
+}
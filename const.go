@@ -20,13 +20,30 @@ const (
 	EXFAT_ROOT_CLUSTER_OFFSET        = 0x60
 	EXFAT_SN_OFFSET                  = 0x64
 	EXFAT_VERSION_OFFSET             = 0x68
+	EXFAT_VOLUME_FLAGS_OFFSET        = 0x6a
 	EXFAT_SECTOR_SIZE_OFFSET         = 0x6c
 	EXFAT_CLUSTER_SIZE_OFFSET        = 0x6d
+	EXFAT_NB_FATS_OFFSET             = 0x6e
+	EXFAT_DRIVE_SELECT_OFFSET        = 0x6f
 	EXFAT_SIGNATURE                  = "EXFAT   "
 	EXFAT_PERCENT_USE_OFFSET         = 0x70
 
 	// There is no cluster 0 or cluster 1 in ExFAT. It starts with cluster 2
 	FIRST_CLUSTER_NUMBER uint64 = 2
+
+	// EXFAT_MIN_VOLUME_SIZE is the smallest volume the specification allows.
+	EXFAT_MIN_VOLUME_SIZE = 1 << 20
+	// EXFAT_MAX_CLUSTER_COUNT is the largest ClusterCount a volume may have.
+	EXFAT_MAX_CLUSTER_COUNT = 0xfffffff5
+	// EXFAT_MAX_LABEL_LENGTH is the longest volume label, in UTF-16 units.
+	EXFAT_MAX_LABEL_LENGTH = 11
+
+	// OVERLAY_MAGIC starts a sidecar delta file written by an Overlay.
+	OVERLAY_MAGIC              = "XFATDLT1"
+	OVERLAY_HEADER_SIZE uint64 = 24
+	OVERLAY_RECORD_SIZE        = 8 + SECTOR_SIZE
+	// OVERLAY_EXPORT_CHUNK is how much of the merged image Export reads at once.
+	OVERLAY_EXPORT_CHUNK = 1 << 20
 )
 
 // exfat entries constants
@@ -46,8 +63,14 @@ const (
 	EXFAT_DIRRECORD_DEL_STREAM_EXT   = 0x40
 	EXFAT_DIRRECORD_FILENAME_EXT     = 0xC1
 	EXFAT_DIRRECORD_DEL_FILENAME_EXT = 0x41
+	EXFAT_DIRRECORD_VENDOR_EXT       = 0xE0
+	EXFAT_DIRRECORD_DEL_VENDOR_EXT   = 0x60
+
+	ALLOCATION_POSSIBLE_FLAG = 0x01
+	NOT_FAT_CHAIN_FLAG       = 0x02
 
-	NOT_FAT_CHAIN_FLAG = 0x02
+	// EXFAT_MAX_NAME_LENGTH is the longest file name, in UTF-16 units.
+	EXFAT_MAX_NAME_LENGTH = 255
 )
 
 const (
@@ -100,3 +123,22 @@ var ErrInvalidCluster = errors.New("invalid cluster")
 var ErrBadCluster = errors.New("bad cluster in FAT chain")
 var ErrClusterChainLoop = errors.New("cluster chain loop detected")
 var ErrAllocationBitmapNotFound = errors.New("allocation bitmap not found")
+var ErrRecordType = errors.New("unexpected directory record type")
+var ErrDirectoryCycle = errors.New("directory cycle detected")
+var ErrMaxDepth = errors.New("maximum directory depth exceeded")
+var ErrMaxEntriesPerDir = errors.New("maximum entries per directory exceeded")
+var ErrMaxTotalEntries = errors.New("maximum total entries exceeded")
+var ErrMaxChainLength = errors.New("maximum cluster chain length exceeded")
+var ErrEntryNotFound = errors.New("entry not found")
+var ErrEntryExists = errors.New("entry already exists")
+var ErrNotDirectory = errors.New("not a directory")
+var ErrInvalidName = errors.New("invalid file name")
+var ErrInvalidAttributes = errors.New("invalid attributes")
+var ErrVolumeFull = errors.New("no free clusters left")
+var ErrDirectoryNotEmpty = errors.New("directory not empty")
+var ErrInvalidFormatOptions = errors.New("invalid format options")
+var ErrReadOnlyImage = errors.New("image is not writable")
+var ErrInvalidDelta = errors.New("invalid overlay delta")
+var ErrUndeleteConflict = errors.New("deleted entry cannot be restored")
+var ErrBootRegionDamaged = errors.New("main and backup boot regions are both damaged")
+var ErrInvalidLabel = errors.New("invalid volume label")
@@ -0,0 +1,104 @@
+package libxfat
+
+import "fmt"
+
+// DiagnosticKind identifies why a directory entry set could not be parsed
+// cleanly.
+type DiagnosticKind int
+
+const (
+	// DIAG_CHECKSUM_MISMATCH: the SetChecksum of a complete set is wrong.
+	DIAG_CHECKSUM_MISMATCH DiagnosticKind = iota + 1
+	// DIAG_MISSING_STREAM: a name record, another primary record or the end
+	// of the directory followed the primary record before any stream
+	// extension record.
+	DIAG_MISSING_STREAM
+	// DIAG_MISSING_NAME: the set ended with fewer secondary records than its
+	// SecondaryCount announced.
+	DIAG_MISSING_NAME
+	// DIAG_ORPHAN_STREAM: a 0xC0/0x40 record that belongs to no file set.
+	DIAG_ORPHAN_STREAM
+	// DIAG_ORPHAN_NAME: a 0xC1/0x41 record that belongs to no file set.
+	DIAG_ORPHAN_NAME
+)
+
+func (k DiagnosticKind) String() string {
+	switch k {
+	case DIAG_CHECKSUM_MISMATCH:
+		return "checksum-mismatch"
+	case DIAG_MISSING_STREAM:
+		return "missing-stream"
+	case DIAG_MISSING_NAME:
+		return "missing-name"
+	case DIAG_ORPHAN_STREAM:
+		return "orphan-stream"
+	case DIAG_ORPHAN_NAME:
+		return "orphan-name"
+	}
+	return fmt.Sprintf("diagnostic(%d)", int(k))
+}
+
+func (k DiagnosticKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Diagnostic describes a malformed directory entry set found while reading a
+// directory. Offset is the absolute image offset of the first record involved
+// and Raw holds a copy of every record that was read for the set, each at the
+// matching entry of RecordOffsets. A set may cross a cluster boundary, so its
+// records need not be adjacent in the image.
+type Diagnostic struct {
+	Kind          DiagnosticKind
+	Directory     string
+	DirCluster    uint32
+	Offset        uint64
+	RecordOffsets []uint64
+	Expected      uint64
+	Actual        uint64
+	Raw           []byte
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s in %s at offset %d: expected %#x, got %#x", d.Kind, d.Directory, d.Offset, d.Expected, d.Actual)
+}
+
+func (e *ExFAT) addDiagnostic(kind DiagnosticKind, offsets []uint64, expected, actual uint64, raw []byte) {
+	e.diagnostics = append(e.diagnostics, Diagnostic{
+		Kind:          kind,
+		Directory:     e.dirPath,
+		DirCluster:    e.dirCluster,
+		Offset:        offsets[0],
+		RecordOffsets: append([]uint64(nil), offsets...),
+		Expected:      expected,
+		Actual:        actual,
+		Raw:           append([]byte(nil), raw...),
+	})
+}
+
+// ReadDirWithDiagnostics behaves like ReadDir and also returns every
+// malformed entry set found in the directory, so an empty directory can be
+// told apart from one that failed to parse.
+func (e *ExFAT) ReadDirWithDiagnostics(entry Entry) ([]Entry, []Diagnostic, error) {
+	entries, err := e.ReadDir(entry)
+	return entries, e.takeDiagnostics(), err
+}
+
+// ReadRootDirWithDiagnostics behaves like ReadRootDir and also returns every
+// malformed entry set found in the root directory.
+func (e *ExFAT) ReadRootDirWithDiagnostics() ([]Entry, []Diagnostic, error) {
+	entries, err := e.ReadRootDir()
+	return entries, e.takeDiagnostics(), err
+}
+
+// Diagnostics returns the malformed entry sets found by the last directory
+// read. Recursive reads such as ReadDirs, GetAllEntries and
+// GetFullPathIndexableEntries report every directory they visited.
+func (e *ExFAT) Diagnostics() []Diagnostic {
+	return append([]Diagnostic(nil), e.diagnostics...)
+}
+
+func (e *ExFAT) takeDiagnostics() []Diagnostic {
+	diagnostics := e.diagnostics
+	e.diagnostics = nil
+	return diagnostics
+}
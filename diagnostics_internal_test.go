@@ -0,0 +1,110 @@
+package libxfat
+
+import "testing"
+
+func TestParseDirReportsMalformedSets(t *testing.T) {
+	exfat := ExFAT{}
+
+	clusterdata := make([]byte, EXFAT_DIRRECORD_SIZE*6)
+
+	// Orphaned name record with no primary before it.
+	clusterdata[0] = EXFAT_DIRRECORD_FILENAME_EXT
+
+	// File set announcing a stream and two name records but holding one.
+	base := EXFAT_DIRRECORD_SIZE
+	clusterdata[base] = EXFAT_DIRRECORD_FILEDIR
+	clusterdata[base+1] = 3
+	stream := base + EXFAT_DIRRECORD_SIZE
+	clusterdata[stream] = EXFAT_DIRRECORD_STREAM_EXT
+	clusterdata[stream+3] = 16
+	name := stream + EXFAT_DIRRECORD_SIZE
+	clusterdata[name] = EXFAT_DIRRECORD_FILENAME_EXT
+	clusterdata[name+2] = 'X'
+	// The zero record that follows ends the directory mid-set.
+
+	entries := exfat.parseDir(clusterdata)
+	if len(entries) != 0 {
+		t.Fatalf("parseDir() entries len = %d, want 0", len(entries))
+	}
+
+	diagnostics := exfat.takeDiagnostics()
+	if len(diagnostics) != 2 {
+		t.Fatalf("diagnostics = %v, want 2", diagnostics)
+	}
+	if diagnostics[0].Kind != DIAG_ORPHAN_NAME || diagnostics[0].Offset != 0 {
+		t.Fatalf("first diagnostic = %v, want orphan name at 0", diagnostics[0])
+	}
+	missing := diagnostics[1]
+	if missing.Kind != DIAG_MISSING_NAME || missing.Offset != uint64(base) {
+		t.Fatalf("second diagnostic = %v, want missing name at %d", missing, base)
+	}
+	if missing.Expected != 3 || missing.Actual != 2 || len(missing.Raw) != 3*EXFAT_DIRRECORD_SIZE {
+		t.Fatalf("missing name expected=%d actual=%d raw=%d", missing.Expected, missing.Actual, len(missing.Raw))
+	}
+}
+
+func TestParseDirReportsChecksumMismatch(t *testing.T) {
+	exfat := ExFAT{}
+
+	clusterdata := make([]byte, EXFAT_DIRRECORD_SIZE*3)
+	clusterdata[0] = EXFAT_DIRRECORD_FILEDIR
+	clusterdata[1] = 2
+	clusterdata[2] = 0xAD
+	clusterdata[3] = 0xDE
+	clusterdata[EXFAT_DIRRECORD_SIZE] = EXFAT_DIRRECORD_STREAM_EXT
+	clusterdata[EXFAT_DIRRECORD_SIZE+3] = 1
+	clusterdata[EXFAT_DIRRECORD_SIZE*2] = EXFAT_DIRRECORD_FILENAME_EXT
+	clusterdata[EXFAT_DIRRECORD_SIZE*2+2] = 'Z'
+
+	entries := exfat.parseDir(clusterdata)
+	if len(entries) != 1 || entries[0].GetName() != "" {
+		t.Fatalf("parseDir() = %v, want one unnamed entry", entries)
+	}
+	if got := entries[0].RecordOffsets(); len(got) != 3 || got[2] != EXFAT_DIRRECORD_SIZE*2 {
+		t.Fatalf("RecordOffsets() = %v", got)
+	}
+
+	diagnostics := exfat.takeDiagnostics()
+	if len(diagnostics) != 1 || diagnostics[0].Kind != DIAG_CHECKSUM_MISMATCH {
+		t.Fatalf("diagnostics = %v, want one checksum mismatch", diagnostics)
+	}
+	if diagnostics[0].Expected != 0xDEAD {
+		t.Fatalf("expected checksum = %#x, want 0xdead", diagnostics[0].Expected)
+	}
+}
+
+func TestParseDirReportsMissingStreamOnce(t *testing.T) {
+	exfat := ExFAT{}
+
+	// A name record takes the place of the stream, then the directory ends
+	// before the set is complete.
+	clusterdata := make([]byte, EXFAT_DIRRECORD_SIZE*3)
+	clusterdata[0] = EXFAT_DIRRECORD_FILEDIR
+	clusterdata[1] = 2
+	clusterdata[EXFAT_DIRRECORD_SIZE] = EXFAT_DIRRECORD_FILENAME_EXT
+	clusterdata[EXFAT_DIRRECORD_SIZE+2] = 'X'
+
+	exfat.parseDir(clusterdata)
+	diagnostics := exfat.takeDiagnostics()
+	if len(diagnostics) != 2 || diagnostics[0].Kind != DIAG_MISSING_STREAM || diagnostics[1].Kind != DIAG_MISSING_NAME {
+		t.Fatalf("diagnostics = %v, want one missing stream then one missing name", diagnostics)
+	}
+}
+
+func TestParseDirReportsMissingStreamAtEnd(t *testing.T) {
+	exfat := ExFAT{}
+
+	// The directory ends right after the primary record.
+	clusterdata := make([]byte, EXFAT_DIRRECORD_SIZE*2)
+	clusterdata[0] = EXFAT_DIRRECORD_FILEDIR
+	clusterdata[1] = 2
+
+	exfat.parseDir(clusterdata)
+	diagnostics := exfat.takeDiagnostics()
+	if len(diagnostics) != 1 || diagnostics[0].Kind != DIAG_MISSING_STREAM || diagnostics[0].Offset != 0 {
+		t.Fatalf("diagnostics = %v, want one missing stream at 0", diagnostics)
+	}
+	if diagnostics[0].Expected != EXFAT_DIRRECORD_STREAM_EXT || diagnostics[0].Actual != 0 {
+		t.Fatalf("missing stream expected=%#x actual=%#x", diagnostics[0].Expected, diagnostics[0].Actual)
+	}
+}
@@ -35,3 +35,10 @@ func (r dirRecordView) le32(start int) uint32 {
 func (r dirRecordView) le64(start int) uint64 {
 	return unpackLELongLong(r.data[start : start+8])
 }
+
+// array copies the record into the fixed-size form the typed decoders take.
+func (r dirRecordView) array() [EXFAT_DIRRECORD_SIZE]byte {
+	var b [EXFAT_DIRRECORD_SIZE]byte
+	copy(b[:], r.data)
+	return b
+}
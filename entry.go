@@ -20,6 +20,67 @@ func (e Entry) IsNotIndexable() bool {
 	return e.IsDeleted() || e.IsDir() || e.IsInvalid() || e.HasFatChain()
 }
 
+// applyFileRecord copies the fields of a 0x85/0x05 file directory record.
+func (e *Entry) applyFileRecord(rec dirRecordView) {
+	var file FileDirectoryEntry
+	_ = file.Decode(rec.array())
+	e.etype = file.EntryType
+	e.seenRecords = []byte{e.etype}
+	e.secondaryCount = uint32(file.SecondaryCount)
+	e.entryAttr = file.FileAttributes
+	e.created = file.CreateTimestamp
+	e.modified = file.LastModifiedTimestamp
+	e.accessed = file.LastAccessedTimestamp
+	e.created10ms = file.Create10msIncrement
+	e.modified10ms = file.LastModified10msIncrement
+}
+
+// applyStreamRecord copies the fields of a 0xC0/0x40 stream extension record.
+func (e *Entry) applyStreamRecord(rec dirRecordView) {
+	var stream StreamExtensionEntry
+	_ = stream.Decode(rec.array())
+	e.nameLen = stream.NameLength
+	e.readNameLen = 0
+	e.entryCluster = stream.FirstCluster
+	e.dataLen = stream.DataLength
+	e.validDataLen = stream.ValidDataLength
+	e.noFatChain = stream.NoFatChain()
+}
+
+func (e *Entry) setParent(parentPath string, parentCluster uint32) {
+	e.parentPath = parentPath
+	e.parentCluster = parentCluster
+}
+
+// withDefaultParent returns the entry with parentPath filled in when the entry
+// was not produced by one of the directory read APIs.
+func (e Entry) withDefaultParent(parentPath string) Entry {
+	if e.parentPath != "" {
+		return e
+	}
+	parentPath = strings.TrimRight(parentPath, "/")
+	if parentPath == "" {
+		parentPath = "/"
+	}
+	e.parentPath = parentPath
+	return e
+}
+
+func joinEntryPath(parentPath, name string) string {
+	if parentPath == "" || parentPath == "/" {
+		return "/" + name
+	}
+	return parentPath + "/" + name
+}
+
+// dirPrefix returns a directory path with exactly one trailing separator.
+func dirPrefix(dirPath string) string {
+	if dirPath == "" || dirPath == "/" {
+		return "/"
+	}
+	return strings.TrimRight(dirPath, "/") + "/"
+}
+
 func getDirEntry(entry Entry, path string, long, simple bool) string {
 	if simple {
 		return entry.name
@@ -55,6 +116,6 @@ func getDirEntryLong(entry Entry, path string) string {
 	accessedtime := getDateTimeString(entry.accessed, 0)
 	createdTime := getDateTimeString(entry.created, uint32(entry.created10ms))
 
-	longname := fmt.Sprintf("Type:%s\nEntryCluster:%d\nSize:%d\nFileAttributes:%s\nModifiedTime:%s\nAcessedTime:%s\nCreatedTime:%s\nSecondaryCount:%d\nNoFatChain:%s\nFullPath:%s%s\n", typestr, entry.entryCluster, entry.dataLen, fileAttributes, modifiedTime, accessedtime, createdTime, entry.secondaryCount, nfc, fullpath, deleted)
+	longname := fmt.Sprintf("Type:%s\nEntryCluster:%d\nSize:%d\nFileAttributes:%s\nModifiedTime:%s\nAcessedTime:%s\nCreatedTime:%s\nSecondaryCount:%d\nNoFatChain:%s\nNameAnomalies:%s\nFullPath:%s%s\n", typestr, entry.entryCluster, entry.dataLen, fileAttributes, modifiedTime, accessedtime, createdTime, entry.secondaryCount, nfc, entry.nameAnomalies, fullpath, deleted)
 	return longname
 }
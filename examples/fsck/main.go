@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aoiflux/libxfat"
+)
+
+func main() {
+	imagePath := flag.String("image", "", "Path to an exFAT image file")
+	optimistic := flag.Bool("optimistic", false, "Skip strict VBR offset verification")
+	offset := flag.Uint64("offset", 0, "Sector offset where the exFAT volume starts")
+	asJSON := flag.Bool("json", false, "Print the report as JSON")
+	flag.Parse()
+
+	if *imagePath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	imageFile, err := os.Open(*imagePath)
+	if err != nil {
+		log.Fatalf("open image: %v", err)
+	}
+	defer imageFile.Close()
+
+	exfat, err := libxfat.New(imageFile, *optimistic, *offset)
+	if err != nil {
+		log.Fatalf("parse exFAT: %v", err)
+	}
+
+	report, err := exfat.Check()
+	if err != nil {
+		log.Fatalf("check volume: %v", err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatalf("encode report: %v", err)
+		}
+	} else {
+		for _, finding := range report.Findings {
+			fmt.Println(finding)
+		}
+		fmt.Printf("Files: %d, directories: %d\n", report.Files, report.Directories)
+		fmt.Printf("Allocated clusters: %d, owned clusters: %d\n", report.AllocatedClusters, report.OwnedClusters)
+		fmt.Printf("Errors: %d, warnings: %d\n", report.Count(libxfat.SEVERITY_ERROR), report.Count(libxfat.SEVERITY_WARNING))
+	}
+
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
@@ -45,7 +45,7 @@ func main() {
 		log.Fatalf("read root directory: %v", err)
 	}
 
-	entries, err := collectEntries(exfat, rootEntries, "/")
+	entries, err := collectEntries(exfat, rootEntries)
 	if err != nil {
 		log.Fatalf("walk filesystem: %v", err)
 	}
@@ -87,6 +87,9 @@ func entryMarks(entry libxfat.Entry) string {
 	if isVolumeEntry(entry) {
 		marks = append(marks, "volume")
 	}
+	if entry.HasNameAnomalies() {
+		marks = append(marks, "name:"+entry.NameAnomalies().String())
+	}
 	if len(marks) == 0 {
 		return "-"
 	}
@@ -110,18 +113,13 @@ func appendVolumeEntry(entries []listingEntry, label string) []listingEntry {
 	return entries
 }
 
-func collectEntries(exfat libxfat.ExFAT, entries []libxfat.Entry, basePath string) ([]listingEntry, error) {
+func collectEntries(exfat libxfat.ExFAT, entries []libxfat.Entry) ([]listingEntry, error) {
 	var out []listingEntry
 
 	for _, entry := range entries {
-		name := entry.GetName()
-		if strings.TrimSpace(name) == "" {
-			name = "<no-name>"
-		}
-
-		fullPath := path.Join(basePath, name)
-		if fullPath == "" {
-			fullPath = "/"
+		fullPath := entry.Path()
+		if strings.TrimSpace(entry.Name()) == "" {
+			fullPath = path.Join(entry.ParentPath(), "<no-name>")
 		}
 		out = append(out, listingEntry{
 			typeName: entryType(entry),
@@ -139,7 +137,7 @@ func collectEntries(exfat libxfat.ExFAT, entries []libxfat.Entry, basePath strin
 			return nil, err
 		}
 
-		childEntries, err := collectEntries(exfat, subEntries, fullPath)
+		childEntries, err := collectEntries(exfat, subEntries)
 		if err != nil {
 			return nil, err
 		}
@@ -46,6 +46,11 @@ func main() {
 		log.Fatalf("get free clusters: %v", err)
 	}
 
+	largestFreeRun, err := exfat.GetLargestFreeRun()
+	if err != nil {
+		log.Fatalf("get largest free run: %v", err)
+	}
+
 	var metadataEntries int
 	for _, entry := range rootEntries {
 		if entry.IsSpecialFile() {
@@ -61,8 +66,10 @@ func main() {
 	fmt.Printf("Volume label: %s\n", volumeLabel)
 	fmt.Printf("Cluster size: %d bytes\n", exfat.GetClusterSize())
 	fmt.Printf("Used space: %s\n", exfat.GetUsedSpace())
+	fmt.Printf("Volume flags: %s\n", exfat.GetVolumeFlags())
 	fmt.Printf("Allocated clusters: %d\n", allocatedClusters)
 	fmt.Printf("Free clusters: %d\n", freeClusters)
+	fmt.Printf("Largest free run: %d clusters at %d\n", largestFreeRun.Length, largestFreeRun.Start)
 	fmt.Printf("Root entries: %d\n", len(rootEntries))
 	fmt.Printf("Metadata entries in root: %d\n", metadataEntries)
 }
@@ -34,6 +34,11 @@ func (e *ExFAT) resetSetAssembly() {
 	e.expectedSC = 0
 	e.expectedNameLen = 0
 	e.nameUnits = nil
+	e.nameRecords = 0
+	e.benignRecords = 0
+	e.streamSeen = false
+	e.setOffset = 0
+	e.setRaw = nil
 }
 
 func (e *ExFAT) clearParsedEntry() {
@@ -43,27 +48,17 @@ func (e *ExFAT) clearParsedEntry() {
 	e.resetSetAssembly()
 }
 
-// GetAllocatedClusters function is experimental, it may not work correctly all the time
-// It has been tested to work correctly if used directly after parsing root entries
+// GetAllocatedClusters counts the clusters the allocation bitmap marks as
+// used. The bitmap is read on demand, so it can be called at any time.
 func (e *ExFAT) GetAllocatedClusters() (uint32, error) {
-	if err := e.ensureBitmapEntry(); err != nil {
-		return 0, ErrAllocationBitmapNotFound
-	}
-
-	counter := bitmapCounter{}
-	err := e.vbr.visitEntryData(e.vbr.bitmapEntry, func(_ uint32, chunk []byte) error {
-		counter.write(chunk)
-		return nil
-	})
-	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, ErrEOF) {
+	bitmap, err := e.loadBitmap()
+	if err != nil {
 		return 0, err
 	}
-	allocatedClusters := counter.count()
-	return allocatedClusters, nil
+	return bitmap.allocatedCount(), nil
 }
 
-// GetFreeClusters function is experimental, it may not work correctly all the time
-// It has been tested to work correctly if used directly after parsing root entries
+// GetFreeClusters counts the clusters the allocation bitmap marks as free.
 func (e *ExFAT) GetFreeClusters() (uint32, error) {
 	allocatedClusters, err := e.GetAllocatedClusters()
 	if err != nil {
@@ -78,17 +73,25 @@ func (e *ExFAT) GetClusterSize() uint64 {
 }
 
 func (e *ExFAT) ExtractEntryContent(entry Entry, dstpath string) error {
+	_, err := e.ExtractEntryContentWithReport(entry, dstpath)
+	return err
+}
+
+// ExtractEntryContentWithReport extracts like ExtractEntryContent and reports
+// the byte ranges the bad cluster policy zero-filled or left out.
+func (e *ExFAT) ExtractEntryContentWithReport(entry Entry, dstpath string) (ExtractionReport, error) {
 	if entry.IsInvalid() {
-		return ErrInvalidEntry
+		return ExtractionReport{}, ErrInvalidEntry
 	}
 	if entry.IsDeleted() {
-		return ErrDeletedEntry
+		return ExtractionReport{}, ErrDeletedEntry
 	}
 	return e.vbr.extractEntryContent(entry, dstpath)
 }
 
 func (e *ExFAT) ExtractAllFiles(rootEntries []Entry, dstdir string) error {
-	err := e.getAllEntriesInfo(rootEntries, "/", dstdir, false, false, true)
+	e.diagnostics = nil
+	err := e.getAllEntriesInfo(e.newTraversal(), rootEntries, "/", dstdir, false, false, true, 1)
 	if err != nil {
 		return err
 	}
@@ -97,22 +100,32 @@ func (e *ExFAT) ExtractAllFiles(rootEntries []Entry, dstdir string) error {
 	return nil
 }
 
+// GetFullPathIndexableEntries recursively collects indexable entries. Entries
+// keep their real names; use Path() for the full path. The path argument is
+// only used as the parent path of entries that do not carry one yet.
+// The walk stops with a *TraversalError on directory cycles and when the
+// traversal limits are exceeded.
 func (e *ExFAT) GetFullPathIndexableEntries(entries []Entry, path string) ([]Entry, error) {
+	e.diagnostics = nil
+	return e.getFullPathIndexableEntries(e.newTraversal(), entries, path, 1)
+}
+
+func (e *ExFAT) getFullPathIndexableEntries(t *traversal, entries []Entry, path string, depth int) ([]Entry, error) {
 	var retentries []Entry
 
 	for _, entry := range entries {
-		entry.name = path + entry.name
+		entry = entry.withDefaultParent(path)
 
 		if entry.IsIndexable() {
 			retentries = append(retentries, entry)
 		}
 
-		subentries, err := e.ReadDir(entry)
+		subentries, err := e.readDirIn(t, entry, depth)
 		if err != nil {
 			return nil, err
 		}
 
-		tempRet, err := e.GetFullPathIndexableEntries(subentries, entry.name+"/")
+		tempRet, err := e.getFullPathIndexableEntries(t, subentries, entry.Path(), depth+1)
 		if err != nil {
 			return nil, err
 		}
@@ -123,22 +136,24 @@ func (e *ExFAT) GetFullPathIndexableEntries(entries []Entry, path string) ([]Ent
 }
 
 func (e *ExFAT) ShowAllEntriesInfo(rootEntries []Entry, path string, long, simple bool) error {
-	return e.getAllEntriesInfo(rootEntries, path, "", long, simple, false)
+	e.diagnostics = nil
+	return e.getAllEntriesInfo(e.newTraversal(), rootEntries, path, "", long, simple, false, 1)
 }
 
-func (e *ExFAT) getAllEntriesInfo(entries []Entry, path, dstdir string, long, simple, extract bool) error {
+func (e *ExFAT) getAllEntriesInfo(t *traversal, entries []Entry, path, dstdir string, long, simple, extract bool, depth int) error {
 	for _, entry := range entries {
-		err := e.processEntry(entry, path, dstdir, extract, long, simple)
+		entry = entry.withDefaultParent(path)
+		err := e.processEntry(entry, dirPrefix(entry.ParentPath()), dstdir, extract, long, simple)
 		if err != nil {
 			return err
 		}
 
-		subentries, err := e.ReadDir(entry)
+		subentries, err := e.readDirIn(t, entry, depth)
 		if err != nil {
 			return err
 		}
 
-		err = e.getAllEntriesInfo(subentries, path+entry.name+"/", dstdir, long, simple, extract)
+		err = e.getAllEntriesInfo(t, subentries, entry.Path(), dstdir, long, simple, extract, depth+1)
 		if err != nil {
 			return err
 		}
@@ -181,6 +196,9 @@ func (e *ExFAT) GetAllEntries(rootEntries []Entry, indexable ...bool) ([]Entry,
 	var err error
 	var allEntries []Entry
 	subEntries := rootEntries
+	t := e.newTraversal()
+	depth := 1
+	e.diagnostics = nil
 
 	if len(indexable) > 0 {
 		flag = indexable[0]
@@ -198,20 +216,26 @@ func (e *ExFAT) GetAllEntries(rootEntries []Entry, indexable ...bool) ([]Entry,
 			allEntries = append(allEntries, subEntry)
 		}
 
-		subEntries, err = e.ReadDirs(subEntries)
+		subEntries, err = e.readDirs(t, subEntries, depth)
 		if err != nil {
 			return nil, err
 		}
+		depth++
 	}
 
 	return allEntries, err
 }
 
 func (e *ExFAT) ReadDirs(rootEntries []Entry) ([]Entry, error) {
+	e.diagnostics = nil
+	return e.readDirs(e.newTraversal(), rootEntries, 1)
+}
+
+func (e *ExFAT) readDirs(t *traversal, rootEntries []Entry, depth int) ([]Entry, error) {
 	var entries []Entry
 
 	for _, entry := range rootEntries {
-		subentries, err := e.ReadDir(entry)
+		subentries, err := e.readDirIn(t, entry, depth)
 		if err != nil {
 			return nil, err
 		}
@@ -222,6 +246,13 @@ func (e *ExFAT) ReadDirs(rootEntries []Entry) ([]Entry, error) {
 }
 
 func (e *ExFAT) ReadDir(entry Entry) ([]Entry, error) {
+	e.diagnostics = nil
+	return e.readDir(entry)
+}
+
+// readDir reads a directory and adds its diagnostics to those collected so
+// far, so recursive reads report every directory they visit.
+func (e *ExFAT) readDir(entry Entry) ([]Entry, error) {
 	if entry.NonParsable() {
 		return nil, nil
 	}
@@ -233,11 +264,15 @@ func (e *ExFAT) ReadDir(entry Entry) ([]Entry, error) {
 }
 
 func (e *ExFAT) ReadRootDir() ([]Entry, error) {
+	e.diagnostics = nil
 	entries, err := e.readRootDirEntries()
 	if err != nil {
 		return nil, err
 	}
-	entries = append(entries, e.createVirtualEntries()...)
+	for _, virtual := range e.createVirtualEntries() {
+		virtual.setParent("/", e.vbr.rootDirCluster)
+		entries = append(entries, virtual)
+	}
 	return entries, nil
 }
 
@@ -245,53 +280,30 @@ func (e *ExFAT) ReadRootDir() ([]Entry, error) {
 // deleted exFAT file entry sets (0x05/0x40/0x41), similar to TSK-style
 // orphan/deleted discovery.
 func (e *ExFAT) RecoverDeletedEntries() ([]Entry, error) {
-	unallocated, err := e.getUnallocatedClusters()
+	unallocated, err := e.GetFreeRuns()
 	if err != nil {
 		return nil, err
 	}
 
 	var deleted []Entry
-	for _, cluster := range unallocated {
-		clusterdata, err := e.vbr.readClusters(cluster, 1)
-		if err != nil {
-			return nil, err
-		}
-		deleted = append(deleted, e.parseDeletedDirEntries(clusterdata)...)
-	}
-
-	return deleted, nil
-}
-
-func (e *ExFAT) getUnallocatedClusters() ([]uint32, error) {
-	if err := e.ensureBitmapEntry(); err != nil {
-		return nil, err
-	}
-
-	var unallocated []uint32
-	clusterIndex := uint32(0)
-	err := e.vbr.visitEntryData(e.vbr.bitmapEntry, func(_ uint32, chunk []byte) error {
-		for _, b := range chunk {
-			for bit := 0; bit < 8 && clusterIndex < e.vbr.nbClusters; bit++ {
-				allocated := (b & (1 << bit)) != 0
-				if !allocated {
-					unallocated = append(unallocated, uint32(FIRST_CLUSTER_NUMBER)+clusterIndex)
-				}
-				clusterIndex++
+	for _, run := range unallocated {
+		for cluster := run.Start; cluster < run.End(); cluster++ {
+			clusterdata, err := e.vbr.readClusters(cluster, 1)
+			if err != nil {
+				return nil, err
 			}
-			if clusterIndex >= e.vbr.nbClusters {
-				return errStopClusterWalk
+			e.dirPath = "/" + ORPHANFILES
+			e.dirCluster = cluster
+			e.chunkOffset = e.vbr.getClusterOffset(cluster)
+			if e.salvage {
+				deleted = append(deleted, e.salvageChunk(clusterdata)...)
+				continue
 			}
+			deleted = append(deleted, e.parseDeletedDirEntries(clusterdata)...)
 		}
-		return nil
-	})
-	if errors.Is(err, errStopClusterWalk) {
-		return unallocated, nil
-	}
-	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, ErrEOF) {
-		return nil, err
 	}
 
-	return unallocated, nil
+	return deleted, nil
 }
 
 func (e *ExFAT) CountClusters(entry Entry) (int, error) {
@@ -303,6 +315,12 @@ func (e *ExFAT) CountClusters(entry Entry) (int, error) {
 func (e *ExFAT) GetClusterList(entry Entry) ([]uint32, uint64, error) {
 	return e.vbr.getClusterList(entry)
 }
+
+// GetClusterRuns returns the cluster extents allocated to entry in file
+// order, one Run per fragment. FAT chained entries report their whole chain.
+func (e *ExFAT) GetClusterRuns(entry Entry) ([]Run, error) {
+	return e.vbr.getClusterRuns(entry)
+}
 func (e *ExFAT) GetClusterOffset(cluster uint32) uint64 {
 	return e.vbr.getClusterOffset(cluster)
 }
@@ -314,21 +332,29 @@ func (e *ExFAT) GetUsedSpace() string {
 func (e *ExFAT) resetDirParser() {
 	e.initEntryState(nil, 0, 0, ENTRY_STATE_START)
 	e.resetSetAssembly()
+	e.salvager = salvager{}
 }
 
 func (e *ExFAT) readDirEntries(entry Entry) ([]Entry, error) {
 	var entries []Entry
 	done := false
 	e.resetDirParser()
-	err := e.vbr.visitEntryData(entry, func(_ uint32, chunk []byte) error {
+	e.dirPath = entry.Path()
+	e.dirCluster = entry.entryCluster
+	err := e.vbr.visitEntryData(entry, func(cluster uint32, chunk []byte) error {
 		if done {
 			return nil
 		}
+		e.chunkOffset = e.vbr.getClusterOffset(cluster)
 		if e.parseDirChunk(chunk, &entries) {
 			done = true
 		}
-		return nil
+		return e.checkDirEntries(len(entries))
 	})
+	if !done {
+		e.interruptSet()
+		e.flushSalvage(&entries)
+	}
 	return entries, err
 }
 
@@ -336,21 +362,29 @@ func (e *ExFAT) readRootDirEntries() ([]Entry, error) {
 	var entries []Entry
 	done := false
 	e.resetDirParser()
-	err := e.vbr.visitFatChain(e.vbr.rootDirCluster, func(_ uint32, chunk []byte) error {
+	e.dirPath = "/"
+	e.dirCluster = e.vbr.rootDirCluster
+	err := e.vbr.visitFatChain(e.vbr.rootDirCluster, func(cluster uint32, chunk []byte) error {
 		if done {
 			return nil
 		}
+		e.chunkOffset = e.vbr.getClusterOffset(cluster)
 		if e.parseDirChunk(chunk, &entries) {
 			done = true
 		}
-		return nil
+		return e.checkDirEntries(len(entries))
 	})
+	if !done {
+		e.interruptSet()
+		e.flushSalvage(&entries)
+	}
 	return entries, err
 }
 
 func (e *ExFAT) parseDir(clusterdata []byte) []Entry {
 	var entries []Entry
 	e.resetDirParser()
+	e.chunkOffset = 0
 	e.parseDirChunk(clusterdata, &entries)
 	return entries
 }
@@ -380,6 +414,7 @@ func (e *ExFAT) parseDeletedDirEntries(clusterdata []byte) []Entry {
 				e.populateDirRecordDel(rec)
 				e.expectedSC = int(e.entry.secondaryCount)
 				e.expectedChecksum = uint16(rec.byteAt(2)) | (uint16(rec.byteAt(3)) << 8)
+				e.addSetRecord(rec, e.recordOffset())
 			}
 			continue
 		}
@@ -389,6 +424,7 @@ func (e *ExFAT) parseDeletedDirEntries(clusterdata []byte) []Entry {
 				e.setChecksum = exfatDirSetChecksumAdd(e.setChecksum, rec.data, false)
 				e.populateDirRecordStreamSeen(rec)
 				e.expectedNameLen = int(e.entry.nameLen)
+				e.addSetRecord(rec, e.recordOffset())
 			}
 			continue
 		}
@@ -400,6 +436,8 @@ func (e *ExFAT) parseDeletedDirEntries(clusterdata []byte) []Entry {
 
 			e.setChecksum = exfatDirSetChecksumAdd(e.setChecksum, rec.data, false)
 			e.nameUnits = append(e.nameUnits, utf16leUnitsFromBytes(rec.bytes(2, EXFAT_DIRRECORD_SIZE), 15)...)
+			e.nameRecords++
+			e.addSetRecord(rec, e.recordOffset())
 
 			if e.remainingSC < 1 {
 				continue
@@ -409,16 +447,17 @@ func (e *ExFAT) parseDeletedDirEntries(clusterdata []byte) []Entry {
 				continue
 			}
 
+			e.recordRawName()
 			if e.expectedNameLen > 0 && len(e.nameUnits) > e.expectedNameLen {
 				e.nameUnits = e.nameUnits[:e.expectedNameLen]
 			}
-			if e.optimistic || e.expectedChecksum == e.setChecksum {
+			if e.optimistic || e.setChecksumMatches() {
 				e.entry.name = utf16UnitsToString(e.nameUnits)
 			}
 			if e.entry.IsDeleted() {
 				e.entry.name += DELETED
 			}
-			entries = append(entries, e.entry)
+			e.emitEntry(&entries, e.entry)
 			e.clearParsedEntry()
 		}
 	}
@@ -432,6 +471,8 @@ func (e *ExFAT) parseDirChunk(clusterdata []byte, entries *[]Entry) bool {
 
 	for e.offset < len(clusterdata) {
 		if clusterdata[e.offset] == 0 {
+			e.interruptSet()
+			e.flushSalvage(entries)
 			return true
 		}
 
@@ -441,89 +482,120 @@ func (e *ExFAT) parseDirChunk(clusterdata []byte, entries *[]Entry) bool {
 		}
 
 		e.dirtype = rec.typeByte()
+		recOffset := e.recordOffset()
+
+		if e.salvage {
+			if isSalvageRecord(e.dirtype) || (e.dirtype&0x40 != 0 && e.salvager.active) {
+				e.salvageRecord(rec, recOffset, entries)
+				e.offset += EXFAT_DIRRECORD_SIZE
+				continue
+			}
+			e.flushSalvage(entries)
+		}
 
 		switch e.dirtype {
 		case EXFAT_DIRRECORD_LABEL:
+			e.interruptSet()
 			// Validate volume label/no-label entry
 			if e.validateVolLabelDentry(rec.data) {
 				e.populateDirRecordLabel(rec)
 			}
 		case EXFAT_DIRRECORD_NOLABEL:
+			e.interruptSet()
 			e.entry.name = ""
 		case EXFAT_DIRRECORD_BITMAP, EXFAT_DIRRECORD_UPCASE:
+			e.interruptSet()
 			if (e.dirtype == EXFAT_DIRRECORD_BITMAP && e.validateAllocBitmapDentry(rec.data)) ||
 				(e.dirtype == EXFAT_DIRRECORD_UPCASE && e.validateUpcaseTableDentry(rec.data)) {
 				e.populateRecordBitmapUpcase(rec)
-				*entries = append(*entries, e.virtualEntry)
+				e.virtualEntry.recordOffsets = []uint64{recOffset}
+				e.emitEntry(entries, e.virtualEntry)
 			}
 		case EXFAT_DIRRECORD_VOLUME_GUID:
+			e.interruptSet()
 			e.virtualEntry.etype = e.dirtype
 			e.virtualEntry.name = VOLUME_GUID
 			e.virtualEntry.entryAttr = 0
-			*entries = append(*entries, e.virtualEntry)
+			e.virtualEntry.recordOffsets = []uint64{recOffset}
+			e.emitEntry(entries, e.virtualEntry)
 		case EXFAT_DIRRECORD_TEXFAT:
+			e.interruptSet()
 			e.virtualEntry.etype = e.dirtype
 			e.virtualEntry.name = TEXFAT
 			e.virtualEntry.entryAttr = 0
-			*entries = append(*entries, e.virtualEntry)
+			e.virtualEntry.recordOffsets = []uint64{recOffset}
+			e.emitEntry(entries, e.virtualEntry)
 		case EXFAT_DIRRECORD_ACT:
+			e.interruptSet()
 			e.virtualEntry.etype = e.dirtype
 			e.virtualEntry.name = ACT
 			e.virtualEntry.entryAttr = 0
-			*entries = append(*entries, e.virtualEntry)
+			e.virtualEntry.recordOffsets = []uint64{recOffset}
+			e.emitEntry(entries, e.virtualEntry)
 		default:
-			if (e.dirtype & 0x7f) == EXFAT_DIRRECORD_DEL_FILEDIR {
+			switch e.dirtype & 0x7f {
+			case EXFAT_DIRRECORD_DEL_FILEDIR:
 				if e.validateFileDentry(rec.data) {
+					e.interruptSet()
+					e.entry = Entry{}
+					e.resetSetAssembly()
 					e.setChecksum = exfatDirSetChecksumAdd(0, rec.data, true)
 					e.populateDirRecordDel(rec)
 					e.expectedSC = int(e.entry.secondaryCount)
 					b0 := uint16(rec.byteAt(2))
 					b1 := uint16(rec.byteAt(3))
 					e.expectedChecksum = b0 | (b1 << 8)
-					e.expectedNameLen = 0
-					e.nameUnits = nil
+					e.addSetRecord(rec, recOffset)
+				}
+			case EXFAT_DIRRECORD_DEL_STREAM_EXT:
+				if e.entryState != ENTRY_STATE_85_SEEN || e.streamSeen {
+					e.addDiagnostic(DIAG_ORPHAN_STREAM, []uint64{recOffset}, 0, uint64(e.dirtype), rec.data)
+					break
 				}
-			}
-			if ((e.dirtype & 0x7f) == EXFAT_DIRRECORD_DEL_STREAM_EXT) &&
-				(e.entryState == ENTRY_STATE_85_SEEN) {
 				if e.validateFileStreamDentry(rec.data) {
 					e.setChecksum = exfatDirSetChecksumAdd(e.setChecksum, rec.data, false)
 					e.populateDirRecordStreamSeen(rec)
 					e.expectedNameLen = int(e.entry.nameLen)
+					e.streamSeen = true
+					e.addSetRecord(rec, recOffset)
 				}
-			}
-			if (e.dirtype & 0x7f) == EXFAT_DIRRECORD_DEL_FILENAME_EXT {
-				if e.validateFileNameDentry(rec.data) {
-					e.setChecksum = exfatDirSetChecksumAdd(e.setChecksum, rec.data, false)
+			case EXFAT_DIRRECORD_DEL_FILENAME_EXT:
+				if e.entryState != ENTRY_STATE_85_SEEN || e.remainingSC < 1 {
+					e.addDiagnostic(DIAG_ORPHAN_NAME, []uint64{recOffset}, 0, uint64(e.dirtype), rec.data)
+					break
+				}
+				if !e.validateFileNameDentry(rec.data) {
+					break
+				}
+				if !e.streamSeen && len(e.setRaw) == EXFAT_DIRRECORD_SIZE {
+					e.addDiagnostic(DIAG_MISSING_STREAM, append(append([]uint64(nil), e.entry.recordOffsets...), recOffset), EXFAT_DIRRECORD_STREAM_EXT, uint64(e.dirtype), append(append([]byte(nil), e.setRaw...), rec.data...))
+				}
+				e.setChecksum = exfatDirSetChecksumAdd(e.setChecksum, rec.data, false)
+				e.addSetRecord(rec, recOffset)
+
+				raw := rec.bytes(2, EXFAT_DIRRECORD_SIZE)
+				units := utf16leUnitsFromBytes(raw, 15)
+				e.nameUnits = append(e.nameUnits, units...)
+				e.nameRecords++
 
-					raw := rec.bytes(2, EXFAT_DIRRECORD_SIZE)
-					units := utf16leUnitsFromBytes(raw, 15)
-					e.nameUnits = append(e.nameUnits, units...)
-
-					if (e.entryState == ENTRY_STATE_85_SEEN) && (e.remainingSC >= 1) {
-						e.remainingSC--
-
-						if e.remainingSC == 0 {
-							if e.expectedNameLen > 0 && len(e.nameUnits) > e.expectedNameLen {
-								e.nameUnits = e.nameUnits[:e.expectedNameLen]
-							}
-							checksumOK := e.expectedChecksum == e.setChecksum
-							if e.optimistic || checksumOK {
-								e.entry.name = utf16UnitsToString(e.nameUnits)
-							} else {
-								e.entry.name = ""
-							}
-							if e.entry.IsDeleted() {
-								e.entry.name += DELETED
-							}
-
-							*entries = append(*entries, e.entry)
-							e.entry = Entry{}
-							e.entryState = ENTRY_STATE_LAST_C1_SEEN
-							e.resetSetAssembly()
-						}
+				e.remainingSC--
+				if e.remainingSC == 0 {
+					e.completeSet(entries)
+				}
+			default:
+				// Vendor extension and allocation records are benign
+				// secondaries: they count towards the set but carry no name.
+				if e.dirtype&0x40 != 0 && e.entryState == ENTRY_STATE_85_SEEN && e.remainingSC >= 1 {
+					e.setChecksum = exfatDirSetChecksumAdd(e.setChecksum, rec.data, false)
+					e.addSetRecord(rec, recOffset)
+					e.benignRecords++
+					e.remainingSC--
+					if e.remainingSC == 0 {
+						e.completeSet(entries)
 					}
+					break
 				}
+				e.interruptSet()
 			}
 		}
 
@@ -533,17 +605,127 @@ func (e *ExFAT) parseDirChunk(clusterdata []byte, entries *[]Entry) bool {
 	return false
 }
 
-func (e *ExFAT) populateDirRecordLabel(rec dirRecordView) {
-	count := int(rec.byteAt(1))
-	endOffset := 2 + count*2
-	if endOffset > len(rec.data) {
-		endOffset = len(rec.data)
+// recordOffset returns the absolute image offset of the record being parsed.
+func (e *ExFAT) recordOffset() uint64 {
+	return e.chunkOffset + uint64(e.offset)
+}
+
+// addSetRecord remembers where a record of the current entry set lives and
+// keeps a copy of its bytes for diagnostics.
+func (e *ExFAT) addSetRecord(rec dirRecordView, recOffset uint64) {
+	if len(e.setRaw) == 0 {
+		e.setOffset = recOffset
+	}
+	e.setRaw = append(e.setRaw, rec.data...)
+	e.entry.recordOffsets = append(e.entry.recordOffsets, recOffset)
+}
+
+// setChecksumMatches reports whether the set just read matches its
+// SetChecksum. A deleted set may still carry the checksum of its live records,
+// as the Windows driver leaves it.
+func (e *ExFAT) setChecksumMatches() bool {
+	if e.expectedChecksum == e.setChecksum {
+		return true
+	}
+	return e.entry.IsDeleted() && e.expectedChecksum == exfatDirLiveSetChecksum(e.setRaw)
+}
+
+// completeSet emits the entry whose secondary records have all been read.
+func (e *ExFAT) completeSet(entries *[]Entry) {
+	e.recordRawName()
+	if e.expectedNameLen > 0 && len(e.nameUnits) > e.expectedNameLen {
+		e.nameUnits = e.nameUnits[:e.expectedNameLen]
+	}
+	checksumOK := e.setChecksumMatches()
+	if !checksumOK {
+		e.addDiagnostic(DIAG_CHECKSUM_MISMATCH, e.entry.recordOffsets, uint64(e.expectedChecksum), uint64(e.setChecksum), e.setRaw)
+	}
+	if e.optimistic || checksumOK {
+		e.entry.name = utf16UnitsToString(e.nameUnits)
+	} else {
+		e.entry.name = ""
 	}
-	e.vbr.volumeLabel = unicodeFromAscii(rec.bytes(2, endOffset), count)
+	if e.entry.IsDeleted() {
+		e.entry.name += DELETED
+	}
+
+	e.emitEntry(entries, e.entry)
+	e.entry = Entry{}
+	e.entryState = ENTRY_STATE_LAST_C1_SEEN
+	e.resetSetAssembly()
+}
+
+// interruptSet reports and abandons an entry set that ends before all the
+// secondary records its SecondaryCount announced were read. A set cut off
+// right after its primary record is missing its stream; one cut off later is
+// missing names. A name record taking the place of the stream reports the
+// missing stream itself.
+func (e *ExFAT) interruptSet() {
+	if e.entryState != ENTRY_STATE_85_SEEN || e.remainingSC < 1 {
+		return
+	}
+	if !e.streamSeen && len(e.setRaw) == EXFAT_DIRRECORD_SIZE {
+		// The record that ended the set, or zero past the end of the data.
+		var actual uint64
+		if e.offset < len(e.clusterdata) {
+			actual = uint64(e.clusterdata[e.offset])
+		}
+		e.addDiagnostic(DIAG_MISSING_STREAM, e.entry.recordOffsets, EXFAT_DIRRECORD_STREAM_EXT, actual, e.setRaw)
+	} else {
+		seen := uint64(e.entry.secondaryCount) - uint64(e.remainingSC)
+		e.addDiagnostic(DIAG_MISSING_NAME, e.entry.recordOffsets, uint64(e.entry.secondaryCount), seen, e.setRaw)
+	}
+	e.clearParsedEntry()
+}
+
+// recordRawName keeps the untouched name units of the completed set on the
+// entry and flags any naming rule violations.
+func (e *ExFAT) recordRawName() {
+	e.entry.rawName = append([]uint16(nil), e.nameUnits...)
+	nameRecords := e.nameRecords + e.trailingNameRecords(e.setRaw[0])
+	e.entry.nameAnomalies = detectNameAnomalies(e.nameUnits, e.expectedNameLen, nameRecords, e.benignRecords, int(e.entry.secondaryCount))
+}
+
+// trailingNameRecords counts the 0xC1 records, in the in-use state of the
+// primary record, that directly follow the record being parsed. A
+// SecondaryCount too small for the name leaves them outside the set.
+func (e *ExFAT) trailingNameRecords(primary byte) int {
+	want := EXFAT_DIRRECORD_DEL_FILENAME_EXT | primary&0x80
+	n := 0
+	for off := e.offset + EXFAT_DIRRECORD_SIZE; off+EXFAT_DIRRECORD_SIZE <= len(e.clusterdata); off += EXFAT_DIRRECORD_SIZE {
+		if e.clusterdata[off] != want {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// emitEntry records the directory being parsed as the entry's parent and
+// appends it to the result list.
+func (e *ExFAT) emitEntry(entries *[]Entry, entry Entry) {
+	entry.setParent(e.dirPath, e.dirCluster)
+	*entries = append(*entries, entry)
+}
+
+func (e *ExFAT) populateDirRecordLabel(rec dirRecordView) {
+	var label VolumeLabelEntry
+	_ = label.Decode(rec.array())
+	e.vbr.volumeLabel = label.Label()
 }
 func (e *ExFAT) populateRecordBitmapUpcase(rec dirRecordView) {
-	entryCluster := rec.le32(20)
-	dataLen := rec.le64(24)
+	var entryCluster uint32
+	var dataLen uint64
+	switch e.dirtype {
+	case EXFAT_DIRRECORD_BITMAP:
+		var bitmap AllocationBitmapEntry
+		_ = bitmap.Decode(rec.array())
+		entryCluster, dataLen = bitmap.FirstCluster, bitmap.DataLength
+	case EXFAT_DIRRECORD_UPCASE:
+		var upcase UpcaseTableEntry
+		_ = upcase.Decode(rec.array())
+		entryCluster, dataLen = upcase.FirstCluster, upcase.DataLength
+	}
 
 	e.virtualEntry.etype = e.dirtype
 	e.virtualEntry.dataLen = dataLen
@@ -572,15 +754,7 @@ func (e *ExFAT) populateRecordBitmapUpcase(rec dirRecordView) {
 	}
 }
 func (e *ExFAT) populateDirRecordDel(rec dirRecordView) {
-	e.entry.etype = e.dirtype
-	e.entry.seenRecords = []byte{e.dirtype}
-	e.entry.secondaryCount = uint32(rec.byteAt(1))
-	e.entry.entryAttr = rec.le16(4)
-	e.entry.created = rec.le32(8)
-	e.entry.modified = rec.le32(12)
-	e.entry.accessed = rec.le32(16)
-	e.entry.created10ms = rec.byteAt(20)
-	e.entry.modified10ms = rec.byteAt(21)
+	e.entry.applyFileRecord(rec)
 	e.remainingSC = int(e.entry.secondaryCount)
 	// Both 0x85 (allocated) and 0x05 (deleted) begin a file entry set.
 	if (e.dirtype & 0x7f) == EXFAT_DIRRECORD_DEL_FILEDIR {
@@ -588,17 +762,7 @@ func (e *ExFAT) populateDirRecordDel(rec dirRecordView) {
 	}
 }
 func (e *ExFAT) populateDirRecordStreamSeen(rec dirRecordView) {
-	e.entry.nameLen = rec.byteAt(3)
-	e.entry.readNameLen = 0
-	e.entry.entryCluster = rec.le32(20)
-	e.entry.dataLen = rec.le64(24)
-	e.entry.validDataLen = rec.le64(24)
-
-	e.entry.noFatChain = false
-	if (rec.byteAt(1) & NOT_FAT_CHAIN_FLAG) != 0 {
-		e.entry.noFatChain = true
-	}
-
+	e.entry.applyStreamRecord(rec)
 	e.remainingSC--
 }
 
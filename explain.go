@@ -0,0 +1,260 @@
+package libxfat
+
+import (
+	"fmt"
+)
+
+// OffsetRegion names the structure an image offset falls in.
+type OffsetRegion int
+
+const (
+	// REGION_BEFORE_VOLUME: before the volume, such as the MBR or the gap
+	// in front of the partition.
+	REGION_BEFORE_VOLUME OffsetRegion = iota + 1
+	// REGION_MAIN_BOOT and REGION_BACKUP_BOOT: the 12-sector boot regions.
+	REGION_MAIN_BOOT
+	REGION_BACKUP_BOOT
+	// REGION_FAT_ALIGNMENT: between the boot regions and the first FAT.
+	REGION_FAT_ALIGNMENT
+	// REGION_FAT1 and REGION_FAT2: the FATs; Cluster is the cluster whose
+	// entry holds the offset.
+	REGION_FAT1
+	REGION_FAT2
+	// REGION_HEAP_ALIGNMENT: between the FATs and the cluster heap.
+	REGION_HEAP_ALIGNMENT
+	// REGION_BITMAP: the allocation bitmap.
+	REGION_BITMAP
+	// REGION_UPCASE: the up-case table.
+	REGION_UPCASE
+	// REGION_DIRECTORY: a directory cluster; EntrySet names the set
+	// holding the offset, if any.
+	REGION_DIRECTORY
+	// REGION_FILE_DATA and REGION_FILE_SLACK: a file's data, or the rest of
+	// its last cluster past DataLength.
+	REGION_FILE_DATA
+	REGION_FILE_SLACK
+	// REGION_UNOWNED_HEAP: an allocated cluster no live entry owns.
+	REGION_UNOWNED_HEAP
+	// REGION_UNALLOCATED_HEAP: a free cluster.
+	REGION_UNALLOCATED_HEAP
+	// REGION_PAST_HEAP: inside the volume but after the last cluster.
+	REGION_PAST_HEAP
+	// REGION_PAST_VOLUME: past VolumeLength.
+	REGION_PAST_VOLUME
+)
+
+var offsetRegionNames = map[OffsetRegion]string{
+	REGION_BEFORE_VOLUME:    "before-volume",
+	REGION_MAIN_BOOT:        "main-boot-region",
+	REGION_BACKUP_BOOT:      "backup-boot-region",
+	REGION_FAT_ALIGNMENT:    "fat-alignment",
+	REGION_FAT1:             "fat1",
+	REGION_FAT2:             "fat2",
+	REGION_HEAP_ALIGNMENT:   "heap-alignment",
+	REGION_BITMAP:           "allocation-bitmap",
+	REGION_UPCASE:           "upcase-table",
+	REGION_DIRECTORY:        "directory",
+	REGION_FILE_DATA:        "file-data",
+	REGION_FILE_SLACK:       "file-slack",
+	REGION_UNOWNED_HEAP:     "unowned-heap",
+	REGION_UNALLOCATED_HEAP: "unallocated-heap",
+	REGION_PAST_HEAP:        "past-heap",
+	REGION_PAST_VOLUME:      "past-volume",
+}
+
+func (r OffsetRegion) String() string {
+	if name, ok := offsetRegionNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("region(%d)", int(r))
+}
+
+func (r OffsetRegion) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// Boot region sector names, indexed by sector within a boot region.
+var bootSectorNames = [VBR_SIZE]string{
+	"boot sector",
+	"extended boot sector 1", "extended boot sector 2", "extended boot sector 3", "extended boot sector 4",
+	"extended boot sector 5", "extended boot sector 6", "extended boot sector 7", "extended boot sector 8",
+	"OEM parameters", "reserved sector", "boot checksum",
+}
+
+// OffsetInfo explains one image offset. Sector is relative to the start of
+// the volume. Cluster is the heap cluster holding the offset; in a FAT it is
+// the cluster whose entry holds the offset and in the allocation bitmap the
+// first of the eight clusters whose bits share the byte. RegionOffset is the
+// offset within the structure: the byte within a file or directory, the
+// byte within a FAT or boot region. Claims lists every entry, live or
+// deleted, pointing at the cluster.
+type OffsetInfo struct {
+	Offset       uint64
+	Region       OffsetRegion
+	Sector       uint64
+	Cluster      uint32
+	RegionOffset uint64
+	Path         string
+	Entry        Entry
+	EntrySet     *Entry
+	Claims       []ClusterClaim
+	Description  string
+}
+
+// ExplainOffset says which structure holds an absolute image offset: the area
+// before the volume, a boot region sector, a FAT entry, the alignment gaps,
+// the allocation bitmap, the up-case table, a directory entry set, file data
+// or slack, unowned or unallocated heap, or space past the heap and the
+// volume. Heap lookups use the same cached map as ClusterOwner.
+func (e *ExFAT) ExplainOffset(off uint64) (OffsetInfo, error) {
+	v := &e.vbr
+	info := OffsetInfo{Offset: off}
+	sectorSize := uint64(v.sectorSize)
+	volumeEnd := v.vbrStart + v.volumeSize*sectorSize
+
+	if off < v.vbrStart {
+		info.Region = REGION_BEFORE_VOLUME
+		info.RegionOffset = off
+		info.Description = fmt.Sprintf("%d bytes before the volume start (MBR or partition gap)", v.vbrStart-off)
+		return info, nil
+	}
+	if off >= volumeEnd {
+		info.Region = REGION_PAST_VOLUME
+		info.RegionOffset = off - volumeEnd
+		info.Description = fmt.Sprintf("%d bytes past VolumeLength", off-volumeEnd)
+		return info, nil
+	}
+
+	rel := off - v.vbrStart
+	info.Sector = rel / sectorSize
+	fats := uint64(v.nbFats)
+	if fats == 0 {
+		fats = 1
+	}
+	fatStart := uint64(v.fatOffset) * sectorSize
+	fatBytes := uint64(v.fatSize) * sectorSize
+	heapEnd := v.dataAreaStart + uint64(v.nbClusters)*v.clusterSize
+
+	switch {
+	case info.Sector < 2*VBR_SIZE && rel < fatStart:
+		info.Region = REGION_MAIN_BOOT
+		if info.Sector >= VBR_SIZE {
+			info.Region = REGION_BACKUP_BOOT
+		}
+		info.RegionOffset = rel % (VBR_SIZE * sectorSize)
+		info.Description = fmt.Sprintf("%s, %s, byte %d", info.Region, bootSectorNames[info.Sector%VBR_SIZE], rel%sectorSize)
+	case rel < fatStart:
+		info.Region = REGION_FAT_ALIGNMENT
+		info.RegionOffset = rel - 2*VBR_SIZE*sectorSize
+		info.Description = "alignment gap between the boot regions and the FAT"
+	case rel < fatStart+fats*fatBytes:
+		index := (rel - fatStart) / fatBytes
+		info.Region = REGION_FAT1
+		if index > 0 {
+			info.Region = REGION_FAT2
+		}
+		info.RegionOffset = (rel - fatStart) % fatBytes
+		info.Cluster = uint32(info.RegionOffset / 4)
+		info.Description = fmt.Sprintf("%s entry of cluster %d, byte %d", info.Region, info.Cluster, info.RegionOffset%4)
+	case off < v.dataAreaStart:
+		info.Region = REGION_HEAP_ALIGNMENT
+		info.RegionOffset = rel - (fatStart + fats*fatBytes)
+		info.Description = "alignment gap between the FAT and the cluster heap"
+	case off >= heapEnd:
+		info.Region = REGION_PAST_HEAP
+		info.RegionOffset = off - heapEnd
+		info.Description = "inside the volume but after the last cluster of the heap"
+	default:
+		if err := e.explainHeapOffset(&info); err != nil {
+			return OffsetInfo{}, err
+		}
+	}
+	return info, nil
+}
+
+// explainHeapOffset resolves an offset inside the cluster heap through the
+// cluster map.
+func (e *ExFAT) explainHeapOffset(info *OffsetInfo) error {
+	ownership, err := e.ClusterOwnerAt(info.Offset)
+	if err != nil {
+		return err
+	}
+	info.Cluster = ownership.Cluster
+	info.Claims = ownership.Claims
+
+	owner, ok := ownership.Owner()
+	if !ok {
+		info.RegionOffset = (info.Offset - e.vbr.dataAreaStart) % e.vbr.clusterSize
+		info.Region = REGION_UNALLOCATED_HEAP
+		if ownership.Allocated {
+			info.Region = REGION_UNOWNED_HEAP
+		}
+		info.Description = fmt.Sprintf("%s, cluster %d", info.Region, info.Cluster)
+		if len(ownership.Claims) > 0 {
+			info.Path = ownership.Claims[0].Path
+			info.Entry = ownership.Claims[0].Entry
+			info.RegionOffset = ownership.Claims[0].Offset
+			info.Description += fmt.Sprintf(", once part of deleted %s at byte %d", info.Path, info.RegionOffset)
+		}
+		return nil
+	}
+
+	info.Path = owner.Path
+	info.Entry = owner.Entry
+	info.RegionOffset = owner.Offset
+	entry := owner.Entry
+	switch {
+	case entry.etype == EXFAT_DIRRECORD_BITMAP || entry.name == BITMAP:
+		info.Region = REGION_BITMAP
+		info.Cluster = uint32(owner.Offset*8 + FIRST_CLUSTER_NUMBER)
+		info.Description = fmt.Sprintf("allocation bitmap byte %d, bits of clusters %d-%d", owner.Offset, info.Cluster, info.Cluster+7)
+	case entry.etype == EXFAT_DIRRECORD_UPCASE || entry.name == UPCASE:
+		info.Region = REGION_UPCASE
+		info.Description = fmt.Sprintf("up-case table byte %d", owner.Offset)
+	case entry.IsDir():
+		info.Region = REGION_DIRECTORY
+		info.Description = fmt.Sprintf("directory %s, record %d", owner.Path, owner.Offset/EXFAT_DIRRECORD_SIZE)
+		set, err := e.entrySetAt(owner, info.Offset-info.Offset%EXFAT_DIRRECORD_SIZE)
+		if err != nil {
+			return err
+		}
+		if set != nil {
+			info.EntrySet = set
+			info.Description += fmt.Sprintf(", entry set of %s", set.Path())
+		}
+	case owner.Offset < entry.dataLen:
+		info.Region = REGION_FILE_DATA
+		info.Description = fmt.Sprintf("%s byte %d", owner.Path, owner.Offset)
+		if owner.Offset >= entry.validDataLen {
+			info.Description += " (past ValidDataLength)"
+		}
+	default:
+		info.Region = REGION_FILE_SLACK
+		info.Description = fmt.Sprintf("%s slack, %d bytes past DataLength", owner.Path, owner.Offset-entry.dataLen)
+	}
+	return nil
+}
+
+// entrySetAt reads the directory owning a record and returns the entry whose
+// set includes the record at recOffset.
+func (e *ExFAT) entrySetAt(dir ClusterClaim, recOffset uint64) (*Entry, error) {
+	var entries []Entry
+	var err error
+	if dir.Path == "/" {
+		entries, err = e.ReadRootDir()
+	} else {
+		entries, err = e.ReadDir(dir.Entry)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		for _, offset := range entries[i].recordOffsets {
+			if offset == recOffset {
+				return &entries[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
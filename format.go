@@ -0,0 +1,335 @@
+package libxfat
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"time"
+	"unicode/utf16"
+)
+
+// FormatOptions configures Format. Zero fields take their defaults.
+type FormatOptions struct {
+	// SectorSize is 512, 1024, 2048 or 4096 bytes. Defaults to 512.
+	SectorSize uint32
+	// ClusterSize is a power of two from the sector size up to 32 MiB. The
+	// default follows Windows: 4 KiB up to 256 MiB, 32 KiB up to 32 GiB and
+	// 128 KiB above.
+	ClusterSize uint32
+	// Alignment is the boundary, in bytes, the FAT and the cluster heap start
+	// on. A multiple of the sector size; defaults to the cluster size.
+	Alignment uint32
+	// Label is the volume label, at most 11 UTF-16 units.
+	Label string
+	// Serial is the volume serial number. Zero derives one from the time.
+	Serial uint32
+	// GUID is the volume GUID. Zero generates a random one.
+	GUID [16]byte
+	// NumberOfFats is 1 or 2. Defaults to 1.
+	NumberOfFats byte
+}
+
+// formatLayout is the geometry Format computed from the volume size and the
+// options. Offsets and lengths are in sectors.
+type formatLayout struct {
+	sectorSize        uint32
+	sectorsPerCluster uint32
+	volumeSectors     uint64
+	fatOffset         uint32
+	fatLength         uint32
+	heapOffset        uint32
+	clusterCount      uint32
+	nbFats            byte
+}
+
+func (l formatLayout) clusterSize() uint64 {
+	return uint64(l.sectorSize) * uint64(l.sectorsPerCluster)
+}
+
+func (l formatLayout) clusterOffset(cluster uint32) int64 {
+	return int64(l.heapOffset)*int64(l.sectorSize) + int64(cluster-uint32(FIRST_CLUSTER_NUMBER))*int64(l.clusterSize())
+}
+
+// clustersFor returns the number of clusters needed to hold n bytes.
+func (l formatLayout) clustersFor(n uint64) uint32 {
+	return uint32((n + l.clusterSize() - 1) / l.clusterSize())
+}
+
+// Format writes an empty exFAT volume of size bytes to w. The volume gets a
+// main and a backup boot region with a valid boot checksum, one or two FATs,
+// an allocation bitmap, the compressed up-case table and a root directory
+// holding the label, bitmap, up-case and volume GUID entries. The metadata
+// area up to the cluster heap is zeroed; the heap itself is not, apart from
+// the clusters Format uses.
+func Format(w io.WriterAt, size int64, opts ...FormatOptions) error {
+	var options FormatOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	layout, err := newFormatLayout(size, options)
+	if err != nil {
+		return err
+	}
+	label := utf16.Encode([]rune(options.Label))
+	if len(label) > EXFAT_MAX_LABEL_LENGTH {
+		return fmt.Errorf("%w: label longer than %d characters", ErrInvalidFormatOptions, EXFAT_MAX_LABEL_LENGTH)
+	}
+
+	upcase := defaultUpcaseTable()
+	bitmapBytes := (uint64(layout.clusterCount) + 7) / 8
+	bitmapCluster := uint32(FIRST_CLUSTER_NUMBER)
+	upcaseCluster := bitmapCluster + layout.clustersFor(bitmapBytes)
+	rootCluster := upcaseCluster + layout.clustersFor(uint64(len(upcase)))
+	used := rootCluster + 1 - uint32(FIRST_CLUSTER_NUMBER)
+	if used > layout.clusterCount {
+		return fmt.Errorf("%w: volume too small for its metadata", ErrInvalidFormatOptions)
+	}
+
+	serial := options.Serial
+	if serial == 0 {
+		now := time.Now()
+		serial = uint32(now.Unix()) ^ uint32(now.Nanosecond())
+	}
+	guid := options.GUID
+	if guid == [16]byte{} {
+		if _, err := rand.Read(guid[:]); err != nil {
+			return err
+		}
+		guid[7] = guid[7]&0x0f | 0x40
+		guid[8] = guid[8]&0x3f | 0x80
+	}
+
+	sectorSize := int64(layout.sectorSize)
+	if err := writeZeros(w, 0, int64(layout.heapOffset)*sectorSize); err != nil {
+		return err
+	}
+	if _, err := w.WriteAt(make([]byte, sectorSize), int64(layout.volumeSectors-1)*sectorSize); err != nil {
+		return err
+	}
+
+	region := buildBootRegion(layout, serial, byte(uint64(used)*100/uint64(layout.clusterCount)), rootCluster)
+	for i := int64(0); i < 2; i++ {
+		if _, err := w.WriteAt(region, i*VBR_SIZE*sectorSize); err != nil {
+			return err
+		}
+	}
+
+	fat := make([]byte, 4*(rootCluster+1))
+	binary.LittleEndian.PutUint32(fat[0:], 0xfffffff8)
+	binary.LittleEndian.PutUint32(fat[4:], 0xffffffff)
+	for _, chain := range [][2]uint32{{bitmapCluster, upcaseCluster}, {upcaseCluster, rootCluster}, {rootCluster, rootCluster + 1}} {
+		for cluster := chain[0]; cluster < chain[1]; cluster++ {
+			next := cluster + 1
+			if next == chain[1] {
+				next = EXFAT_EOF_END
+			}
+			binary.LittleEndian.PutUint32(fat[4*cluster:], next)
+		}
+	}
+	for i := int64(0); i < int64(layout.nbFats); i++ {
+		if _, err := w.WriteAt(fat, (int64(layout.fatOffset)+i*int64(layout.fatLength))*sectorSize); err != nil {
+			return err
+		}
+	}
+
+	bitmap := make([]byte, (used+7)/8)
+	for index := uint32(0); index < used; index++ {
+		bitmap[index/8] |= 1 << (index % 8)
+	}
+	bitmapOffset := layout.clusterOffset(bitmapCluster)
+	if err := writeZeros(w, bitmapOffset, int64(upcaseCluster-bitmapCluster)*int64(layout.clusterSize())); err != nil {
+		return err
+	}
+	if _, err := w.WriteAt(bitmap, bitmapOffset); err != nil {
+		return err
+	}
+
+	upcaseData := make([]byte, uint64(rootCluster-upcaseCluster)*layout.clusterSize())
+	copy(upcaseData, upcase)
+	if _, err := w.WriteAt(upcaseData, layout.clusterOffset(upcaseCluster)); err != nil {
+		return err
+	}
+
+	root := make([]byte, layout.clusterSize())
+	labelEntry := VolumeLabelEntry{EntryType: EXFAT_DIRRECORD_NOLABEL}
+	if len(label) > 0 {
+		labelEntry.EntryType = EXFAT_DIRRECORD_LABEL
+		labelEntry.CharacterCount = byte(len(label))
+		copy(labelEntry.VolumeLabel[:], label)
+	}
+	guidEntry := VolumeGuidEntry{EntryType: EXFAT_DIRRECORD_VOLUME_GUID, VolumeGuid: guid}
+	guidRecord := guidEntry.Encode()
+	guidEntry.SetChecksum = exfatDirSetChecksumAdd(0, guidRecord[:], true)
+	records := [][EXFAT_DIRRECORD_SIZE]byte{
+		labelEntry.Encode(),
+		AllocationBitmapEntry{EntryType: EXFAT_DIRRECORD_BITMAP, FirstCluster: bitmapCluster, DataLength: bitmapBytes}.Encode(),
+		UpcaseTableEntry{
+			EntryType:     EXFAT_DIRRECORD_UPCASE,
+			TableChecksum: upcaseTableChecksum(upcase),
+			FirstCluster:  upcaseCluster,
+			DataLength:    uint64(len(upcase)),
+		}.Encode(),
+		guidEntry.Encode(),
+	}
+	for i, record := range records {
+		copy(root[i*EXFAT_DIRRECORD_SIZE:], record[:])
+	}
+	_, err = w.WriteAt(root, layout.clusterOffset(rootCluster))
+	return err
+}
+
+// newFormatLayout checks the options and places the FATs and the cluster
+// heap. The cluster count and the FAT length depend on each other, so the
+// placement is repeated until the cluster count stops shrinking.
+func newFormatLayout(size int64, options FormatOptions) (formatLayout, error) {
+	l := formatLayout{sectorSize: options.SectorSize, nbFats: options.NumberOfFats}
+	if l.sectorSize == 0 {
+		l.sectorSize = uint32(SECTOR_SIZE)
+	}
+	if l.sectorSize < 512 || l.sectorSize > 4096 || bits.OnesCount32(l.sectorSize) != 1 {
+		return l, fmt.Errorf("%w: sector size %d", ErrInvalidFormatOptions, l.sectorSize)
+	}
+	if size < EXFAT_MIN_VOLUME_SIZE {
+		return l, fmt.Errorf("%w: volume of %d bytes is under 1 MiB", ErrInvalidFormatOptions, size)
+	}
+	if l.nbFats == 0 {
+		l.nbFats = 1
+	}
+	if l.nbFats > 2 {
+		return l, fmt.Errorf("%w: %d FATs", ErrInvalidFormatOptions, l.nbFats)
+	}
+
+	clusterSize := options.ClusterSize
+	switch {
+	case clusterSize != 0:
+	case size <= 256<<20:
+		clusterSize = 4 << 10
+	case size <= 32<<30:
+		clusterSize = 32 << 10
+	default:
+		clusterSize = 128 << 10
+	}
+	if bits.OnesCount32(clusterSize) != 1 || clusterSize < l.sectorSize || clusterSize > 32<<20 {
+		return l, fmt.Errorf("%w: cluster size %d", ErrInvalidFormatOptions, clusterSize)
+	}
+	l.sectorsPerCluster = clusterSize / l.sectorSize
+
+	alignment := options.Alignment
+	if alignment == 0 {
+		alignment = clusterSize
+	}
+	if alignment%l.sectorSize != 0 {
+		return l, fmt.Errorf("%w: alignment %d is not a multiple of the sector size", ErrInvalidFormatOptions, alignment)
+	}
+	alignSectors := uint64(alignment / l.sectorSize)
+	alignUp := func(sector uint64) uint64 {
+		return (sector + alignSectors - 1) / alignSectors * alignSectors
+	}
+
+	l.volumeSectors = uint64(size) / uint64(l.sectorSize)
+	fatOffset := alignUp(2 * VBR_SIZE)
+	clusterCount := l.volumeSectors / uint64(l.sectorsPerCluster)
+	for {
+		fatLength := (4*(clusterCount+FIRST_CLUSTER_NUMBER) + uint64(l.sectorSize) - 1) / uint64(l.sectorSize)
+		heapOffset := alignUp(fatOffset + uint64(l.nbFats)*fatLength)
+		if heapOffset >= l.volumeSectors || heapOffset > 0xffffffff {
+			return l, fmt.Errorf("%w: volume too small for its FAT", ErrInvalidFormatOptions)
+		}
+		count := min((l.volumeSectors-heapOffset)/uint64(l.sectorsPerCluster), EXFAT_MAX_CLUSTER_COUNT)
+		l.fatOffset, l.fatLength, l.heapOffset = uint32(fatOffset), uint32(fatLength), uint32(heapOffset)
+		if count >= clusterCount {
+			break
+		}
+		clusterCount = count
+	}
+	if clusterCount == 0 {
+		return l, fmt.Errorf("%w: no room for a cluster heap", ErrInvalidFormatOptions)
+	}
+	l.clusterCount = uint32(clusterCount)
+	return l, nil
+}
+
+// buildBootRegion lays out one boot region: the boot sector, eight extended
+// boot sectors, the OEM parameters and reserved sectors, and the checksum
+// sector.
+func buildBootRegion(l formatLayout, serial uint32, percentInUse byte, rootCluster uint32) []byte {
+	sectorSize := int(l.sectorSize)
+	region := make([]byte, VBR_SIZE*sectorSize)
+
+	boot := region[:sectorSize]
+	copy(boot[0:3], []byte{0xeb, 0x76, 0x90})
+	copy(boot[EXFAT_SIGN_OFFSET:], EXFAT_SIGNATURE)
+	binary.LittleEndian.PutUint64(boot[EXFAT_VOLSIZE_OFFSET:], l.volumeSectors)
+	binary.LittleEndian.PutUint32(boot[EXFAT_FAT1_OFFSET:], l.fatOffset)
+	binary.LittleEndian.PutUint32(boot[EXFAT_FATSIZE_OFFSET:], l.fatLength)
+	binary.LittleEndian.PutUint32(boot[EXFAT_DATA_OFFSET:], l.heapOffset)
+	binary.LittleEndian.PutUint32(boot[EXFAT_NB_CLUSTERS:], l.clusterCount)
+	binary.LittleEndian.PutUint32(boot[EXFAT_ROOT_CLUSTER_OFFSET:], rootCluster)
+	binary.LittleEndian.PutUint32(boot[EXFAT_SN_OFFSET:], serial)
+	binary.LittleEndian.PutUint16(boot[EXFAT_VERSION_OFFSET:], 0x0100)
+	boot[EXFAT_SECTOR_SIZE_OFFSET] = byte(bits.TrailingZeros32(l.sectorSize))
+	boot[EXFAT_CLUSTER_SIZE_OFFSET] = byte(bits.TrailingZeros32(l.sectorsPerCluster))
+	boot[EXFAT_NB_FATS_OFFSET] = l.nbFats
+	boot[EXFAT_DRIVE_SELECT_OFFSET] = 0x80
+	boot[EXFAT_PERCENT_USE_OFFSET] = percentInUse
+	binary.BigEndian.PutUint16(boot[SYNC_OFFSET:], SYNC_VALUE)
+
+	for sector := 1; sector <= 8; sector++ {
+		end := (sector + 1) * sectorSize
+		binary.BigEndian.PutUint32(region[end-4:end], SYNC_VALUE)
+	}
+
+	checksum := bootChecksum(region[:(VBR_SIZE-1)*sectorSize])
+	for off := (VBR_SIZE - 1) * sectorSize; off < len(region); off += 4 {
+		binary.LittleEndian.PutUint32(region[off:], checksum)
+	}
+	return region
+}
+
+// bootChecksum computes the boot region checksum over the first eleven
+// sectors. VolumeFlags and PercentInUse change during use and are left out.
+func bootChecksum(sectors []byte) uint32 {
+	var checksum uint32
+	for i, b := range sectors {
+		if i == EXFAT_VOLUME_FLAGS_OFFSET || i == EXFAT_VOLUME_FLAGS_OFFSET+1 || i == EXFAT_PERCENT_USE_OFFSET {
+			continue
+		}
+		checksum = bits.RotateLeft32(checksum, -1) + uint32(b)
+	}
+	return checksum
+}
+
+// upcaseTableChecksum computes the TableChecksum of an up-case table entry.
+func upcaseTableChecksum(table []byte) uint32 {
+	var checksum uint32
+	for _, b := range table {
+		checksum = bits.RotateLeft32(checksum, -1) + uint32(b)
+	}
+	return checksum
+}
+
+// defaultUpcaseTable returns the up-case table Format writes, the one the
+// specification recommends, as little-endian bytes.
+func defaultUpcaseTable() []byte {
+	table := make([]byte, 2*len(defaultUpcase))
+	for i, unit := range defaultUpcase {
+		binary.LittleEndian.PutUint16(table[2*i:], unit)
+	}
+	return table
+}
+
+// writeZeros zeroes n bytes of w from off, a chunk at a time.
+func writeZeros(w io.WriterAt, off, n int64) error {
+	zeros := make([]byte, min(n, 1<<20))
+	for n > 0 {
+		chunk := min(n, int64(len(zeros)))
+		if _, err := w.WriteAt(zeros[:chunk], off); err != nil {
+			return err
+		}
+		off += chunk
+		n -= chunk
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package libxfat
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestDefaultUpcaseTableCoversEveryUnit(t *testing.T) {
+	table := defaultUpcaseTable()
+	var expanded []uint16
+	for i := 0; i+1 < len(table); i += 2 {
+		unit := binary.LittleEndian.Uint16(table[i:])
+		if unit == 0xffff && i+3 < len(table) {
+			run := int(binary.LittleEndian.Uint16(table[i+2:]))
+			for n := 0; n < run; n++ {
+				expanded = append(expanded, uint16(len(expanded)))
+			}
+			i += 2
+			continue
+		}
+		expanded = append(expanded, unit)
+	}
+
+	if len(expanded) != 1<<16 {
+		t.Fatalf("expanded table has %d units, want 65536", len(expanded))
+	}
+	for unit, want := range map[uint16]uint16{'a': 'A', 'z': 'Z', 'A': 'A', 0xe9: 0xc9, 0xff: 0x178, '0': '0', 0xb5: 0xb5, 0x1fcc: 0x1fc3} {
+		if expanded[unit] != want {
+			t.Fatalf("table[%#x] = %#x, want %#x", unit, expanded[unit], want)
+		}
+	}
+}
+
+func TestDefaultUpcaseTableIsTheRecommendedOne(t *testing.T) {
+	table := defaultUpcaseTable()
+	if len(table) != 5836 {
+		t.Fatalf("table is %d bytes, want 5836", len(table))
+	}
+	if checksum := upcaseTableChecksum(table); checksum != 0xE619D30D {
+		t.Fatalf("TableChecksum = %#08x, want 0xE619D30D", checksum)
+	}
+}
+
+func TestNewFormatLayout(t *testing.T) {
+	for _, size := range []int64{1 << 20, 7<<20 + 3*512, 300 << 20, 40 << 30} {
+		l, err := newFormatLayout(size, FormatOptions{})
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if l.fatOffset < 2*VBR_SIZE {
+			t.Fatalf("size %d: FAT at sector %d overlaps the boot regions", size, l.fatOffset)
+		}
+		if uint64(l.fatLength)*uint64(l.sectorSize) < 4*(uint64(l.clusterCount)+2) {
+			t.Fatalf("size %d: FAT of %d sectors cannot map %d clusters", size, l.fatLength, l.clusterCount)
+		}
+		if l.heapOffset < l.fatOffset+l.fatLength {
+			t.Fatalf("size %d: heap at sector %d overlaps the FAT", size, l.heapOffset)
+		}
+		if uint64(l.heapOffset)+uint64(l.clusterCount)*uint64(l.sectorsPerCluster) > l.volumeSectors {
+			t.Fatalf("size %d: heap runs past the volume", size)
+		}
+		if heapOffsetBytes := uint64(l.heapOffset) * uint64(l.sectorSize); heapOffsetBytes%l.clusterSize() != 0 {
+			t.Fatalf("size %d: heap at %d not aligned to the cluster size", size, heapOffsetBytes)
+		}
+	}
+}
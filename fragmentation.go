@@ -0,0 +1,142 @@
+package libxfat
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// FileFragmentation describes how one entry's data is laid out on the heap.
+// Gaps[i] is the distance in clusters from the end of Runs[i] to the start of
+// Runs[i+1]; it is negative when the chain jumps backwards.
+type FileFragmentation struct {
+	Entry      Entry
+	Path       string
+	Runs       []Run
+	Fragments  int
+	Gaps       []int64
+	NoFatChain bool
+}
+
+// IsFragmented reports whether the data is split over more than one run.
+func (f FileFragmentation) IsFragmented() bool {
+	return f.Fragments > 1
+}
+
+// FragmentSizeBucket counts runs whose length in clusters lies in
+// [MinClusters, MaxClusters].
+type FragmentSizeBucket struct {
+	MinClusters uint32
+	MaxClusters uint32
+	Count       int
+}
+
+// VolumeFragmentation summarises the layout of every live file and
+// directory. Ratio is the share of entries with data that are fragmented.
+// Unreadable counts entries whose chain could not be followed.
+type VolumeFragmentation struct {
+	Entries         int
+	FragmentedFiles int
+	TotalFragments  int
+	NoFatChainFiles int
+	Unreadable      int
+	Ratio           float64
+	MostFragmented  []FileFragmentation
+	FragmentSizes   []FragmentSizeBucket
+}
+
+// AnalyzeFileFragmentation reports the runs, fragment count and gaps of one
+// entry.
+func (e *ExFAT) AnalyzeFileFragmentation(entry Entry) (FileFragmentation, error) {
+	runs, err := e.vbr.getClusterRuns(entry)
+	if err != nil {
+		return FileFragmentation{}, err
+	}
+
+	analysis := FileFragmentation{
+		Entry:      entry,
+		Path:       entry.Path(),
+		Runs:       runs,
+		Fragments:  len(runs),
+		NoFatChain: entry.noFatChain,
+	}
+	for i := 1; i < len(runs); i++ {
+		analysis.Gaps = append(analysis.Gaps, int64(runs[i].Start)-int64(runs[i-1].End()))
+	}
+	return analysis, nil
+}
+
+// AnalyzeFragmentation walks the tree and analyses every live file and
+// directory that holds data. MostFragmented keeps the top entries by
+// fragment count, at most top of them.
+func (e *ExFAT) AnalyzeFragmentation(top int) (VolumeFragmentation, error) {
+	var volume VolumeFragmentation
+	var fragmented []FileFragmentation
+	histogram := map[int]int{}
+
+	err := e.walkTree(func(entry Entry) error {
+		if !entry.IsValid() || entry.IsSpecialFile() || entry.IsDeleted() || entry.dataLen == 0 {
+			return nil
+		}
+
+		analysis, err := e.AnalyzeFileFragmentation(entry)
+		if err != nil {
+			volume.Unreadable++
+			return nil
+		}
+
+		volume.Entries++
+		volume.TotalFragments += analysis.Fragments
+		if analysis.NoFatChain {
+			volume.NoFatChainFiles++
+		}
+		if analysis.IsFragmented() {
+			volume.FragmentedFiles++
+			fragmented = append(fragmented, analysis)
+		}
+		for _, run := range analysis.Runs {
+			histogram[bits.Len32(run.Length)-1]++
+		}
+		return nil
+	}, func(Entry, []Diagnostic, error) error {
+		return nil
+	})
+	if err != nil {
+		return VolumeFragmentation{}, err
+	}
+
+	if volume.Entries > 0 {
+		volume.Ratio = float64(volume.FragmentedFiles) / float64(volume.Entries)
+	}
+
+	sort.SliceStable(fragmented, func(i, j int) bool {
+		return fragmented[i].Fragments > fragmented[j].Fragments
+	})
+	if top >= 0 && len(fragmented) > top {
+		fragmented = fragmented[:top]
+	}
+	volume.MostFragmented = fragmented
+	volume.FragmentSizes = fragmentSizeBuckets(histogram)
+
+	return volume, nil
+}
+
+// fragmentSizeBuckets turns a histogram keyed by floor(log2(run length)) into
+// power-of-two buckets ordered by size.
+func fragmentSizeBuckets(histogram map[int]int) []FragmentSizeBucket {
+	var exponents []int
+	for exponent := range histogram {
+		exponents = append(exponents, exponent)
+	}
+	sort.Ints(exponents)
+
+	buckets := make([]FragmentSizeBucket, 0, len(exponents))
+	for _, exponent := range exponents {
+		min := uint32(1) << exponent
+		buckets = append(buckets, FragmentSizeBucket{
+			MinClusters: min,
+			MaxClusters: min + (min - 1),
+			Count:       histogram[exponent],
+		})
+	}
+	return buckets
+}
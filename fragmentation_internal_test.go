@@ -0,0 +1,37 @@
+package libxfat
+
+import "testing"
+
+func TestAnalyzeFileFragmentationReportsGaps(t *testing.T) {
+	vbr := newTestVBRWithFAT(t, map[uint32]uint32{
+		6: 7,
+		7: 2,
+		2: 4,
+		4: EXFAT_EOF_END,
+	})
+	vbr.clusterSize = 512
+	exfat := ExFAT{vbr: vbr}
+
+	analysis, err := exfat.AnalyzeFileFragmentation(Entry{entryCluster: 6, dataLen: 4 * 512})
+	if err != nil {
+		t.Fatalf("AnalyzeFileFragmentation() error = %v", err)
+	}
+	if analysis.Fragments != 3 || !analysis.IsFragmented() {
+		t.Fatalf("fragments = %d, want 3", analysis.Fragments)
+	}
+	want := []int64{-6, 1}
+	if len(analysis.Gaps) != 2 || analysis.Gaps[0] != want[0] || analysis.Gaps[1] != want[1] {
+		t.Fatalf("gaps = %v, want %v", analysis.Gaps, want)
+	}
+}
+
+func TestFragmentSizeBuckets(t *testing.T) {
+	buckets := fragmentSizeBuckets(map[int]int{3: 1, 0: 4})
+	want := []FragmentSizeBucket{
+		{MinClusters: 1, MaxClusters: 1, Count: 4},
+		{MinClusters: 8, MaxClusters: 15, Count: 1},
+	}
+	if len(buckets) != len(want) || buckets[0] != want[0] || buckets[1] != want[1] {
+		t.Fatalf("fragmentSizeBuckets() = %v, want %v", buckets, want)
+	}
+}
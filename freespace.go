@@ -0,0 +1,120 @@
+package libxfat
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// FreeSpaceRegion reports the free clusters of one slice of the heap,
+// covering Length clusters from Start.
+type FreeSpaceRegion struct {
+	Start  uint32
+	Length uint32
+	Free   uint32
+}
+
+// FreeSpace describes the unallocated part of the cluster heap as the
+// allocation bitmap records it. Histogram buckets free runs by length in
+// clusters, using the same power-of-two buckets as fragmentation analysis.
+type FreeSpace struct {
+	Clusters          uint32
+	AllocatedClusters uint32
+	FreeClusters      uint32
+	FreeRuns          []Run
+	LargestFreeRun    Run
+	Histogram         []FragmentSizeBucket
+	Regions           []FreeSpaceRegion
+}
+
+// GetFreeRuns returns the free extents of the heap in cluster order. The
+// bitmap is read on demand, so it can be called at any time.
+func (e *ExFAT) GetFreeRuns() ([]Run, error) {
+	bitmap, err := e.loadBitmap()
+	if err != nil {
+		return nil, err
+	}
+	return bitmap.freeRuns(), nil
+}
+
+// GetLargestFreeRun returns the longest free extent, or a zero Run when the
+// heap is full.
+func (e *ExFAT) GetLargestFreeRun() (Run, error) {
+	runs, err := e.GetFreeRuns()
+	if err != nil {
+		return Run{}, err
+	}
+	return largestRun(runs), nil
+}
+
+// AnalyzeFreeSpace reads the bitmap and reports free extents, the largest
+// one, a histogram of their lengths and how much is free in each of regions
+// equal slices of the heap (at least one).
+func (e *ExFAT) AnalyzeFreeSpace(regions int) (FreeSpace, error) {
+	bitmap, err := e.loadBitmap()
+	if err != nil {
+		return FreeSpace{}, err
+	}
+
+	space := FreeSpace{
+		Clusters:          e.vbr.nbClusters,
+		AllocatedClusters: bitmap.allocatedCount(),
+		FreeRuns:          bitmap.freeRuns(),
+	}
+	space.FreeClusters = space.Clusters - space.AllocatedClusters
+	space.LargestFreeRun = largestRun(space.FreeRuns)
+
+	histogram := map[int]int{}
+	for _, run := range space.FreeRuns {
+		histogram[bits.Len32(run.Length)-1]++
+	}
+	space.Histogram = fragmentSizeBuckets(histogram)
+	space.Regions = freeSpaceRegions(space.FreeRuns, e.vbr.nbClusters, regions)
+
+	return space, nil
+}
+
+func largestRun(runs []Run) Run {
+	var largest Run
+	for _, run := range runs {
+		if run.Length > largest.Length {
+			largest = run
+		}
+	}
+	return largest
+}
+
+// freeSpaceRegions splits the heap into count slices and adds up the free
+// runs falling into each one. The last slice absorbs the remainder.
+func freeSpaceRegions(runs []Run, nbClusters uint32, count int) []FreeSpaceRegion {
+	if count < 1 {
+		count = 1
+	}
+	if uint32(count) > nbClusters && nbClusters > 0 {
+		count = int(nbClusters)
+	}
+
+	size := nbClusters / uint32(count)
+	regions := make([]FreeSpaceRegion, count)
+	for i := range regions {
+		regions[i].Start = uint32(FIRST_CLUSTER_NUMBER) + uint32(i)*size
+		regions[i].Length = size
+	}
+	regions[count-1].Length = nbClusters - uint32(count-1)*size
+
+	for _, run := range runs {
+		first := sort.Search(len(regions), func(i int) bool {
+			return regions[i].Start+regions[i].Length > run.Start
+		})
+		for i := first; i < len(regions) && regions[i].Start < run.End(); i++ {
+			start, end := run.Start, run.End()
+			if start < regions[i].Start {
+				start = regions[i].Start
+			}
+			if regionEnd := regions[i].Start + regions[i].Length; end > regionEnd {
+				end = regionEnd
+			}
+			regions[i].Free += end - start
+		}
+	}
+	return regions
+}
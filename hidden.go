@@ -0,0 +1,497 @@
+package libxfat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// HiddenAreaKind names an area of the volume the parser never reads but that
+// can carry data.
+type HiddenAreaKind int
+
+const (
+	// HIDDEN_BOOT_MUST_BE_ZERO: the MustBeZero field of a boot sector (0x0B-0x3F).
+	HIDDEN_BOOT_MUST_BE_ZERO HiddenAreaKind = iota + 1
+	// HIDDEN_BOOT_SECTOR_SLACK: boot sector bytes past 512 on larger sectors.
+	HIDDEN_BOOT_SECTOR_SLACK
+	// HIDDEN_EXTENDED_BOOT: extended boot sectors, less their signature.
+	HIDDEN_EXTENDED_BOOT
+	// HIDDEN_OEM_PARAMETERS: the OEM parameters sector.
+	HIDDEN_OEM_PARAMETERS
+	// HIDDEN_BOOT_RESERVED: the reserved sector of a boot region.
+	HIDDEN_BOOT_RESERVED
+	// HIDDEN_FAT_ALIGNMENT: between the boot regions and the first FAT.
+	HIDDEN_FAT_ALIGNMENT
+	// HIDDEN_FAT_TAIL: FAT entries past the last cluster of the heap.
+	HIDDEN_FAT_TAIL
+	// HIDDEN_HEAP_ALIGNMENT: between the FATs and the cluster heap.
+	HIDDEN_HEAP_ALIGNMENT
+	// HIDDEN_BITMAP_TAIL: bitmap bits and bytes past the last cluster,
+	// through the end of the bitmap's clusters.
+	HIDDEN_BITMAP_TAIL
+	// HIDDEN_PAST_HEAP: inside VolumeLength but after the cluster heap.
+	HIDDEN_PAST_HEAP
+	// HIDDEN_PAST_VOLUME: between VolumeLength and the end of the image.
+	HIDDEN_PAST_VOLUME
+	// HIDDEN_DIRECTORY_RESERVED: reserved fields of directory records.
+	HIDDEN_DIRECTORY_RESERVED
+	// HIDDEN_NAME_PADDING: file name or volume label characters past the
+	// recorded length.
+	HIDDEN_NAME_PADDING
+	// HIDDEN_DIRECTORY_UNUSED: unused (type 0x00) directory records and any
+	// record past the first of them, where the directory ends.
+	HIDDEN_DIRECTORY_UNUSED
+)
+
+var hiddenAreaKindNames = map[HiddenAreaKind]string{
+	HIDDEN_BOOT_MUST_BE_ZERO:  "boot-must-be-zero",
+	HIDDEN_BOOT_SECTOR_SLACK:  "boot-sector-slack",
+	HIDDEN_EXTENDED_BOOT:      "extended-boot",
+	HIDDEN_OEM_PARAMETERS:     "oem-parameters",
+	HIDDEN_BOOT_RESERVED:      "boot-reserved",
+	HIDDEN_FAT_ALIGNMENT:      "fat-alignment",
+	HIDDEN_FAT_TAIL:           "fat-tail",
+	HIDDEN_HEAP_ALIGNMENT:     "heap-alignment",
+	HIDDEN_BITMAP_TAIL:        "bitmap-tail",
+	HIDDEN_PAST_HEAP:          "past-heap",
+	HIDDEN_PAST_VOLUME:        "past-volume",
+	HIDDEN_DIRECTORY_RESERVED: "directory-reserved",
+	HIDDEN_NAME_PADDING:       "name-padding",
+	HIDDEN_DIRECTORY_UNUSED:   "directory-unused",
+}
+
+func (k HiddenAreaKind) String() string {
+	if name, ok := hiddenAreaKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("hidden(%d)", int(k))
+}
+
+func (k HiddenAreaKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// HiddenArea is a non-standard area holding non-zero bytes. Offset and Length
+// give its absolute location in the image; FirstNonZero is the offset of the
+// first non-zero byte and NonZeroBytes how many there are. Path names the
+// directory for record-level areas. For the last bitmap byte only the bits
+// past the last cluster are counted, but the whole byte is extracted.
+type HiddenArea struct {
+	Kind         HiddenAreaKind
+	Offset       uint64
+	Length       uint64
+	FirstNonZero uint64
+	NonZeroBytes uint64
+	Path         string
+	Description  string
+}
+
+// HiddenDataReport lists the areas found with data. ScannedAreas and
+// ScannedBytes count everything that was examined. Unreadable lists the
+// directories that could not be read, in whole or in part; the records
+// before the damage are scanned.
+type HiddenDataReport struct {
+	Areas        []HiddenArea
+	ScannedAreas int
+	ScannedBytes uint64
+	Unreadable   []Finding
+}
+
+// hiddenScanner reads candidate areas and keeps the ones holding data.
+type hiddenScanner struct {
+	e      *ExFAT
+	report HiddenDataReport
+	buf    []byte
+}
+
+const hiddenScanChunk = 1 << 20
+
+// ScanHiddenData checks the areas of the volume the parser never reads for
+// non-zero content: the MustBeZero field, extended boot sectors, OEM
+// parameters and reserved sector of both boot regions, the alignment gaps
+// before the FAT and before the heap, FAT entries past the last cluster, the
+// bitmap past the last cluster, space past the heap and past VolumeLength,
+// and the reserved fields, name padding and unused records of every live
+// directory. Boot sectors overlapping the FAT on undersized volumes are
+// skipped.
+func (e *ExFAT) ScanHiddenData() (HiddenDataReport, error) {
+	v := &e.vbr
+	s := &hiddenScanner{e: e, buf: make([]byte, hiddenScanChunk)}
+	sectorSize := uint64(v.sectorSize)
+	fatStart := uint64(v.fatOffset) * sectorSize
+	fats := uint64(v.nbFats)
+	if fats == 0 {
+		fats = 1
+	}
+	fatBytes := uint64(v.fatSize) * sectorSize
+
+	if err := s.scanBootRegions(fatStart); err != nil {
+		return HiddenDataReport{}, err
+	}
+
+	if fatStart > 2*VBR_SIZE*sectorSize {
+		if err := s.scan(HIDDEN_FAT_ALIGNMENT, v.vbrStart+2*VBR_SIZE*sectorSize, fatStart-2*VBR_SIZE*sectorSize, "", "gap before the first FAT"); err != nil {
+			return HiddenDataReport{}, err
+		}
+	}
+
+	usedEntries := (uint64(v.nbClusters) + FIRST_CLUSTER_NUMBER) * 4
+	for i := uint64(0); i < fats && usedEntries < fatBytes; i++ {
+		start := v.vbrStart + fatStart + i*fatBytes
+		desc := fmt.Sprintf("FAT%d entries from cluster %d", i+1, uint64(v.nbClusters)+FIRST_CLUSTER_NUMBER)
+		if err := s.scan(HIDDEN_FAT_TAIL, start+usedEntries, fatBytes-usedEntries, "", desc); err != nil {
+			return HiddenDataReport{}, err
+		}
+	}
+
+	if fatsEnd := v.vbrStart + fatStart + fats*fatBytes; v.dataAreaStart > fatsEnd {
+		if err := s.scan(HIDDEN_HEAP_ALIGNMENT, fatsEnd, v.dataAreaStart-fatsEnd, "", "gap between the FAT and the cluster heap"); err != nil {
+			return HiddenDataReport{}, err
+		}
+	}
+
+	if err := s.scanBitmapTail(); err != nil {
+		return HiddenDataReport{}, err
+	}
+
+	heapEnd := v.dataAreaStart + uint64(v.nbClusters)*v.clusterSize
+	volumeEnd := v.vbrStart + v.volumeSize*sectorSize
+	if volumeEnd > heapEnd {
+		if err := s.scan(HIDDEN_PAST_HEAP, heapEnd, volumeEnd-heapEnd, "", "space after the cluster heap"); err != nil {
+			return HiddenDataReport{}, err
+		}
+	}
+	size, err := imageSize(v.dimage)
+	if err != nil {
+		return HiddenDataReport{}, err
+	}
+	if imageEnd := uint64(size); imageEnd > volumeEnd {
+		if err := s.scan(HIDDEN_PAST_VOLUME, volumeEnd, imageEnd-volumeEnd, "", "space past VolumeLength"); err != nil {
+			return HiddenDataReport{}, err
+		}
+	}
+
+	if err := s.scanDirectories(); err != nil {
+		return HiddenDataReport{}, err
+	}
+	return s.report, nil
+}
+
+// OpenHiddenArea returns a reader over the bytes of area.
+func (e *ExFAT) OpenHiddenArea(area HiddenArea) *io.SectionReader {
+	return io.NewSectionReader(e.vbr.dimage, int64(area.Offset), int64(area.Length))
+}
+
+// ExtractHiddenArea copies the bytes of area to dstpath.
+func (e *ExFAT) ExtractHiddenArea(area HiddenArea, dstpath string) error {
+	dstfile, err := os.Create(dstpath)
+	if err != nil {
+		return err
+	}
+	defer dstfile.Close()
+
+	_, err = io.Copy(dstfile, e.OpenHiddenArea(area))
+	return err
+}
+
+// bootSpan is a byte range of a boot region; desc takes the region name.
+type bootSpan struct {
+	kind       HiddenAreaKind
+	start, end uint64
+	desc       string
+}
+
+// scanBootRegions scans the unused parts of both boot regions, stopping at
+// the first FAT.
+func (s *hiddenScanner) scanBootRegions(fatStart uint64) error {
+	v := &s.e.vbr
+	sectorSize := uint64(v.sectorSize)
+	for region := uint64(0); region < 2; region++ {
+		name := "main"
+		if region > 0 {
+			name = "backup"
+		}
+		base := region * VBR_SIZE * sectorSize
+		if base >= fatStart {
+			return nil
+		}
+
+		sectors := []bootSpan{
+			{HIDDEN_BOOT_MUST_BE_ZERO, 0x0b, 0x40, "MustBeZero field of the %s boot sector"},
+			{HIDDEN_BOOT_SECTOR_SLACK, 512, sectorSize, "%s boot sector past byte 512"},
+		}
+		for i := uint64(1); i <= 8; i++ {
+			sectors = append(sectors, bootSpan{HIDDEN_EXTENDED_BOOT, i * sectorSize, (i+1)*sectorSize - 4, fmt.Sprintf("%%s extended boot sector %d", i)})
+		}
+		sectors = append(sectors,
+			bootSpan{HIDDEN_OEM_PARAMETERS, 9 * sectorSize, 10 * sectorSize, "%s OEM parameters sector"},
+			bootSpan{HIDDEN_BOOT_RESERVED, 10 * sectorSize, 11 * sectorSize, "%s reserved boot sector"},
+		)
+
+		for _, sector := range sectors {
+			end := sector.end
+			if base+end > fatStart {
+				end = fatStart - base
+			}
+			if sector.start >= end {
+				continue
+			}
+			if err := s.scan(sector.kind, v.vbrStart+base+sector.start, end-sector.start, "", fmt.Sprintf(sector.desc, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// scanBitmapTail scans the bits of the last bitmap byte past the last
+// cluster, then every byte after it through the end of the bitmap's clusters.
+func (s *hiddenScanner) scanBitmapTail() error {
+	e := s.e
+	if err := e.ensureBitmapEntry(); err != nil {
+		return err
+	}
+	runs, err := e.vbr.getClusterRuns(e.vbr.bitmapEntry)
+	if err != nil {
+		return err
+	}
+
+	nbClusters := uint64(e.vbr.nbClusters)
+	tail := (nbClusters + 7) / 8
+	if used := nbClusters % 8; used != 0 {
+		off, ok := runsByteOffset(&e.vbr, runs, tail-1)
+		if ok {
+			if err := s.scanMasked(off, ^byte(0)<<used, fmt.Sprintf("bitmap bits %d-7 of byte %d", used, tail-1)); err != nil {
+				return err
+			}
+		}
+	}
+
+	pos := uint64(0)
+	for _, run := range runs {
+		size := uint64(run.Length) * e.vbr.clusterSize
+		if pos+size > tail {
+			from := tail
+			if from < pos {
+				from = pos
+			}
+			off := e.vbr.getClusterOffset(run.Start) + from - pos
+			desc := fmt.Sprintf("bitmap bytes %d-%d past the last cluster", from, pos+size-1)
+			if err := s.scan(HIDDEN_BITMAP_TAIL, off, pos+size-from, "/"+BITMAP, desc); err != nil {
+				return err
+			}
+		}
+		pos += size
+	}
+	return nil
+}
+
+// runsByteOffset maps a byte offset inside the data held by runs to its
+// absolute image offset.
+func runsByteOffset(v *VBR, runs []Run, off uint64) (uint64, bool) {
+	for _, run := range runs {
+		size := uint64(run.Length) * v.clusterSize
+		if off < size {
+			return v.getClusterOffset(run.Start) + off, true
+		}
+		off -= size
+	}
+	return 0, false
+}
+
+// scanDirectories walks every live directory and scans its raw records.
+func (s *hiddenScanner) scanDirectories() error {
+	e := s.e
+	salvage := e.salvage
+	e.salvage = false
+	defer func() { e.salvage = salvage }()
+
+	return e.walkTree(func(Entry) error {
+		return nil
+	}, func(dir Entry, _ []Diagnostic, err error) error {
+		path := dir.Path()
+		var state recordScanState
+		visit := func(cluster uint32, data []byte) error {
+			base := e.vbr.getClusterOffset(cluster)
+			for pos := 0; pos+EXFAT_DIRRECORD_SIZE <= len(data); pos += EXFAT_DIRRECORD_SIZE {
+				s.scanRecord(&state, base+uint64(pos), data[pos:pos+EXFAT_DIRRECORD_SIZE], path)
+			}
+			return nil
+		}
+		// The clusters before the damage are scanned either way; the
+		// directory is reported once, with the error of the read.
+		var verr error
+		if dir.entryCluster == e.vbr.rootDirCluster && dir.name == "" {
+			path = "/"
+			verr = e.vbr.visitFatChain(dir.entryCluster, visit)
+		} else {
+			verr = e.vbr.visitEntryData(dir, visit)
+		}
+		if err == nil {
+			err = verr
+		}
+		if err != nil {
+			s.report.Unreadable = append(s.report.Unreadable, unreadableDirectory(dir, err))
+		}
+		return nil
+	})
+}
+
+// recordField is a byte range inside a directory record.
+type recordField struct {
+	start, end int
+}
+
+// recordScanState carries the name length of the entry set being scanned
+// into its name records, and whether the end of the directory was reached.
+type recordScanState struct {
+	nameLeft int
+	ended    bool
+}
+
+// scanRecord counts the non-zero bytes of the fields of rec no reader looks
+// at.
+func (s *hiddenScanner) scanRecord(state *recordScanState, off uint64, rec []byte, path string) {
+	var reserved []recordField
+	var padding recordField
+	kind := "record"
+
+	// Readers stop at the first 0x00 record, so whatever follows it is unused
+	// whatever its type byte says.
+	if state.ended {
+		s.addRecordArea(HIDDEN_DIRECTORY_UNUSED, off, rec, recordField{0, EXFAT_DIRRECORD_SIZE}, path, "record past the end of the directory")
+		return
+	}
+	switch rec[0] {
+	case 0x00:
+		state.ended = true
+		s.addRecordArea(HIDDEN_DIRECTORY_UNUSED, off, rec, recordField{0, EXFAT_DIRRECORD_SIZE}, path, "unused directory record")
+		return
+	case EXFAT_DIRRECORD_FILEDIR, EXFAT_DIRRECORD_DEL_FILEDIR:
+		kind = "file record"
+		reserved = []recordField{{6, 8}, {25, 32}}
+	case EXFAT_DIRRECORD_STREAM_EXT, EXFAT_DIRRECORD_DEL_STREAM_EXT:
+		kind = "stream record"
+		reserved = []recordField{{2, 3}, {6, 8}, {16, 20}}
+		state.nameLeft = int(rec[3])
+	case EXFAT_DIRRECORD_FILENAME_EXT, EXFAT_DIRRECORD_DEL_FILENAME_EXT:
+		kind = "name record"
+		used := state.nameLeft
+		if used > 15 {
+			used = 15
+		}
+		state.nameLeft -= used
+		padding = recordField{2 + used*2, EXFAT_DIRRECORD_SIZE}
+	case EXFAT_DIRRECORD_BITMAP:
+		kind = "bitmap record"
+		reserved = []recordField{{2, 20}}
+	case EXFAT_DIRRECORD_UPCASE:
+		kind = "up-case record"
+		reserved = []recordField{{1, 4}, {8, 20}}
+	case EXFAT_DIRRECORD_LABEL, EXFAT_DIRRECORD_NOLABEL:
+		kind = "volume label record"
+		reserved = []recordField{{24, 32}}
+		count := int(rec[1])
+		if count > 11 {
+			count = 11
+		}
+		padding = recordField{2 + count*2, 24}
+	case EXFAT_DIRRECORD_VOLUME_GUID:
+		kind = "volume GUID record"
+		reserved = []recordField{{22, 32}}
+	}
+
+	for _, f := range reserved {
+		s.addRecordArea(HIDDEN_DIRECTORY_RESERVED, off, rec, f, path, fmt.Sprintf("reserved bytes %d-%d of %s", f.start, f.end-1, kind))
+	}
+	if padding.end > padding.start {
+		s.addRecordArea(HIDDEN_NAME_PADDING, off, rec, padding, path, fmt.Sprintf("bytes %d-%d of %s past the name length", padding.start, padding.end-1, kind))
+	}
+}
+
+// addRecordArea records bytes start-end of a directory record when any is
+// non-zero. Unused records following each other are merged into one area.
+func (s *hiddenScanner) addRecordArea(kind HiddenAreaKind, off uint64, rec []byte, f recordField, path, desc string) {
+	s.report.ScannedAreas++
+	s.report.ScannedBytes += uint64(f.end - f.start)
+
+	area := HiddenArea{Kind: kind, Offset: off + uint64(f.start), Length: uint64(f.end - f.start), Path: path, Description: desc}
+	for i, b := range rec[f.start:f.end] {
+		if b != 0 {
+			if area.NonZeroBytes == 0 {
+				area.FirstNonZero = area.Offset + uint64(i)
+			}
+			area.NonZeroBytes++
+		}
+	}
+	if area.NonZeroBytes == 0 {
+		return
+	}
+
+	if n := len(s.report.Areas); n > 0 && kind == HIDDEN_DIRECTORY_UNUSED {
+		last := &s.report.Areas[n-1]
+		if last.Kind == kind && last.Path == path && last.Offset+last.Length == area.Offset {
+			last.Length += area.Length
+			last.NonZeroBytes += area.NonZeroBytes
+			last.Description = "unused directory records"
+			return
+		}
+	}
+	s.report.Areas = append(s.report.Areas, area)
+}
+
+// scan reads length bytes at off in chunks and keeps the area when any byte
+// is non-zero. Parts past the end of the image are ignored.
+func (s *hiddenScanner) scan(kind HiddenAreaKind, off, length uint64, path, desc string) error {
+	s.report.ScannedAreas++
+	area := HiddenArea{Kind: kind, Offset: off, Length: length, Path: path, Description: desc}
+
+	for pos := uint64(0); pos < length; {
+		chunk := s.buf
+		if rest := length - pos; rest < uint64(len(chunk)) {
+			chunk = chunk[:rest]
+		}
+		n, err := s.e.vbr.dimage.ReadAt(chunk, int64(off+pos))
+		for i, b := range chunk[:n] {
+			if b != 0 {
+				if area.NonZeroBytes == 0 {
+					area.FirstNonZero = off + pos + uint64(i)
+				}
+				area.NonZeroBytes++
+			}
+		}
+		s.report.ScannedBytes += uint64(n)
+		pos += uint64(n)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if area.NonZeroBytes > 0 {
+		s.report.Areas = append(s.report.Areas, area)
+	}
+	return nil
+}
+
+// scanMasked checks the bits of mask in the byte at off.
+func (s *hiddenScanner) scanMasked(off uint64, mask byte, desc string) error {
+	s.report.ScannedAreas++
+	s.report.ScannedBytes++
+
+	var b [1]byte
+	if _, err := s.e.vbr.dimage.ReadAt(b[:], int64(off)); err != nil {
+		return err
+	}
+	if b[0]&mask != 0 {
+		s.report.Areas = append(s.report.Areas, HiddenArea{
+			Kind: HIDDEN_BITMAP_TAIL, Offset: off, Length: 1, FirstNonZero: off, NonZeroBytes: 1,
+			Path: "/" + BITMAP, Description: desc,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package libxfat
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// readFullAt fills p from off. Like io.ReadFull, it returns io.EOF when
+// nothing could be read and io.ErrUnexpectedEOF when p was only partly filled.
+func readFullAt(image io.ReaderAt, p []byte, off int64) error {
+	_, err := io.ReadFull(io.NewSectionReader(image, off, int64(len(p))), p)
+	return err
+}
+
+// imageSize returns the size of image in bytes. Files report it through Stat
+// and in-memory images such as *bytes.Reader through Size; any other image is
+// sized by probing for its last readable byte.
+func imageSize(image io.ReaderAt) (int64, error) {
+	switch sized := image.(type) {
+	case *os.File:
+		info, err := sized.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	case interface{ Size() int64 }:
+		return sized.Size(), nil
+	}
+
+	var probe [1]byte
+	readable := func(off int64) bool {
+		n, _ := image.ReadAt(probe[:], off)
+		return n == 1
+	}
+	limit := int64(1)
+	for readable(limit - 1) {
+		if limit > 1<<62 {
+			return 0, errors.New("unable to size image")
+		}
+		limit *= 2
+	}
+	return int64(sort.Search(int(limit), func(off int) bool { return !readable(int64(off)) })), nil
+}
+
+// writeAt writes p at an absolute image offset. Images that cannot be
+// written return ErrReadOnlyImage.
+func (v *VBR) writeAt(p []byte, off uint64) error {
+	w, ok := v.dimage.(io.WriterAt)
+	if !ok {
+		return ErrReadOnlyImage
+	}
+	_, err := w.WriteAt(p, int64(off))
+	return err
+}
@@ -0,0 +1,86 @@
+package libxfat
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// splitPath returns the components of a slash separated path, ignoring empty
+// components.
+func splitPath(path string) []string {
+	var parts []string
+	for _, part := range strings.Split(path, "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// rootEntry returns an entry standing for the root directory.
+func (e *ExFAT) rootEntry() Entry {
+	return Entry{entryCluster: e.vbr.rootDirCluster, entryAttr: ENTRY_ATTR_DIR_MASK}
+}
+
+// isRootEntry reports whether entry stands for the root directory.
+func (e *ExFAT) isRootEntry(entry Entry) bool {
+	return entry.entryCluster == e.vbr.rootDirCluster && entry.name == "" && entry.etype == 0
+}
+
+// Lookup returns the live file or directory at path. Names are compared the
+// way exFAT does, through the volume's up-case table. "/" returns an entry
+// standing for the root directory.
+func (e *ExFAT) Lookup(path string) (Entry, error) {
+	upcase, err := e.loadUpcaseTable()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	current := e.rootEntry()
+	for _, part := range splitPath(path) {
+		entries, err := e.readDirOf(current)
+		if err != nil {
+			return Entry{}, err
+		}
+		child, ok := findChild(upcase, entries, part)
+		if !ok {
+			return Entry{}, fmt.Errorf("%w: %s", ErrEntryNotFound, path)
+		}
+		current = child
+	}
+	return current, nil
+}
+
+// readDirOf lists a directory, the root included.
+func (e *ExFAT) readDirOf(dir Entry) ([]Entry, error) {
+	if e.isRootEntry(dir) {
+		return e.ReadRootDir()
+	}
+	if !dir.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrNotDirectory, dir.Path())
+	}
+	return e.ReadDir(dir)
+}
+
+// findChild returns the live file or directory called name.
+func findChild(upcase upcaseTable, entries []Entry, name string) (Entry, bool) {
+	units := utf16.Encode([]rune(name))
+	for _, entry := range entries {
+		if !entry.IsValid() || entry.IsSpecialFile() {
+			continue
+		}
+		if upcase.equalFold(entryNameUnits(entry), units) {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// entryNameUnits returns the on-disk UTF-16 name of entry.
+func entryNameUnits(entry Entry) []uint16 {
+	if entry.nameLen > 0 && int(entry.nameLen) <= len(entry.rawName) {
+		return entry.rawName[:entry.nameLen]
+	}
+	return utf16.Encode([]rune(entry.Name()))
+}
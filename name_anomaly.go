@@ -0,0 +1,116 @@
+package libxfat
+
+import "strings"
+
+// NameAnomaly is a bit set of ways an entry name breaks the exFAT naming
+// rules. Tools that hide files from Explorer rely on exactly these tricks.
+type NameAnomaly uint16
+
+const (
+	// NAME_ANOMALY_ILLEGAL_CHAR: control characters or one of "*/:<>?\|.
+	NAME_ANOMALY_ILLEGAL_CHAR NameAnomaly = 1 << iota
+	// NAME_ANOMALY_UNPAIRED_SURROGATE: a UTF-16 surrogate without its partner.
+	NAME_ANOMALY_UNPAIRED_SURROGATE
+	// NAME_ANOMALY_EMBEDDED_NUL: a NUL unit inside the first NameLength units.
+	NAME_ANOMALY_EMBEDDED_NUL
+	// NAME_ANOMALY_NAME_LENGTH_MISMATCH: NameLength disagrees with the number
+	// of 0xC1 records actually present.
+	NAME_ANOMALY_NAME_LENGTH_MISMATCH
+	// NAME_ANOMALY_SECONDARY_COUNT_MISMATCH: SecondaryCount disagrees with
+	// the stream, name and vendor records actually present.
+	NAME_ANOMALY_SECONDARY_COUNT_MISMATCH
+	// NAME_ANOMALY_TRAILING_DOT_SPACE: the name ends with a dot or a space.
+	NAME_ANOMALY_TRAILING_DOT_SPACE
+)
+
+var nameAnomalyNames = []struct {
+	flag NameAnomaly
+	name string
+}{
+	{NAME_ANOMALY_ILLEGAL_CHAR, "illegal-char"},
+	{NAME_ANOMALY_UNPAIRED_SURROGATE, "unpaired-surrogate"},
+	{NAME_ANOMALY_EMBEDDED_NUL, "embedded-nul"},
+	{NAME_ANOMALY_NAME_LENGTH_MISMATCH, "name-length-mismatch"},
+	{NAME_ANOMALY_SECONDARY_COUNT_MISMATCH, "secondary-count-mismatch"},
+	{NAME_ANOMALY_TRAILING_DOT_SPACE, "trailing-dot-space"},
+}
+
+// Has reports whether every bit of flag is set.
+func (a NameAnomaly) Has(flag NameAnomaly) bool {
+	return a&flag == flag
+}
+
+func (a NameAnomaly) String() string {
+	if a == 0 {
+		return "none"
+	}
+	var names []string
+	for _, n := range nameAnomalyNames {
+		if a.Has(n.flag) {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// isIllegalNameUnit reports characters the exFAT specification forbids in
+// file names. NUL is reported separately as an embedded NUL.
+func isIllegalNameUnit(unit uint16) bool {
+	if unit > 0 && unit < 0x20 {
+		return true
+	}
+	switch unit {
+	case '"', '*', '/', ':', '<', '>', '?', '\\', '|':
+		return true
+	}
+	return false
+}
+
+func nameRecordsFor(nameLen int) int {
+	return (nameLen + 14) / 15
+}
+
+// detectNameAnomalies checks raw name units against the exFAT naming rules.
+// units holds every unit read from the 0xC1 records, including padding.
+// nameRecords counts the 0xC1 records read, those past the end of the set
+// included, and benign the vendor and other secondaries without a name.
+func detectNameAnomalies(units []uint16, nameLen, nameRecords, benign, secondaryCount int) NameAnomaly {
+	var anomalies NameAnomaly
+
+	if nameRecordsFor(nameLen) != nameRecords || nameLen == 0 {
+		anomalies |= NAME_ANOMALY_NAME_LENGTH_MISMATCH
+	}
+	if secondaryCount != 1+nameRecords+benign {
+		anomalies |= NAME_ANOMALY_SECONDARY_COUNT_MISMATCH
+	}
+
+	if nameLen < len(units) {
+		units = units[:nameLen]
+	}
+	for i := 0; i < len(units); i++ {
+		unit := units[i]
+		switch {
+		case unit == 0:
+			anomalies |= NAME_ANOMALY_EMBEDDED_NUL
+		case isIllegalNameUnit(unit):
+			anomalies |= NAME_ANOMALY_ILLEGAL_CHAR
+		case unit >= 0xD800 && unit < 0xDC00:
+			if i+1 < len(units) && units[i+1] >= 0xDC00 && units[i+1] < 0xE000 {
+				i++
+				continue
+			}
+			anomalies |= NAME_ANOMALY_UNPAIRED_SURROGATE
+		case unit >= 0xDC00 && unit < 0xE000:
+			anomalies |= NAME_ANOMALY_UNPAIRED_SURROGATE
+		}
+	}
+
+	if len(units) > 0 {
+		last := units[len(units)-1]
+		if last == '.' || last == ' ' {
+			anomalies |= NAME_ANOMALY_TRAILING_DOT_SPACE
+		}
+	}
+
+	return anomalies
+}
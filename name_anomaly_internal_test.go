@@ -0,0 +1,107 @@
+package libxfat
+
+import "testing"
+
+func TestDetectNameAnomalies(t *testing.T) {
+	tests := []struct {
+		name        string
+		units       []uint16
+		nameLen     int
+		nameRecords int
+		benign      int
+		sc          int
+		want        NameAnomaly
+	}{
+		{"clean", []uint16{'a', '.', 't'}, 3, 1, 0, 2, 0},
+		{"illegal", []uint16{'a', ':', 0x07}, 3, 1, 0, 2, NAME_ANOMALY_ILLEGAL_CHAR},
+		{"nul", []uint16{'a', 0, 'b'}, 3, 1, 0, 2, NAME_ANOMALY_EMBEDDED_NUL},
+		{"lone high surrogate", []uint16{0xD800, 'a'}, 2, 1, 0, 2, NAME_ANOMALY_UNPAIRED_SURROGATE},
+		{"paired surrogate", []uint16{0xD83D, 0xDE00}, 2, 1, 0, 2, 0},
+		{"trailing dot", []uint16{'a', '.'}, 2, 1, 0, 2, NAME_ANOMALY_TRAILING_DOT_SPACE},
+		{"trailing space", []uint16{'a', ' '}, 2, 1, 0, 2, NAME_ANOMALY_TRAILING_DOT_SPACE},
+		{"extra name record", []uint16{'a'}, 1, 2, 0, 3, NAME_ANOMALY_NAME_LENGTH_MISMATCH},
+		{"secondary count", []uint16{'a'}, 1, 1, 0, 4, NAME_ANOMALY_SECONDARY_COUNT_MISMATCH},
+		{"vendor secondary", []uint16{'a'}, 1, 1, 1, 3, 0},
+		{"records past the set", []uint16{'a'}, 20, 2, 0, 2, NAME_ANOMALY_SECONDARY_COUNT_MISMATCH},
+	}
+
+	for _, tt := range tests {
+		got := detectNameAnomalies(tt.units, tt.nameLen, tt.nameRecords, tt.benign, tt.sc)
+		if got != tt.want {
+			t.Errorf("%s: detectNameAnomalies() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseDirKeepsRawNameAndFlagsAnomalies(t *testing.T) {
+	exfat := ExFAT{optimistic: true}
+
+	clusterdata := make([]byte, EXFAT_DIRRECORD_SIZE*4)
+	clusterdata[0] = EXFAT_DIRRECORD_FILEDIR
+	clusterdata[1] = 2
+
+	stream := EXFAT_DIRRECORD_SIZE
+	clusterdata[stream] = EXFAT_DIRRECORD_STREAM_EXT
+	clusterdata[stream+3] = 3
+
+	name := EXFAT_DIRRECORD_SIZE * 2
+	clusterdata[name] = EXFAT_DIRRECORD_FILENAME_EXT
+	clusterdata[name+2] = 'A'
+	clusterdata[name+4] = 0
+	clusterdata[name+6] = '.'
+
+	entries := exfat.parseDir(clusterdata)
+	if len(entries) != 1 {
+		t.Fatalf("parseDir() entries len = %d, want 1", len(entries))
+	}
+
+	entry := entries[0]
+	if entry.GetName() != "A." {
+		t.Fatalf("entry name = %q, want %q", entry.GetName(), "A.")
+	}
+	raw := entry.RawName()
+	if len(raw) != 15 || raw[0] != 'A' || raw[1] != 0 || raw[2] != '.' {
+		t.Fatalf("RawName() = %v, want 15 units starting A, NUL, .", raw)
+	}
+	want := NAME_ANOMALY_EMBEDDED_NUL | NAME_ANOMALY_TRAILING_DOT_SPACE
+	if entry.NameAnomalies() != want {
+		t.Fatalf("NameAnomalies() = %v, want %v", entry.NameAnomalies(), want)
+	}
+}
+
+func TestParseDirCountsVendorAndTrailingNameRecords(t *testing.T) {
+	exfat := ExFAT{optimistic: true}
+
+	// A set with a vendor extension record, then a set whose SecondaryCount
+	// leaves its second name record outside.
+	clusterdata := make([]byte, EXFAT_DIRRECORD_SIZE*9)
+	clusterdata[0] = EXFAT_DIRRECORD_FILEDIR
+	clusterdata[1] = 3
+	clusterdata[EXFAT_DIRRECORD_SIZE] = EXFAT_DIRRECORD_STREAM_EXT
+	clusterdata[EXFAT_DIRRECORD_SIZE+3] = 1
+	clusterdata[EXFAT_DIRRECORD_SIZE*2] = EXFAT_DIRRECORD_FILENAME_EXT
+	clusterdata[EXFAT_DIRRECORD_SIZE*2+2] = 'a'
+	clusterdata[EXFAT_DIRRECORD_SIZE*3] = EXFAT_DIRRECORD_VENDOR_EXT
+
+	clusterdata[EXFAT_DIRRECORD_SIZE*4] = EXFAT_DIRRECORD_FILEDIR
+	clusterdata[EXFAT_DIRRECORD_SIZE*4+1] = 2
+	clusterdata[EXFAT_DIRRECORD_SIZE*5] = EXFAT_DIRRECORD_STREAM_EXT
+	clusterdata[EXFAT_DIRRECORD_SIZE*5+3] = 20
+	for _, name := range []int{6, 7} {
+		clusterdata[EXFAT_DIRRECORD_SIZE*name] = EXFAT_DIRRECORD_FILENAME_EXT
+		for k := 0; k < 15; k++ {
+			clusterdata[EXFAT_DIRRECORD_SIZE*name+2+2*k] = 'b'
+		}
+	}
+
+	entries := exfat.parseDir(clusterdata)
+	if len(entries) != 2 {
+		t.Fatalf("parseDir() entries len = %d, want 2", len(entries))
+	}
+	if got := entries[0].NameAnomalies(); got != 0 {
+		t.Fatalf("vendor set NameAnomalies() = %v, want none", got)
+	}
+	if got, want := entries[1].NameAnomalies(), NAME_ANOMALY_SECONDARY_COUNT_MISMATCH; got != want {
+		t.Fatalf("short set NameAnomalies() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,286 @@
+package libxfat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// DeltaStore holds the sectors written to an Overlay. *os.File satisfies it.
+type DeltaStore interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// Overlay is a copy-on-write layer over a disk image. Reads fall through to
+// the base image; writes go to a delta, either in memory or in a sidecar
+// DeltaStore, so the base is never modified. An ExFAT opened on an Overlay
+// with NewFromImage can be repaired or written like a writable image.
+//
+// Changes are tracked in whole sectors of SECTOR_SIZE bytes. A sidecar delta
+// starts with OVERLAY_MAGIC, a little-endian sector count and the merged image
+// size, followed by records of an 8-byte sector number and the sector
+// contents.
+type Overlay struct {
+	base    io.ReaderAt
+	size    int64
+	store   DeltaStore
+	sectors map[uint64]int64  // sector number -> record offset in store
+	memory  map[uint64][]byte // sector number -> contents, without a store
+}
+
+// NewOverlay opens a copy-on-write layer over base. Without a delta store,
+// changes are kept in memory. A store holding an earlier delta is resumed; an
+// empty one is initialised.
+func NewOverlay(base io.ReaderAt, delta ...DeltaStore) (*Overlay, error) {
+	size, err := imageSize(base)
+	if err != nil {
+		return nil, err
+	}
+	o := &Overlay{base: base, size: size}
+	if len(delta) == 0 || delta[0] == nil {
+		o.memory = map[uint64][]byte{}
+		return o, nil
+	}
+
+	o.store = delta[0]
+	o.sectors = map[uint64]int64{}
+	if err := o.loadDelta(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// loadDelta reads the sector index of an existing delta, or writes the
+// header of an empty one.
+func (o *Overlay) loadDelta() error {
+	header := make([]byte, OVERLAY_HEADER_SIZE)
+	n, err := o.store.ReadAt(header, 0)
+	if n == 0 && (err == nil || err == io.EOF) {
+		return o.writeDeltaHeader()
+	}
+	if n < len(header) || string(header[:len(OVERLAY_MAGIC)]) != OVERLAY_MAGIC {
+		return ErrInvalidDelta
+	}
+
+	count := binary.LittleEndian.Uint64(header[8:])
+	o.size = int64(binary.LittleEndian.Uint64(header[16:]))
+	var number [8]byte
+	for i := uint64(0); i < count; i++ {
+		off := int64(OVERLAY_HEADER_SIZE + i*OVERLAY_RECORD_SIZE)
+		if err := readFullAt(o.store, number[:], off); err != nil {
+			return fmt.Errorf("%w: record %d: %v", ErrInvalidDelta, i, err)
+		}
+		o.sectors[binary.LittleEndian.Uint64(number[:])] = off
+	}
+	return nil
+}
+
+func (o *Overlay) writeDeltaHeader() error {
+	header := make([]byte, OVERLAY_HEADER_SIZE)
+	copy(header, OVERLAY_MAGIC)
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(o.sectors)))
+	binary.LittleEndian.PutUint64(header[16:], uint64(o.size))
+	_, err := o.store.WriteAt(header, 0)
+	return err
+}
+
+// Size returns the size of the merged image. Writes past the end of the base
+// image grow it.
+func (o *Overlay) Size() int64 {
+	return o.size
+}
+
+// ReadAt reads the merged image: changed sectors from the delta, everything
+// else from the base. Bytes past the base but within Size read as zeros.
+func (o *Overlay) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= o.size {
+		return 0, io.EOF
+	}
+	want := len(p)
+	if remaining := o.size - off; int64(want) > remaining {
+		p = p[:remaining]
+	}
+	end := off + int64(len(p))
+
+	var sector []byte
+	for done := 0; done < len(p); {
+		pos := off + int64(done)
+		number, within := uint64(pos)/SECTOR_SIZE, pos%int64(SECTOR_SIZE)
+		if o.changed(number) {
+			if sector == nil {
+				sector = make([]byte, SECTOR_SIZE)
+			}
+			if err := o.readSector(number, sector); err != nil {
+				return done, err
+			}
+			done += copy(p[done:], sector[within:])
+			continue
+		}
+
+		// The unchanged sectors up to the next changed one come from the
+		// base in a single read.
+		stop := len(p)
+		for next := number + 1; int64(next*SECTOR_SIZE) < end; next++ {
+			if o.changed(next) {
+				stop = int(int64(next*SECTOR_SIZE) - off)
+				break
+			}
+		}
+		if err := o.readBase(p[done:stop], pos); err != nil {
+			return done, err
+		}
+		done = stop
+	}
+	if len(p) < want {
+		return len(p), io.EOF
+	}
+	return len(p), nil
+}
+
+// changed reports whether the delta holds sector number.
+func (o *Overlay) changed(number uint64) bool {
+	if o.memory != nil {
+		_, ok := o.memory[number]
+		return ok
+	}
+	_, ok := o.sectors[number]
+	return ok
+}
+
+// readSector fills p with the merged contents of one sector.
+func (o *Overlay) readSector(number uint64, p []byte) error {
+	if o.memory != nil {
+		if data, ok := o.memory[number]; ok {
+			copy(p, data)
+			return nil
+		}
+	} else if off, ok := o.sectors[number]; ok {
+		return readFullAt(o.store, p, off+8)
+	}
+	return o.readBase(p, int64(number*SECTOR_SIZE))
+}
+
+// readBase fills p from the base image at off.
+func (o *Overlay) readBase(p []byte, off int64) error {
+	n, err := o.base.ReadAt(p, off)
+	if n == len(p) || err == nil || err == io.EOF {
+		// A short read is the end of the base image, or space only the
+		// delta grew to; the rest reads as zeros.
+		clear(p[n:])
+		return nil
+	}
+	return err
+}
+
+// WriteAt writes p into the delta. Partly written sectors are first copied
+// from the merged image.
+func (o *Overlay) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+
+	sector := make([]byte, SECTOR_SIZE)
+	for done := 0; done < len(p); {
+		pos := off + int64(done)
+		number, within := uint64(pos)/SECTOR_SIZE, pos%int64(SECTOR_SIZE)
+		if err := o.readSector(number, sector); err != nil {
+			return done, err
+		}
+		n := copy(sector[within:], p[done:])
+		if err := o.writeSector(number, sector); err != nil {
+			return done, err
+		}
+		done += n
+	}
+	if end := off + int64(len(p)); end > o.size {
+		o.size = end
+		if o.store != nil {
+			if err := o.writeDeltaHeader(); err != nil {
+				return len(p), err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// writeSector stores one sector in the delta, replacing an earlier version
+// of it in place.
+func (o *Overlay) writeSector(number uint64, p []byte) error {
+	if o.memory != nil {
+		o.memory[number] = append([]byte(nil), p...)
+		return nil
+	}
+
+	off, ok := o.sectors[number]
+	if !ok {
+		off = int64(OVERLAY_HEADER_SIZE + uint64(len(o.sectors))*OVERLAY_RECORD_SIZE)
+	}
+	record := make([]byte, OVERLAY_RECORD_SIZE)
+	binary.LittleEndian.PutUint64(record, number)
+	copy(record[8:], p)
+	if _, err := o.store.WriteAt(record, off); err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+	o.sectors[number] = off
+	return o.writeDeltaHeader()
+}
+
+// ChangedSectors lists, in ascending order, the numbers of the SECTOR_SIZE
+// sectors the delta holds.
+func (o *Overlay) ChangedSectors() []uint64 {
+	sectors := make([]uint64, 0, len(o.sectors)+len(o.memory))
+	for number := range o.sectors {
+		sectors = append(sectors, number)
+	}
+	for number := range o.memory {
+		sectors = append(sectors, number)
+	}
+	sort.Slice(sectors, func(i, j int) bool { return sectors[i] < sectors[j] })
+	return sectors
+}
+
+// Discard drops every change, so reads again return the base image. A
+// sidecar delta is reset to an empty one; its old records are left in place
+// but no longer counted.
+func (o *Overlay) Discard() error {
+	base, err := imageSize(o.base)
+	if err != nil {
+		return err
+	}
+	o.size = base
+	if o.memory != nil {
+		o.memory = map[uint64][]byte{}
+		return nil
+	}
+	o.sectors = map[uint64]int64{}
+	return o.writeDeltaHeader()
+}
+
+// Export writes the merged image to w as a raw image of Size bytes.
+func (o *Overlay) Export(w io.Writer) error {
+	buf := make([]byte, OVERLAY_EXPORT_CHUNK)
+	for off := int64(0); off < o.size; {
+		n, err := o.ReadAt(buf, off)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			off += int64(n)
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 0 {
+			return io.ErrUnexpectedEOF
+		}
+	}
+	return nil
+}
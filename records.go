@@ -0,0 +1,434 @@
+package libxfat
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// DirectoryRecord is one decoded 32-byte exFAT directory entry record.
+type DirectoryRecord interface {
+	Type() byte
+	Encode() [EXFAT_DIRRECORD_SIZE]byte
+}
+
+// FileDirectoryEntry is the 0x85 (0x05 when deleted) primary record of a
+// file entry set.
+type FileDirectoryEntry struct {
+	EntryType                 byte
+	SecondaryCount            byte
+	SetChecksum               uint16
+	FileAttributes            uint16
+	Reserved1                 uint16
+	CreateTimestamp           uint32
+	LastModifiedTimestamp     uint32
+	LastAccessedTimestamp     uint32
+	Create10msIncrement       byte
+	LastModified10msIncrement byte
+	CreateUtcOffset           byte
+	LastModifiedUtcOffset     byte
+	LastAccessedUtcOffset     byte
+	Reserved2                 [7]byte
+}
+
+// StreamExtensionEntry is the 0xC0 (0x40 when deleted) secondary record that
+// holds the allocation and name length of a file entry set.
+type StreamExtensionEntry struct {
+	EntryType             byte
+	GeneralSecondaryFlags byte
+	Reserved1             byte
+	NameLength            byte
+	NameHash              uint16
+	Reserved2             uint16
+	ValidDataLength       uint64
+	Reserved3             uint32
+	FirstCluster          uint32
+	DataLength            uint64
+}
+
+// FileNameEntry is a 0xC1 (0x41 when deleted) record holding up to 15 UTF-16
+// units of a file name.
+type FileNameEntry struct {
+	EntryType             byte
+	GeneralSecondaryFlags byte
+	FileName              [15]uint16
+}
+
+// AllocationBitmapEntry is the 0x81 record locating an allocation bitmap.
+type AllocationBitmapEntry struct {
+	EntryType    byte
+	BitmapFlags  byte
+	Reserved     [18]byte
+	FirstCluster uint32
+	DataLength   uint64
+}
+
+// UpcaseTableEntry is the 0x82 record locating the up-case table.
+type UpcaseTableEntry struct {
+	EntryType     byte
+	Reserved1     [3]byte
+	TableChecksum uint32
+	Reserved2     [12]byte
+	FirstCluster  uint32
+	DataLength    uint64
+}
+
+// VolumeLabelEntry is the 0x83 record holding the volume label, or 0x03 when
+// the volume has no label.
+type VolumeLabelEntry struct {
+	EntryType      byte
+	CharacterCount byte
+	VolumeLabel    [11]uint16
+	Reserved       [8]byte
+}
+
+// VolumeGuidEntry is the 0xA0 record holding the volume GUID.
+type VolumeGuidEntry struct {
+	EntryType           byte
+	SecondaryCount      byte
+	SetChecksum         uint16
+	GeneralPrimaryFlags uint16
+	VolumeGuid          [16]byte
+	Reserved            [10]byte
+}
+
+// VendorExtensionEntry is a 0xE0 secondary record carrying vendor data inside
+// a file entry set.
+type VendorExtensionEntry struct {
+	EntryType             byte
+	GeneralSecondaryFlags byte
+	VendorGuid            [16]byte
+	VendorDefined         [14]byte
+}
+
+// RawRecord holds a record whose type has no typed decoder, including unused
+// (0x00) records.
+type RawRecord struct {
+	Data [EXFAT_DIRRECORD_SIZE]byte
+}
+
+func checkRecordType(b [EXFAT_DIRRECORD_SIZE]byte, want byte, allowDeleted bool) error {
+	if b[0] == want || (allowDeleted && entryTypeNormal(b[0]) == entryTypeNormal(want)) {
+		return nil
+	}
+	return fmt.Errorf("%w: got %#x want %#x", ErrRecordType, b[0], want)
+}
+
+func (r FileDirectoryEntry) Type() byte { return r.EntryType }
+
+// Decode fills r from a 0x85 or 0x05 record.
+func (r *FileDirectoryEntry) Decode(b [EXFAT_DIRRECORD_SIZE]byte) error {
+	if err := checkRecordType(b, EXFAT_DIRRECORD_FILEDIR, true); err != nil {
+		return err
+	}
+	r.EntryType = b[0]
+	r.SecondaryCount = b[1]
+	r.SetChecksum = binary.LittleEndian.Uint16(b[2:4])
+	r.FileAttributes = binary.LittleEndian.Uint16(b[4:6])
+	r.Reserved1 = binary.LittleEndian.Uint16(b[6:8])
+	r.CreateTimestamp = binary.LittleEndian.Uint32(b[8:12])
+	r.LastModifiedTimestamp = binary.LittleEndian.Uint32(b[12:16])
+	r.LastAccessedTimestamp = binary.LittleEndian.Uint32(b[16:20])
+	r.Create10msIncrement = b[20]
+	r.LastModified10msIncrement = b[21]
+	r.CreateUtcOffset = b[22]
+	r.LastModifiedUtcOffset = b[23]
+	r.LastAccessedUtcOffset = b[24]
+	copy(r.Reserved2[:], b[25:32])
+	return nil
+}
+
+func (r FileDirectoryEntry) Encode() [EXFAT_DIRRECORD_SIZE]byte {
+	var b [EXFAT_DIRRECORD_SIZE]byte
+	b[0] = r.EntryType
+	b[1] = r.SecondaryCount
+	binary.LittleEndian.PutUint16(b[2:4], r.SetChecksum)
+	binary.LittleEndian.PutUint16(b[4:6], r.FileAttributes)
+	binary.LittleEndian.PutUint16(b[6:8], r.Reserved1)
+	binary.LittleEndian.PutUint32(b[8:12], r.CreateTimestamp)
+	binary.LittleEndian.PutUint32(b[12:16], r.LastModifiedTimestamp)
+	binary.LittleEndian.PutUint32(b[16:20], r.LastAccessedTimestamp)
+	b[20] = r.Create10msIncrement
+	b[21] = r.LastModified10msIncrement
+	b[22] = r.CreateUtcOffset
+	b[23] = r.LastModifiedUtcOffset
+	b[24] = r.LastAccessedUtcOffset
+	copy(b[25:32], r.Reserved2[:])
+	return b
+}
+
+func (r StreamExtensionEntry) Type() byte { return r.EntryType }
+
+// NoFatChain reports whether the allocation is one contiguous run that is
+// not recorded in the FAT.
+func (r StreamExtensionEntry) NoFatChain() bool {
+	return r.GeneralSecondaryFlags&NOT_FAT_CHAIN_FLAG != 0
+}
+
+// Decode fills r from a 0xC0 or 0x40 record.
+func (r *StreamExtensionEntry) Decode(b [EXFAT_DIRRECORD_SIZE]byte) error {
+	if err := checkRecordType(b, EXFAT_DIRRECORD_STREAM_EXT, true); err != nil {
+		return err
+	}
+	r.EntryType = b[0]
+	r.GeneralSecondaryFlags = b[1]
+	r.Reserved1 = b[2]
+	r.NameLength = b[3]
+	r.NameHash = binary.LittleEndian.Uint16(b[4:6])
+	r.Reserved2 = binary.LittleEndian.Uint16(b[6:8])
+	r.ValidDataLength = binary.LittleEndian.Uint64(b[8:16])
+	r.Reserved3 = binary.LittleEndian.Uint32(b[16:20])
+	r.FirstCluster = binary.LittleEndian.Uint32(b[20:24])
+	r.DataLength = binary.LittleEndian.Uint64(b[24:32])
+	return nil
+}
+
+func (r StreamExtensionEntry) Encode() [EXFAT_DIRRECORD_SIZE]byte {
+	var b [EXFAT_DIRRECORD_SIZE]byte
+	b[0] = r.EntryType
+	b[1] = r.GeneralSecondaryFlags
+	b[2] = r.Reserved1
+	b[3] = r.NameLength
+	binary.LittleEndian.PutUint16(b[4:6], r.NameHash)
+	binary.LittleEndian.PutUint16(b[6:8], r.Reserved2)
+	binary.LittleEndian.PutUint64(b[8:16], r.ValidDataLength)
+	binary.LittleEndian.PutUint32(b[16:20], r.Reserved3)
+	binary.LittleEndian.PutUint32(b[20:24], r.FirstCluster)
+	binary.LittleEndian.PutUint64(b[24:32], r.DataLength)
+	return b
+}
+
+func (r FileNameEntry) Type() byte { return r.EntryType }
+
+// Decode fills r from a 0xC1 or 0x41 record.
+func (r *FileNameEntry) Decode(b [EXFAT_DIRRECORD_SIZE]byte) error {
+	if err := checkRecordType(b, EXFAT_DIRRECORD_FILENAME_EXT, true); err != nil {
+		return err
+	}
+	r.EntryType = b[0]
+	r.GeneralSecondaryFlags = b[1]
+	for i := range r.FileName {
+		r.FileName[i] = binary.LittleEndian.Uint16(b[2+i*2:])
+	}
+	return nil
+}
+
+func (r FileNameEntry) Encode() [EXFAT_DIRRECORD_SIZE]byte {
+	var b [EXFAT_DIRRECORD_SIZE]byte
+	b[0] = r.EntryType
+	b[1] = r.GeneralSecondaryFlags
+	for i, unit := range r.FileName {
+		binary.LittleEndian.PutUint16(b[2+i*2:], unit)
+	}
+	return b
+}
+
+func (r AllocationBitmapEntry) Type() byte { return r.EntryType }
+
+// Decode fills r from a 0x81 record.
+func (r *AllocationBitmapEntry) Decode(b [EXFAT_DIRRECORD_SIZE]byte) error {
+	if err := checkRecordType(b, EXFAT_DIRRECORD_BITMAP, false); err != nil {
+		return err
+	}
+	r.EntryType = b[0]
+	r.BitmapFlags = b[1]
+	copy(r.Reserved[:], b[2:20])
+	r.FirstCluster = binary.LittleEndian.Uint32(b[20:24])
+	r.DataLength = binary.LittleEndian.Uint64(b[24:32])
+	return nil
+}
+
+func (r AllocationBitmapEntry) Encode() [EXFAT_DIRRECORD_SIZE]byte {
+	var b [EXFAT_DIRRECORD_SIZE]byte
+	b[0] = r.EntryType
+	b[1] = r.BitmapFlags
+	copy(b[2:20], r.Reserved[:])
+	binary.LittleEndian.PutUint32(b[20:24], r.FirstCluster)
+	binary.LittleEndian.PutUint64(b[24:32], r.DataLength)
+	return b
+}
+
+func (r UpcaseTableEntry) Type() byte { return r.EntryType }
+
+// Decode fills r from a 0x82 record.
+func (r *UpcaseTableEntry) Decode(b [EXFAT_DIRRECORD_SIZE]byte) error {
+	if err := checkRecordType(b, EXFAT_DIRRECORD_UPCASE, false); err != nil {
+		return err
+	}
+	r.EntryType = b[0]
+	copy(r.Reserved1[:], b[1:4])
+	r.TableChecksum = binary.LittleEndian.Uint32(b[4:8])
+	copy(r.Reserved2[:], b[8:20])
+	r.FirstCluster = binary.LittleEndian.Uint32(b[20:24])
+	r.DataLength = binary.LittleEndian.Uint64(b[24:32])
+	return nil
+}
+
+func (r UpcaseTableEntry) Encode() [EXFAT_DIRRECORD_SIZE]byte {
+	var b [EXFAT_DIRRECORD_SIZE]byte
+	b[0] = r.EntryType
+	copy(b[1:4], r.Reserved1[:])
+	binary.LittleEndian.PutUint32(b[4:8], r.TableChecksum)
+	copy(b[8:20], r.Reserved2[:])
+	binary.LittleEndian.PutUint32(b[20:24], r.FirstCluster)
+	binary.LittleEndian.PutUint64(b[24:32], r.DataLength)
+	return b
+}
+
+func (r VolumeLabelEntry) Type() byte { return r.EntryType }
+
+// Label returns the volume label as a Go string.
+func (r VolumeLabelEntry) Label() string {
+	count := int(r.CharacterCount)
+	if count > len(r.VolumeLabel) {
+		count = len(r.VolumeLabel)
+	}
+	return utf16UnitsToString(r.VolumeLabel[:count])
+}
+
+// Decode fills r from a 0x83 or 0x03 record.
+func (r *VolumeLabelEntry) Decode(b [EXFAT_DIRRECORD_SIZE]byte) error {
+	if err := checkRecordType(b, EXFAT_DIRRECORD_LABEL, true); err != nil {
+		return err
+	}
+	r.EntryType = b[0]
+	r.CharacterCount = b[1]
+	for i := range r.VolumeLabel {
+		r.VolumeLabel[i] = binary.LittleEndian.Uint16(b[2+i*2:])
+	}
+	copy(r.Reserved[:], b[24:32])
+	return nil
+}
+
+func (r VolumeLabelEntry) Encode() [EXFAT_DIRRECORD_SIZE]byte {
+	var b [EXFAT_DIRRECORD_SIZE]byte
+	b[0] = r.EntryType
+	b[1] = r.CharacterCount
+	for i, unit := range r.VolumeLabel {
+		binary.LittleEndian.PutUint16(b[2+i*2:], unit)
+	}
+	copy(b[24:32], r.Reserved[:])
+	return b
+}
+
+func (r VolumeGuidEntry) Type() byte { return r.EntryType }
+
+// Decode fills r from a 0xA0 record.
+func (r *VolumeGuidEntry) Decode(b [EXFAT_DIRRECORD_SIZE]byte) error {
+	if err := checkRecordType(b, EXFAT_DIRRECORD_VOLUME_GUID, false); err != nil {
+		return err
+	}
+	r.EntryType = b[0]
+	r.SecondaryCount = b[1]
+	r.SetChecksum = binary.LittleEndian.Uint16(b[2:4])
+	r.GeneralPrimaryFlags = binary.LittleEndian.Uint16(b[4:6])
+	copy(r.VolumeGuid[:], b[6:22])
+	copy(r.Reserved[:], b[22:32])
+	return nil
+}
+
+func (r VolumeGuidEntry) Encode() [EXFAT_DIRRECORD_SIZE]byte {
+	var b [EXFAT_DIRRECORD_SIZE]byte
+	b[0] = r.EntryType
+	b[1] = r.SecondaryCount
+	binary.LittleEndian.PutUint16(b[2:4], r.SetChecksum)
+	binary.LittleEndian.PutUint16(b[4:6], r.GeneralPrimaryFlags)
+	copy(b[6:22], r.VolumeGuid[:])
+	copy(b[22:32], r.Reserved[:])
+	return b
+}
+
+func (r VendorExtensionEntry) Type() byte { return r.EntryType }
+
+// Decode fills r from a 0xE0 or 0x60 record.
+func (r *VendorExtensionEntry) Decode(b [EXFAT_DIRRECORD_SIZE]byte) error {
+	if err := checkRecordType(b, EXFAT_DIRRECORD_VENDOR_EXT, true); err != nil {
+		return err
+	}
+	r.EntryType = b[0]
+	r.GeneralSecondaryFlags = b[1]
+	copy(r.VendorGuid[:], b[2:18])
+	copy(r.VendorDefined[:], b[18:32])
+	return nil
+}
+
+func (r VendorExtensionEntry) Encode() [EXFAT_DIRRECORD_SIZE]byte {
+	var b [EXFAT_DIRRECORD_SIZE]byte
+	b[0] = r.EntryType
+	b[1] = r.GeneralSecondaryFlags
+	copy(b[2:18], r.VendorGuid[:])
+	copy(b[18:32], r.VendorDefined[:])
+	return b
+}
+
+func (r RawRecord) Type() byte { return r.Data[0] }
+
+// Decode copies any record into r.
+func (r *RawRecord) Decode(b [EXFAT_DIRRECORD_SIZE]byte) error {
+	r.Data = b
+	return nil
+}
+
+func (r RawRecord) Encode() [EXFAT_DIRRECORD_SIZE]byte {
+	return r.Data
+}
+
+// DecodeRecord decodes one record into its typed form. Types without a typed
+// decoder, including unused (0x00) records, come back as RawRecord.
+func DecodeRecord(b [EXFAT_DIRRECORD_SIZE]byte) DirectoryRecord {
+	switch b[0] {
+	case EXFAT_DIRRECORD_FILEDIR, EXFAT_DIRRECORD_DEL_FILEDIR:
+		var r FileDirectoryEntry
+		_ = r.Decode(b)
+		return r
+	case EXFAT_DIRRECORD_STREAM_EXT, EXFAT_DIRRECORD_DEL_STREAM_EXT:
+		var r StreamExtensionEntry
+		_ = r.Decode(b)
+		return r
+	case EXFAT_DIRRECORD_FILENAME_EXT, EXFAT_DIRRECORD_DEL_FILENAME_EXT:
+		var r FileNameEntry
+		_ = r.Decode(b)
+		return r
+	case EXFAT_DIRRECORD_BITMAP:
+		var r AllocationBitmapEntry
+		_ = r.Decode(b)
+		return r
+	case EXFAT_DIRRECORD_UPCASE:
+		var r UpcaseTableEntry
+		_ = r.Decode(b)
+		return r
+	case EXFAT_DIRRECORD_LABEL, EXFAT_DIRRECORD_NOLABEL:
+		var r VolumeLabelEntry
+		_ = r.Decode(b)
+		return r
+	case EXFAT_DIRRECORD_VOLUME_GUID:
+		var r VolumeGuidEntry
+		_ = r.Decode(b)
+		return r
+	case EXFAT_DIRRECORD_VENDOR_EXT, EXFAT_DIRRECORD_DEL_VENDOR_EXT:
+		var r VendorExtensionEntry
+		_ = r.Decode(b)
+		return r
+	}
+	return RawRecord{Data: b}
+}
+
+// DecodeRecords decodes every 32-byte record in data, for example a whole
+// directory cluster. Trailing bytes that do not fill a record are ignored.
+func DecodeRecords(data []byte) []DirectoryRecord {
+	records := make([]DirectoryRecord, 0, len(data)/EXFAT_DIRRECORD_SIZE)
+	for offset := 0; offset+EXFAT_DIRRECORD_SIZE <= len(data); offset += EXFAT_DIRRECORD_SIZE {
+		var b [EXFAT_DIRRECORD_SIZE]byte
+		copy(b[:], data[offset:offset+EXFAT_DIRRECORD_SIZE])
+		records = append(records, DecodeRecord(b))
+	}
+	return records
+}
+
+// DecodeCluster reads a cluster from the image and decodes it into records.
+func (e *ExFAT) DecodeCluster(cluster uint32) ([]DirectoryRecord, error) {
+	clusterdata, err := e.vbr.readClusters(cluster, 1)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeRecords(clusterdata), nil
+}
@@ -0,0 +1,48 @@
+package libxfat
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDirectoryRecordsRoundTrip(t *testing.T) {
+	records := []DirectoryRecord{
+		FileDirectoryEntry{EntryType: EXFAT_DIRRECORD_FILEDIR, SecondaryCount: 2, SetChecksum: 0xBEEF, FileAttributes: ENTRY_ATTR_DIR_MASK, CreateTimestamp: 0x12345678, LastAccessedUtcOffset: 0x84},
+		StreamExtensionEntry{EntryType: EXFAT_DIRRECORD_DEL_STREAM_EXT, GeneralSecondaryFlags: 0x03, NameLength: 7, NameHash: 0x1234, ValidDataLength: 10, FirstCluster: 9, DataLength: 4096},
+		FileNameEntry{EntryType: EXFAT_DIRRECORD_FILENAME_EXT, FileName: [15]uint16{'a', 'b', 0xD800}},
+		AllocationBitmapEntry{EntryType: EXFAT_DIRRECORD_BITMAP, BitmapFlags: 1, FirstCluster: 2, DataLength: 512},
+		UpcaseTableEntry{EntryType: EXFAT_DIRRECORD_UPCASE, TableChecksum: 0xE619D30D, FirstCluster: 3, DataLength: 5836},
+		VolumeLabelEntry{EntryType: EXFAT_DIRRECORD_LABEL, CharacterCount: 2, VolumeLabel: [11]uint16{'O', 'K'}},
+		VolumeGuidEntry{EntryType: EXFAT_DIRRECORD_VOLUME_GUID, SetChecksum: 7, VolumeGuid: [16]byte{1, 2, 3}},
+		VendorExtensionEntry{EntryType: EXFAT_DIRRECORD_VENDOR_EXT, VendorGuid: [16]byte{9}, VendorDefined: [14]byte{8}},
+		RawRecord{Data: [EXFAT_DIRRECORD_SIZE]byte{EXFAT_DIRRECORD_TEXFAT, 1, 2}},
+	}
+
+	var cluster []byte
+	for _, record := range records {
+		encoded := record.Encode()
+		if encoded[0] != record.Type() {
+			t.Errorf("%T: encoded type %#x, want %#x", record, encoded[0], record.Type())
+		}
+		if decoded := DecodeRecord(encoded); decoded != record {
+			t.Errorf("DecodeRecord(%T) = %+v, want %+v", record, decoded, record)
+		}
+		cluster = append(cluster, encoded[:]...)
+	}
+
+	decoded := DecodeRecords(append(cluster, 0xFF))
+	if len(decoded) != len(records) {
+		t.Fatalf("DecodeRecords() len = %d, want %d", len(decoded), len(records))
+	}
+	if label, ok := decoded[5].(VolumeLabelEntry); !ok || label.Label() != "OK" {
+		t.Fatalf("decoded label = %+v", decoded[5])
+	}
+}
+
+func TestDecodeRejectsWrongRecordType(t *testing.T) {
+	var stream StreamExtensionEntry
+	err := stream.Decode(FileNameEntry{EntryType: EXFAT_DIRRECORD_FILENAME_EXT}.Encode())
+	if !errors.Is(err, ErrRecordType) {
+		t.Fatalf("Decode() error = %v, want ErrRecordType", err)
+	}
+}
@@ -0,0 +1,333 @@
+package libxfat
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// RedactOptions sets what ExportRedacted replaces.
+type RedactOptions struct {
+	// Fill replaces the content clusters. It starts over at every cluster
+	// boundary. Empty means zeros.
+	Fill []byte
+	// Names replaces every file and directory name, deleted and carved ones
+	// included, and the volume label with placeholders of the same length.
+	Names bool
+}
+
+// RedactReport says what ExportRedacted wrote. KeptClusters and
+// FilledClusters split the cluster heap between structure copied as it is
+// and content replaced by the fill. Unreadable lists the directories that
+// could not be read, whose subdirectories are filled and whose names are not
+// replaced.
+type RedactReport struct {
+	Written        uint64
+	KeptClusters   uint64
+	FilledClusters uint64
+	RenamedEntries int
+	Unreadable     []Finding
+}
+
+const redactChunk = 1 << 20
+
+// ExportRedacted writes a copy of the volume to w that keeps its structure
+// and drops its content, so parser problems can be shared without the data.
+// The copy starts at the boot sector and runs VolumeLength sectors, or to the
+// end of the image when that comes first.
+//
+// Everything outside the cluster heap is copied byte for byte: boot regions,
+// FATs and the gaps between them. In the heap the root directory, every live
+// directory, the allocation bitmap, the up-case table and the free clusters
+// in which RecoverDeletedEntries finds entry sets are kept; every other
+// cluster, live and deleted file data included, is replaced by the fill.
+//
+// With Names set each name becomes 'X' padding followed by a counter, unique
+// within its directory while the length allows. The name characters past the
+// name length are zeroed. A NameHash or SetChecksum is recomputed only when
+// it matched before, in the live or deleted form it matched, so damaged sets
+// stay damaged. The image itself is never written.
+func (e *ExFAT) ExportRedacted(w io.Writer, opts ...RedactOptions) (RedactReport, error) {
+	var options RedactOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	fill := options.Fill
+	if len(fill) == 0 {
+		fill = []byte{0}
+	}
+
+	overlay, err := NewOverlay(e.vbr.dimage)
+	if err != nil {
+		return RedactReport{}, err
+	}
+	view := *e
+	view.vbr.dimage = overlay
+	view.clusterMap = nil
+	view.diagnostics = nil
+	view.salvage = false
+
+	var report RedactReport
+	keep, unreadable, err := view.structureRuns()
+	report.Unreadable = unreadable
+	if err != nil {
+		return report, err
+	}
+	report.KeptClusters = runsClusterCount(keep)
+	report.FilledClusters = uint64(e.vbr.nbClusters) - report.KeptClusters
+	if options.Names {
+		if report.RenamedEntries, err = view.redactNames(); err != nil {
+			return report, err
+		}
+	}
+	report.Written, err = view.copyRedacted(w, heapGaps(keep, e.vbr.nbClusters), fill)
+	return report, err
+}
+
+// structureRuns returns the heap clusters ExportRedacted keeps, sorted and
+// merged, and the directories that could not be read.
+func (e *ExFAT) structureRuns() ([]Run, []Finding, error) {
+	var unreadable []Finding
+	runs := append([]Run(nil), e.vbr.traceChain(e.vbr.rootDirCluster).runs...)
+	err := e.walkTree(func(entry Entry) error {
+		switch {
+		case entry.IsVirtualEntry():
+		case entry.IsBitmapUpcase():
+			runs = append(runs, e.ownedRuns(entry)...)
+		case entry.IsDir() && entry.IsValid() && !entry.IsDeleted():
+			runs = append(runs, e.ownedRuns(entry)...)
+		}
+		return nil
+	}, func(dir Entry, _ []Diagnostic, err error) error {
+		if err != nil {
+			unreadable = append(unreadable, unreadableDirectory(dir, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	carved, err := e.RecoverDeletedEntries()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range carved {
+		runs = append(runs, Run{Start: entry.parentCluster, Length: 1})
+	}
+
+	var inHeap []Run
+	for _, run := range mergeRuns(runs) {
+		if run.Start < uint32(FIRST_CLUSTER_NUMBER) {
+			continue
+		}
+		if end := e.vbr.nbClusters + uint32(FIRST_CLUSTER_NUMBER); run.End() > end {
+			run.Length = end - run.Start
+		}
+		inHeap = append(inHeap, run)
+	}
+	return inHeap, unreadable, nil
+}
+
+// heapGaps returns the runs of the heap not covered by the sorted runs.
+func heapGaps(runs []Run, nbClusters uint32) []Run {
+	var gaps []Run
+	next := uint32(FIRST_CLUSTER_NUMBER)
+	for _, run := range runs {
+		if run.Start > next {
+			gaps = append(gaps, Run{Start: next, Length: run.Start - next})
+		}
+		next = run.End()
+	}
+	if end := nbClusters + uint32(FIRST_CLUSTER_NUMBER); end > next {
+		gaps = append(gaps, Run{Start: next, Length: end - next})
+	}
+	return gaps
+}
+
+// copyRedacted copies the volume to w, replacing the clusters of fill.
+func (e *ExFAT) copyRedacted(w io.Writer, fill []Run, pattern []byte) (uint64, error) {
+	v := &e.vbr
+	size := v.volumeSize * uint64(v.sectorSize)
+	buf := make([]byte, max(uint64(redactChunk), v.clusterSize))
+	var written uint64
+	next := 0
+	for written < size {
+		chunk := buf[:min(uint64(len(buf)), size-written)]
+		n, err := v.dimage.ReadAt(chunk, int64(v.vbrStart+written))
+		chunk = chunk[:n]
+		if err != nil && !errors.Is(err, io.EOF) {
+			return written, err
+		}
+
+		start := v.vbrStart + written
+		end := start + uint64(n)
+		for next < len(fill) && v.getClusterOffset(fill[next].End()) <= start {
+			next++
+		}
+		for _, run := range fill[next:] {
+			from := v.getClusterOffset(run.Start)
+			if from >= end {
+				break
+			}
+			from = max(from, start)
+			to := min(v.getClusterOffset(run.End()), end)
+			fillPattern(chunk[from-start:to-start], pattern, (from-v.dataAreaStart)%v.clusterSize, v.clusterSize)
+		}
+
+		if _, werr := w.Write(chunk); werr != nil {
+			return written, werr
+		}
+		written += uint64(n)
+		if err != nil || n == 0 {
+			break
+		}
+	}
+	return written, nil
+}
+
+// redactNames replaces the names of every entry set in the tree and in free
+// space, and the volume label.
+func (e *ExFAT) redactNames() (int, error) {
+	upcase, err := e.loadUpcaseTable()
+	if err != nil {
+		return 0, err
+	}
+	counters := map[string]int{}
+	renamed := 0
+	rename := func(entry Entry) error {
+		if entry.IsVirtualEntry() || entry.IsSpecialFile() || len(entry.recordOffsets) < 3 {
+			return nil
+		}
+		index := counters[entry.parentPath]
+		counters[entry.parentPath]++
+		ok, err := e.redactEntryName(upcase, entry, index)
+		if ok {
+			renamed++
+		}
+		return err
+	}
+
+	// The walk is the one structureRuns made over the same view, which
+	// already reported the directories it could not read.
+	err = e.walkTree(rename, func(Entry, []Diagnostic, error) error {
+		return nil
+	})
+	if err != nil {
+		return renamed, err
+	}
+	carved, err := e.RecoverDeletedEntries()
+	if err != nil {
+		return renamed, err
+	}
+	for _, entry := range carved {
+		if err := rename(entry); err != nil {
+			return renamed, err
+		}
+	}
+	return renamed, e.redactLabel()
+}
+
+// redactEntryName gives the set of entry the placeholder name number index.
+func (e *ExFAT) redactEntryName(upcase upcaseTable, entry Entry, index int) (bool, error) {
+	records, err := e.readEntrySet(entry)
+	if err != nil {
+		return false, err
+	}
+	if records[1][0]&0x7f != EXFAT_DIRRECORD_STREAM_EXT&0x7f {
+		return false, nil
+	}
+	nameLen := int(records[1][3])
+	var names []int
+	var old []uint16
+	for i := 2; i < len(records); i++ {
+		if records[i][0]&0x7f != EXFAT_DIRRECORD_FILENAME_EXT&0x7f {
+			continue
+		}
+		names = append(names, i)
+		for k := 0; k < 15 && len(old) < nameLen; k++ {
+			old = append(old, binary.LittleEndian.Uint16(records[i][2+2*k:]))
+		}
+	}
+	if len(old) == 0 {
+		return false, nil
+	}
+
+	hashOK := binary.LittleEndian.Uint16(records[1][4:6]) == upcase.nameHash(old)
+	stored := binary.LittleEndian.Uint16(records[0][2:4])
+	deletedOK := stored == entrySetChecksum(records, false)
+	liveOK := stored == entrySetChecksum(records, true)
+
+	name := placeholderName(len(old), index)
+	pos := 0
+	for _, i := range names {
+		for k := 0; k < 15; k++ {
+			var unit uint16
+			if pos < len(name) {
+				unit = name[pos]
+			}
+			binary.LittleEndian.PutUint16(records[i][2+2*k:], unit)
+			pos++
+		}
+	}
+	if hashOK {
+		binary.LittleEndian.PutUint16(records[1][4:6], upcase.nameHash(name))
+	}
+	switch {
+	case deletedOK:
+		binary.LittleEndian.PutUint16(records[0][2:4], entrySetChecksum(records, false))
+	case liveOK:
+		binary.LittleEndian.PutUint16(records[0][2:4], entrySetChecksum(records, true))
+	}
+	return true, e.writeRecords(entry.recordOffsets, records)
+}
+
+// redactLabel replaces the characters of the volume label.
+func (e *ExFAT) redactLabel() error {
+	slots, index, err := e.findRootRecord(EXFAT_DIRRECORD_LABEL)
+	if err != nil || index < 0 {
+		return err
+	}
+	var raw [EXFAT_DIRRECORD_SIZE]byte
+	if err := readFullAt(e.vbr.dimage, raw[:], int64(slots.offsets[index])); err != nil {
+		return err
+	}
+	var label VolumeLabelEntry
+	if err := label.Decode(raw); err != nil {
+		return err
+	}
+	count := min(int(label.CharacterCount), len(label.VolumeLabel))
+	copy(label.VolumeLabel[:count], placeholderName(count, 0))
+	record := label.Encode()
+	return e.vbr.writeAt(record[:], slots.offsets[index])
+}
+
+// entrySetChecksum computes the SetChecksum of records as they are, or with
+// live set as they were before deletion.
+func entrySetChecksum(records [][EXFAT_DIRRECORD_SIZE]byte, live bool) uint16 {
+	var checksum uint16
+	for i := range records {
+		if live {
+			checksum = exfatDirLiveChecksumAdd(checksum, records[i][:], i == 0)
+		} else {
+			checksum = exfatDirSetChecksumAdd(checksum, records[i][:], i == 0)
+		}
+	}
+	return checksum
+}
+
+// placeholderName returns n units of 'X' padding ending in index in base 36.
+// Only the last n digits are kept when index does not fit.
+func placeholderName(n, index int) []uint16 {
+	digits := strings.ToUpper(strconv.FormatInt(int64(index), 36))
+	name := make([]uint16, n)
+	for i := range name {
+		name[i] = 'X'
+	}
+	for i := 0; i < len(digits) && i < n; i++ {
+		name[n-1-i] = uint16(digits[len(digits)-1-i])
+	}
+	return name
+}
@@ -0,0 +1,261 @@
+package libxfat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Remove deletes the file or empty directory at path the way the Windows
+// driver does: the in-use bit of every record of the entry set is cleared
+// (0x85 to 0x05, 0xC0 to 0x40, 0xC1 to 0x41), leaving the SetChecksum as it
+// was, and the clusters are freed in the allocation bitmap. FAT entries are
+// left untouched, so the old chain can still be followed.
+func (e *ExFAT) Remove(path string) error {
+	entry, err := e.lookupEntrySet(path)
+	if err != nil {
+		return err
+	}
+	if entry.IsDir() {
+		children, err := e.liveChildren(entry)
+		if err != nil {
+			return err
+		}
+		if len(children) > 0 {
+			return fmt.Errorf("%w: %s", ErrDirectoryNotEmpty, path)
+		}
+	}
+	return e.update(func(a *allocator) error {
+		return e.removeEntry(a, entry)
+	})
+}
+
+// RemoveAll deletes path and, for a directory, everything below it, children
+// before their parent. A missing path is not an error.
+func (e *ExFAT) RemoveAll(path string) error {
+	entry, err := e.lookupEntrySet(path)
+	if err != nil {
+		if errors.Is(err, ErrEntryNotFound) {
+			return nil
+		}
+		return err
+	}
+	return e.update(func(a *allocator) error {
+		return e.removeTree(a, e.newTraversal(), entry, 1)
+	})
+}
+
+// Rename gives the file or directory at path a new name in the same
+// directory.
+func (e *ExFAT) Rename(path, newName string) error {
+	parts := splitPath(path)
+	if len(parts) == 0 {
+		return fmt.Errorf("%w: the root directory has no entry set", ErrInvalidEntry)
+	}
+	return e.Move(path, "/"+strings.Join(append(parts[:len(parts)-1], newName), "/"))
+}
+
+// Move moves the file or directory at src to the path dst, whose parent must
+// exist. The entry set is rebuilt under the new name with a fresh NameHash and
+// SetChecksum; attributes, timestamps and data stay as they were. A set that
+// keeps its directory and its number of name records is rewritten in place.
+// Otherwise the new set is written first and the old one deleted, leaving a
+// recoverable trace under the old name as on Windows. Vendor extension and
+// vendor allocation records follow the new name records unchanged.
+func (e *ExFAT) Move(src, dst string) error {
+	entry, err := e.lookupEntrySet(src)
+	if err != nil {
+		return err
+	}
+	parts := splitPath(dst)
+	if len(parts) == 0 {
+		return fmt.Errorf("%w: %q", ErrInvalidName, dst)
+	}
+	name, err := validateName(parts[len(parts)-1])
+	if err != nil {
+		return err
+	}
+	parentPath := "/" + strings.Join(parts[:len(parts)-1], "/")
+	if entry.IsDir() && isPathWithin(parentPath, entry.Path()) {
+		return fmt.Errorf("%w: cannot move %s below itself", ErrInvalidName, src)
+	}
+	parent, err := e.Lookup(parentPath)
+	if err != nil {
+		return err
+	}
+	entries, err := e.readDirOf(parent)
+	if err != nil {
+		return err
+	}
+	upcase, err := e.loadUpcaseTable()
+	if err != nil {
+		return err
+	}
+	if existing, ok := findChild(upcase, entries, parts[len(parts)-1]); ok && !sameEntrySet(existing, entry) {
+		return fmt.Errorf("%w: %s", ErrEntryExists, dst)
+	}
+
+	records, err := e.readEntrySet(entry)
+	if err != nil {
+		return err
+	}
+	moved := rebuildEntrySet(upcase, records, name)
+	samePlace := parent.entryCluster == entry.parentCluster && len(moved) == len(records)
+
+	return e.update(func(a *allocator) error {
+		if samePlace {
+			return e.writeRecords(entry.recordOffsets, moved)
+		}
+		slots, err := e.readDirSlots(parent)
+		if err != nil {
+			return err
+		}
+		offsets, err := e.reserveSlots(a, slots, len(moved))
+		if err != nil {
+			return err
+		}
+		if err := e.writeRecords(offsets, moved); err != nil {
+			return err
+		}
+		return e.markDeleted(entry)
+	})
+}
+
+// removeTree deletes entry, found at depth, and everything below it. t
+// stops directory cycles and enforces the depth limit.
+func (e *ExFAT) removeTree(a *allocator, t *traversal, entry Entry, depth int) error {
+	if entry.IsDir() {
+		if err := t.enter(entry, depth); err != nil {
+			return err
+		}
+		children, err := e.liveChildren(entry)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err := e.removeTree(a, t, child, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return e.removeEntry(a, entry)
+}
+
+// removeEntry marks the entry set deleted and frees its clusters.
+func (e *ExFAT) removeEntry(a *allocator, entry Entry) error {
+	runs, err := e.vbr.getClusterRuns(entry)
+	if err != nil {
+		return err
+	}
+	if err := e.markDeleted(entry); err != nil {
+		return err
+	}
+	for _, run := range runs {
+		for cluster := run.Start; cluster < run.End(); cluster++ {
+			if !e.vbr.isValidCluster(cluster) {
+				continue
+			}
+			if err := a.set(cluster, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// markDeleted clears the in-use bit of every record of the entry set. Only
+// the type bytes are written.
+func (e *ExFAT) markDeleted(entry Entry) error {
+	for _, off := range entry.recordOffsets {
+		var etype [1]byte
+		if _, err := e.vbr.dimage.ReadAt(etype[:], int64(off)); err != nil {
+			return err
+		}
+		etype[0] &^= 0x80
+		if err := e.vbr.writeAt(etype[:], off); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// liveChildren lists the files and directories in dir that are not deleted.
+func (e *ExFAT) liveChildren(dir Entry) ([]Entry, error) {
+	entries, err := e.readDirOf(dir)
+	if err != nil {
+		return nil, err
+	}
+	var children []Entry
+	for _, entry := range entries {
+		if entry.IsValid() && !entry.IsDeleted() && !entry.IsSpecialFile() {
+			children = append(children, entry)
+		}
+	}
+	return children, nil
+}
+
+// readEntrySet reads the records of entry's set.
+func (e *ExFAT) readEntrySet(entry Entry) ([][EXFAT_DIRRECORD_SIZE]byte, error) {
+	records := make([][EXFAT_DIRRECORD_SIZE]byte, len(entry.recordOffsets))
+	for i, off := range entry.recordOffsets {
+		if _, err := e.vbr.dimage.ReadAt(records[i][:], int64(off)); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// writeRecords writes records at the given image offsets.
+func (e *ExFAT) writeRecords(offsets []uint64, records [][EXFAT_DIRRECORD_SIZE]byte) error {
+	for i, off := range offsets {
+		if err := e.vbr.writeAt(records[i][:], off); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildEntrySet keeps the file and stream records of a set and gives it a
+// new name, NameHash, SecondaryCount and SetChecksum. The other secondaries
+// are carried over after the name records, in their order.
+func rebuildEntrySet(upcase upcaseTable, records [][EXFAT_DIRRECORD_SIZE]byte, name []uint16) [][EXFAT_DIRRECORD_SIZE]byte {
+	var file FileDirectoryEntry
+	_ = file.Decode(records[0])
+	var stream StreamExtensionEntry
+	_ = stream.Decode(records[1])
+
+	var others [][EXFAT_DIRRECORD_SIZE]byte
+	for _, record := range records[2:] {
+		if record[0] != EXFAT_DIRRECORD_FILENAME_EXT {
+			others = append(others, record)
+		}
+	}
+	nameRecords := nameRecordsFor(len(name))
+	file.SecondaryCount = byte(1 + nameRecords + len(others))
+	stream.NameLength = byte(len(name))
+	stream.NameHash = upcase.nameHash(name)
+
+	rebuilt := [][EXFAT_DIRRECORD_SIZE]byte{file.Encode(), stream.Encode()}
+	for i := 0; i < nameRecords; i++ {
+		record := FileNameEntry{EntryType: EXFAT_DIRRECORD_FILENAME_EXT}
+		copy(record.FileName[:], name[i*15:])
+		rebuilt = append(rebuilt, record.Encode())
+	}
+	rebuilt = append(rebuilt, others...)
+	writeSetChecksum(rebuilt)
+	return rebuilt
+}
+
+// sameEntrySet reports whether two entries were read from the same records.
+func sameEntrySet(a, b Entry) bool {
+	return len(a.recordOffsets) > 0 && len(b.recordOffsets) > 0 && a.recordOffsets[0] == b.recordOffsets[0]
+}
+
+// isPathWithin reports whether path is dir or lies below it. Paths are
+// compared case-insensitively, close enough to the up-case table for this
+// guard.
+func isPathWithin(path, dir string) bool {
+	path = strings.ToUpper(strings.TrimSuffix(path, "/") + "/")
+	dir = strings.ToUpper(strings.TrimSuffix(dir, "/") + "/")
+	return strings.HasPrefix(path, dir)
+}
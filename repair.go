@@ -0,0 +1,487 @@
+package libxfat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	gopath "path"
+)
+
+// LostClusterAction says what Repair does with lost clusters: clusters the
+// bitmap marks allocated that no file, directory or metadata owns.
+type LostClusterAction int
+
+const (
+	// LOST_CLUSTERS_KEEP leaves lost clusters allocated.
+	LOST_CLUSTERS_KEEP LostClusterAction = iota
+	// LOST_CLUSTERS_FREE clears them in the allocation bitmap.
+	LOST_CLUSTERS_FREE
+	// LOST_CLUSTERS_RECOVER links every run of them into a FILEnnnn.CHK file
+	// in a new FOUND.nnn directory at the root, as chkdsk does.
+	LOST_CLUSTERS_RECOVER
+)
+
+var lostClusterActionNames = map[LostClusterAction]string{
+	LOST_CLUSTERS_KEEP:    "keep",
+	LOST_CLUSTERS_FREE:    "free",
+	LOST_CLUSTERS_RECOVER: "recover",
+}
+
+func (a LostClusterAction) String() string {
+	if name, ok := lostClusterActionNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("lost-clusters(%d)", int(a))
+}
+
+func (a LostClusterAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// RepairOptions selects the repairs Repair applies. Every repair is off
+// unless asked for.
+type RepairOptions struct {
+	// EntrySets recomputes the NameHash and SetChecksum of entry sets the
+	// check found with a wrong checksum or NameHash.
+	EntrySets bool
+	// CutLoops ends looping FAT chains at the cluster that turns back.
+	CutLoops bool
+	// LostClusters frees or recovers lost clusters.
+	LostClusters LostClusterAction
+	// RebuildBitmap makes the allocation bitmap match the directory tree.
+	// Lost clusters that are kept are freed by it; clusters the FAT marks
+	// bad keep their bit.
+	RebuildBitmap bool
+	// BootRegion copies the backup boot region over a main boot region that
+	// fails validation.
+	BootRegion bool
+	// ClearDirty clears VolumeDirty once every other repair succeeded. A
+	// finding left in RepairLog.Skipped keeps the flag as it was.
+	ClearDirty bool
+}
+
+// RepairKind names the repair a change was made for.
+type RepairKind int
+
+const (
+	REPAIR_BOOT_REGION RepairKind = iota + 1
+	REPAIR_VOLUME_FLAGS
+	REPAIR_ENTRY_SET
+	REPAIR_CHAIN_LOOP
+	REPAIR_LOST_CLUSTERS
+	REPAIR_BITMAP
+)
+
+var repairKindNames = map[RepairKind]string{
+	REPAIR_BOOT_REGION:   "boot-region",
+	REPAIR_VOLUME_FLAGS:  "volume-flags",
+	REPAIR_ENTRY_SET:     "entry-set",
+	REPAIR_CHAIN_LOOP:    "chain-loop",
+	REPAIR_LOST_CLUSTERS: "lost-clusters",
+	REPAIR_BITMAP:        "bitmap",
+}
+
+func (k RepairKind) String() string {
+	if name, ok := repairKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("repair(%d)", int(k))
+}
+
+func (k RepairKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// ByteChange is one write made by Repair: the bytes at Offset before and
+// after it, trimmed to the span that actually changed.
+type ByteChange struct {
+	Kind   RepairKind
+	Offset uint64
+	Old    []byte
+	New    []byte
+}
+
+// RepairLog lists every change Repair made, in the order it made them, and
+// the findings a selected repair could not fix.
+type RepairLog struct {
+	Changes []ByteChange
+	Skipped []Finding
+}
+
+// ChangedBytes returns the number of bytes written with a new value.
+func (l RepairLog) ChangedBytes() int {
+	count := 0
+	for _, change := range l.Changes {
+		count += len(change.New)
+	}
+	return count
+}
+
+// repairImage records every write made through it into a RepairLog. Writes
+// that would not change anything are dropped.
+type repairImage struct {
+	io.ReaderAt
+	log  *RepairLog
+	kind RepairKind
+}
+
+func (r *repairImage) WriteAt(p []byte, off int64) (int, error) {
+	w, ok := r.ReaderAt.(io.WriterAt)
+	if !ok {
+		return 0, ErrReadOnlyImage
+	}
+	old := make([]byte, len(p))
+	if err := readFullAt(r.ReaderAt, old, off); err != nil {
+		return 0, err
+	}
+	first := 0
+	for first < len(p) && old[first] == p[first] {
+		first++
+	}
+	if first == len(p) {
+		return len(p), nil
+	}
+	last := len(p)
+	for old[last-1] == p[last-1] {
+		last--
+	}
+
+	n, err := w.WriteAt(p, off)
+	if err != nil {
+		return n, err
+	}
+	r.log.Changes = append(r.log.Changes, ByteChange{
+		Kind:   r.kind,
+		Offset: uint64(off) + uint64(first),
+		Old:    old[first:last],
+		New:    append([]byte(nil), p[first:last]...),
+	})
+	return n, nil
+}
+
+// Repair applies the repairs selected in opts to the problems in report, a
+// report Check produced for this volume. Entry sets and looping chains are
+// fixed from the report; lost clusters and the bitmap are worked out again
+// afterwards, since a repaired entry set gives its clusters their owner back.
+// The volume is flagged dirty while Repair runs.
+//
+// The log holds every byte changed, also when Repair fails part way. Open the
+// volume on an Overlay to keep the original image untouched.
+func (e *ExFAT) Repair(report CheckReport, opts RepairOptions) (RepairLog, error) {
+	var log RepairLog
+	logger := &repairImage{ReaderAt: e.vbr.dimage, log: &log}
+	e.vbr.dimage = logger
+	defer func() { e.vbr.dimage = logger.ReaderAt }()
+	e.clusterMap = nil
+
+	if opts.BootRegion {
+		logger.kind = REPAIR_BOOT_REGION
+		if err := e.restoreBootRegion(); err != nil {
+			return log, err
+		}
+	}
+
+	logger.kind = REPAIR_VOLUME_FLAGS
+	flags := e.vbr.volumeFlags
+	if err := e.writeVolumeFlags(flags | VOLUME_FLAG_DIRTY); err != nil {
+		return log, err
+	}
+
+	for _, finding := range report.Findings {
+		var err error
+		switch {
+		case opts.EntrySets && finding.Kind == FINDING_MALFORMED_ENTRY_SET && finding.Diagnostic == DIAG_CHECKSUM_MISMATCH:
+			logger.kind = REPAIR_ENTRY_SET
+			err = e.repairEntrySet(finding.Path, finding.Offset)
+		case opts.EntrySets && finding.Kind == FINDING_NAME_HASH_MISMATCH:
+			logger.kind = REPAIR_ENTRY_SET
+			err = e.repairEntrySet(gopath.Dir(finding.Path), finding.Offset)
+		case opts.CutLoops && finding.Kind == FINDING_CHAIN_LOOP:
+			logger.kind = REPAIR_CHAIN_LOOP
+			err = e.cutLoop(finding)
+		default:
+			continue
+		}
+		if err != nil {
+			finding.Message = fmt.Sprintf("%s: not repaired: %v", finding.Message, err)
+			log.Skipped = append(log.Skipped, finding)
+		}
+	}
+
+	if opts.LostClusters != LOST_CLUSTERS_KEEP {
+		logger.kind = REPAIR_LOST_CLUSTERS
+		if err := e.repairLostClusters(opts.LostClusters); err != nil {
+			return log, err
+		}
+	}
+	if opts.RebuildBitmap {
+		logger.kind = REPAIR_BITMAP
+		if err := e.rebuildBitmap(); err != nil {
+			return log, err
+		}
+	}
+
+	logger.kind = REPAIR_VOLUME_FLAGS
+	if opts.ClearDirty && len(log.Skipped) == 0 {
+		flags &^= VOLUME_FLAG_DIRTY
+	}
+	return log, e.writeVolumeFlags(flags)
+}
+
+// restoreBootRegion copies the backup boot region over the main one when the
+// main one fails validation and the backup passes it.
+func (e *ExFAT) restoreBootRegion() error {
+	v := &e.vbr
+	size := uint64(VBR_SIZE) * uint64(v.sectorSize)
+	main := make([]byte, size)
+	if err := readFullAt(v.dimage, main, int64(v.vbrStart)); err != nil {
+		return err
+	}
+	if validBootRegion(main, v.sectorSize) {
+		return nil
+	}
+	backup := make([]byte, size)
+	if err := readFullAt(v.dimage, backup, int64(v.vbrStart+size)); err != nil {
+		return err
+	}
+	if !validBootRegion(backup, v.sectorSize) {
+		return ErrBootRegionDamaged
+	}
+	return v.writeAt(backup, v.vbrStart)
+}
+
+// validBootRegion checks the signature, boot signature, sector size and
+// checksum sector of a 12-sector boot region.
+func validBootRegion(region []byte, sectorSize uint32) bool {
+	if string(region[EXFAT_SIGN_OFFSET:EXFAT_SIGN_OFFSET+8]) != EXFAT_SIGNATURE ||
+		unpackBEShort(region[SYNC_OFFSET:SYNC_OFFSET+2]) != SYNC_VALUE ||
+		uint32(1)<<region[EXFAT_SECTOR_SIZE_OFFSET] != sectorSize {
+		return false
+	}
+	checksumSector := (VBR_SIZE - 1) * int(sectorSize)
+	checksum := bootChecksum(region[:checksumSector])
+	for off := checksumSector; off < len(region); off += 4 {
+		if binary.LittleEndian.Uint32(region[off:]) != checksum {
+			return false
+		}
+	}
+	return true
+}
+
+// repairEntrySet recomputes the NameHash and SetChecksum of the live entry
+// set whose primary record is at offset in the directory at dirPath.
+func (e *ExFAT) repairEntrySet(dirPath string, offset uint64) error {
+	upcase, err := e.loadUpcaseTable()
+	if err != nil {
+		return err
+	}
+	dir, err := e.Lookup(dirPath)
+	if err != nil {
+		return err
+	}
+	slots, err := e.readDirSlots(dir)
+	if err != nil {
+		return err
+	}
+	index := -1
+	for i, off := range slots.offsets {
+		if off == offset {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("%w: no record at offset %d in %s", ErrInvalidEntry, offset, dirPath)
+	}
+
+	var primary [EXFAT_DIRRECORD_SIZE]byte
+	if err := readFullAt(e.vbr.dimage, primary[:], int64(offset)); err != nil {
+		return err
+	}
+	count := 1 + int(primary[1])
+	if primary[0] != EXFAT_DIRRECORD_FILEDIR || count < 3 || index+count > len(slots.offsets) {
+		return fmt.Errorf("%w: no complete file entry set at offset %d", ErrInvalidEntry, offset)
+	}
+	offsets := slots.offsets[index : index+count]
+	records := make([][EXFAT_DIRRECORD_SIZE]byte, count)
+	for i, off := range offsets {
+		if err := readFullAt(e.vbr.dimage, records[i][:], int64(off)); err != nil {
+			return err
+		}
+	}
+	if records[1][0] != EXFAT_DIRRECORD_STREAM_EXT {
+		return fmt.Errorf("%w: entry set at offset %d has no stream record", ErrInvalidEntry, offset)
+	}
+
+	nameLen := int(records[1][3])
+	var name []uint16
+	for _, record := range records[2:] {
+		if record[0] != EXFAT_DIRRECORD_FILENAME_EXT {
+			continue
+		}
+		for pos := 2; pos < EXFAT_DIRRECORD_SIZE && len(name) < nameLen; pos += 2 {
+			name = append(name, binary.LittleEndian.Uint16(record[pos:]))
+		}
+	}
+	if len(name) < nameLen {
+		return fmt.Errorf("%w: entry set at offset %d holds %d of %d name characters", ErrInvalidEntry, offset, len(name), nameLen)
+	}
+
+	binary.LittleEndian.PutUint16(records[1][4:6], upcase.nameHash(name))
+	writeSetChecksum(records)
+	return e.writeRecords(offsets, records)
+}
+
+// cutLoop ends the chain at the cluster whose FAT entry points back into it.
+// A FAT that no longer holds the reported loop is left alone.
+func (e *ExFAT) cutLoop(finding Finding) error {
+	next, err := e.vbr.fatEntry(finding.Cluster)
+	if err != nil {
+		return err
+	}
+	if uint64(next) != finding.Actual {
+		return fmt.Errorf("FAT entry of cluster %d changed to %#x since the check", finding.Cluster, next)
+	}
+	return e.vbr.writeFatEntry(finding.Cluster, EXFAT_EOF_END)
+}
+
+// repairLostClusters frees or recovers the lost clusters a fresh check finds.
+func (e *ExFAT) repairLostClusters(action LostClusterAction) error {
+	c, err := e.check()
+	if err != nil {
+		return err
+	}
+	var lost []Run
+	for _, finding := range c.report.Findings {
+		if finding.Kind == FINDING_LOST_CLUSTERS {
+			lost = append(lost, Run{Start: finding.Cluster, Length: finding.Count})
+		}
+	}
+	if len(lost) == 0 {
+		return nil
+	}
+
+	a, err := e.newAllocator()
+	if err != nil {
+		return err
+	}
+	switch action {
+	case LOST_CLUSTERS_FREE:
+		for _, run := range lost {
+			for cluster := run.Start; cluster < run.End(); cluster++ {
+				if err := a.set(cluster, false); err != nil {
+					return err
+				}
+			}
+		}
+	case LOST_CLUSTERS_RECOVER:
+		if err := e.recoverLostClusters(a, lost); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown lost cluster action %s", action)
+	}
+	return a.flush()
+}
+
+// recoverLostClusters creates the first free FOUND.nnn directory at the root
+// and gives every lost run a FILEnnnn.CHK file that covers it as a
+// NoFatChain allocation.
+func (e *ExFAT) recoverLostClusters(a *allocator, lost []Run) error {
+	upcase, err := e.loadUpcaseTable()
+	if err != nil {
+		return err
+	}
+	rootEntries, err := e.ReadRootDir()
+	if err != nil {
+		return err
+	}
+	var found string
+	for i := 0; i < 1000 && found == ""; i++ {
+		name := fmt.Sprintf("FOUND.%03d", i)
+		if _, ok := findChild(upcase, rootEntries, name); !ok {
+			found = name
+		}
+	}
+	if found == "" {
+		return fmt.Errorf("%w: no free FOUND.nnn name", ErrEntryExists)
+	}
+
+	dirName, err := validateName(found)
+	if err != nil {
+		return err
+	}
+	cluster, err := a.next(0)
+	if err != nil {
+		return err
+	}
+	if err := e.vbr.writeAt(make([]byte, e.vbr.clusterSize), e.vbr.getClusterOffset(cluster)); err != nil {
+		return err
+	}
+	dirSpec := entrySetSpec{
+		name:       dirName,
+		options:    resolveCreateOptions(nil, true),
+		cluster:    cluster,
+		dataLen:    e.vbr.clusterSize,
+		noFatChain: true,
+	}
+	if err := e.insertEntrySet(a, e.rootEntry(), buildEntrySet(upcase, dirSpec)); err != nil {
+		return err
+	}
+
+	for i, run := range lost {
+		dir, err := e.Lookup("/" + found)
+		if err != nil {
+			return err
+		}
+		name, err := validateName(fmt.Sprintf("FILE%04d.CHK", i))
+		if err != nil {
+			return err
+		}
+		spec := entrySetSpec{
+			name:       name,
+			options:    resolveCreateOptions(nil, false),
+			cluster:    run.Start,
+			dataLen:    uint64(run.Length) * e.vbr.clusterSize,
+			noFatChain: true,
+		}
+		if err := e.insertEntrySet(a, dir, buildEntrySet(upcase, spec)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildBitmap sets the bitmap bit of every cluster a fresh check finds an
+// owner for and clears the others. Allocated clusters the FAT marks bad stay
+// allocated.
+func (e *ExFAT) rebuildBitmap() error {
+	c, err := e.check()
+	if err != nil {
+		return err
+	}
+	inventory, err := e.GetBadClusters()
+	if err != nil {
+		return err
+	}
+	bad := map[uint32]bool{}
+	for _, cluster := range inventory.Clusters {
+		bad[cluster.Cluster] = cluster.Allocated
+	}
+
+	a, err := e.newAllocator()
+	if err != nil {
+		return err
+	}
+	for index := uint32(0); index < e.vbr.nbClusters && int(index/8) < len(a.bitmap.bits); index++ {
+		cluster := index + uint32(FIRST_CLUSTER_NUMBER)
+		owned := c.isOwned(cluster) || bad[cluster]
+		if a.bitmap.isAllocated(cluster) == owned {
+			continue
+		}
+		if err := a.set(cluster, owned); err != nil {
+			return err
+		}
+	}
+	return a.flush()
+}
@@ -0,0 +1,233 @@
+package libxfat
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Run is an extent of Length consecutive clusters starting at Start.
+type Run struct {
+	Start  uint32
+	Length uint32
+}
+
+// End returns the first cluster after the run.
+func (r Run) End() uint32 {
+	return r.Start + r.Length
+}
+
+// Contains reports whether cluster lies inside the run.
+func (r Run) Contains(cluster uint32) bool {
+	return cluster >= r.Start && cluster-r.Start < r.Length
+}
+
+// runsClusterCount returns the number of clusters covered by runs.
+func runsClusterCount(runs []Run) uint64 {
+	var count uint64
+	for _, run := range runs {
+		count += uint64(run.Length)
+	}
+	return count
+}
+
+// mergeRuns sorts runs and joins the ones that overlap or touch.
+func mergeRuns(runs []Run) []Run {
+	sorted := append([]Run(nil), runs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+	var merged []Run
+	for _, run := range sorted {
+		if run.Length == 0 {
+			continue
+		}
+		if n := len(merged); n > 0 && run.Start <= merged[n-1].End() {
+			if run.End() > merged[n-1].End() {
+				merged[n-1].Length = run.End() - merged[n-1].Start
+			}
+			continue
+		}
+		merged = append(merged, run)
+	}
+	return merged
+}
+
+// clusterSet records the clusters a chain walk has visited, one bit per
+// cluster, in pages allocated as the chain reaches them.
+type clusterSet struct {
+	pages map[uint32]*[clusterSetPageWords]uint64
+}
+
+const (
+	clusterSetPageBits  = 1 << 12
+	clusterSetPageWords = clusterSetPageBits / 64
+)
+
+func (s *clusterSet) contains(cluster uint32) bool {
+	page := s.pages[cluster/clusterSetPageBits]
+	if page == nil {
+		return false
+	}
+	bit := cluster % clusterSetPageBits
+	return page[bit/64]&(1<<(bit%64)) != 0
+}
+
+func (s *clusterSet) insert(run Run) {
+	if s.pages == nil {
+		s.pages = map[uint32]*[clusterSetPageWords]uint64{}
+	}
+	for cluster := run.Start; cluster != run.End(); cluster++ {
+		page := s.pages[cluster/clusterSetPageBits]
+		if page == nil {
+			page = new([clusterSetPageWords]uint64)
+			s.pages[cluster/clusterSetPageBits] = page
+		}
+		bit := cluster % clusterSetPageBits
+		page[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// contiguousRun returns the run of a NoFatChain allocation of count
+// clusters, clipped to the cluster heap. The error reports an allocation
+// that starts or ends outside the heap; the clipped run is still usable.
+func (v *VBR) contiguousRun(start uint32, count uint64) (Run, error) {
+	if !v.isValidCluster(start) {
+		return Run{}, fmt.Errorf("%w: %d", ErrInvalidCluster, start)
+	}
+	heapEnd := uint64(v.nbClusters) + FIRST_CLUSTER_NUMBER
+	if uint64(start)+count > heapEnd {
+		return Run{Start: start, Length: uint32(heapEnd - uint64(start))},
+			fmt.Errorf("%w: %d", ErrInvalidCluster, heapEnd)
+	}
+	return Run{Start: start, Length: uint32(count)}, nil
+}
+
+// walkChainRuns follows the FAT from start and hands every run to fn as soon
+// as the chain leaves it. A limit above zero stops the walk after that many
+// clusters without reading further FAT entries. A damaged chain still
+// delivers the runs before the damage, then fails with ErrBadCluster,
+// ErrInvalidCluster, ErrClusterChainLoop or, past MaxChainLength clusters,
+// ErrMaxChainLength.
+func (v *VBR) walkChainRuns(start uint32, limit uint64, fn func(run Run) error) error {
+	trace := v.followChain(start, limit, fn)
+	switch trace.end {
+	case chainEndBad:
+		return ErrBadCluster
+	case chainEndInvalid:
+		return fmt.Errorf("%w: %d", ErrInvalidCluster, trace.next)
+	case chainEndLoop:
+		return ErrClusterChainLoop
+	case chainEndError:
+		return trace.err
+	}
+	return nil
+}
+
+// followChain is the chain walker behind walkChainRuns and traceChain. It
+// records where and why the chain ends in the returned trace, whose runs it
+// leaves empty. An error from fn ends the walk with chainEndError.
+func (v *VBR) followChain(start uint32, limit uint64, fn func(run Run) error) (trace chainTrace) {
+	if !v.isValidCluster(start) {
+		trace.end = chainEndInvalid
+		trace.next = start
+		return trace
+	}
+
+	var seen clusterSet
+	run := Run{Start: start, Length: 1}
+	trace.count = 1
+	finish := func(end chainEnd, next uint32, err error) chainTrace {
+		trace.end, trace.next, trace.err = end, next, err
+		if ferr := fn(run); ferr != nil {
+			trace.end, trace.err = chainEndError, ferr
+		}
+		return trace
+	}
+
+	for {
+		if limit > 0 && trace.count >= limit {
+			return finish(chainEndEOF, 0, nil)
+		}
+
+		next, err := v.fatEntry(run.End() - 1)
+		if err != nil {
+			return finish(chainEndError, 0, err)
+		}
+		switch {
+		case next >= EXFAT_EOF_START && next <= EXFAT_EOF_END:
+			return finish(chainEndEOF, 0, nil)
+		case next == EXFAT_BAD_CLUSTER:
+			return finish(chainEndBad, next, nil)
+		case !v.isValidCluster(next):
+			return finish(chainEndInvalid, next, nil)
+		case run.Contains(next) || seen.contains(next):
+			return finish(chainEndLoop, next, nil)
+		}
+
+		if v.maxChainLength > 0 && trace.count+1 > uint64(v.maxChainLength) {
+			return finish(chainEndError, 0, v.chainLengthError(start))
+		}
+		trace.count++
+		if next == run.End() {
+			run.Length++
+			continue
+		}
+		if err := fn(run); err != nil {
+			trace.end, trace.err = chainEndError, err
+			return trace
+		}
+		seen.insert(run)
+		run = Run{Start: next, Length: 1}
+	}
+}
+
+func (v *VBR) chainLengthError(start uint32) error {
+	return &TraversalError{Err: ErrMaxChainLength, Cluster: start, Limit: uint64(v.maxChainLength)}
+}
+
+// walkEntryRuns hands fn the runs holding entry's data, in file order, and
+// stops once they cover DataLength.
+func (v *VBR) walkEntryRuns(entry Entry, fn func(run Run) error) error {
+	if entry.dataLen == 0 {
+		return nil
+	}
+	sizeInClusters, _ := v.size2Clusters(entry.dataLen)
+
+	if entry.noFatChain {
+		run, err := v.contiguousRun(entry.entryCluster, sizeInClusters)
+		if run.Length > 0 {
+			if ferr := fn(run); ferr != nil {
+				return ferr
+			}
+		}
+		return err
+	}
+	return v.walkChainRuns(entry.entryCluster, sizeInClusters, fn)
+}
+
+// getClusterRuns returns the extents allocated to entry. FAT chained entries
+// report their whole chain, even past DataLength.
+func (v *VBR) getClusterRuns(entry Entry) ([]Run, error) {
+	if entry.dataLen == 0 {
+		return nil, nil
+	}
+
+	if entry.noFatChain {
+		sizeInClusters, _ := v.size2Clusters(entry.dataLen)
+		run, err := v.contiguousRun(entry.entryCluster, sizeInClusters)
+		if err != nil {
+			return nil, err
+		}
+		return []Run{run}, nil
+	}
+
+	var runs []Run
+	err := v.walkChainRuns(entry.entryCluster, 0, func(run Run) error {
+		runs = append(runs, run)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
@@ -0,0 +1,243 @@
+package libxfat
+
+import "strings"
+
+// SalvagePart identifies one piece of a file entry set recovered in salvage
+// mode.
+type SalvagePart uint8
+
+const (
+	// SALVAGE_PRIMARY: the 0x85/0x05 file directory record (attributes,
+	// timestamps).
+	SALVAGE_PRIMARY SalvagePart = 1 << iota
+	// SALVAGE_STREAM: the 0xC0/0x40 stream extension record (size, first
+	// cluster, name length).
+	SALVAGE_STREAM
+	// SALVAGE_NAME: one or more 0xC1/0x41 file name records.
+	SALVAGE_NAME
+	// SALVAGE_CHECKSUM: the complete set matched its SetChecksum.
+	SALVAGE_CHECKSUM
+)
+
+// Weights used to score a salvaged entry. They sum to 1, so an intact set
+// whose parts all validate scores 1.
+var salvageWeights = []struct {
+	part   SalvagePart
+	weight float64
+}{
+	{SALVAGE_PRIMARY, 0.2},
+	{SALVAGE_STREAM, 0.3},
+	{SALVAGE_NAME, 0.2},
+	{SALVAGE_CHECKSUM, 0.3},
+}
+
+// Has reports whether every bit of part is set.
+func (p SalvagePart) Has(part SalvagePart) bool {
+	return p&part == part
+}
+
+func (p SalvagePart) String() string {
+	if p == 0 {
+		return "none"
+	}
+	var names []string
+	if p.Has(SALVAGE_PRIMARY) {
+		names = append(names, "primary")
+	}
+	if p.Has(SALVAGE_STREAM) {
+		names = append(names, "stream")
+	}
+	if p.Has(SALVAGE_NAME) {
+		names = append(names, "name")
+	}
+	if p.Has(SALVAGE_CHECKSUM) {
+		names = append(names, "checksum")
+	}
+	return strings.Join(names, ",")
+}
+
+// salvageConfidence scores recovered parts: validated parts count fully,
+// parts that were present but failed validation count a third.
+func salvageConfidence(found, valid SalvagePart) float64 {
+	var score float64
+	for _, w := range salvageWeights {
+		switch {
+		case valid.Has(w.part):
+			score += w.weight
+		case found.Has(w.part):
+			score += w.weight / 3
+		}
+	}
+	return score
+}
+
+// SetSalvage switches salvage mode on or off. In salvage mode directory reads
+// and RecoverDeletedEntries keep every fragment of a file entry set they find,
+// including sets that fail their checksum and lone stream, name or file
+// records. Each result reports which parts were found and validated and a
+// confidence score. File sets parsed in salvage mode do not produce
+// diagnostics; the salvage parts carry the same information.
+func (e *ExFAT) SetSalvage(enabled bool) {
+	e.salvage = enabled
+}
+
+// salvager groups the file, stream and name records of one (possibly
+// damaged) entry set.
+type salvager struct {
+	active      bool
+	entry       Entry
+	found       SalvagePart
+	valid       SalvagePart
+	checksum    uint16
+	live        uint16
+	expected    uint16
+	remaining   int
+	units       []uint16
+	nameRecords int
+	benign      int
+	trailing    int
+}
+
+// isSalvageRecord reports whether a record type belongs to a file entry set.
+func isSalvageRecord(dirtype byte) bool {
+	switch dirtype & 0x7f {
+	case EXFAT_DIRRECORD_DEL_FILEDIR, EXFAT_DIRRECORD_DEL_STREAM_EXT, EXFAT_DIRRECORD_DEL_FILENAME_EXT:
+		return true
+	}
+	return false
+}
+
+// salvageRecord feeds one record to the salvager. Records that cannot belong
+// to a file entry set end the current group.
+func (e *ExFAT) salvageRecord(rec dirRecordView, recOffset uint64, entries *[]Entry) {
+	s := &e.salvager
+	dirtype := rec.typeByte()
+
+	switch dirtype & 0x7f {
+	case EXFAT_DIRRECORD_DEL_FILEDIR:
+		e.flushSalvage(entries)
+		s.start(dirtype)
+		s.found |= SALVAGE_PRIMARY
+		if e.validateFileDentry(rec.data) {
+			s.valid |= SALVAGE_PRIMARY
+		}
+		s.entry.applyFileRecord(rec)
+		s.remaining = int(s.entry.secondaryCount)
+		s.expected = rec.le16(2)
+		s.checksum = exfatDirSetChecksumAdd(0, rec.data, true)
+		s.live = exfatDirLiveChecksumAdd(0, rec.data, true)
+	case EXFAT_DIRRECORD_DEL_STREAM_EXT:
+		if !s.active || s.found.Has(SALVAGE_STREAM) || s.found.Has(SALVAGE_NAME) {
+			e.flushSalvage(entries)
+			s.start(deletedOrLiveFileType(dirtype))
+		}
+		s.found |= SALVAGE_STREAM
+		if e.validateFileStreamDentry(rec.data) {
+			s.valid |= SALVAGE_STREAM
+		}
+		s.entry.applyStreamRecord(rec)
+		s.addSecondary(rec)
+	case EXFAT_DIRRECORD_DEL_FILENAME_EXT:
+		if !s.active {
+			s.start(deletedOrLiveFileType(dirtype))
+		}
+		s.found |= SALVAGE_NAME
+		s.units = append(s.units, utf16leUnitsFromBytes(rec.bytes(2, EXFAT_DIRRECORD_SIZE), 15)...)
+		s.nameRecords++
+		s.addSecondary(rec)
+	default:
+		if dirtype&0x40 != 0 && s.active && s.found.Has(SALVAGE_PRIMARY) && s.remaining > 0 {
+			s.addSecondary(rec)
+			s.benign++
+			break
+		}
+		e.flushSalvage(entries)
+		return
+	}
+
+	s.entry.recordOffsets = append(s.entry.recordOffsets, recOffset)
+	if s.found.Has(SALVAGE_PRIMARY) && s.remaining == 0 {
+		s.trailing = e.trailingNameRecords(s.entry.etype)
+		e.flushSalvage(entries)
+	}
+}
+
+func (s *salvager) start(etype byte) {
+	*s = salvager{active: true}
+	s.entry.etype = etype
+}
+
+func (s *salvager) addSecondary(rec dirRecordView) {
+	s.checksum = exfatDirSetChecksumAdd(s.checksum, rec.data, false)
+	s.live = exfatDirLiveChecksumAdd(s.live, rec.data, false)
+	s.remaining--
+}
+
+// deletedOrLiveFileType returns the file directory type matching the in-use
+// bit of a fragment, so fragments without a primary record still report
+// whether they were deleted.
+func deletedOrLiveFileType(dirtype byte) byte {
+	if entryInUse(dirtype) {
+		return EXFAT_DIRRECORD_FILEDIR
+	}
+	return EXFAT_DIRRECORD_DEL_FILEDIR
+}
+
+// flushSalvage emits the group being assembled, if any.
+func (e *ExFAT) flushSalvage(entries *[]Entry) {
+	s := &e.salvager
+	if !s.active {
+		return
+	}
+
+	entry := s.entry
+	units := s.units
+	nameLen := int(entry.nameLen)
+	if s.found.Has(SALVAGE_STREAM) && nameLen > 0 && len(units) > nameLen {
+		units = units[:nameLen]
+	}
+	if s.valid.Has(SALVAGE_STREAM) && nameLen > 0 && nameRecordsFor(nameLen) == s.nameRecords && len(s.units) >= nameLen {
+		s.valid |= SALVAGE_NAME
+	}
+	if s.found.Has(SALVAGE_PRIMARY) && s.remaining == 0 {
+		s.found |= SALVAGE_CHECKSUM
+		if s.checksum == s.expected || s.live == s.expected {
+			s.valid |= SALVAGE_CHECKSUM
+		}
+	}
+
+	entry.rawName = append([]uint16(nil), s.units...)
+	if s.found.Has(SALVAGE_NAME) {
+		entry.nameAnomalies = detectNameAnomalies(s.units, nameLen, s.nameRecords+s.trailing, s.benign, int(entry.secondaryCount))
+	}
+	entry.name = utf16UnitsToString(units)
+	if entry.IsDeleted() {
+		entry.name += DELETED
+	}
+	entry.salvaged = true
+	entry.salvageFound = s.found
+	entry.salvageValid = s.valid
+	entry.confidence = salvageConfidence(s.found, s.valid)
+
+	*s = salvager{}
+	e.emitEntry(entries, entry)
+}
+
+// salvageChunk runs the salvager over every record of a carved cluster.
+func (e *ExFAT) salvageChunk(clusterdata []byte) []Entry {
+	var entries []Entry
+	e.salvager = salvager{}
+	e.clusterdata = clusterdata
+
+	for offset := 0; offset+EXFAT_DIRRECORD_SIZE <= len(clusterdata); offset += EXFAT_DIRRECORD_SIZE {
+		rec, ok := newDirRecordView(clusterdata, offset)
+		if !ok {
+			break
+		}
+		e.offset = offset
+		e.salvageRecord(rec, e.recordOffset(), &entries)
+	}
+	e.flushSalvage(&entries)
+
+	return entries
+}
@@ -0,0 +1,84 @@
+package libxfat
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestSalvageKeepsNameOfSetWithBadChecksum(t *testing.T) {
+	exfat := ExFAT{salvage: true}
+
+	clusterdata := make([]byte, EXFAT_DIRRECORD_SIZE*4)
+	clusterdata[0] = EXFAT_DIRRECORD_FILEDIR
+	clusterdata[1] = 2
+	clusterdata[2] = 0x34 // wrong SetChecksum
+	clusterdata[EXFAT_DIRRECORD_SIZE] = EXFAT_DIRRECORD_STREAM_EXT
+	clusterdata[EXFAT_DIRRECORD_SIZE+3] = 2
+	clusterdata[EXFAT_DIRRECORD_SIZE*2] = EXFAT_DIRRECORD_FILENAME_EXT
+	clusterdata[EXFAT_DIRRECORD_SIZE*2+2] = 'O'
+	clusterdata[EXFAT_DIRRECORD_SIZE*2+4] = 'K'
+
+	entries := exfat.parseDir(clusterdata)
+	if len(entries) != 1 {
+		t.Fatalf("parseDir() entries len = %d, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.GetName() != "OK" || !entry.IsSalvaged() {
+		t.Fatalf("entry name=%q salvaged=%t", entry.GetName(), entry.IsSalvaged())
+	}
+	if entry.ValidatedParts() != SALVAGE_PRIMARY|SALVAGE_STREAM|SALVAGE_NAME {
+		t.Fatalf("ValidatedParts() = %v", entry.ValidatedParts())
+	}
+	if !entry.SalvagedParts().Has(SALVAGE_CHECKSUM) {
+		t.Fatalf("SalvagedParts() = %v, want checksum found", entry.SalvagedParts())
+	}
+	if got := entry.Confidence(); math.Abs(got-0.8) > 1e-9 {
+		t.Fatalf("Confidence() = %v, want 0.8", got)
+	}
+}
+
+func TestSalvageChunkRecoversLoneFragments(t *testing.T) {
+	exfat := ExFAT{salvage: true, vbr: VBR{nbClusters: 16, clusterSize: 512}}
+
+	clusterdata := make([]byte, EXFAT_DIRRECORD_SIZE*6)
+
+	// Lone deleted stream record followed by one name record.
+	clusterdata[0] = EXFAT_DIRRECORD_DEL_STREAM_EXT
+	clusterdata[3] = 3
+	binary.LittleEndian.PutUint32(clusterdata[20:24], 7)
+	binary.LittleEndian.PutUint64(clusterdata[24:32], 1000)
+	name := EXFAT_DIRRECORD_SIZE
+	clusterdata[name] = EXFAT_DIRRECORD_DEL_FILENAME_EXT
+	copy(clusterdata[name+2:], []byte{'c', 0, 'a', 0, 'r', 0})
+
+	// Zero record, then a lone deleted file record with timestamps.
+	primary := EXFAT_DIRRECORD_SIZE * 3
+	clusterdata[primary] = EXFAT_DIRRECORD_DEL_FILEDIR
+	clusterdata[primary+1] = 2
+	binary.LittleEndian.PutUint32(clusterdata[primary+12:primary+16], 0x5A2B3C4D)
+
+	entries := exfat.salvageChunk(clusterdata)
+	if len(entries) != 2 {
+		t.Fatalf("salvageChunk() entries len = %d, want 2", len(entries))
+	}
+
+	fragment := entries[0]
+	if fragment.GetName() != "car"+DELETED || fragment.GetEntryCluster() != 7 || fragment.GetSize() != 1000 {
+		t.Fatalf("fragment name=%q cluster=%d size=%d", fragment.GetName(), fragment.GetEntryCluster(), fragment.GetSize())
+	}
+	if fragment.SalvagedParts() != SALVAGE_STREAM|SALVAGE_NAME || fragment.ValidatedParts() != SALVAGE_STREAM|SALVAGE_NAME {
+		t.Fatalf("fragment parts found=%v valid=%v", fragment.SalvagedParts(), fragment.ValidatedParts())
+	}
+	if !fragment.IsDeleted() {
+		t.Fatal("fragment from deleted records should be deleted")
+	}
+
+	lone := entries[1]
+	if lone.SalvagedParts() != SALVAGE_PRIMARY || lone.modified != 0x5A2B3C4D {
+		t.Fatalf("lone primary parts=%v modified=%#x", lone.SalvagedParts(), lone.modified)
+	}
+	if lone.Confidence() >= fragment.Confidence() {
+		t.Fatalf("lone primary confidence %v should be below fragment %v", lone.Confidence(), fragment.Confidence())
+	}
+}
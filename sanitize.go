@@ -0,0 +1,397 @@
+package libxfat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// RemnantKind names data that VerifySanitized found left behind.
+type RemnantKind int
+
+const (
+	// REMNANT_FREE_CLUSTERS: free clusters that do not hold the fill.
+	REMNANT_FREE_CLUSTERS RemnantKind = iota + 1
+	// REMNANT_FILE_SLACK: bytes past the end of a file, in its last
+	// cluster, that do not hold the fill.
+	REMNANT_FILE_SLACK
+	// REMNANT_DIRECTORY_RECORD: an unused directory record, or one past the
+	// end of the directory, that still holds data.
+	REMNANT_DIRECTORY_RECORD
+	// REMNANT_RECOVERED_ENTRY: RecoverDeletedEntries still finds an entry
+	// set in free space.
+	REMNANT_RECOVERED_ENTRY
+	// REMNANT_UNREADABLE_DIRECTORY: a directory that could not be read, so
+	// neither its records nor the slack of its files were handled.
+	REMNANT_UNREADABLE_DIRECTORY
+)
+
+var remnantKindNames = map[RemnantKind]string{
+	REMNANT_FREE_CLUSTERS:        "free-clusters",
+	REMNANT_FILE_SLACK:           "file-slack",
+	REMNANT_DIRECTORY_RECORD:     "directory-record",
+	REMNANT_RECOVERED_ENTRY:      "recovered-entry",
+	REMNANT_UNREADABLE_DIRECTORY: "unreadable-directory",
+}
+
+func (k RemnantKind) String() string {
+	if name, ok := remnantKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("remnant(%d)", int(k))
+}
+
+func (k RemnantKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Remnant is an area VerifySanitized found still holding data. Offset and
+// Length give its absolute location in the image; Mismatched counts the bytes
+// that differ from what Sanitize writes; all three are zero for an unreadable
+// directory. Path names the file or directory, when there is one.
+type Remnant struct {
+	Kind       RemnantKind
+	Offset     uint64
+	Length     uint64
+	Mismatched uint64
+	Path       string
+	Message    string
+}
+
+// SanitizeOptions sets what Sanitize writes.
+type SanitizeOptions struct {
+	// Pattern fills free clusters and file slack. It starts over at every
+	// cluster boundary. Empty means zeros.
+	Pattern []byte
+}
+
+// SanitizeReport says what Sanitize overwrote and what its verification
+// found afterwards. BadClusters counts free clusters the FAT marks bad, which
+// are left alone.
+type SanitizeReport struct {
+	FreeClusters     uint64
+	BadClusters      uint64
+	SlackBytes       uint64
+	DeletedRecords   int
+	DirectoryRecords int
+	Remnants         []Remnant
+}
+
+// Clean reports whether the verification found nothing left behind.
+func (r SanitizeReport) Clean() bool {
+	return len(r.Remnants) == 0
+}
+
+const sanitizeChunk = 1 << 20
+
+// Sanitize overwrites what a file system keeps after data is deleted, then
+// runs VerifySanitized and returns its remnants in the report.
+//
+// Every free cluster is filled with the pattern, except those the FAT marks
+// bad. The bytes of each live file's last cluster past its DataLength are
+// filled the same way. In every live directory the unused records are
+// scrubbed: deleted records after the last in-use one become 0x00 records and
+// join the end of the directory, deleted records between live ones become
+// empty 0x05 records, which no reader takes for an entry set, and the records
+// past the end of the directory are zeroed. A 0x03 no-label record keeps its
+// type. Live records are not touched.
+func (e *ExFAT) Sanitize(opts ...SanitizeOptions) (SanitizeReport, error) {
+	s, err := e.newSanitizer(false, opts)
+	if err != nil {
+		return SanitizeReport{}, err
+	}
+	err = e.update(func(*allocator) error {
+		return s.run()
+	})
+	if err != nil {
+		return s.report, err
+	}
+	s.report.Remnants, err = e.VerifySanitized(opts...)
+	return s.report, err
+}
+
+// VerifySanitized checks a volume against what Sanitize writes with the same
+// options: free clusters and file slack hold the fill, and unused directory
+// records hold nothing. It then runs RecoverDeletedEntries, which must not
+// find anything. Every difference is returned as a Remnant, and so is every
+// directory that could not be read, as nothing in it was checked.
+func (e *ExFAT) VerifySanitized(opts ...SanitizeOptions) ([]Remnant, error) {
+	s, err := e.newSanitizer(true, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.run(); err != nil {
+		return nil, err
+	}
+
+	recovered, err := e.RecoverDeletedEntries()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range recovered {
+		remnant := Remnant{
+			Kind:    REMNANT_RECOVERED_ENTRY,
+			Path:    entry.Path(),
+			Message: fmt.Sprintf("RecoverDeletedEntries found %s", entry.Path()),
+		}
+		if len(entry.recordOffsets) > 0 {
+			remnant.Offset = entry.recordOffsets[0]
+			remnant.Length = uint64(len(entry.recordOffsets)) * EXFAT_DIRRECORD_SIZE
+		}
+		s.report.Remnants = append(s.report.Remnants, remnant)
+	}
+	return s.report.Remnants, nil
+}
+
+// sanitizer walks the areas Sanitize overwrites. It writes them, or with
+// verify set compares them and collects remnants.
+type sanitizer struct {
+	e       *ExFAT
+	pattern []byte
+	verify  bool
+	bad     map[uint32]bool
+	buf     []byte
+	want    []byte
+	report  SanitizeReport
+}
+
+func (e *ExFAT) newSanitizer(verify bool, opts []SanitizeOptions) (*sanitizer, error) {
+	var options SanitizeOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	pattern := options.Pattern
+	if len(pattern) == 0 {
+		pattern = []byte{0}
+	}
+	bad, err := e.GetBadClusters()
+	if err != nil {
+		return nil, err
+	}
+	s := &sanitizer{e: e, pattern: pattern, verify: verify, bad: map[uint32]bool{}}
+	for _, cluster := range bad.Clusters {
+		if !cluster.Allocated {
+			s.bad[cluster.Cluster] = true
+		}
+	}
+
+	chunk := uint64(sanitizeChunk)
+	if clusterSize := e.vbr.clusterSize; chunk < clusterSize {
+		chunk = clusterSize
+	}
+	s.buf = make([]byte, chunk)
+	s.want = make([]byte, chunk)
+	return s, nil
+}
+
+// run handles the directories and file slack of the tree, then the free
+// clusters.
+func (s *sanitizer) run() error {
+	e := s.e
+	err := e.walkTree(func(entry Entry) error {
+		if entry.IsDir() || entry.IsDeleted() || entry.IsInvalid() || entry.IsVirtualEntry() || entry.IsSpecialFile() || entry.dataLen == 0 {
+			return nil
+		}
+		return s.fileSlack(entry)
+	}, func(dir Entry, _ []Diagnostic, err error) error {
+		if err != nil {
+			s.report.Remnants = append(s.report.Remnants, Remnant{
+				Kind:    REMNANT_UNREADABLE_DIRECTORY,
+				Path:    dir.Path(),
+				Message: fmt.Sprintf("directory %s could not be read: %v", dir.Path(), err),
+			})
+			return nil
+		}
+		return s.directory(dir)
+	})
+	if err != nil {
+		return err
+	}
+
+	free, err := e.GetFreeRuns()
+	if err != nil {
+		return err
+	}
+	for _, run := range free {
+		start := run.Start
+		for cluster := run.Start; cluster <= run.End(); cluster++ {
+			if cluster < run.End() && !s.bad[cluster] {
+				continue
+			}
+			if cluster > start {
+				if err := s.freeClusters(Run{Start: start, Length: cluster - start}); err != nil {
+					return err
+				}
+			}
+			if cluster < run.End() {
+				s.report.BadClusters++
+			}
+			start = cluster + 1
+		}
+	}
+	return nil
+}
+
+func (s *sanitizer) freeClusters(run Run) error {
+	v := &s.e.vbr
+	off := v.getClusterOffset(run.Start)
+	desc := fmt.Sprintf("free clusters %d-%d", run.Start, run.End()-1)
+	if err := s.fill(REMNANT_FREE_CLUSTERS, off, uint64(run.Length)*v.clusterSize, "", desc); err != nil {
+		return err
+	}
+	if !s.verify {
+		s.report.FreeClusters += uint64(run.Length)
+	}
+	return nil
+}
+
+// fileSlack handles the bytes of entry's last cluster past its DataLength.
+func (s *sanitizer) fileSlack(entry Entry) error {
+	v := &s.e.vbr
+	runs, err := v.getClusterRuns(entry)
+	if err != nil {
+		return err
+	}
+	used := entry.dataLen % v.clusterSize
+	if used == 0 || len(runs) == 0 {
+		return nil
+	}
+	last := runs[len(runs)-1].End() - 1
+	off := v.getClusterOffset(last) + used
+	length := v.clusterSize - used
+	if err := s.fill(REMNANT_FILE_SLACK, off, length, entry.Path(), fmt.Sprintf("slack of %s in cluster %d", entry.Path(), last)); err != nil {
+		return err
+	}
+	if !s.verify {
+		s.report.SlackBytes += length
+	}
+	return nil
+}
+
+// fill writes the pattern over length bytes at off, or compares them with
+// it. The pattern is aligned on the cluster holding each byte.
+func (s *sanitizer) fill(kind RemnantKind, off, length uint64, path, desc string) error {
+	v := &s.e.vbr
+	remnant := Remnant{Kind: kind, Offset: off, Length: length, Path: path}
+	for pos := uint64(0); pos < length; {
+		n := length - pos
+		if n > uint64(len(s.buf)) {
+			n = uint64(len(s.buf))
+		}
+		want := s.want[:n]
+		fillPattern(want, s.pattern, (off+pos-v.dataAreaStart)%v.clusterSize, v.clusterSize)
+
+		if !s.verify {
+			if err := v.writeAt(want, off+pos); err != nil {
+				return err
+			}
+			pos += n
+			continue
+		}
+		got := s.buf[:n]
+		if err := readFullAt(v.dimage, got, int64(off+pos)); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				remnant.Mismatched++
+			}
+		}
+		pos += n
+	}
+
+	if remnant.Mismatched > 0 {
+		remnant.Message = fmt.Sprintf("%d bytes of %s do not hold the fill", remnant.Mismatched, desc)
+		s.report.Remnants = append(s.report.Remnants, remnant)
+	}
+	return nil
+}
+
+// directory scrubs the unused records of dir, or checks that they are.
+func (s *sanitizer) directory(dir Entry) error {
+	e := s.e
+	v := &e.vbr
+	slots, err := e.readDirSlots(dir)
+	if err != nil {
+		return err
+	}
+	path := dir.Path()
+	if slots.root {
+		path = "/"
+	}
+
+	records := make([][EXFAT_DIRRECORD_SIZE]byte, len(slots.offsets))
+	for i, off := range slots.offsets {
+		if err := readFullAt(v.dimage, records[i][:], int64(off)); err != nil {
+			return err
+		}
+	}
+	kept := -1
+	for i, rec := range records[:slots.end] {
+		if entryInUse(rec[0]) || rec[0] == EXFAT_DIRRECORD_NOLABEL {
+			kept = i
+		}
+	}
+
+	for i, rec := range records {
+		var scrubbed [EXFAT_DIRRECORD_SIZE]byte
+		switch {
+		case i < slots.end && entryInUse(rec[0]):
+			continue
+		case i < slots.end && rec[0] == EXFAT_DIRRECORD_NOLABEL:
+			scrubbed[0] = EXFAT_DIRRECORD_NOLABEL
+		case i < kept:
+			scrubbed[0] = EXFAT_DIRRECORD_DEL_FILEDIR
+		}
+		if rec == scrubbed {
+			continue
+		}
+
+		off := slots.offsets[i]
+		if s.verify {
+			desc := "unused record"
+			if i >= slots.end {
+				desc = "record past the end of the directory"
+			}
+			s.report.Remnants = append(s.report.Remnants, Remnant{
+				Kind:       REMNANT_DIRECTORY_RECORD,
+				Offset:     off,
+				Length:     EXFAT_DIRRECORD_SIZE,
+				Mismatched: uint64(countDiffering(rec[:], scrubbed[:])),
+				Path:       path,
+				Message:    fmt.Sprintf("%s %#02x at offset %d in %s holds data", desc, rec[0], off, path),
+			})
+			continue
+		}
+		if err := v.writeAt(scrubbed[:], off); err != nil {
+			return err
+		}
+		if i < slots.end {
+			s.report.DeletedRecords++
+		} else {
+			s.report.DirectoryRecords++
+		}
+	}
+	return nil
+}
+
+// fillPattern fills p with pattern, starting over at every cluster boundary.
+// at is the position of p[0] within its cluster.
+func fillPattern(p, pattern []byte, at, clusterSize uint64) {
+	for i := range p {
+		p[i] = pattern[at%uint64(len(pattern))]
+		if at++; at == clusterSize {
+			at = 0
+		}
+	}
+}
+
+func countDiffering(a, b []byte) int {
+	n := 0
+	for i := range a {
+		if a[i] != b[i] {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,261 @@
+package libxfat
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VolumeFlags is the VolumeFlags field of the boot sector (offset 0x6A).
+type VolumeFlags uint16
+
+const (
+	// VOLUME_FLAG_ACTIVE_FAT: the second FAT and bitmap are active (TexFAT).
+	VOLUME_FLAG_ACTIVE_FAT VolumeFlags = 1 << iota
+	// VOLUME_FLAG_DIRTY: the volume was not unmounted cleanly.
+	VOLUME_FLAG_DIRTY
+	// VOLUME_FLAG_MEDIA_FAILURE: the driver hit read or write errors.
+	VOLUME_FLAG_MEDIA_FAILURE
+	// VOLUME_FLAG_CLEAR_TO_ZERO: reserved, should be zero.
+	VOLUME_FLAG_CLEAR_TO_ZERO
+)
+
+// PERCENT_IN_USE_UNKNOWN is the PercentInUse value meaning "not available".
+const PERCENT_IN_USE_UNKNOWN = 0xff
+
+// Has reports whether every bit of flag is set.
+func (f VolumeFlags) Has(flag VolumeFlags) bool {
+	return f&flag == flag
+}
+
+func (f VolumeFlags) String() string {
+	if f == 0 {
+		return "none"
+	}
+	var names []string
+	if f.Has(VOLUME_FLAG_ACTIVE_FAT) {
+		names = append(names, "active-fat")
+	}
+	if f.Has(VOLUME_FLAG_DIRTY) {
+		names = append(names, "dirty")
+	}
+	if f.Has(VOLUME_FLAG_MEDIA_FAILURE) {
+		names = append(names, "media-failure")
+	}
+	if f.Has(VOLUME_FLAG_CLEAR_TO_ZERO) {
+		names = append(names, "clear-to-zero")
+	}
+	if rest := f &^ (VOLUME_FLAG_ACTIVE_FAT | VOLUME_FLAG_DIRTY | VOLUME_FLAG_MEDIA_FAILURE | VOLUME_FLAG_CLEAR_TO_ZERO); rest != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint16(rest)))
+	}
+	return strings.Join(names, ",")
+}
+
+func (f VolumeFlags) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// GetVolumeFlags returns the VolumeFlags field of the main boot sector.
+func (e *ExFAT) GetVolumeFlags() VolumeFlags {
+	return e.vbr.volumeFlags
+}
+
+// IsVolumeDirty reports whether the VolumeDirty flag is set.
+func (e *ExFAT) IsVolumeDirty() bool {
+	return e.vbr.volumeFlags.Has(VOLUME_FLAG_DIRTY)
+}
+
+// HasMediaFailure reports whether the MediaFailure flag is set.
+func (e *ExFAT) HasMediaFailure() bool {
+	return e.vbr.volumeFlags.Has(VOLUME_FLAG_MEDIA_FAILURE)
+}
+
+// GetPercentInUse returns the PercentInUse byte of the boot sector. ok is
+// false when the volume records it as unknown (0xFF).
+func (e *ExFAT) GetPercentInUse() (percent byte, ok bool) {
+	return e.vbr.percentInUse, e.vbr.percentInUse != PERCENT_IN_USE_UNKNOWN
+}
+
+// SuspectKind names a structure that looks caught in the middle of an update.
+type SuspectKind int
+
+const (
+	// SUSPECT_DIRTY_FLAG: the VolumeDirty flag is still set.
+	SUSPECT_DIRTY_FLAG SuspectKind = iota + 1
+	// SUSPECT_MEDIA_FAILURE: the MediaFailure flag is set.
+	SUSPECT_MEDIA_FAILURE
+	// SUSPECT_STALE_PERCENT_IN_USE: PercentInUse disagrees with the bitmap.
+	SUSPECT_STALE_PERCENT_IN_USE
+	// SUSPECT_TORN_ENTRY_SET: an entry set fails its checksum, as if it was
+	// only partly written.
+	SUSPECT_TORN_ENTRY_SET
+	// SUSPECT_UNOWNED_ALLOCATION: clusters were allocated in the bitmap but
+	// no entry points at them yet.
+	SUSPECT_UNOWNED_ALLOCATION
+	// SUSPECT_UNRECORDED_ALLOCATION: an entry points at clusters the bitmap
+	// still marks free.
+	SUSPECT_UNRECORDED_ALLOCATION
+	// SUSPECT_CHAIN_LENGTH: DataLength and the cluster chain disagree.
+	SUSPECT_CHAIN_LENGTH
+)
+
+var suspectKindNames = map[SuspectKind]string{
+	SUSPECT_DIRTY_FLAG:            "dirty-flag",
+	SUSPECT_MEDIA_FAILURE:         "media-failure",
+	SUSPECT_STALE_PERCENT_IN_USE:  "stale-percent-in-use",
+	SUSPECT_TORN_ENTRY_SET:        "torn-entry-set",
+	SUSPECT_UNOWNED_ALLOCATION:    "unowned-allocation",
+	SUSPECT_UNRECORDED_ALLOCATION: "unrecorded-allocation",
+	SUSPECT_CHAIN_LENGTH:          "chain-length",
+}
+
+func (k SuspectKind) String() string {
+	if name, ok := suspectKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("suspect(%d)", int(k))
+}
+
+func (k SuspectKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Suspect is one structure that cannot be trusted after an unclean unmount.
+type Suspect struct {
+	Kind    SuspectKind
+	Path    string
+	Offset  uint64
+	Cluster uint32
+	Message string
+}
+
+// VolumeState compares what the boot sector records with what the volume
+// holds. ActualPercentInUse is computed from the bitmap, rounded down as the
+// specification asks. UncleanUnmount is set when any suspect other than a
+// media failure was found.
+type VolumeState struct {
+	Flags                VolumeFlags
+	Dirty                bool
+	MediaFailure         bool
+	RecordedPercentInUse byte
+	PercentInUseKnown    bool
+	ActualPercentInUse   byte
+	PercentInUseStale    bool
+	AllocatedClusters    uint32
+	UncleanUnmount       bool
+	Suspects             []Suspect
+}
+
+// GetVolumeState reads the volume flags, recomputes PercentInUse from the
+// bitmap and runs Check to list the structures that look mid-update: set
+// flags, a stale PercentInUse, entry sets failing their checksum (noting when
+// their clusters are already allocated), allocations no entry owns yet,
+// entries pointing at clusters still free, and chains disagreeing with
+// DataLength. A recorded PercentInUse within one point of the bitmap is not
+// reported, since drivers round differently.
+func (e *ExFAT) GetVolumeState() (VolumeState, error) {
+	bitmap, err := e.loadBitmap()
+	if err != nil {
+		return VolumeState{}, err
+	}
+
+	state := VolumeState{
+		Flags:             e.vbr.volumeFlags,
+		Dirty:             e.IsVolumeDirty(),
+		MediaFailure:      e.HasMediaFailure(),
+		AllocatedClusters: bitmap.allocatedCount(),
+	}
+	state.RecordedPercentInUse, state.PercentInUseKnown = e.GetPercentInUse()
+	state.ActualPercentInUse = byte(uint64(state.AllocatedClusters) * 100 / uint64(e.vbr.nbClusters))
+
+	if state.Dirty {
+		state.addSuspect(Suspect{Kind: SUSPECT_DIRTY_FLAG, Offset: e.vbr.vbrStart + EXFAT_VOLUME_FLAGS_OFFSET, Message: "VolumeDirty flag is set"})
+	}
+	if state.MediaFailure {
+		state.addSuspect(Suspect{Kind: SUSPECT_MEDIA_FAILURE, Offset: e.vbr.vbrStart + EXFAT_VOLUME_FLAGS_OFFSET, Message: "MediaFailure flag is set"})
+	}
+	if state.PercentInUseKnown {
+		diff := int(state.RecordedPercentInUse) - int(state.ActualPercentInUse)
+		if diff > 1 || diff < -1 {
+			state.PercentInUseStale = true
+			state.addSuspect(Suspect{
+				Kind:    SUSPECT_STALE_PERCENT_IN_USE,
+				Offset:  e.vbr.vbrStart + EXFAT_PERCENT_USE_OFFSET,
+				Message: fmt.Sprintf("PercentInUse records %d%%, bitmap says %d%%", state.RecordedPercentInUse, state.ActualPercentInUse),
+			})
+		}
+	}
+
+	report, err := e.Check()
+	if err != nil {
+		return VolumeState{}, err
+	}
+	for _, finding := range report.Findings {
+		suspect := Suspect{Path: finding.Path, Cluster: finding.Cluster, Offset: finding.Offset, Message: finding.Message}
+		switch finding.Kind {
+		case FINDING_MALFORMED_ENTRY_SET:
+			if finding.Diagnostic != DIAG_CHECKSUM_MISMATCH {
+				continue
+			}
+			suspect.Kind = SUSPECT_TORN_ENTRY_SET
+			e.describeTornSet(&suspect, finding.RecordOffsets, bitmap)
+		case FINDING_LOST_CLUSTERS:
+			suspect.Kind = SUSPECT_UNOWNED_ALLOCATION
+			suspect.Offset = e.vbr.getClusterOffset(finding.Cluster)
+		case FINDING_FREE_CLUSTER_IN_CHAIN:
+			suspect.Kind = SUSPECT_UNRECORDED_ALLOCATION
+			suspect.Offset = e.vbr.getClusterOffset(finding.Cluster)
+		case FINDING_CHAIN_TOO_SHORT, FINDING_CHAIN_TOO_LONG:
+			suspect.Kind = SUSPECT_CHAIN_LENGTH
+		default:
+			continue
+		}
+		state.addSuspect(suspect)
+	}
+
+	return state, nil
+}
+
+func (s *VolumeState) addSuspect(suspect Suspect) {
+	s.Suspects = append(s.Suspects, suspect)
+	if suspect.Kind != SUSPECT_MEDIA_FAILURE {
+		s.UncleanUnmount = true
+	}
+}
+
+// describeTornSet looks at the stream record of a set that failed its
+// checksum and notes when the clusters it points at are already allocated,
+// the pattern left by a write interrupted between allocation and the entry
+// set update. recordOffsets locates the records of the set, which need not be
+// adjacent when the set crosses a cluster boundary.
+func (e *ExFAT) describeTornSet(suspect *Suspect, recordOffsets []uint64, bitmap *allocationBitmap) {
+	if len(recordOffsets) < 2 {
+		return
+	}
+	var raw [EXFAT_DIRRECORD_SIZE]byte
+	if _, err := e.vbr.dimage.ReadAt(raw[:], int64(recordOffsets[1])); err != nil {
+		return
+	}
+	var stream StreamExtensionEntry
+	if stream.Decode(raw) != nil || !e.vbr.isValidCluster(stream.FirstCluster) || stream.DataLength == 0 {
+		return
+	}
+
+	count, _ := e.vbr.size2Clusters(stream.DataLength)
+	run, _ := e.vbr.contiguousRun(stream.FirstCluster, count)
+	if !stream.NoFatChain() {
+		run.Length = 1
+	}
+	allocated := uint32(0)
+	for cluster := run.Start; cluster < run.End(); cluster++ {
+		if bitmap.isAllocated(cluster) {
+			allocated++
+		}
+	}
+	if allocated == 0 {
+		return
+	}
+
+	suspect.Cluster = stream.FirstCluster
+	suspect.Message = fmt.Sprintf("%s; its data at cluster %d is already allocated (%d of %d clusters checked)",
+		suspect.Message, stream.FirstCluster, allocated, run.Length)
+}
@@ -0,0 +1,25 @@
+package libxfat
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDescribeTornSetFollowsRecordOffsets(t *testing.T) {
+	// The set crosses a cluster boundary: the stream record sits at the start
+	// of the next cluster of the directory, not after the primary record.
+	image := make([]byte, 3*4096)
+	stream := StreamExtensionEntry{EntryType: EXFAT_DIRRECORD_STREAM_EXT, FirstCluster: 5, DataLength: 100}
+	encoded := stream.Encode()
+	copy(image[2*4096:], encoded[:])
+
+	e := ExFAT{vbr: VBR{dimage: bytes.NewReader(image), clusterSize: 4096, nbClusters: 16}}
+	bitmap := &allocationBitmap{bits: []byte{0b00001000}, nbClusters: 16}
+
+	suspect := Suspect{Offset: 4096 - EXFAT_DIRRECORD_SIZE, Message: "torn"}
+	e.describeTornSet(&suspect, []uint64{suspect.Offset, 2 * 4096}, bitmap)
+	if suspect.Cluster != 5 || !strings.Contains(suspect.Message, "already allocated") {
+		t.Fatalf("suspect = %+v, want cluster 5 noted as allocated", suspect)
+	}
+}
@@ -1,6 +1,7 @@
 package libxfat
 
 import (
+	"io"
 	"os"
 	"strings"
 )
@@ -11,6 +12,7 @@ type VBR struct {
 	volumeSize        uint64
 	fatOffset         uint32
 	fatSize           uint32
+	nbFats            byte
 	dataRegionOffset  uint32
 	nbClusters        uint32
 	rootDirCluster    uint32
@@ -22,8 +24,11 @@ type VBR struct {
 	vbrStart          uint64
 	firstFat          uint64
 	percentInUse      byte
+	volumeFlags       VolumeFlags
+	maxChainLength    uint32
+	badClusterPolicy  BadClusterPolicy
 	dataAreaStart     uint64
-	dimage            *os.File
+	dimage            io.ReaderAt
 	volumeLabel       string
 	bitmcapCluster    uint32
 	bitmapLength      uint64
@@ -49,6 +54,15 @@ type Entry struct {
 	nameLen        byte
 	readNameLen    uint32
 	validDataLen   uint64
+	parentPath     string
+	parentCluster  uint32
+	rawName        []uint16
+	nameAnomalies  NameAnomaly
+	recordOffsets  []uint64
+	salvaged       bool
+	salvageFound   SalvagePart
+	salvageValid   SalvagePart
+	confidence     float64
 }
 
 func (e Entry) IsInvalid() bool {
@@ -75,15 +89,90 @@ func (e Entry) IsSpecialFile() bool {
 func (e Entry) GetNameLength() byte {
 	return e.nameLen
 }
+
+// RawName returns the UTF-16 units read from the entry's name records,
+// including padding, NULs and unpaired surrogates that Name() cannot show.
+func (e Entry) RawName() []uint16 {
+	return append([]uint16(nil), e.rawName...)
+}
+
+// RecordOffsets returns the absolute image offsets of the 32-byte records
+// that make up the entry set, primary record first.
+func (e Entry) RecordOffsets() []uint64 {
+	return append([]uint64(nil), e.recordOffsets...)
+}
+
+// IsSalvaged reports whether the entry was assembled in salvage mode.
+func (e Entry) IsSalvaged() bool {
+	return e.salvaged
+}
+
+// SalvagedParts returns the parts of the entry set that were found.
+func (e Entry) SalvagedParts() SalvagePart {
+	return e.salvageFound
+}
+
+// ValidatedParts returns the found parts that passed validation.
+func (e Entry) ValidatedParts() SalvagePart {
+	return e.salvageValid
+}
+
+// Confidence scores a salvaged entry between 0 and 1. Entries parsed outside
+// salvage mode always report 1.
+func (e Entry) Confidence() float64 {
+	if !e.salvaged {
+		return 1
+	}
+	return e.confidence
+}
+
+// NameAnomalies reports how the entry name breaks the exFAT naming rules.
+func (e Entry) NameAnomalies() NameAnomaly {
+	return e.nameAnomalies
+}
+func (e Entry) HasNameAnomalies() bool {
+	return e.nameAnomalies != 0
+}
 func (e Entry) GetName() string {
 	return e.name
 }
+
+// Name returns the on-disk name of the entry, without the deleted marker that
+// GetName appends to deleted entries.
+func (e Entry) Name() string {
+	if e.IsDeleted() {
+		return strings.TrimSuffix(e.name, DELETED)
+	}
+	return e.name
+}
+
+// Path returns the absolute path of the entry inside the volume.
+func (e Entry) Path() string {
+	return joinEntryPath(e.ParentPath(), e.Name())
+}
+
+// ParentPath returns the absolute path of the directory the entry was read from.
+func (e Entry) ParentPath() string {
+	if e.parentPath == "" {
+		return "/"
+	}
+	return e.parentPath
+}
+
+// ParentCluster returns the first cluster of the directory the entry was read
+// from. Recovered deleted entries report the cluster they were carved from.
+func (e Entry) ParentCluster() uint32 {
+	return e.parentCluster
+}
 func (e Entry) IsFile() bool {
 	return !e.IsDir()
 }
 func (e Entry) IsDir() bool {
 	return e.entryAttr&ENTRY_ATTR_DIR_MASK > 0
 }
+func (e Entry) GetAttributes() uint16 {
+	return e.entryAttr
+}
 func (e Entry) GetEntryCluster() uint32 {
 	return e.entryCluster
 }
@@ -126,22 +215,64 @@ type ExFAT struct {
 	clusterdata  []byte
 	dirtype      byte
 	optimistic   bool
+	salvage      bool
+	salvager     salvager
+	// Directory currently being parsed, recorded as parent on emitted entries
+	dirPath    string
+	dirCluster uint32
 	// Parsing state for filename/checksum assembly
 	setChecksum      uint16
 	expectedChecksum uint16
 	expectedSC       int
 	expectedNameLen  int
 	nameUnits        []uint16
+	nameRecords      int
+	benignRecords    int
+	streamSeen       bool
+	setOffset        uint64
+	setRaw           []byte
+	// Image offset of the chunk being parsed and the problems found so far
+	chunkOffset uint64
+	diagnostics []Diagnostic
+	// Ownership map built on the first ClusterOwner call
+	clusterMap *ClusterMap
+	limits     TraversalLimits
+	// Expanded up-case table, read on first use
+	upcase upcaseTable
 }
 
 func New(imagefile *os.File, optimistic bool, offset ...uint64) (ExFAT, error) {
+	return NewFromImage(imagefile, optimistic, offset...)
+}
+
+// NewFromImage opens the volume stored in image, such as a *bytes.Reader
+// over an in-memory image. Write operations need the image to also be an
+// io.WriterAt and fail with ErrReadOnlyImage otherwise.
+func NewFromImage(image io.ReaderAt, optimistic bool, offset ...uint64) (ExFAT, error) {
+	if len(offset) < 1 {
+		offset = append(offset, 0)
+	}
+	var exfatdata ExFAT
+	var err error
+	exfatdata.optimistic = optimistic
+	exfatdata.vbr, err = parseVBR(image, offset[0], exfatdata.optimistic)
+	exfatdata.SetTraversalLimits(DefaultTraversalLimits)
+	return exfatdata, err
+}
+
+// NewFromBackup opens the volume in image through its backup boot region,
+// for volumes whose main boot sector is damaged. Offsets still locate the
+// start of the volume, and writes still go to the main boot region, so a
+// Repair with BootRegion set can restore it.
+func NewFromBackup(image io.ReaderAt, optimistic bool, offset ...uint64) (ExFAT, error) {
 	if len(offset) < 1 {
 		offset = append(offset, 0)
 	}
 	var exfatdata ExFAT
 	var err error
 	exfatdata.optimistic = optimistic
-	exfatdata.vbr, err = parseVBR(imagefile, offset[0], exfatdata.optimistic)
+	exfatdata.vbr, err = parseBackupVBR(image, offset[0], exfatdata.optimistic)
+	exfatdata.SetTraversalLimits(DefaultTraversalLimits)
 	return exfatdata, err
 }
 func (e *ExFAT) initEntryState(clusetrdata []byte, offset, remainingSC, entryState int) {
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+// createBadClusterTestImage adds a file /F.BIN over clusters 4 and 5 and
+// marks cluster 5 bad in the FAT. With chained set the file follows the FAT,
+// otherwise it is a NoFatChain allocation.
+func createBadClusterTestImage(t *testing.T, chained bool) *os.File {
+	t.Helper()
+
+	image := createTestImage(t)
+	writeTestBitmap(t, image, 0x0f)
+
+	set := make([]byte, 96)
+	size := writeTestEntrySet(set, "F.BIN", testArchiveAttr, testUpcaseCluster, 2*testSectorSize)
+	if chained {
+		set[33] = 0x01
+		writeTestSetChecksum(set[:size])
+		writeTestFATEntry(t, image, testUpcaseCluster, testDirCluster)
+	}
+	writeTestBytes(t, image, testDataOffset*testSectorSize+160, set[:size])
+	clusterOffset := int64((testDataOffset + testUpcaseCluster - testRootCluster) * testSectorSize)
+	writeTestBytes(t, image, clusterOffset, bytes.Repeat([]byte{'A'}, testSectorSize))
+	writeTestFATEntry(t, image, testDirCluster, 0x0ffffff7)
+	return image
+}
+
+func TestGetBadClusters(t *testing.T) {
+	exfat, _ := openTestImage(t, createBadClusterTestImage(t, false))
+
+	inventory, err := exfat.GetBadClusters()
+	if err != nil {
+		t.Fatalf("GetBadClusters error: %v", err)
+	}
+	if len(inventory.Clusters) != 1 || inventory.Clusters[0].Cluster != testDirCluster || !inventory.Clusters[0].Allocated {
+		t.Fatalf("clusters = %+v, want allocated cluster %d", inventory.Clusters, testDirCluster)
+	}
+	if inventory.Allocated != 1 || inventory.Free != 0 || len(inventory.Runs) != 1 {
+		t.Fatalf("inventory = %+v, want one allocated bad cluster", inventory)
+	}
+}
+
+func TestExtractEntryContentBadClusterPolicies(t *testing.T) {
+	exfat, root := openTestImage(t, createBadClusterTestImage(t, true))
+	entry := findEntry(t, root, "F.BIN")
+	dst := filepath.Join(t.TempDir(), "F.BIN")
+
+	if err := exfat.ExtractEntryContent(entry, dst); !errors.Is(err, libxfat.ErrBadCluster) {
+		t.Fatalf("ExtractEntryContent error = %v, want ErrBadCluster", err)
+	}
+
+	exfat.SetBadClusterPolicy(libxfat.BAD_CLUSTER_ZERO_FILL)
+	report, err := exfat.ExtractEntryContentWithReport(entry, dst)
+	if err != nil {
+		t.Fatalf("zero-fill extraction error: %v", err)
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("read extracted file: %v", err)
+	}
+	want := append(bytes.Repeat([]byte{'A'}, testSectorSize), make([]byte, testSectorSize)...)
+	if !bytes.Equal(data, want) || report.Written != uint64(len(want)) || report.Partial {
+		t.Fatalf("zero-fill report = %+v, data length %d", report, len(data))
+	}
+	damaged := libxfat.DamagedRange{Kind: libxfat.DAMAGE_BAD_CLUSTER, Offset: testSectorSize, Length: testSectorSize, Cluster: testDirCluster}
+	if len(report.Damaged) != 1 || report.Damaged[0] != damaged {
+		t.Fatalf("damaged = %+v, want %+v", report.Damaged, damaged)
+	}
+
+	exfat.SetBadClusterPolicy(libxfat.BAD_CLUSTER_PARTIAL)
+	report, err = exfat.ExtractEntryContentWithReport(entry, dst)
+	if err != nil {
+		t.Fatalf("partial extraction error: %v", err)
+	}
+	data, err = os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("read extracted file: %v", err)
+	}
+	if !report.Partial || report.Written != testSectorSize || len(data) != testSectorSize {
+		t.Fatalf("partial report = %+v, data length %d", report, len(data))
+	}
+}
+
+func TestExtractEntryContentIgnoresFatOfContiguousFile(t *testing.T) {
+	// The marker inside the NoFatChain allocation is listed by GetBadClusters
+	// but takes no part in reading the file.
+	exfat, root := openTestImage(t, createBadClusterTestImage(t, false))
+	entry := findEntry(t, root, "F.BIN")
+	dst := filepath.Join(t.TempDir(), "F.BIN")
+
+	report, err := exfat.ExtractEntryContentWithReport(entry, dst)
+	if err != nil {
+		t.Fatalf("ExtractEntryContentWithReport error: %v", err)
+	}
+	if report.Written != 2*testSectorSize || report.Partial || len(report.Damaged) != 0 {
+		t.Fatalf("report = %+v, want the whole file and no damage", report)
+	}
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+// writeTestBitmap overwrites the first byte of the allocation bitmap, which
+// covers clusters 2-9 of the test images.
+func writeTestBitmap(t *testing.T, image *os.File, bits byte) {
+	t.Helper()
+
+	offset := int64((testDataOffset + testBitmapCluster - testRootCluster) * testSectorSize)
+	if _, err := image.WriteAt([]byte{bits}, offset); err != nil {
+		t.Fatalf("write bitmap: %v", err)
+	}
+}
+
+func checkTestImage(t *testing.T, image *os.File) libxfat.CheckReport {
+	t.Helper()
+
+	exfat, err := libxfat.New(image, false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	report, err := exfat.Check()
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	return report
+}
+
+func findingKinds(report libxfat.CheckReport) map[libxfat.FindingKind]libxfat.Finding {
+	kinds := map[libxfat.FindingKind]libxfat.Finding{}
+	for _, finding := range report.Findings {
+		kinds[finding.Kind] = finding
+	}
+	return kinds
+}
+
+func TestCheckCleanImage(t *testing.T) {
+	image := createNestedTestImage(t)
+	writeTestBitmap(t, image, 0x0f)
+
+	report := checkTestImage(t, image)
+	if len(report.Findings) != 0 {
+		t.Fatalf("findings = %v, want none", report.Findings)
+	}
+	if report.Files != 1 || report.Directories != 1 {
+		t.Fatalf("files/dirs = %d/%d, want 1/1", report.Files, report.Directories)
+	}
+	if report.AllocatedClusters != 4 || report.OwnedClusters != 4 {
+		t.Fatalf("allocated/owned = %d/%d, want 4/4", report.AllocatedClusters, report.OwnedClusters)
+	}
+}
+
+func TestCheckLostClusters(t *testing.T) {
+	image := createTestImage(t)
+	writeTestBitmap(t, image, 0x0f)
+
+	report := checkTestImage(t, image)
+	lost, ok := findingKinds(report)[libxfat.FINDING_LOST_CLUSTERS]
+	if !ok {
+		t.Fatalf("findings = %v, want lost clusters", report.Findings)
+	}
+	if lost.Cluster != testDirCluster || lost.Count != 1 {
+		t.Fatalf("lost = cluster %d count %d, want %d/1", lost.Cluster, lost.Count, testDirCluster)
+	}
+	if !report.OK() {
+		t.Fatalf("lost clusters should only warn: %v", report.Findings)
+	}
+}
+
+func TestCheckFreeClusterInChain(t *testing.T) {
+	image := createNestedTestImage(t)
+	writeTestBitmap(t, image, 0x07)
+
+	report := checkTestImage(t, image)
+	free, ok := findingKinds(report)[libxfat.FINDING_FREE_CLUSTER_IN_CHAIN]
+	if !ok || free.Path != "/DIR" || free.Cluster != testDirCluster {
+		t.Fatalf("findings = %v, want free cluster %d in /DIR", report.Findings, testDirCluster)
+	}
+	if report.OK() {
+		t.Fatal("report OK, want errors")
+	}
+}
+
+func TestCheckCrossLinkedChain(t *testing.T) {
+	image := createNestedTestImage(t)
+	writeTestBitmap(t, image, 0x0f)
+	// Extend the root directory chain into the cluster /DIR occupies.
+	writeTestFATEntry(t, image, testRootCluster, testDirCluster)
+
+	report := checkTestImage(t, image)
+	cross, ok := findingKinds(report)[libxfat.FINDING_CROSS_LINKED]
+	if !ok || cross.Path != "/DIR" || cross.Cluster != testDirCluster {
+		t.Fatalf("findings = %v, want /DIR cross-linked at %d", report.Findings, testDirCluster)
+	}
+}
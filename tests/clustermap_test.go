@@ -0,0 +1,118 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+// createOwnershipTestImage adds a deleted file /DIR/OLD.BIN whose data still
+// points at the $UpCase cluster.
+func createOwnershipTestImage(t *testing.T) *libxfat.ExFAT {
+	t.Helper()
+
+	image := createNestedTestImage(t)
+	writeTestBitmap(t, image, 0x0f)
+
+	set := make([]byte, 96)
+	size := writeTestEntrySet(set, "OLD.BIN", testArchiveAttr, testUpcaseCluster, 100)
+	deleteTestEntrySet(set[:size])
+	offset := int64((testDataOffset+testDirCluster-testRootCluster)*testSectorSize + 96)
+	if _, err := image.WriteAt(set[:size], offset); err != nil {
+		t.Fatalf("write deleted set: %v", err)
+	}
+
+	exfat, err := libxfat.New(image, false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	return &exfat
+}
+
+func TestClusterOwnerResolvesLiveAndMetadata(t *testing.T) {
+	exfat := createOwnershipTestImage(t)
+
+	ownership, err := exfat.ClusterOwner(testDirCluster)
+	if err != nil {
+		t.Fatalf("ClusterOwner error: %v", err)
+	}
+	owner, ok := ownership.Owner()
+	if ownership.State != libxfat.CLUSTER_OWNED || !ok || owner.Path != "/DIR" || owner.Offset != 0 {
+		t.Fatalf("ownership = %+v, want /DIR at offset 0", ownership)
+	}
+
+	ownership, err = exfat.ClusterOwner(testBitmapCluster)
+	if err != nil {
+		t.Fatalf("ClusterOwner error: %v", err)
+	}
+	owner, ok = ownership.Owner()
+	if !ok || !owner.Metadata || owner.Path != "/$BitMap" {
+		t.Fatalf("bitmap ownership = %+v, want metadata /$BitMap", ownership)
+	}
+}
+
+func TestClusterOwnerReportsDeletedClaims(t *testing.T) {
+	exfat := createOwnershipTestImage(t)
+
+	ownership, err := exfat.ClusterOwner(testUpcaseCluster)
+	if err != nil {
+		t.Fatalf("ClusterOwner error: %v", err)
+	}
+	if len(ownership.Claims) != 2 {
+		t.Fatalf("claims = %+v, want live and deleted", ownership.Claims)
+	}
+	if ownership.Claims[0].Deleted || ownership.Claims[0].Path != "/$UpCase" {
+		t.Fatalf("first claim = %+v, want live /$UpCase", ownership.Claims[0])
+	}
+	if !ownership.Claims[1].Deleted || ownership.Claims[1].Path != "/DIR/OLD.BIN" {
+		t.Fatalf("second claim = %+v, want deleted /DIR/OLD.BIN", ownership.Claims[1])
+	}
+}
+
+func TestClusterOwnerAtOffset(t *testing.T) {
+	exfat := createOwnershipTestImage(t)
+
+	offset := uint64((testDataOffset+testDirCluster-testRootCluster)*testSectorSize + 40)
+	ownership, err := exfat.ClusterOwnerAt(offset)
+	if err != nil {
+		t.Fatalf("ClusterOwnerAt error: %v", err)
+	}
+	owner, ok := ownership.Owner()
+	if ownership.Cluster != testDirCluster || !ok || owner.Offset != 40 {
+		t.Fatalf("ownership = %+v, want /DIR offset 40", ownership)
+	}
+
+	if _, err := exfat.ClusterOwnerAt(0); err == nil {
+		t.Fatal("expected error for offset before the cluster heap")
+	}
+}
+
+func TestClusterOwnerUnownedAndUnallocated(t *testing.T) {
+	image := createTestImage(t)
+	writeTestBitmap(t, image, 0x0f)
+	exfat, err := libxfat.New(image, false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	ownership, err := exfat.ClusterOwner(testDirCluster)
+	if err != nil {
+		t.Fatalf("ClusterOwner error: %v", err)
+	}
+	if ownership.State != libxfat.CLUSTER_UNOWNED || len(ownership.Claims) != 0 {
+		t.Fatalf("ownership = %+v, want unowned", ownership)
+	}
+
+	writeTestBitmap(t, image, 0x07)
+	m, err := exfat.BuildClusterMap()
+	if err != nil {
+		t.Fatalf("BuildClusterMap error: %v", err)
+	}
+	ownership, err = m.Owner(testDirCluster)
+	if err != nil {
+		t.Fatalf("Owner error: %v", err)
+	}
+	if ownership.State != libxfat.CLUSTER_UNALLOCATED {
+		t.Fatalf("state = %v, want unallocated", ownership.State)
+	}
+}
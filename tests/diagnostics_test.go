@@ -0,0 +1,84 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+func TestReadDirWithDiagnosticsSeparatesEmptyFromBroken(t *testing.T) {
+	image := createNestedTestImage(t)
+	exfat, err := libxfat.New(image, false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	rootEntries, diagnostics, err := exfat.ReadRootDirWithDiagnostics()
+	if err != nil {
+		t.Fatalf("ReadRootDirWithDiagnostics error: %v", err)
+	}
+	if len(diagnostics) != 0 {
+		t.Fatalf("root diagnostics = %v, want none", diagnostics)
+	}
+	dir := findEntry(t, rootEntries, "DIR")
+
+	// Corrupt the SetChecksum of /DIR/A.TXT.
+	dirOffset := int64(exfat.GetClusterOffset(testDirCluster))
+	if _, err := image.WriteAt([]byte{0xFF, 0xFF}, dirOffset+2); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+
+	_, diagnostics, err = exfat.ReadDirWithDiagnostics(dir)
+	if err != nil {
+		t.Fatalf("ReadDirWithDiagnostics error: %v", err)
+	}
+	if len(diagnostics) != 1 {
+		t.Fatalf("diagnostics = %v, want 1", diagnostics)
+	}
+	diag := diagnostics[0]
+	if diag.Kind != libxfat.DIAG_CHECKSUM_MISMATCH || diag.Directory != "/DIR" || diag.Offset != uint64(dirOffset) {
+		t.Fatalf("diagnostic = %+v", diag)
+	}
+}
+
+func TestRecursiveReadsCollectDiagnostics(t *testing.T) {
+	image := createNestedTestImage(t)
+	exfat, err := libxfat.New(image, false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	// Corrupt the SetChecksum of /DIR/A.TXT, one level below the root.
+	dirOffset := int64(exfat.GetClusterOffset(testDirCluster))
+	if _, err := image.WriteAt([]byte{0xFF, 0xFF}, dirOffset+2); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+	rootEntries, err := exfat.ReadRootDir()
+	if err != nil {
+		t.Fatalf("ReadRootDir error: %v", err)
+	}
+
+	reads := map[string]func() error{
+		"ReadDirs": func() error {
+			_, err := exfat.ReadDirs(rootEntries)
+			return err
+		},
+		"GetAllEntries": func() error {
+			_, err := exfat.GetAllEntries(rootEntries)
+			return err
+		},
+		"GetFullPathIndexableEntries": func() error {
+			_, err := exfat.GetFullPathIndexableEntries(rootEntries, "/")
+			return err
+		},
+	}
+	for name, read := range reads {
+		if err := read(); err != nil {
+			t.Fatalf("%s error: %v", name, err)
+		}
+		diagnostics := exfat.Diagnostics()
+		if len(diagnostics) != 1 || diagnostics[0].Kind != libxfat.DIAG_CHECKSUM_MISMATCH || diagnostics[0].Directory != "/DIR" {
+			t.Fatalf("%s diagnostics = %v, want the checksum mismatch in /DIR", name, diagnostics)
+		}
+	}
+}
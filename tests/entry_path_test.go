@@ -0,0 +1,75 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+func findEntry(t *testing.T, entries []libxfat.Entry, name string) libxfat.Entry {
+	t.Helper()
+
+	for _, entry := range entries {
+		if entry.Name() == name {
+			return entry
+		}
+	}
+	t.Fatalf("entry %s not found", name)
+	return libxfat.Entry{}
+}
+
+func TestReadDirFillsPathAndParent(t *testing.T) {
+	image := createNestedTestImage(t)
+	exfat, err := libxfat.New(image, false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	rootEntries, err := exfat.ReadRootDir()
+	if err != nil {
+		t.Fatalf("ReadRootDir error: %v", err)
+	}
+	dir := findEntry(t, rootEntries, "DIR")
+	if dir.Path() != "/DIR" || dir.ParentPath() != "/" || dir.ParentCluster() != testRootCluster {
+		t.Fatalf("dir path=%q parent=%q parentCluster=%d", dir.Path(), dir.ParentPath(), dir.ParentCluster())
+	}
+
+	subEntries, err := exfat.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir error: %v", err)
+	}
+	file := findEntry(t, subEntries, "A.TXT")
+	if file.Path() != "/DIR/A.TXT" || file.ParentCluster() != testDirCluster {
+		t.Fatalf("file path=%q parentCluster=%d", file.Path(), file.ParentCluster())
+	}
+}
+
+func TestTraversalAPIsAgreeOnPaths(t *testing.T) {
+	image := createNestedTestImage(t)
+	exfat, err := libxfat.New(image, false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	rootEntries, err := exfat.ReadRootDir()
+	if err != nil {
+		t.Fatalf("ReadRootDir error: %v", err)
+	}
+
+	all, err := exfat.GetAllEntries(rootEntries)
+	if err != nil {
+		t.Fatalf("GetAllEntries error: %v", err)
+	}
+	if file := findEntry(t, all, "A.TXT"); file.Path() != "/DIR/A.TXT" {
+		t.Fatalf("GetAllEntries path = %q, want /DIR/A.TXT", file.Path())
+	}
+
+	indexable, err := exfat.GetFullPathIndexableEntries(rootEntries, "/")
+	if err != nil {
+		t.Fatalf("GetFullPathIndexableEntries error: %v", err)
+	}
+	file := findEntry(t, indexable, "A.TXT")
+	if file.GetName() != "A.TXT" || file.Path() != "/DIR/A.TXT" {
+		t.Fatalf("GetFullPathIndexableEntries name=%q path=%q", file.GetName(), file.Path())
+	}
+}
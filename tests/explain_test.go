@@ -0,0 +1,85 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+func explainTestOffset(t *testing.T, exfat *libxfat.ExFAT, off uint64) libxfat.OffsetInfo {
+	t.Helper()
+
+	info, err := exfat.ExplainOffset(off)
+	if err != nil {
+		t.Fatalf("ExplainOffset(%d) error: %v", off, err)
+	}
+	return info
+}
+
+func TestExplainOffsetVolumeStructures(t *testing.T) {
+	exfat, _ := openTestImage(t, createNestedTestImage(t))
+
+	info := explainTestOffset(t, exfat, 0x6a)
+	if info.Region != libxfat.REGION_MAIN_BOOT || info.Sector != 0 || info.RegionOffset != 0x6a {
+		t.Fatalf("boot info = %+v, want main boot region byte 0x6a", info)
+	}
+
+	info = explainTestOffset(t, exfat, testFatOffsetSector*testSectorSize+testDirCluster*4+1)
+	if info.Region != libxfat.REGION_FAT1 || info.Cluster != testDirCluster {
+		t.Fatalf("FAT info = %+v, want FAT1 entry of cluster %d", info, testDirCluster)
+	}
+
+	bitmapOffset := uint64((testDataOffset + testBitmapCluster - testRootCluster) * testSectorSize)
+	info = explainTestOffset(t, exfat, bitmapOffset)
+	if info.Region != libxfat.REGION_BITMAP || info.Cluster != testRootCluster {
+		t.Fatalf("bitmap info = %+v, want bitmap byte covering cluster %d", info, testRootCluster)
+	}
+
+	upcaseOffset := uint64((testDataOffset+testUpcaseCluster-testRootCluster)*testSectorSize + 10)
+	info = explainTestOffset(t, exfat, upcaseOffset)
+	if info.Region != libxfat.REGION_UPCASE || info.RegionOffset != 10 {
+		t.Fatalf("upcase info = %+v, want up-case byte 10", info)
+	}
+
+	info = explainTestOffset(t, exfat, testVolumeSectors*testSectorSize)
+	if info.Region != libxfat.REGION_PAST_VOLUME {
+		t.Fatalf("past volume info = %+v, want past volume", info)
+	}
+}
+
+func TestExplainOffsetDirectoryEntrySet(t *testing.T) {
+	exfat, _ := openTestImage(t, createNestedTestImage(t))
+
+	info := explainTestOffset(t, exfat, testDataOffset*testSectorSize+160+40)
+	if info.Region != libxfat.REGION_DIRECTORY || info.Path != "/" {
+		t.Fatalf("root info = %+v, want root directory", info)
+	}
+	if info.EntrySet == nil || info.EntrySet.GetName() != "DIR" {
+		t.Fatalf("root entry set = %+v, want DIR", info.EntrySet)
+	}
+
+	dirOffset := uint64((testDataOffset+testDirCluster-testRootCluster)*testSectorSize + 70)
+	info = explainTestOffset(t, exfat, dirOffset)
+	if info.Region != libxfat.REGION_DIRECTORY || info.Path != "/DIR" || info.RegionOffset != 70 {
+		t.Fatalf("dir info = %+v, want /DIR byte 70", info)
+	}
+	if info.EntrySet == nil || info.EntrySet.GetName() != "A.TXT" {
+		t.Fatalf("dir entry set = %+v, want A.TXT", info.EntrySet)
+	}
+
+	info = explainTestOffset(t, exfat, dirOffset+200)
+	if info.Region != libxfat.REGION_DIRECTORY || info.EntrySet != nil {
+		t.Fatalf("unused record info = %+v, want directory without entry set", info)
+	}
+}
+
+func TestExplainOffsetUnallocatedHeap(t *testing.T) {
+	image := createTestImage(t)
+	writeTestBitmap(t, image, 0x07)
+	exfat, _ := openTestImage(t, image)
+
+	info := explainTestOffset(t, exfat, (testDataOffset+testDirCluster-testRootCluster)*testSectorSize+5)
+	if info.Region != libxfat.REGION_UNALLOCATED_HEAP || info.Cluster != testDirCluster || info.RegionOffset != 5 {
+		t.Fatalf("info = %+v, want unallocated cluster %d byte 5", info, testDirCluster)
+	}
+}
@@ -0,0 +1,166 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+func formatTestImage(t *testing.T, size int64, opts libxfat.FormatOptions) *os.File {
+	t.Helper()
+
+	image, err := os.Create(filepath.Join(t.TempDir(), "formatted.exfat"))
+	if err != nil {
+		t.Fatalf("create image: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = image.Close()
+	})
+	if err := libxfat.Format(image, size, opts); err != nil {
+		t.Fatalf("Format error: %v", err)
+	}
+	return image
+}
+
+// checkTestBootRegion verifies the checksum sector of the boot region starting
+// at sector first.
+func checkTestBootRegion(t *testing.T, image io.ReaderAt, sectorSize int, first int) []byte {
+	t.Helper()
+
+	region := make([]byte, 12*sectorSize)
+	if _, err := image.ReadAt(region, int64(first*sectorSize)); err != nil {
+		t.Fatalf("read boot region: %v", err)
+	}
+	var checksum uint32
+	for i, b := range region[:11*sectorSize] {
+		if i == 106 || i == 107 || i == 112 {
+			continue
+		}
+		checksum = bits.RotateLeft32(checksum, -1) + uint32(b)
+	}
+	for off := 11 * sectorSize; off < len(region); off += 4 {
+		if got := binary.LittleEndian.Uint32(region[off:]); got != checksum {
+			t.Fatalf("boot checksum at %d = %#x, want %#x", off, got, checksum)
+		}
+	}
+	return region
+}
+
+func TestFormatDefaults(t *testing.T) {
+	const size = 8 << 20
+	image := formatTestImage(t, size, libxfat.FormatOptions{Label: "TESTVOL", Serial: 0x12345678})
+
+	main := checkTestBootRegion(t, image, 512, 0)
+	backup := checkTestBootRegion(t, image, 512, 12)
+	if !bytes.Equal(main, backup) {
+		t.Fatal("backup boot region differs from the main one")
+	}
+	if serial := binary.LittleEndian.Uint32(main[0x64:]); serial != 0x12345678 {
+		t.Fatalf("serial = %#x, want 0x12345678", serial)
+	}
+
+	exfat, entries := openTestImage(t, image)
+	if exfat.GetVolumeLabel() != "TESTVOL" {
+		t.Fatalf("label = %q, want TESTVOL", exfat.GetVolumeLabel())
+	}
+	for _, name := range []string{"$BitMap", "$UpCase", "$Volume GUID"} {
+		findEntry(t, entries, name)
+	}
+	if exfat.GetClusterSize() != 4096 {
+		t.Fatalf("cluster size = %d, want 4096", exfat.GetClusterSize())
+	}
+	report, err := exfat.Check()
+	if err != nil || !report.OK() {
+		t.Fatalf("Check = %+v, %v, want a clean volume", report, err)
+	}
+
+	if _, err := exfat.CreateFile("/été.txt", bytes.NewReader([]byte("summer"))); err != nil {
+		t.Fatalf("CreateFile error: %v", err)
+	}
+	if _, err := exfat.Lookup("/ÉTÉ.TXT"); err != nil {
+		t.Fatalf("Lookup through the up-case table error: %v", err)
+	}
+}
+
+func TestFormatWritesRecommendedUpcaseTable(t *testing.T) {
+	image := formatTestImage(t, 8<<20, libxfat.FormatOptions{})
+	exfat, _ := openTestImage(t, image)
+	if _, err := exfat.CreateFile("/\u00b5.txt", bytes.NewReader([]byte("micro"))); err != nil {
+		t.Fatalf("CreateFile error: %v", err)
+	}
+
+	// The table leaves the micro sign alone, where Unicode maps it to a
+	// capital mu.
+	if _, err := exfat.Lookup("/\u00b5.TXT"); err != nil {
+		t.Fatalf("Lookup error: %v", err)
+	}
+	if _, err := exfat.Lookup("/\u039c.txt"); !errors.Is(err, libxfat.ErrEntryNotFound) {
+		t.Fatalf("Lookup through capital mu error = %v, want ErrEntryNotFound", err)
+	}
+}
+
+func TestFormatOptions(t *testing.T) {
+	image := formatTestImage(t, 16<<20, libxfat.FormatOptions{
+		SectorSize:   4096,
+		ClusterSize:  16384,
+		Alignment:    1 << 20,
+		NumberOfFats: 2,
+	})
+	main := checkTestBootRegion(t, image, 4096, 0)
+	checkTestBootRegion(t, image, 4096, 12)
+
+	fatOffset := binary.LittleEndian.Uint32(main[0x50:])
+	fatLength := binary.LittleEndian.Uint32(main[0x54:])
+	heapOffset := binary.LittleEndian.Uint32(main[0x58:])
+	if main[0x6e] != 2 || fatOffset*4096%(1<<20) != 0 || heapOffset*4096%(1<<20) != 0 {
+		t.Fatalf("FATs/FAT offset/heap offset = %d/%d/%d, want 2 FATs on 1 MiB boundaries", main[0x6e], fatOffset, heapOffset)
+	}
+	fats := make([]byte, 2*fatLength*4096)
+	if _, err := image.ReadAt(fats, int64(fatOffset)*4096); err != nil {
+		t.Fatalf("read FATs: %v", err)
+	}
+	if !bytes.Equal(fats[:len(fats)/2], fats[len(fats)/2:]) {
+		t.Fatal("second FAT differs from the first")
+	}
+
+	exfat, _ := openTestImage(t, image)
+	if exfat.GetVolumeLabel() != "" {
+		t.Fatalf("label = %q, want none", exfat.GetVolumeLabel())
+	}
+	report, err := exfat.Check()
+	if err != nil || !report.OK() {
+		t.Fatalf("Check = %+v, %v, want a clean volume", report, err)
+	}
+}
+
+func TestFormatRejectsBadOptions(t *testing.T) {
+	cases := map[string]struct {
+		size int64
+		opts libxfat.FormatOptions
+	}{
+		"too small":     {512 << 10, libxfat.FormatOptions{}},
+		"sector size":   {8 << 20, libxfat.FormatOptions{SectorSize: 768}},
+		"cluster size":  {8 << 20, libxfat.FormatOptions{ClusterSize: 3000}},
+		"small cluster": {8 << 20, libxfat.FormatOptions{SectorSize: 4096, ClusterSize: 512}},
+		"fats":          {8 << 20, libxfat.FormatOptions{NumberOfFats: 3}},
+		"label":         {8 << 20, libxfat.FormatOptions{Label: "TWELVE CHARS"}},
+	}
+	for name, tc := range cases {
+		image, err := os.Create(filepath.Join(t.TempDir(), "bad.exfat"))
+		if err != nil {
+			t.Fatalf("create image: %v", err)
+		}
+		err = libxfat.Format(image, tc.size, tc.opts)
+		_ = image.Close()
+		if !errors.Is(err, libxfat.ErrInvalidFormatOptions) {
+			t.Fatalf("%s: Format error = %v, want ErrInvalidFormatOptions", name, err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+func TestAnalyzeFragmentationContiguousVolume(t *testing.T) {
+	image := createNestedTestImage(t)
+	exfat, err := libxfat.New(image, false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	volume, err := exfat.AnalyzeFragmentation(10)
+	if err != nil {
+		t.Fatalf("AnalyzeFragmentation error: %v", err)
+	}
+	if volume.Entries != 1 || volume.NoFatChainFiles != 1 {
+		t.Fatalf("entries/noFatChain = %d/%d, want 1/1", volume.Entries, volume.NoFatChainFiles)
+	}
+	if volume.FragmentedFiles != 0 || volume.Ratio != 0 || len(volume.MostFragmented) != 0 {
+		t.Fatalf("volume = %+v, want no fragmentation", volume)
+	}
+	if len(volume.FragmentSizes) != 1 || volume.FragmentSizes[0].Count != 1 {
+		t.Fatalf("fragment sizes = %v, want one single-cluster run", volume.FragmentSizes)
+	}
+}
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+func TestAnalyzeFreeSpaceWithoutPriorRead(t *testing.T) {
+	image := createTestImage(t)
+	exfat, err := libxfat.New(image, false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	space, err := exfat.AnalyzeFreeSpace(2)
+	if err != nil {
+		t.Fatalf("AnalyzeFreeSpace error: %v", err)
+	}
+	if space.Clusters != testClusterCount || space.FreeClusters != 2 || space.AllocatedClusters != 2 {
+		t.Fatalf("space = %+v, want 2 of 4 clusters free", space)
+	}
+	wantRuns := []libxfat.Run{{Start: testBitmapCluster, Length: 1}, {Start: testDirCluster, Length: 1}}
+	if len(space.FreeRuns) != 2 || space.FreeRuns[0] != wantRuns[0] || space.FreeRuns[1] != wantRuns[1] {
+		t.Fatalf("free runs = %v, want %v", space.FreeRuns, wantRuns)
+	}
+	if space.LargestFreeRun != wantRuns[0] {
+		t.Fatalf("largest free run = %v, want %v", space.LargestFreeRun, wantRuns[0])
+	}
+	if len(space.Histogram) != 1 || space.Histogram[0].Count != 2 {
+		t.Fatalf("histogram = %v, want two single-cluster runs", space.Histogram)
+	}
+	if len(space.Regions) != 2 || space.Regions[0].Free != 1 || space.Regions[1].Free != 1 {
+		t.Fatalf("regions = %v, want one free cluster in each half", space.Regions)
+	}
+}
+
+func TestGetLargestFreeRunOnFullHeap(t *testing.T) {
+	image := createTestImage(t)
+	writeTestBitmap(t, image, 0x0f)
+	exfat, err := libxfat.New(image, false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	run, err := exfat.GetLargestFreeRun()
+	if err != nil {
+		t.Fatalf("GetLargestFreeRun error: %v", err)
+	}
+	if run.Length != 0 {
+		t.Fatalf("largest free run = %v, want none", run)
+	}
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+func writeTestBytes(t *testing.T, image *os.File, offset int64, data []byte) {
+	t.Helper()
+
+	if _, err := image.WriteAt(data, offset); err != nil {
+		t.Fatalf("write at %d: %v", offset, err)
+	}
+}
+
+func findHiddenArea(report libxfat.HiddenDataReport, kind libxfat.HiddenAreaKind) (libxfat.HiddenArea, bool) {
+	for _, area := range report.Areas {
+		if area.Kind == kind {
+			return area, true
+		}
+	}
+	return libxfat.HiddenArea{}, false
+}
+
+func TestScanHiddenDataCleanImage(t *testing.T) {
+	exfat, _ := openTestImage(t, createNestedTestImage(t))
+
+	report, err := exfat.ScanHiddenData()
+	if err != nil {
+		t.Fatalf("ScanHiddenData error: %v", err)
+	}
+	if len(report.Areas) != 0 {
+		t.Fatalf("areas = %+v, want none", report.Areas)
+	}
+	if report.ScannedAreas == 0 || report.ScannedBytes == 0 {
+		t.Fatalf("report = %+v, want scanned areas", report)
+	}
+}
+
+func TestScanHiddenDataFindsInjectedContent(t *testing.T) {
+	image := createNestedTestImage(t)
+	dirOffset := int64((testDataOffset + testDirCluster - testRootCluster) * testSectorSize)
+	bitmapOffset := int64((testDataOffset + testBitmapCluster - testRootCluster) * testSectorSize)
+
+	writeTestBytes(t, image, 10*testSectorSize+7, []byte{0xaa})
+	writeTestBytes(t, image, testFatOffsetSector*testSectorSize+100, []byte{0xbb})
+	writeTestBitmap(t, image, 0x15)
+	writeTestBytes(t, image, dirOffset+25, []byte{0xcc})
+	writeTestBytes(t, image, dirOffset+64+2+5*2, []byte{'X'})
+	writeTestBytes(t, image, dirOffset+200, []byte{0xdd, 0xee})
+	secret := []byte("hidden after the volume")
+	writeTestBytes(t, image, testVolumeSectors*testSectorSize, secret)
+
+	exfat, _ := openTestImage(t, image)
+	report, err := exfat.ScanHiddenData()
+	if err != nil {
+		t.Fatalf("ScanHiddenData error: %v", err)
+	}
+
+	want := []struct {
+		kind   libxfat.HiddenAreaKind
+		offset uint64
+		path   string
+	}{
+		{libxfat.HIDDEN_BOOT_RESERVED, 10*testSectorSize + 7, ""},
+		{libxfat.HIDDEN_FAT_TAIL, testFatOffsetSector*testSectorSize + 100, ""},
+		{libxfat.HIDDEN_BITMAP_TAIL, uint64(bitmapOffset), "/$BitMap"},
+		{libxfat.HIDDEN_DIRECTORY_RESERVED, uint64(dirOffset + 25), "/DIR"},
+		{libxfat.HIDDEN_NAME_PADDING, uint64(dirOffset + 64 + 12), "/DIR"},
+		{libxfat.HIDDEN_DIRECTORY_UNUSED, uint64(dirOffset + 200), "/DIR"},
+		{libxfat.HIDDEN_PAST_VOLUME, testVolumeSectors * testSectorSize, ""},
+	}
+	for _, w := range want {
+		area, ok := findHiddenArea(report, w.kind)
+		if !ok {
+			t.Fatalf("no %v area in %+v", w.kind, report.Areas)
+		}
+		if area.FirstNonZero != w.offset || area.Path != w.path {
+			t.Fatalf("%v area = %+v, want first non-zero byte at %d in %q", w.kind, area, w.offset, w.path)
+		}
+	}
+	if len(report.Areas) != len(want) {
+		t.Fatalf("areas = %+v, want %d", report.Areas, len(want))
+	}
+
+	area, _ := findHiddenArea(report, libxfat.HIDDEN_PAST_VOLUME)
+	dst := filepath.Join(t.TempDir(), "past-volume.bin")
+	if err := exfat.ExtractHiddenArea(area, dst); err != nil {
+		t.Fatalf("ExtractHiddenArea error: %v", err)
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("read extracted area: %v", err)
+	}
+	if !bytes.Equal(data, secret) {
+		t.Fatalf("extracted %q, want %q", data, secret)
+	}
+}
+
+func TestScanHiddenDataFlagsRecordsPastDirectoryEnd(t *testing.T) {
+	image := createNestedTestImage(t)
+	dirOffset := int64((testDataOffset + testDirCluster - testRootCluster) * testSectorSize)
+
+	// A complete live entry set after the end of /DIR, which no reader lists.
+	set := make([]byte, 3*32)
+	if _, err := image.ReadAt(set, dirOffset); err != nil {
+		t.Fatalf("read entry set: %v", err)
+	}
+	writeTestBytes(t, image, dirOffset+256, set)
+
+	exfat, _ := openTestImage(t, image)
+	report, err := exfat.ScanHiddenData()
+	if err != nil {
+		t.Fatalf("ScanHiddenData error: %v", err)
+	}
+	area, ok := findHiddenArea(report, libxfat.HIDDEN_DIRECTORY_UNUSED)
+	if !ok || len(report.Areas) != 1 {
+		t.Fatalf("areas = %+v, want one unused directory area", report.Areas)
+	}
+	if area.FirstNonZero != uint64(dirOffset+256) || area.Length != uint64(len(set)) || area.Path != "/DIR" {
+		t.Fatalf("area = %+v, want the %d bytes at %d in /DIR", area, len(set), dirOffset+256)
+	}
+}
+
+func TestScanHiddenDataReportsUnreadableDirectory(t *testing.T) {
+	exfat, _ := openTestImage(t, createCycleTestImage(t))
+
+	report, err := exfat.ScanHiddenData()
+	if err != nil {
+		t.Fatalf("ScanHiddenData error: %v", err)
+	}
+	if len(report.Unreadable) != 1 || report.Unreadable[0].Kind != libxfat.FINDING_UNREADABLE_DIRECTORY || report.Unreadable[0].Path != "/DIR/LOOP" {
+		t.Fatalf("unreadable = %+v, want /DIR/LOOP", report.Unreadable)
+	}
+}
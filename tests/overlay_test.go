@@ -0,0 +1,168 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+	"github.com/aoiflux/libxfat/xfattest"
+)
+
+func TestOverlayKeepsBaseUntouched(t *testing.T) {
+	built, err := xfattest.Build(sampleTestVolume())
+	if err != nil {
+		t.Fatalf("Build error: %v", err)
+	}
+	original := append([]byte(nil), built.Image.Bytes()...)
+	deltaPath := filepath.Join(t.TempDir(), "image.delta")
+	delta, err := os.Create(deltaPath)
+	if err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+	defer delta.Close()
+
+	overlay, err := libxfat.NewOverlay(built.Image, delta)
+	if err != nil {
+		t.Fatalf("NewOverlay error: %v", err)
+	}
+	exfat, err := libxfat.NewFromImage(overlay, false)
+	if err != nil {
+		t.Fatalf("NewFromImage error: %v", err)
+	}
+	if _, err := exfat.CreateFile("/docs/added.txt", bytes.NewReader([]byte("added"))); err != nil {
+		t.Fatalf("CreateFile error: %v", err)
+	}
+	if err := exfat.Remove("/notes.txt"); err != nil {
+		t.Fatalf("Remove error: %v", err)
+	}
+	if !bytes.Equal(built.Image.Bytes(), original) {
+		t.Fatal("writes through the overlay changed the base image")
+	}
+	if len(overlay.ChangedSectors()) == 0 {
+		t.Fatal("ChangedSectors is empty after writes")
+	}
+
+	// A second overlay on the same delta file resumes the changes.
+	resumed, err := libxfat.NewOverlay(built.Image, delta)
+	if err != nil {
+		t.Fatalf("NewOverlay resume error: %v", err)
+	}
+	if !reflect.DeepEqual(resumed.ChangedSectors(), overlay.ChangedSectors()) {
+		t.Fatalf("resumed sectors = %v, want %v", resumed.ChangedSectors(), overlay.ChangedSectors())
+	}
+
+	var merged bytes.Buffer
+	if err := resumed.Export(&merged); err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if int64(merged.Len()) != built.Image.Size() {
+		t.Fatalf("exported %d bytes, want %d", merged.Len(), built.Image.Size())
+	}
+	exported, err := libxfat.NewFromImage(bytes.NewReader(merged.Bytes()), false)
+	if err != nil {
+		t.Fatalf("NewFromImage on export error: %v", err)
+	}
+	added, err := exported.Lookup("/docs/added.txt")
+	if err != nil || string(readTestFile(t, &exported, added)) != "added" {
+		t.Fatalf("exported /docs/added.txt = %v, want its content", err)
+	}
+	if _, err := exported.Lookup("/notes.txt"); !errors.Is(err, libxfat.ErrEntryNotFound) {
+		t.Fatalf("exported /notes.txt error = %v, want ErrEntryNotFound", err)
+	}
+
+	if err := resumed.Discard(); err != nil {
+		t.Fatalf("Discard error: %v", err)
+	}
+	merged.Reset()
+	if err := resumed.Export(&merged); err != nil || !bytes.Equal(merged.Bytes(), original) {
+		t.Fatalf("Export after Discard = %v, want the base image", err)
+	}
+	discarded, err := libxfat.NewOverlay(built.Image, delta)
+	if err != nil || len(discarded.ChangedSectors()) != 0 {
+		t.Fatalf("reopened discarded delta = %v, %v, want no changes", discarded.ChangedSectors(), err)
+	}
+}
+
+func TestOverlayPartialSectors(t *testing.T) {
+	base := bytes.Repeat([]byte{0xaa}, 1000)
+	overlay, err := libxfat.NewOverlay(bytes.NewReader(base))
+	if err != nil {
+		t.Fatalf("NewOverlay error: %v", err)
+	}
+
+	if _, err := overlay.WriteAt([]byte{1, 2, 3, 4}, 510); err != nil {
+		t.Fatalf("WriteAt error: %v", err)
+	}
+	if _, err := overlay.WriteAt([]byte{9, 9}, 1002); err != nil {
+		t.Fatalf("WriteAt past the end error: %v", err)
+	}
+	if got := overlay.ChangedSectors(); !reflect.DeepEqual(got, []uint64{0, 1}) {
+		t.Fatalf("ChangedSectors = %v, want [0 1]", got)
+	}
+	if overlay.Size() != 1004 {
+		t.Fatalf("Size = %d, want 1004", overlay.Size())
+	}
+
+	got := make([]byte, 8)
+	if _, err := overlay.ReadAt(got, 508); err != nil {
+		t.Fatalf("ReadAt error: %v", err)
+	}
+	if want := []byte{0xaa, 0xaa, 1, 2, 3, 4, 0xaa, 0xaa}; !bytes.Equal(got, want) {
+		t.Fatalf("ReadAt = %x, want %x", got, want)
+	}
+	tail := make([]byte, 8)
+	n, err := overlay.ReadAt(tail, 998)
+	if n != 6 || err == nil || !bytes.Equal(tail[:n], []byte{0xaa, 0xaa, 0, 0, 9, 9}) {
+		t.Fatalf("ReadAt tail = %x, %d, %v", tail[:n], n, err)
+	}
+	if !bytes.Equal(base, bytes.Repeat([]byte{0xaa}, 1000)) {
+		t.Fatal("base image changed")
+	}
+}
+
+// countingReader counts the reads that reach an image.
+type countingReader struct {
+	*bytes.Reader
+	reads int
+}
+
+func (r *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	r.reads++
+	return r.Reader.ReadAt(p, off)
+}
+
+func TestOverlayCoalescesBaseReads(t *testing.T) {
+	const sector = int(libxfat.SECTOR_SIZE)
+	data := make([]byte, 16*sector)
+	for i := range data {
+		data[i] = byte(i / sector)
+	}
+	base := &countingReader{Reader: bytes.NewReader(data)}
+	overlay, err := libxfat.NewOverlay(base)
+	if err != nil {
+		t.Fatalf("NewOverlay error: %v", err)
+	}
+	if _, err := overlay.WriteAt([]byte{0xff}, 8*int64(sector)); err != nil {
+		t.Fatalf("WriteAt error: %v", err)
+	}
+
+	// The unchanged sectors on each side of the changed one take one read
+	// each, however many sectors they span.
+	base.reads = 0
+	got := make([]byte, len(data)-1)
+	if _, err := overlay.ReadAt(got, 1); err != nil {
+		t.Fatalf("ReadAt error: %v", err)
+	}
+	want := append([]byte(nil), data[1:]...)
+	want[8*sector-1] = 0xff
+	if !bytes.Equal(got, want) {
+		t.Fatal("merged read differs from the base with the change applied")
+	}
+	if base.reads != 2 {
+		t.Fatalf("base reads = %d, want 2", base.reads)
+	}
+}
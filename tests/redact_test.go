@@ -0,0 +1,149 @@
+package test
+
+import (
+	"bytes"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/aoiflux/libxfat"
+	"github.com/aoiflux/libxfat/xfattest"
+)
+
+func utf16leBytes(s string) []byte {
+	var b []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(unit), byte(unit>>8))
+	}
+	return b
+}
+
+func exportTestRedacted(t *testing.T, built *xfattest.Built, opts libxfat.RedactOptions) ([]byte, libxfat.RedactReport, *libxfat.ExFAT) {
+	t.Helper()
+
+	// A read-only reader is enough: the image is never written.
+	exfat, err := libxfat.NewFromImage(bytes.NewReader(built.Image.Bytes()), false)
+	if err != nil {
+		t.Fatalf("NewFromImage error: %v", err)
+	}
+	var out bytes.Buffer
+	report, err := exfat.ExportRedacted(&out, opts)
+	if err != nil {
+		t.Fatalf("ExportRedacted error: %v", err)
+	}
+	if report.Written != uint64(out.Len()) || out.Len() != len(built.Image.Bytes()) {
+		t.Fatalf("wrote %d bytes, report says %d, want %d", out.Len(), report.Written, len(built.Image.Bytes()))
+	}
+	redacted, err := libxfat.NewFromImage(bytes.NewReader(out.Bytes()), false)
+	if err != nil {
+		t.Fatalf("NewFromImage on the redacted copy error: %v", err)
+	}
+	return out.Bytes(), report, &redacted
+}
+
+func TestExportRedactedKeepsStructure(t *testing.T) {
+	v := undeleteTestVolume()
+	v.Corruptions = []xfattest.Corruption{{Kind: xfattest.CORRUPT_SET_CHECKSUM, Path: "/notes.txt"}}
+	built := mustBuild(t, v)
+	original := built.Image.Bytes()
+	out, report, redacted := exportTestRedacted(t, built, libxfat.RedactOptions{Fill: []byte{0xee}, Names: true})
+
+	heap := redacted.GetClusterOffset(2)
+	if !bytes.Equal(out[:heap], original[:heap]) {
+		t.Fatal("redacted copy differs before the cluster heap")
+	}
+	if report.KeptClusters == 0 || report.FilledClusters == 0 || report.RenamedEntries == 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	for _, secret := range []string{"hello exFAT", "left behind", "inner"} {
+		if bytes.Contains(out, []byte(secret)) {
+			t.Fatalf("redacted copy still holds %q", secret)
+		}
+	}
+	for _, name := range []string{"notes.txt", "gone.txt", "vendor.dat", "orphan.txt", "olddir"} {
+		if bytes.Contains(out, utf16leBytes(name)) {
+			t.Fatalf("redacted copy still holds the name %s", name)
+		}
+	}
+
+	// The damaged set stays damaged, whatever it is called now.
+	base, err := built.Open(false)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	want, err := base.Check()
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	got, err := redacted.Check()
+	if err != nil {
+		t.Fatalf("Check on the redacted copy error: %v", err)
+	}
+	if len(got.Findings) != len(want.Findings) {
+		t.Fatalf("findings = %v, want %v", got.Findings, want.Findings)
+	}
+	for kind := range findingKinds(want) {
+		if _, ok := findingKinds(got)[kind]; !ok {
+			t.Fatalf("findings = %v, want %s", got.Findings, kind)
+		}
+	}
+
+	before, err := base.ReadRootDir()
+	if err != nil {
+		t.Fatalf("ReadRootDir error: %v", err)
+	}
+	after, err := redacted.ReadRootDir()
+	if err != nil || len(after) != len(before) {
+		t.Fatalf("redacted root = %d entries, %v, want %d", len(after), err, len(before))
+	}
+	for i := range before {
+		if after[i].IsDeleted() != before[i].IsDeleted() || len(after[i].Name()) != len(before[i].Name()) || after[i].GetSize() != before[i].GetSize() {
+			t.Fatalf("redacted entry %q differs from %q", after[i].Name(), before[i].Name())
+		}
+	}
+	recovered, err := redacted.RecoverDeletedEntries()
+	if err != nil || len(recovered) == 0 {
+		t.Fatalf("RecoverDeletedEntries on the redacted copy = %v, %v", recovered, err)
+	}
+
+	notes := mustTruth(t, built, "/notes.txt")
+	content := out[redacted.GetClusterOffset(notes.Runs[0].Start):][:len(notes.Content)]
+	if !bytes.Equal(content, bytes.Repeat([]byte{0xee}, len(notes.Content))) {
+		t.Fatalf("notes.txt content = %q, want the fill", content)
+	}
+}
+
+func TestExportRedactedKeepsNames(t *testing.T) {
+	built := mustBuild(t, sampleTestVolume())
+	out, report, redacted := exportTestRedacted(t, built, libxfat.RedactOptions{})
+	if report.RenamedEntries != 0 {
+		t.Fatalf("RenamedEntries = %d without Names", report.RenamedEntries)
+	}
+
+	// Directories are copied byte for byte, file data is zeroed.
+	docs := mustTruth(t, built, "/docs")
+	start := redacted.GetClusterOffset(docs.Runs[0].Start)
+	end := start + uint64(docs.Runs[0].Length)*built.Truth.ClusterSize
+	if !bytes.Equal(out[start:end], built.Image.Bytes()[start:end]) {
+		t.Fatal("/docs differs in the redacted copy")
+	}
+	split, err := redacted.Lookup("/split.bin")
+	if err != nil {
+		t.Fatalf("Lookup error: %v", err)
+	}
+	if data := readTestFile(t, redacted, split); !bytes.Equal(data, make([]byte, len(data))) {
+		t.Fatal("split.bin is not zeroed")
+	}
+}
+
+func TestExportRedactedReportsUnreadableDirectory(t *testing.T) {
+	exfat, _ := openTestImage(t, createCycleTestImage(t))
+
+	var out bytes.Buffer
+	report, err := exfat.ExportRedacted(&out, libxfat.RedactOptions{Names: true})
+	if err != nil {
+		t.Fatalf("ExportRedacted error: %v", err)
+	}
+	if len(report.Unreadable) != 1 || report.Unreadable[0].Kind != libxfat.FINDING_UNREADABLE_DIRECTORY || report.Unreadable[0].Path != "/DIR/LOOP" {
+		t.Fatalf("unreadable = %+v, want /DIR/LOOP", report.Unreadable)
+	}
+}
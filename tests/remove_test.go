@@ -0,0 +1,219 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+func readTestRecords(t *testing.T, image *os.File, entry libxfat.Entry) [][32]byte {
+	t.Helper()
+
+	var records [][32]byte
+	for _, off := range entry.RecordOffsets() {
+		var record [32]byte
+		if _, err := image.ReadAt(record[:], int64(off)); err != nil {
+			t.Fatalf("read record: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// deletedRootNames lists the deleted entry sets left in the root directory.
+func deletedRootNames(t *testing.T, image *os.File) map[string]bool {
+	t.Helper()
+
+	_, entries := openTestImage(t, image)
+	names := map[string]bool{}
+	for _, entry := range entries {
+		if entry.IsDeleted() {
+			names[entry.Name()] = true
+		}
+	}
+	return names
+}
+
+func TestRemoveFileLikeWindows(t *testing.T) {
+	image := createWritableTestImage(t)
+	// Leave clusters 5-6 and 8-10 free so the file needs a FAT chain.
+	writeTestBytes(t, image, int64((testDataOffset+testBitmapCluster-testRootCluster)*testSectorSize),
+		[]byte{0x27, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	exfat, _ := openTestImage(t, image)
+	entry, err := exfat.CreateFile("/victim.txt", bytes.NewReader(bytes.Repeat([]byte{'v'}, 4*testSectorSize)))
+	if err != nil {
+		t.Fatalf("CreateFile error: %v", err)
+	}
+	before := readTestRecords(t, image, entry)
+
+	if err := exfat.Remove("/victim.txt"); err != nil {
+		t.Fatalf("Remove error: %v", err)
+	}
+	after := readTestRecords(t, image, entry)
+	for i, want := range []byte{0x05, 0x40, 0x41} {
+		if after[i][0] != want {
+			t.Fatalf("record %d type = %#x, want %#x", i, after[i][0], want)
+		}
+		if !bytes.Equal(after[i][1:], before[i][1:]) {
+			t.Fatalf("record %d changed beyond its type byte", i)
+		}
+	}
+	var fat [4]byte
+	if _, err := image.ReadAt(fat[:], testFatOffsetSector*testSectorSize+10*4); err != nil {
+		t.Fatalf("read FAT entry: %v", err)
+	}
+	if next := binary.LittleEndian.Uint32(fat[:]); next != 5 {
+		t.Fatalf("FAT entry of cluster 10 = %d, want the chain left at 5", next)
+	}
+
+	reopened, _ := openTestImage(t, image)
+	if free, err := reopened.GetFreeClusters(); err != nil || free != 5 {
+		t.Fatalf("free clusters = %d, %v, want 5", free, err)
+	}
+	if _, err := reopened.Lookup("/victim.txt"); !errors.Is(err, libxfat.ErrEntryNotFound) {
+		t.Fatalf("Lookup after Remove error = %v, want ErrEntryNotFound", err)
+	}
+	if !deletedRootNames(t, image)["victim.txt"] {
+		t.Fatal("removed file not recovered with its name")
+	}
+}
+
+func TestRemoveDirectory(t *testing.T) {
+	image := createWritableTestImage(t)
+	exfat, _ := openTestImage(t, image)
+	for _, dir := range []string{"/top", "/top/sub"} {
+		if _, err := exfat.CreateDir(dir); err != nil {
+			t.Fatalf("CreateDir %s error: %v", dir, err)
+		}
+	}
+	if _, err := exfat.CreateFile("/top/sub/f.bin", bytes.NewReader([]byte("data"))); err != nil {
+		t.Fatalf("CreateFile error: %v", err)
+	}
+
+	if err := exfat.Remove("/top"); !errors.Is(err, libxfat.ErrDirectoryNotEmpty) {
+		t.Fatalf("Remove of a non-empty directory error = %v, want ErrDirectoryNotEmpty", err)
+	}
+	if err := exfat.RemoveAll("/top"); err != nil {
+		t.Fatalf("RemoveAll error: %v", err)
+	}
+	if err := exfat.RemoveAll("/top"); err != nil {
+		t.Fatalf("RemoveAll of a missing path error = %v, want nil", err)
+	}
+
+	reopened, _ := openTestImage(t, image)
+	if free, err := reopened.GetFreeClusters(); err != nil || free != testWritableClusters-3 {
+		t.Fatalf("free clusters = %d, %v, want %d", free, err, testWritableClusters-3)
+	}
+	report, err := reopened.Check()
+	if err != nil || !report.OK() || report.Files != 0 || report.Directories != 0 {
+		t.Fatalf("Check = %+v, %v, want an empty clean volume", report, err)
+	}
+	if names := deletedRootNames(t, image); !names["top"] {
+		t.Fatalf("deleted = %v, want the removed directory", names)
+	}
+	orphans, err := reopened.RecoverDeletedEntries()
+	if err != nil {
+		t.Fatalf("RecoverDeletedEntries error: %v", err)
+	}
+	if len(orphans) != 2 {
+		t.Fatalf("orphans = %d, want sub and f.bin from the freed clusters", len(orphans))
+	}
+}
+
+func TestRemoveAllStopsAtDirectoryCycle(t *testing.T) {
+	exfat, _ := openTestImage(t, createCycleTestImage(t))
+	exfat.SetTraversalLimits(libxfat.TraversalLimits{})
+
+	err := exfat.RemoveAll("/DIR")
+	var traversalErr *libxfat.TraversalError
+	if !errors.Is(err, libxfat.ErrDirectoryCycle) || !errors.As(err, &traversalErr) || traversalErr.Path != "/DIR/LOOP" {
+		t.Fatalf("RemoveAll error = %v, want a cycle at /DIR/LOOP", err)
+	}
+}
+
+func TestRenameAndMove(t *testing.T) {
+	image := createWritableTestImage(t)
+	exfat, _ := openTestImage(t, image)
+	content := []byte("payload")
+	entry, err := exfat.CreateFile("/a.txt", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("CreateFile error: %v", err)
+	}
+	if _, err := exfat.CreateDir("/dir"); err != nil {
+		t.Fatalf("CreateDir error: %v", err)
+	}
+
+	if err := exfat.Rename("/a.txt", "b.txt"); err != nil {
+		t.Fatalf("Rename error: %v", err)
+	}
+	renamed, err := exfat.Lookup("/b.txt")
+	if err != nil {
+		t.Fatalf("Lookup after Rename error: %v", err)
+	}
+	if renamed.RecordOffsets()[0] != entry.RecordOffsets()[0] {
+		t.Fatal("same-size rename did not rewrite the set in place")
+	}
+	if err := exfat.Rename("/b.txt", "B.TXT"); err != nil {
+		t.Fatalf("case-only Rename error: %v", err)
+	}
+	if err := exfat.Rename("/B.TXT", "dir"); !errors.Is(err, libxfat.ErrEntryExists) {
+		t.Fatalf("Rename onto a directory error = %v, want ErrEntryExists", err)
+	}
+	if err := exfat.Move("/dir", "/dir/inner"); !errors.Is(err, libxfat.ErrInvalidName) {
+		t.Fatalf("Move below itself error = %v, want ErrInvalidName", err)
+	}
+
+	if err := exfat.Move("/B.TXT", "/dir/a much longer file name.txt"); err != nil {
+		t.Fatalf("Move error: %v", err)
+	}
+	reopened, _ := openTestImage(t, image)
+	moved, err := reopened.Lookup("/dir/A MUCH LONGER FILE NAME.TXT")
+	if err != nil {
+		t.Fatalf("Lookup after Move error: %v", err)
+	}
+	if !bytes.Equal(readTestFile(t, reopened, moved), content) {
+		t.Fatal("moved file content differs")
+	}
+	report, err := reopened.Check()
+	if err != nil || !report.OK() || report.Files != 1 {
+		t.Fatalf("Check = %+v, %v, want a clean volume with one file", report, err)
+	}
+	if !deletedRootNames(t, image)["B.TXT"] {
+		t.Fatal("old entry set of the moved file not left behind as deleted")
+	}
+}
+
+func TestMoveKeepsVendorRecords(t *testing.T) {
+	built := mustBuild(t, sampleTestVolume())
+	vendor := mustTruth(t, built, "/docs/vendor.dat")
+	last := vendor.RecordOffsets[len(vendor.RecordOffsets)-1]
+	want := append([]byte(nil), built.Image.Bytes()[last:last+32]...)
+	overlay, exfat := openRepairTestVolume(t, built, openMainBoot)
+
+	if err := exfat.Rename("/docs/vendor.dat", "vendor.bin"); err != nil {
+		t.Fatalf("Rename error: %v", err)
+	}
+	if err := exfat.Move("/docs/vendor.bin", "/a vendor file with a long name.bin"); err != nil {
+		t.Fatalf("Move error: %v", err)
+	}
+	moved, err := exfat.Lookup("/a vendor file with a long name.bin")
+	if err != nil {
+		t.Fatalf("Lookup after Move error: %v", err)
+	}
+	offsets := moved.RecordOffsets()
+	if len(offsets) != 6 {
+		t.Fatalf("moved set has %d records, want file, stream, three names and the vendor record", len(offsets))
+	}
+	got := make([]byte, 32)
+	if _, err := overlay.ReadAt(got, int64(offsets[5])); err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("last record = %x, %v, want the vendor record %x", got, err, want)
+	}
+	report, err := exfat.Check()
+	if err != nil || !report.OK() {
+		t.Fatalf("Check = %+v, %v, want a clean volume", report, err)
+	}
+}
@@ -0,0 +1,234 @@
+package test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+	"github.com/aoiflux/libxfat/xfattest"
+)
+
+// openRepairTestVolume opens a built volume on an in-memory overlay, so the
+// repaired image can be compared with the untouched base.
+func openRepairTestVolume(t *testing.T, built *xfattest.Built, open func(image *libxfat.Overlay) (libxfat.ExFAT, error)) (*libxfat.Overlay, *libxfat.ExFAT) {
+	t.Helper()
+
+	overlay, err := libxfat.NewOverlay(built.Image)
+	if err != nil {
+		t.Fatalf("NewOverlay error: %v", err)
+	}
+	exfat, err := open(overlay)
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+	return overlay, &exfat
+}
+
+func openMainBoot(image *libxfat.Overlay) (libxfat.ExFAT, error) {
+	return libxfat.NewFromImage(image, false)
+}
+
+// checkRepairLog replays the log on a copy of the base image and expects the
+// repaired image.
+func checkRepairLog(t *testing.T, built *xfattest.Built, overlay *libxfat.Overlay, log libxfat.RepairLog) {
+	t.Helper()
+
+	replayed := append([]byte(nil), built.Image.Bytes()...)
+	for _, change := range log.Changes {
+		if !bytes.Equal(replayed[change.Offset:change.Offset+uint64(len(change.Old))], change.Old) {
+			t.Fatalf("%s change at %d: old bytes do not match the image", change.Kind, change.Offset)
+		}
+		copy(replayed[change.Offset:], change.New)
+	}
+	var repaired bytes.Buffer
+	if err := overlay.Export(&repaired); err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if !bytes.Equal(replayed, repaired.Bytes()) {
+		t.Fatal("replaying the repair log does not give the repaired image")
+	}
+}
+
+func repairKinds(log libxfat.RepairLog) map[libxfat.RepairKind]bool {
+	kinds := map[libxfat.RepairKind]bool{}
+	for _, change := range log.Changes {
+		kinds[change.Kind] = true
+	}
+	return kinds
+}
+
+func TestRepairEntrySetsLoopsAndBitmap(t *testing.T) {
+	v := sampleTestVolume()
+	v.Corruptions = []xfattest.Corruption{
+		{Kind: xfattest.CORRUPT_SET_CHECKSUM, Path: "/notes.txt"},
+		{Kind: xfattest.CORRUPT_FAT_LOOP, Path: "/split.bin"},
+		{Kind: xfattest.CORRUPT_LOST_CLUSTERS, Path: "/gone.txt"},
+	}
+	built := mustBuild(t, v)
+
+	// Give /docs/vendor.dat a wrong NameHash under a valid SetChecksum.
+	vendor := mustTruth(t, built, "/docs/vendor.dat")
+	first := vendor.RecordOffsets[0]
+	set := built.Image.Bytes()[first : first+32*uint64(len(vendor.RecordOffsets))]
+	set[32+4] ^= 0x5a
+	writeTestSetChecksum(set)
+	overlay, exfat := openRepairTestVolume(t, built, openMainBoot)
+
+	report, err := exfat.Check()
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	kinds := findingKinds(report)
+	for _, kind := range []libxfat.FindingKind{libxfat.FINDING_MALFORMED_ENTRY_SET, libxfat.FINDING_CHAIN_LOOP, libxfat.FINDING_NAME_HASH_MISMATCH, libxfat.FINDING_LOST_CLUSTERS} {
+		if _, ok := kinds[kind]; !ok {
+			t.Fatalf("findings = %v, want %s", report.Findings, kind)
+		}
+	}
+
+	log, err := exfat.Repair(report, libxfat.RepairOptions{EntrySets: true, CutLoops: true, RebuildBitmap: true, ClearDirty: true})
+	if err != nil {
+		t.Fatalf("Repair error: %v", err)
+	}
+	if len(log.Skipped) != 0 {
+		t.Fatalf("skipped = %v, want none", log.Skipped)
+	}
+	if got := repairKinds(log); !got[libxfat.REPAIR_ENTRY_SET] || !got[libxfat.REPAIR_CHAIN_LOOP] || !got[libxfat.REPAIR_BITMAP] {
+		t.Fatalf("repair kinds = %v, want entry-set, chain-loop and bitmap", got)
+	}
+	checkRepairLog(t, built, overlay, log)
+
+	report, err = exfat.Check()
+	if err != nil || len(report.Findings) != 0 {
+		t.Fatalf("Check after Repair = %v, %v, want no findings", report.Findings, err)
+	}
+	if exfat.IsVolumeDirty() {
+		t.Fatal("volume still dirty after Repair")
+	}
+	notes, err := exfat.Lookup("/notes.txt")
+	if err != nil || string(readTestFile(t, exfat, notes)) != "hello exFAT" {
+		t.Fatalf("/notes.txt after Repair = %v, want its content", err)
+	}
+}
+
+func TestRepairKeepsDirtyWhenSkipping(t *testing.T) {
+	v := sampleTestVolume()
+	v.Corruptions = []xfattest.Corruption{{Kind: xfattest.CORRUPT_SET_CHECKSUM, Path: "/notes.txt"}}
+	built := mustBuild(t, v)
+	built.Image.Bytes()[libxfat.EXFAT_VOLUME_FLAGS_OFFSET] |= byte(libxfat.VOLUME_FLAG_DIRTY)
+	_, exfat := openRepairTestVolume(t, built, openMainBoot)
+
+	report, err := exfat.Check()
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	// A finding pointing at no entry set cannot be repaired.
+	unrepairable := libxfat.CheckReport{Findings: append([]libxfat.Finding{{
+		Kind:       libxfat.FINDING_MALFORMED_ENTRY_SET,
+		Diagnostic: libxfat.DIAG_CHECKSUM_MISMATCH,
+		Path:       "/",
+		Offset:     1,
+	}}, report.Findings...)}
+
+	log, err := exfat.Repair(unrepairable, libxfat.RepairOptions{EntrySets: true, ClearDirty: true})
+	if err != nil {
+		t.Fatalf("Repair error: %v", err)
+	}
+	if len(log.Skipped) != 1 || !exfat.IsVolumeDirty() {
+		t.Fatalf("skipped = %v, dirty = %v, want one skipped finding and the flag kept", log.Skipped, exfat.IsVolumeDirty())
+	}
+
+	log, err = exfat.Repair(report, libxfat.RepairOptions{EntrySets: true, ClearDirty: true})
+	if err != nil || len(log.Skipped) != 0 || exfat.IsVolumeDirty() {
+		t.Fatalf("Repair = %v, %v, dirty = %v, want the flag cleared", log.Skipped, err, exfat.IsVolumeDirty())
+	}
+}
+
+func TestRepairLostClusters(t *testing.T) {
+	v := sampleTestVolume()
+	v.Corruptions = []xfattest.Corruption{{Kind: xfattest.CORRUPT_LOST_CLUSTERS, Path: "/$OrphanFiles/orphan.txt"}}
+	built := mustBuild(t, v)
+	orphan := mustTruth(t, built, "/$OrphanFiles/orphan.txt")
+
+	for _, action := range []libxfat.LostClusterAction{libxfat.LOST_CLUSTERS_FREE, libxfat.LOST_CLUSTERS_RECOVER} {
+		overlay, exfat := openRepairTestVolume(t, built, openMainBoot)
+		report, err := exfat.Check()
+		if err != nil {
+			t.Fatalf("Check error: %v", err)
+		}
+		log, err := exfat.Repair(report, libxfat.RepairOptions{LostClusters: action})
+		if err != nil {
+			t.Fatalf("%s: Repair error: %v", action, err)
+		}
+		checkRepairLog(t, built, overlay, log)
+
+		report, err = exfat.Check()
+		if err != nil {
+			t.Fatalf("Check error: %v", err)
+		}
+		if _, ok := findingKinds(report)[libxfat.FINDING_LOST_CLUSTERS]; ok {
+			t.Fatalf("%s: lost clusters remain: %v", action, report.Findings)
+		}
+		recovered, err := exfat.Lookup("/FOUND.000/FILE0000.CHK")
+		if action == libxfat.LOST_CLUSTERS_FREE {
+			if err == nil {
+				t.Fatal("free: FOUND.000 was created")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("recover: Lookup error: %v", err)
+		}
+		content := readTestFile(t, exfat, recovered)
+		if recovered.GetEntryCluster() != orphan.Runs[0].Start || !bytes.HasPrefix(content, orphan.Content) {
+			t.Fatalf("recover: FILE0000.CHK at cluster %d = %q, want the lost orphan data", recovered.GetEntryCluster(), content)
+		}
+	}
+}
+
+func mustBuild(t *testing.T, v xfattest.Volume) *xfattest.Built {
+	t.Helper()
+
+	built, err := xfattest.Build(v)
+	if err != nil {
+		t.Fatalf("Build error: %v", err)
+	}
+	return built
+}
+
+func TestRepairBootRegionFromBackup(t *testing.T) {
+	v := sampleTestVolume()
+	v.Corruptions = []xfattest.Corruption{{Kind: xfattest.CORRUPT_MAIN_VBR}}
+	built := mustBuild(t, v)
+	overlay, exfat := openRepairTestVolume(t, built, func(image *libxfat.Overlay) (libxfat.ExFAT, error) {
+		if _, err := libxfat.NewFromImage(image, false); err == nil {
+			t.Fatal("NewFromImage succeeded on a damaged main boot sector")
+		}
+		return libxfat.NewFromBackup(image, false)
+	})
+
+	report, err := exfat.Check()
+	if err != nil || !report.OK() {
+		t.Fatalf("Check through the backup = %v, %v, want a clean tree", report.Findings, err)
+	}
+	log, err := exfat.Repair(report, libxfat.RepairOptions{BootRegion: true})
+	if err != nil {
+		t.Fatalf("Repair error: %v", err)
+	}
+	if !repairKinds(log)[libxfat.REPAIR_BOOT_REGION] {
+		t.Fatalf("repair kinds = %v, want boot-region", repairKinds(log))
+	}
+	checkRepairLog(t, built, overlay, log)
+
+	repaired, err := libxfat.NewFromImage(overlay, false)
+	if err != nil {
+		t.Fatalf("NewFromImage after Repair error: %v", err)
+	}
+	if _, err := repaired.Lookup("/docs/vendor.dat"); err != nil {
+		t.Fatalf("Lookup after Repair error: %v", err)
+	}
+	for _, sector := range overlay.ChangedSectors() {
+		if sector >= 12 {
+			t.Fatalf("changed sectors = %v, want only the main boot region", overlay.ChangedSectors())
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+func remnantKinds(remnants []libxfat.Remnant) map[libxfat.RemnantKind]bool {
+	kinds := map[libxfat.RemnantKind]bool{}
+	for _, remnant := range remnants {
+		kinds[remnant.Kind] = true
+	}
+	return kinds
+}
+
+func TestSanitizeWipesRemnants(t *testing.T) {
+	built := mustBuild(t, undeleteTestVolume())
+	original := append([]byte(nil), built.Image.Bytes()...)
+	overlay, exfat := openRepairTestVolume(t, built, openMainBoot)
+	opts := libxfat.SanitizeOptions{Pattern: []byte{0xde, 0xad, 0xbe}}
+
+	before, err := exfat.VerifySanitized(opts)
+	if err != nil {
+		t.Fatalf("VerifySanitized error: %v", err)
+	}
+	kinds := remnantKinds(before)
+	for _, kind := range []libxfat.RemnantKind{libxfat.REMNANT_FREE_CLUSTERS, libxfat.REMNANT_DIRECTORY_RECORD, libxfat.REMNANT_RECOVERED_ENTRY} {
+		if !kinds[kind] {
+			t.Fatalf("remnants before Sanitize = %v, want %s", before, kind)
+		}
+	}
+
+	report, err := exfat.Sanitize(opts)
+	if err != nil {
+		t.Fatalf("Sanitize error: %v", err)
+	}
+	if !report.Clean() {
+		t.Fatalf("remnants after Sanitize = %+v", report.Remnants)
+	}
+	if report.FreeClusters != uint64(built.Truth.ClusterCount-built.Truth.Allocated) || report.SlackBytes == 0 || report.DeletedRecords == 0 {
+		t.Fatalf("report = %+v, want free clusters, slack and deleted records overwritten", report)
+	}
+	if !bytes.Equal(built.Image.Bytes(), original) {
+		t.Fatal("Sanitize through the overlay changed the base image")
+	}
+
+	for _, path := range []string{"/notes.txt", "/split.bin", "/docs/vendor.dat"} {
+		entry, err := exfat.Lookup(path)
+		if err != nil || !bytes.Equal(readTestFile(t, exfat, entry), mustTruth(t, built, path).Content) {
+			t.Fatalf("%s after Sanitize = %v, want its content", path, err)
+		}
+	}
+	root, err := exfat.ReadRootDir()
+	if err != nil {
+		t.Fatalf("ReadRootDir error: %v", err)
+	}
+	for _, entry := range root {
+		if entry.IsDeleted() {
+			t.Fatalf("deleted entry %s still listed", entry.Name())
+		}
+	}
+	hidden, err := exfat.ScanHiddenData()
+	if err != nil {
+		t.Fatalf("ScanHiddenData error: %v", err)
+	}
+	for _, area := range hidden.Areas {
+		if area.Kind == libxfat.HIDDEN_DIRECTORY_UNUSED {
+			t.Fatalf("unused directory records hold data: %+v", area)
+		}
+	}
+	checkReport, err := exfat.Check()
+	if err != nil || len(checkReport.Findings) != 0 {
+		t.Fatalf("Check after Sanitize = %v, %v, want no findings", checkReport.Findings, err)
+	}
+
+	// The pattern is aligned on the cluster, so the slack of notes.txt picks
+	// it up at byte 11.
+	notes := mustTruth(t, built, "/notes.txt")
+	slack := make([]byte, 4)
+	if _, err := overlay.ReadAt(slack, int64(exfat.GetClusterOffset(notes.Runs[0].Start))+int64(len(notes.Content))); err != nil {
+		t.Fatalf("ReadAt error: %v", err)
+	}
+	if want := []byte{0xbe, 0xde, 0xad, 0xbe}; !bytes.Equal(slack, want) {
+		t.Fatalf("slack of notes.txt = %x, want %x", slack, want)
+	}
+
+	// Anything written to free space afterwards shows up again.
+	free, err := exfat.GetLargestFreeRun()
+	if err != nil {
+		t.Fatalf("GetLargestFreeRun error: %v", err)
+	}
+	if _, err := overlay.WriteAt([]byte("secret"), int64(exfat.GetClusterOffset(free.Start))+100); err != nil {
+		t.Fatalf("WriteAt error: %v", err)
+	}
+	after, err := exfat.VerifySanitized(opts)
+	if err != nil || len(after) != 1 || after[0].Kind != libxfat.REMNANT_FREE_CLUSTERS || after[0].Mismatched == 0 {
+		t.Fatalf("VerifySanitized after a write = %+v, %v, want one free-clusters remnant", after, err)
+	}
+}
+
+func TestVerifySanitizedReportsUnreadableDirectory(t *testing.T) {
+	exfat, _ := openTestImage(t, createCycleTestImage(t))
+
+	remnants, err := exfat.VerifySanitized()
+	if err != nil {
+		t.Fatalf("VerifySanitized error: %v", err)
+	}
+	for _, remnant := range remnants {
+		if remnant.Kind == libxfat.REMNANT_UNREADABLE_DIRECTORY && remnant.Path == "/DIR/LOOP" {
+			return
+		}
+	}
+	t.Fatalf("remnants = %+v, want /DIR/LOOP unreadable", remnants)
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+func writeTestVBRByte(t *testing.T, image *os.File, offset int64, value byte) {
+	t.Helper()
+
+	if _, err := image.WriteAt([]byte{value}, offset); err != nil {
+		t.Fatalf("write VBR byte: %v", err)
+	}
+}
+
+func volumeState(t *testing.T, image *os.File) libxfat.VolumeState {
+	t.Helper()
+
+	exfat, err := libxfat.New(image, false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	state, err := exfat.GetVolumeState()
+	if err != nil {
+		t.Fatalf("GetVolumeState error: %v", err)
+	}
+	return state
+}
+
+func TestVolumeStateClean(t *testing.T) {
+	image := createNestedTestImage(t)
+	writeTestBitmap(t, image, 0x0f)
+	writeTestVBRByte(t, image, 0x70, 100)
+
+	state := volumeState(t, image)
+	if state.UncleanUnmount || len(state.Suspects) != 0 {
+		t.Fatalf("state = %+v, want clean", state)
+	}
+	if state.ActualPercentInUse != 100 || state.PercentInUseStale {
+		t.Fatalf("percent in use = %d stale=%v, want 100 fresh", state.ActualPercentInUse, state.PercentInUseStale)
+	}
+}
+
+func TestVolumeStateStalePercentInUse(t *testing.T) {
+	image := createNestedTestImage(t)
+	writeTestBitmap(t, image, 0x0f)
+
+	state := volumeState(t, image)
+	if !state.PercentInUseStale || state.RecordedPercentInUse != 25 || state.ActualPercentInUse != 100 {
+		t.Fatalf("state = %+v, want stale 25%% against 100%%", state)
+	}
+	if !state.UncleanUnmount {
+		t.Fatal("stale PercentInUse should mark the unmount unclean")
+	}
+}
+
+func TestVolumeStateDirtyWithTornEntrySet(t *testing.T) {
+	image := createNestedTestImage(t)
+	writeTestBitmap(t, image, 0x0f)
+	writeTestVBRByte(t, image, 0x70, 100)
+	writeTestVBRByte(t, image, 0x6a, 0x06)
+	// Break the checksum of the /DIR entry set, whose cluster is allocated.
+	setOffset := int64(testDataOffset*testSectorSize + 160)
+	writeTestVBRByte(t, image, setOffset+2, 0)
+	writeTestVBRByte(t, image, setOffset+3, 0)
+
+	state := volumeState(t, image)
+	if !state.Dirty || !state.MediaFailure || !state.UncleanUnmount {
+		t.Fatalf("state = %+v, want dirty and media failure", state)
+	}
+
+	kinds := map[libxfat.SuspectKind]libxfat.Suspect{}
+	for _, suspect := range state.Suspects {
+		kinds[suspect.Kind] = suspect
+	}
+	for _, kind := range []libxfat.SuspectKind{libxfat.SUSPECT_DIRTY_FLAG, libxfat.SUSPECT_MEDIA_FAILURE, libxfat.SUSPECT_TORN_ENTRY_SET} {
+		if _, ok := kinds[kind]; !ok {
+			t.Fatalf("suspects = %v, missing %v", state.Suspects, kind)
+		}
+	}
+	torn := kinds[libxfat.SUSPECT_TORN_ENTRY_SET]
+	if torn.Offset != uint64(setOffset) || torn.Cluster != testDirCluster {
+		t.Fatalf("torn set = %+v, want offset %d cluster %d", torn, setOffset, testDirCluster)
+	}
+}
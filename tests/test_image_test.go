@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"unicode"
 )
 
 const (
@@ -24,7 +25,15 @@ const (
 	testVolumeGUIDType  = 0xA0
 	testTexFATType      = 0xA1
 	testACTType         = 0xE2
+	testDirCluster      = 5
 	testFinalCluster    = 0xffffffff
+
+	testFileEntryType   = 0x85
+	testStreamEntryType = 0xC0
+	testNameEntryType   = 0xC1
+	testDirAttr         = 0x10
+	testArchiveAttr     = 0x20
+	testNoFatChainFlag  = 0x03
 )
 
 func createTestImage(t *testing.T) *os.File {
@@ -55,6 +64,97 @@ func createTestImage(t *testing.T) *os.File {
 	return image
 }
 
+// createNestedTestImage extends the minimal image with a directory /DIR stored
+// in cluster 5 that contains an empty file A.TXT.
+func createNestedTestImage(t *testing.T) *os.File {
+	t.Helper()
+
+	image := createTestImage(t)
+	data := make([]byte, testVolumeSectors*testSectorSize)
+	if _, err := image.ReadAt(data, 0); err != nil {
+		t.Fatalf("read image: %v", err)
+	}
+
+	root := data[testDataOffset*testSectorSize:]
+	writeTestEntrySet(root[160:], "DIR", testDirAttr, testDirCluster, testSectorSize)
+	dir := data[(testDataOffset+testDirCluster-testRootCluster)*testSectorSize:]
+	writeTestEntrySet(dir, "A.TXT", testArchiveAttr, 0, 0)
+	binary.LittleEndian.PutUint32(data[testFatOffsetSector*testSectorSize+testDirCluster*4:], testFinalCluster)
+
+	if _, err := image.WriteAt(data, 0); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+	return image
+}
+
+// writeTestEntrySet writes a FILE/STREAM/NAME entry set with a valid set
+// checksum and returns the number of bytes it occupies.
+func writeTestEntrySet(dst []byte, name string, attr uint16, cluster uint32, size uint64) int {
+	units := []uint16{}
+	for _, r := range name {
+		units = append(units, uint16(r))
+	}
+	nameRecords := (len(units) + 14) / 15
+	set := dst[:(2+nameRecords)*32]
+
+	set[0] = testFileEntryType
+	set[1] = byte(1 + nameRecords)
+	binary.LittleEndian.PutUint16(set[4:6], attr)
+
+	stream := set[32:64]
+	stream[0] = testStreamEntryType
+	stream[1] = testNoFatChainFlag
+	stream[3] = byte(len(units))
+	binary.LittleEndian.PutUint16(stream[4:6], testNameHash(units))
+	binary.LittleEndian.PutUint64(stream[8:16], size)
+	binary.LittleEndian.PutUint32(stream[20:24], cluster)
+	binary.LittleEndian.PutUint64(stream[24:32], size)
+
+	for i, unit := range units {
+		record := set[64+(i/15)*32:]
+		record[0] = testNameEntryType
+		binary.LittleEndian.PutUint16(record[2+(i%15)*2:], unit)
+	}
+	for i := 1; i < nameRecords; i++ {
+		set[64+i*32] = testNameEntryType
+	}
+
+	writeTestSetChecksum(set)
+	return len(set)
+}
+
+// testNameHash hashes the up-cased name the way exFAT does, low byte first.
+func testNameHash(units []uint16) uint16 {
+	var hash uint16
+	for _, unit := range units {
+		unit = uint16(unicode.ToUpper(rune(unit)))
+		for _, b := range []byte{byte(unit), byte(unit >> 8)} {
+			hash = ((hash >> 1) | (hash << 15)) + uint16(b)
+		}
+	}
+	return hash
+}
+
+// deleteTestEntrySet clears the in-use bit of every record in set and
+// refreshes its checksum.
+func deleteTestEntrySet(set []byte) {
+	for i := 0; i < len(set); i += 32 {
+		set[i] &^= 0x80
+	}
+	writeTestSetChecksum(set)
+}
+
+func writeTestSetChecksum(set []byte) {
+	var checksum uint16
+	for i, b := range set {
+		if i == 2 || i == 3 {
+			continue
+		}
+		checksum = ((checksum >> 1) | (checksum << 15)) + uint16(b)
+	}
+	binary.LittleEndian.PutUint16(set[2:4], checksum)
+}
+
 func createLoopedRootDirImage(t *testing.T) *os.File {
 	t.Helper()
 
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+// createCycleTestImage adds /DIR/LOOP, a directory whose first cluster is the
+// root directory.
+func createCycleTestImage(t *testing.T) *os.File {
+	t.Helper()
+
+	image := createNestedTestImage(t)
+	set := make([]byte, 96)
+	size := writeTestEntrySet(set, "LOOP", testDirAttr, testRootCluster, testSectorSize)
+	offset := int64((testDataOffset+testDirCluster-testRootCluster)*testSectorSize + 96)
+	if _, err := image.WriteAt(set[:size], offset); err != nil {
+		t.Fatalf("write loop set: %v", err)
+	}
+	return image
+}
+
+func openTestImage(t *testing.T, image *os.File) (*libxfat.ExFAT, []libxfat.Entry) {
+	t.Helper()
+
+	exfat, err := libxfat.New(image, false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	rootEntries, err := exfat.ReadRootDir()
+	if err != nil {
+		t.Fatalf("ReadRootDir error: %v", err)
+	}
+	return &exfat, rootEntries
+}
+
+func TestDirectoryCycleIsReported(t *testing.T) {
+	exfat, rootEntries := openTestImage(t, createCycleTestImage(t))
+
+	_, err := exfat.GetFullPathIndexableEntries(rootEntries, "/")
+	var traversalErr *libxfat.TraversalError
+	if !errors.Is(err, libxfat.ErrDirectoryCycle) || !errors.As(err, &traversalErr) {
+		t.Fatalf("GetFullPathIndexableEntries error = %v, want ErrDirectoryCycle", err)
+	}
+	if traversalErr.Path != "/DIR/LOOP" || traversalErr.Cluster != testRootCluster {
+		t.Fatalf("traversal error = %+v, want /DIR/LOOP at root cluster", traversalErr)
+	}
+
+	if _, err := exfat.GetAllEntries(rootEntries); !errors.Is(err, libxfat.ErrDirectoryCycle) {
+		t.Fatalf("GetAllEntries error = %v, want ErrDirectoryCycle", err)
+	}
+}
+
+func TestCheckSurvivesDirectoryCycle(t *testing.T) {
+	exfat, _ := openTestImage(t, createCycleTestImage(t))
+
+	report, err := exfat.Check()
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	unreadable, ok := findingKinds(report)[libxfat.FINDING_UNREADABLE_DIRECTORY]
+	if !ok || unreadable.Path != "/DIR/LOOP" {
+		t.Fatalf("findings = %v, want /DIR/LOOP unreadable", report.Findings)
+	}
+}
+
+func TestMaxDepthLimit(t *testing.T) {
+	exfat, rootEntries := openTestImage(t, createCycleTestImage(t))
+	exfat.SetTraversalLimits(libxfat.TraversalLimits{MaxDepth: 1})
+
+	_, err := exfat.GetFullPathIndexableEntries(rootEntries, "/")
+	if !errors.Is(err, libxfat.ErrMaxDepth) {
+		t.Fatalf("GetFullPathIndexableEntries error = %v, want ErrMaxDepth", err)
+	}
+}
+
+func TestMaxEntriesPerDirLimit(t *testing.T) {
+	exfat, err := libxfat.New(createNestedTestImage(t), false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	exfat.SetTraversalLimits(libxfat.TraversalLimits{MaxEntriesPerDir: 1})
+
+	if _, err := exfat.ReadRootDir(); !errors.Is(err, libxfat.ErrMaxEntriesPerDir) {
+		t.Fatalf("ReadRootDir error = %v, want ErrMaxEntriesPerDir", err)
+	}
+}
+
+func TestMaxTotalEntriesLimit(t *testing.T) {
+	exfat, err := libxfat.New(createNestedTestImage(t), false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	exfat.SetTraversalLimits(libxfat.TraversalLimits{MaxTotalEntries: 2})
+
+	if _, err := exfat.Check(); !errors.Is(err, libxfat.ErrMaxTotalEntries) {
+		t.Fatalf("Check error = %v, want ErrMaxTotalEntries", err)
+	}
+}
+
+func TestMaxChainLengthLimit(t *testing.T) {
+	image := createTestImage(t)
+	writeTestFATEntry(t, image, testRootCluster, testDirCluster)
+	writeTestFATEntry(t, image, testDirCluster, testFinalCluster)
+	exfat, err := libxfat.New(image, false)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	exfat.SetTraversalLimits(libxfat.TraversalLimits{MaxChainLength: 1})
+
+	if _, err := exfat.ReadRootDir(); !errors.Is(err, libxfat.ErrMaxChainLength) {
+		t.Fatalf("ReadRootDir error = %v, want ErrMaxChainLength", err)
+	}
+}
@@ -0,0 +1,170 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+	"github.com/aoiflux/libxfat/xfattest"
+)
+
+func undeleteTestVolume() xfattest.Volume {
+	v := sampleTestVolume()
+	v.Root = append(v.Root,
+		xfattest.Node{Name: "frag.del", Content: bytes.Repeat([]byte{'f'}, 3*512), Fragments: []int{1, 2}, Deleted: true},
+		xfattest.Node{Name: "olddir", Dir: true, Deleted: true, Children: []xfattest.Node{
+			{Name: "inner.txt", Content: []byte("inner")},
+		}},
+	)
+	return v
+}
+
+func deletedRootEntry(t *testing.T, exfat *libxfat.ExFAT, name string) libxfat.Entry {
+	t.Helper()
+
+	root, err := exfat.ReadRootDir()
+	if err != nil {
+		t.Fatalf("ReadRootDir error: %v", err)
+	}
+	for _, entry := range root {
+		if entry.IsDeleted() && entry.Name() == name {
+			return entry
+		}
+	}
+	t.Fatalf("deleted entry %s not found", name)
+	return libxfat.Entry{}
+}
+
+func TestUndeleteRestoresEntries(t *testing.T) {
+	built := mustBuild(t, undeleteTestVolume())
+	_, exfat := openRepairTestVolume(t, built, openMainBoot)
+
+	orphans, err := exfat.RecoverDeletedEntries()
+	if err != nil || len(orphans) == 0 {
+		t.Fatalf("RecoverDeletedEntries = %v, %v", orphans, err)
+	}
+	if _, err := exfat.Undelete(orphans[0]); !errors.Is(err, libxfat.ErrInvalidEntry) {
+		t.Fatalf("Undelete of an orphan error = %v, want ErrInvalidEntry", err)
+	}
+
+	for _, path := range []string{"/gone.txt", "/frag.del"} {
+		want := mustTruth(t, built, path)
+		restored, err := exfat.Undelete(deletedRootEntry(t, exfat, path[1:]))
+		if err != nil {
+			t.Fatalf("Undelete %s error: %v", path, err)
+		}
+		if restored.IsDeleted() || !bytes.Equal(readTestFile(t, exfat, restored), want.Content) {
+			t.Fatalf("%s: restored entry is deleted or has other content", path)
+		}
+		runs, err := exfat.GetClusterRuns(restored)
+		if err != nil || len(runs) != len(want.Runs) {
+			t.Fatalf("%s: runs = %v, %v, want %v", path, runs, err, want.Runs)
+		}
+	}
+
+	// A deleted directory comes back empty-handed; its children can follow.
+	dir, err := exfat.Undelete(deletedRootEntry(t, exfat, "olddir"))
+	if err != nil {
+		t.Fatalf("Undelete olddir error: %v", err)
+	}
+	children, err := exfat.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir error: %v", err)
+	}
+	inner := findEntry(t, children, "inner.txt")
+	if !inner.IsDeleted() {
+		t.Fatal("child of the restored directory is live")
+	}
+	if _, err := exfat.Undelete(inner); err != nil {
+		t.Fatalf("Undelete inner.txt error: %v", err)
+	}
+
+	report, err := exfat.Check()
+	if err != nil || len(report.Findings) != 0 {
+		t.Fatalf("Check after Undelete = %v, %v, want no findings", report.Findings, err)
+	}
+	live, err := exfat.Lookup("/split.bin")
+	if err != nil {
+		t.Fatalf("Lookup error: %v", err)
+	}
+	if _, err := exfat.Undelete(live); !errors.Is(err, libxfat.ErrInvalidEntry) {
+		t.Fatalf("Undelete of a live entry error = %v, want ErrInvalidEntry", err)
+	}
+}
+
+func TestUndeleteRefusesConflicts(t *testing.T) {
+	built := mustBuild(t, undeleteTestVolume())
+	_, exfat := openRepairTestVolume(t, built, openMainBoot)
+	gone := deletedRootEntry(t, exfat, "gone.txt")
+
+	// Fill every free cluster, the freed ones of gone.txt included.
+	free := built.Truth.ClusterCount - built.Truth.Allocated
+	filler := make([]byte, int(free)*int(built.Truth.ClusterSize))
+	if _, err := exfat.CreateFile("/docs/filler.bin", bytes.NewReader(filler)); err != nil {
+		t.Fatalf("CreateFile error: %v", err)
+	}
+	if _, err := exfat.CreateDir("/GONE.TXT"); err == nil {
+		t.Fatal("CreateDir succeeded on a full volume")
+	}
+
+	_, err := exfat.Undelete(gone)
+	var undelete *libxfat.UndeleteError
+	if !errors.Is(err, libxfat.ErrUndeleteConflict) || !errors.As(err, &undelete) {
+		t.Fatalf("Undelete error = %v, want an UndeleteError", err)
+	}
+	cluster := mustTruth(t, built, "/gone.txt").Runs[0].Start
+	if len(undelete.Conflicts) != 1 {
+		t.Fatalf("conflicts = %+v, want one", undelete.Conflicts)
+	}
+	conflict := undelete.Conflicts[0]
+	if conflict.Kind != libxfat.CONFLICT_CLUSTER_IN_USE || conflict.Cluster != cluster || conflict.Owner != "/docs/filler.bin" {
+		t.Fatalf("conflict = %+v, want cluster %d in use by /docs/filler.bin", conflict, cluster)
+	}
+
+	if err := exfat.Remove("/docs/filler.bin"); err != nil {
+		t.Fatalf("Remove error: %v", err)
+	}
+	if _, err := exfat.CreateDir("/GONE.TXT"); err != nil {
+		t.Fatalf("CreateDir error: %v", err)
+	}
+	_, err = exfat.Undelete(gone)
+	if !errors.As(err, &undelete) || len(undelete.Conflicts) != 1 || undelete.Conflicts[0].Kind != libxfat.CONFLICT_NAME_IN_USE {
+		t.Fatalf("Undelete error = %v, want a name conflict", err)
+	}
+}
+
+func TestUndeleteRefusesOverwrittenSet(t *testing.T) {
+	built := mustBuild(t, undeleteTestVolume())
+	notes := mustTruth(t, built, "/notes.txt")
+	primary := append([]byte(nil), built.Image.Bytes()[notes.RecordOffsets[0]:][:32]...)
+
+	for _, tc := range []struct {
+		name  string
+		write func(overlay *libxfat.Overlay, offsets []uint64) error
+	}{
+		{"live set over the tail", func(overlay *libxfat.Overlay, offsets []uint64) error {
+			_, err := overlay.WriteAt(primary, int64(offsets[len(offsets)-1]))
+			return err
+		}},
+		{"changed name record", func(overlay *libxfat.Overlay, offsets []uint64) error {
+			_, err := overlay.WriteAt([]byte{'X'}, int64(offsets[2])+2)
+			return err
+		}},
+	} {
+		overlay, exfat := openRepairTestVolume(t, built, openMainBoot)
+		gone := deletedRootEntry(t, exfat, "gone.txt")
+		if err := tc.write(overlay, gone.RecordOffsets()); err != nil {
+			t.Fatalf("%s: WriteAt error: %v", tc.name, err)
+		}
+
+		_, err := exfat.Undelete(gone)
+		var undelete *libxfat.UndeleteError
+		if !errors.As(err, &undelete) || len(undelete.Conflicts) != 1 || undelete.Conflicts[0].Kind != libxfat.CONFLICT_ENTRY_SET_CHANGED {
+			t.Fatalf("%s: Undelete error = %v, want an entry-set-changed conflict", tc.name, err)
+		}
+		if len(overlay.ChangedSectors()) != 1 {
+			t.Fatalf("%s: Undelete wrote to the image", tc.name)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aoiflux/libxfat"
+)
+
+// reopenTestVolume parses the overlay afresh, root directory included.
+func reopenTestVolume(t *testing.T, overlay *libxfat.Overlay, open func(image *libxfat.Overlay) (libxfat.ExFAT, error)) *libxfat.ExFAT {
+	t.Helper()
+
+	exfat, err := open(overlay)
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+	if _, err := exfat.ReadRootDir(); err != nil {
+		t.Fatalf("ReadRootDir error: %v", err)
+	}
+	return &exfat
+}
+
+func TestSetVolumeLabel(t *testing.T) {
+	built := mustBuild(t, sampleTestVolume())
+	overlay, exfat := openRepairTestVolume(t, built, openMainBoot)
+
+	if err := exfat.SetVolumeLabel("FIELD-07"); err != nil {
+		t.Fatalf("SetVolumeLabel error: %v", err)
+	}
+	if got := reopenTestVolume(t, overlay, openMainBoot).GetVolumeLabel(); got != "FIELD-07" {
+		t.Fatalf("label = %q, want FIELD-07", got)
+	}
+	if err := exfat.SetVolumeLabel("ÉTÉ"); err != nil {
+		t.Fatalf("SetVolumeLabel error: %v", err)
+	}
+	if got := reopenTestVolume(t, overlay, openMainBoot).GetVolumeLabel(); got != "ÉTÉ" {
+		t.Fatalf("label = %q, want ÉTÉ", got)
+	}
+
+	if err := exfat.SetVolumeLabel(""); err != nil {
+		t.Fatalf("SetVolumeLabel clear error: %v", err)
+	}
+	if got := reopenTestVolume(t, overlay, openMainBoot).GetVolumeLabel(); got != "" {
+		t.Fatalf("cleared label = %q", got)
+	}
+	if err := exfat.SetVolumeLabel("FIFTEEN-CHARS15"); !errors.Is(err, libxfat.ErrInvalidLabel) {
+		t.Fatalf("SetVolumeLabel of 15 characters error = %v, want ErrInvalidLabel", err)
+	}
+
+	report, err := exfat.Check()
+	if err != nil || len(report.Findings) != 0 {
+		t.Fatalf("Check = %v, %v, want no findings", report.Findings, err)
+	}
+}
+
+func TestSetVolumeSerial(t *testing.T) {
+	built := mustBuild(t, sampleTestVolume())
+	overlay, exfat := openRepairTestVolume(t, built, openMainBoot)
+
+	if err := exfat.SetVolumeSerial(0xcafef00d); err != nil {
+		t.Fatalf("SetVolumeSerial error: %v", err)
+	}
+	if exfat.GetVolumeSerial() != 0xcafef00d {
+		t.Fatalf("GetVolumeSerial = %#x after SetVolumeSerial", exfat.GetVolumeSerial())
+	}
+	checkTestBootRegion(t, overlay, 512, 0)
+	checkTestBootRegion(t, overlay, 512, 12)
+
+	openBackup := func(image *libxfat.Overlay) (libxfat.ExFAT, error) {
+		return libxfat.NewFromBackup(image, false)
+	}
+	for _, open := range []func(image *libxfat.Overlay) (libxfat.ExFAT, error){openMainBoot, openBackup} {
+		if got := reopenTestVolume(t, overlay, open).GetVolumeSerial(); got != 0xcafef00d {
+			t.Fatalf("reopened serial = %#x, want 0xcafef00d", got)
+		}
+	}
+}
+
+func TestSetVolumeGUID(t *testing.T) {
+	v := sampleTestVolume()
+	v.Format.GUID = [16]byte{0x11, 0x22, 15: 0x33}
+	built := mustBuild(t, v)
+	overlay, exfat := openRepairTestVolume(t, built, openMainBoot)
+
+	guid, ok, err := exfat.GetVolumeGUID()
+	if err != nil || !ok || guid != v.Format.GUID {
+		t.Fatalf("GetVolumeGUID = %x, %v, %v, want %x", guid, ok, err, v.Format.GUID)
+	}
+	updated := [16]byte{0xde, 0xad, 0xbe, 0xef, 15: 0x01}
+	if err := exfat.SetVolumeGUID(updated); err != nil {
+		t.Fatalf("SetVolumeGUID error: %v", err)
+	}
+	if guid, ok, _ := reopenTestVolume(t, overlay, openMainBoot).GetVolumeGUID(); !ok || guid != updated {
+		t.Fatalf("updated GUID = %x, %v, want %x", guid, ok, updated)
+	}
+
+	// A zero GUID removes the record; the next GUID needs a new one.
+	if err := exfat.SetVolumeGUID([16]byte{}); err != nil {
+		t.Fatalf("SetVolumeGUID clear error: %v", err)
+	}
+	if _, ok, err := exfat.GetVolumeGUID(); ok || err != nil {
+		t.Fatalf("GetVolumeGUID after clear = %v, %v, want none", ok, err)
+	}
+	created := [16]byte{1, 2, 3, 4}
+	if err := exfat.SetVolumeGUID(created); err != nil {
+		t.Fatalf("SetVolumeGUID create error: %v", err)
+	}
+	if guid, ok, _ := reopenTestVolume(t, overlay, openMainBoot).GetVolumeGUID(); !ok || guid != created {
+		t.Fatalf("created GUID = %x, %v, want %x", guid, ok, created)
+	}
+
+	report, err := exfat.Check()
+	if err != nil || len(report.Findings) != 0 {
+		t.Fatalf("Check = %v, %v, want no findings", report.Findings, err)
+	}
+}
@@ -0,0 +1,234 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aoiflux/libxfat"
+)
+
+const (
+	testWritableClusters = 64
+	testWritableSectors  = testDataOffset + testWritableClusters
+)
+
+// createWritableTestImage grows the minimal image to 64 clusters and gives it
+// an up-case table folding 'a'-'z' onto 'A'-'Z'.
+func createWritableTestImage(t *testing.T) *os.File {
+	t.Helper()
+
+	image := createTestImage(t)
+	var vbr [12]byte
+	binary.LittleEndian.PutUint64(vbr[0:8], testWritableSectors)
+	writeTestBytes(t, image, 0x48, vbr[0:8])
+	binary.LittleEndian.PutUint32(vbr[8:12], testWritableClusters)
+	writeTestBytes(t, image, 0x5c, vbr[8:12])
+	if err := image.Truncate(testWritableSectors * testSectorSize); err != nil {
+		t.Fatalf("grow image: %v", err)
+	}
+
+	root := int64(testDataOffset * testSectorSize)
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], testWritableClusters/8)
+	writeTestBytes(t, image, root+24, length[:])
+
+	upcase := []uint16{0xffff, 'a'}
+	for r := 'A'; r <= 'Z'; r++ {
+		upcase = append(upcase, uint16(r))
+	}
+	upcase = append(upcase, 0xffff, 0xffff-'z')
+	table := make([]byte, 2*len(upcase))
+	for i, unit := range upcase {
+		binary.LittleEndian.PutUint16(table[2*i:], unit)
+	}
+	binary.LittleEndian.PutUint64(length[:], uint64(len(table)))
+	writeTestBytes(t, image, root+32+24, length[:])
+	writeTestBytes(t, image, int64((testDataOffset+testUpcaseCluster-testRootCluster)*testSectorSize), table)
+	writeTestBitmap(t, image, 0x07)
+	return image
+}
+
+func readTestFile(t *testing.T, exfat *libxfat.ExFAT, entry libxfat.Entry) []byte {
+	t.Helper()
+
+	dst := filepath.Join(t.TempDir(), "out")
+	if err := exfat.ExtractEntryContent(entry, dst); err != nil {
+		t.Fatalf("ExtractEntryContent error: %v", err)
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("read extracted file: %v", err)
+	}
+	return data
+}
+
+func TestCreateDirAndFile(t *testing.T) {
+	image := createWritableTestImage(t)
+	exfat, _ := openTestImage(t, image)
+
+	if _, err := exfat.CreateDir("/docs"); err != nil {
+		t.Fatalf("CreateDir error: %v", err)
+	}
+	content := bytes.Repeat([]byte("0123456789"), 120)
+	entry, err := exfat.CreateFile("/docs/readme.txt", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("CreateFile error: %v", err)
+	}
+	if !entry.DoesNotHaveFatChain() || entry.GetSize() != uint64(len(content)) {
+		t.Fatalf("entry = %+v, want contiguous %d bytes", entry, len(content))
+	}
+
+	reopened, _ := openTestImage(t, image)
+	found, err := reopened.Lookup("/DOCS/README.TXT")
+	if err != nil {
+		t.Fatalf("Lookup error: %v", err)
+	}
+	if !bytes.Equal(readTestFile(t, reopened, found), content) {
+		t.Fatal("file content differs from what was written")
+	}
+	if found.GetAttributes() != testArchiveAttr {
+		t.Fatalf("attributes = %#x, want archive", found.GetAttributes())
+	}
+
+	report, err := reopened.Check()
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if !report.OK() || report.Files != 1 || report.Directories != 1 {
+		t.Fatalf("report = %+v, want a clean volume with one file and one directory", report)
+	}
+	if percent, ok := reopened.GetPercentInUse(); !ok || percent != 7*100/testWritableClusters {
+		t.Fatalf("PercentInUse = %d, want %d", percent, 7*100/testWritableClusters)
+	}
+	if reopened.IsVolumeDirty() {
+		t.Fatal("volume left dirty after a successful write")
+	}
+}
+
+func TestCreateFileFragmented(t *testing.T) {
+	image := createWritableTestImage(t)
+	// Leave clusters 5-6 and 8-10 free.
+	writeTestBytes(t, image, int64((testDataOffset+testBitmapCluster-testRootCluster)*testSectorSize),
+		[]byte{0x27, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	exfat, _ := openTestImage(t, image)
+
+	content := bytes.Repeat([]byte{'x'}, 4*testSectorSize)
+	entry, err := exfat.CreateFile("/frag.bin", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("CreateFile error: %v", err)
+	}
+	if !entry.HasFatChain() {
+		t.Fatal("fragmented file recorded as NoFatChain")
+	}
+	runs, err := exfat.GetClusterRuns(entry)
+	if err != nil {
+		t.Fatalf("GetClusterRuns error: %v", err)
+	}
+	want := []libxfat.Run{{Start: 8, Length: 3}, {Start: 5, Length: 1}}
+	if len(runs) != 2 || runs[0] != want[0] || runs[1] != want[1] {
+		t.Fatalf("runs = %v, want %v", runs, want)
+	}
+	if !bytes.Equal(readTestFile(t, exfat, entry), content) {
+		t.Fatal("file content differs from what was written")
+	}
+
+	if _, err := exfat.CreateFile("/more.bin", bytes.NewReader(content)); !errors.Is(err, libxfat.ErrVolumeFull) {
+		t.Fatalf("CreateFile on a full volume error = %v, want ErrVolumeFull", err)
+	}
+	reopened, _ := openTestImage(t, image)
+	if free, err := reopened.GetFreeClusters(); err != nil || free != 1 {
+		t.Fatalf("free clusters = %d, %v, want 1 after the failed write", free, err)
+	}
+}
+
+func TestCreateGrowsDirectory(t *testing.T) {
+	image := createWritableTestImage(t)
+	exfat, _ := openTestImage(t, image)
+
+	names := []string{"a", "b", "c", "d", "e", "f", "g"}
+	for _, name := range names {
+		if _, err := exfat.CreateFile("/"+name, bytes.NewReader([]byte(name))); err != nil {
+			t.Fatalf("CreateFile %s error: %v", name, err)
+		}
+	}
+
+	reopened, entries := openTestImage(t, image)
+	for _, name := range names {
+		findEntry(t, entries, name)
+	}
+	report, err := reopened.Check()
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if !report.OK() || report.Files != len(names) {
+		t.Fatalf("report = %+v, want a clean volume with %d files", report, len(names))
+	}
+}
+
+func TestCreateRejectsConflicts(t *testing.T) {
+	exfat, _ := openTestImage(t, createWritableTestImage(t))
+
+	if _, err := exfat.CreateFile("/Name.txt", nil); err != nil {
+		t.Fatalf("CreateFile error: %v", err)
+	}
+	if _, err := exfat.CreateDir("/NAME.TXT"); !errors.Is(err, libxfat.ErrEntryExists) {
+		t.Fatalf("duplicate error = %v, want ErrEntryExists", err)
+	}
+	if _, err := exfat.CreateDir("/missing/dir"); !errors.Is(err, libxfat.ErrEntryNotFound) {
+		t.Fatalf("missing parent error = %v, want ErrEntryNotFound", err)
+	}
+	if _, err := exfat.CreateFile("/Name.txt/child", nil); !errors.Is(err, libxfat.ErrNotDirectory) {
+		t.Fatalf("file parent error = %v, want ErrNotDirectory", err)
+	}
+	if _, err := exfat.CreateFile("/a:b", nil); !errors.Is(err, libxfat.ErrInvalidName) {
+		t.Fatalf("illegal name error = %v, want ErrInvalidName", err)
+	}
+}
+
+func TestSetAttributesAndTimes(t *testing.T) {
+	image := createWritableTestImage(t)
+	exfat, _ := openTestImage(t, image)
+	if _, err := exfat.CreateFile("/f.txt", bytes.NewReader([]byte("data"))); err != nil {
+		t.Fatalf("CreateFile error: %v", err)
+	}
+
+	if err := exfat.SetAttributes("/f.txt", testArchiveAttr|0x01); err != nil {
+		t.Fatalf("SetAttributes error: %v", err)
+	}
+	if err := exfat.SetAttributes("/f.txt", testDirAttr); !errors.Is(err, libxfat.ErrInvalidAttributes) {
+		t.Fatalf("SetAttributes with directory bit error = %v, want ErrInvalidAttributes", err)
+	}
+	modified := time.Date(2020, 2, 29, 10, 30, 0, 0, time.UTC)
+	if err := exfat.SetTimes("/f.txt", time.Time{}, modified, time.Time{}); err != nil {
+		t.Fatalf("SetTimes error: %v", err)
+	}
+
+	reopened, _ := openTestImage(t, image)
+	entry, err := reopened.Lookup("/f.txt")
+	if err != nil {
+		t.Fatalf("Lookup error: %v", err)
+	}
+	if entry.GetAttributes() != testArchiveAttr|0x01 {
+		t.Fatalf("attributes = %#x, want %#x", entry.GetAttributes(), testArchiveAttr|0x01)
+	}
+	var raw [32]byte
+	if _, err := image.ReadAt(raw[:], int64(entry.RecordOffsets()[0])); err != nil {
+		t.Fatalf("read file record: %v", err)
+	}
+	file, ok := libxfat.DecodeRecord(raw).(libxfat.FileDirectoryEntry)
+	if !ok {
+		t.Fatalf("record %#x is not a file record", raw[0])
+	}
+	if want := uint32(40)<<25 | 2<<21 | 29<<16 | 10<<11 | 30<<5; file.LastModifiedTimestamp != want {
+		t.Fatalf("LastModifiedTimestamp = %#08x, want %#08x", file.LastModifiedTimestamp, want)
+	}
+	report, err := reopened.Check()
+	if err != nil || !report.OK() {
+		t.Fatalf("Check = %+v, %v, want a clean volume", report, err)
+	}
+}
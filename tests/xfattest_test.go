@@ -0,0 +1,201 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aoiflux/libxfat"
+	"github.com/aoiflux/libxfat/xfattest"
+)
+
+func buildTestVolume(t *testing.T, v xfattest.Volume) (*xfattest.Built, *libxfat.ExFAT) {
+	t.Helper()
+
+	built, err := xfattest.Build(v)
+	if err != nil {
+		t.Fatalf("Build error: %v", err)
+	}
+	exfat, err := built.Open(false)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	return built, &exfat
+}
+
+func sampleTestVolume() xfattest.Volume {
+	stamp := time.Date(2019, 7, 4, 12, 30, 10, 0, time.UTC)
+	return xfattest.Volume{
+		Root: []xfattest.Node{
+			{Name: "notes.txt", Content: []byte("hello exFAT"), Modified: stamp},
+			{Name: "split.bin", Content: bytes.Repeat([]byte{'s'}, 5*512), Fragments: []int{2, 3}},
+			{Name: "gone.txt", Content: []byte("deleted data"), Deleted: true},
+			{Name: "docs", Dir: true, Children: []xfattest.Node{
+				{Name: "vendor.dat", Content: []byte("v"), Vendor: []libxfat.VendorExtensionEntry{{VendorGuid: [16]byte{1, 2, 3}}}},
+			}},
+		},
+		Orphans: []xfattest.Node{
+			{Name: "orphan.txt", Content: []byte("left behind")},
+		},
+	}
+}
+
+func TestBuiltVolumeMatchesTruth(t *testing.T) {
+	built, exfat := buildTestVolume(t, sampleTestVolume())
+
+	report, err := exfat.Check()
+	if err != nil || !report.OK() {
+		t.Fatalf("Check = %+v, %v, want a clean volume", report, err)
+	}
+	allocated, err := exfat.GetAllocatedClusters()
+	if err != nil || allocated != built.Truth.Allocated {
+		t.Fatalf("allocated = %d, %v, want %d", allocated, err, built.Truth.Allocated)
+	}
+
+	for _, want := range built.Truth.Entries {
+		if want.Deleted || want.Orphan {
+			continue
+		}
+		entry, err := exfat.Lookup(want.Path)
+		if err != nil {
+			t.Fatalf("Lookup %s error: %v", want.Path, err)
+		}
+		if entry.DoesNotHaveFatChain() != want.NoFatChain || entry.GetAttributes() != want.Attributes {
+			t.Fatalf("%s: NoFatChain/attributes = %v/%#x, want %v/%#x", want.Path,
+				entry.DoesNotHaveFatChain(), entry.GetAttributes(), want.NoFatChain, want.Attributes)
+		}
+		runs, err := exfat.GetClusterRuns(entry)
+		if err != nil || len(runs) != len(want.Runs) {
+			t.Fatalf("%s: runs = %v, %v, want %v", want.Path, runs, err, want.Runs)
+		}
+		if !want.Dir && !bytes.Equal(readTestFile(t, exfat, entry), want.Content) {
+			t.Fatalf("%s: content differs", want.Path)
+		}
+	}
+}
+
+func TestBuiltVolumeDeletedAndOrphans(t *testing.T) {
+	built, exfat := buildTestVolume(t, sampleTestVolume())
+
+	root, err := exfat.ReadRootDir()
+	if err != nil {
+		t.Fatalf("ReadRootDir error: %v", err)
+	}
+	gone := findEntry(t, root, "gone.txt")
+	if !gone.IsDeleted() || gone.RecordOffsets()[0] != mustTruth(t, built, "/gone.txt").RecordOffsets[0] {
+		t.Fatalf("deleted entry = %+v, want the deleted set of /gone.txt", gone)
+	}
+
+	orphans, err := exfat.RecoverDeletedEntries()
+	if err != nil {
+		t.Fatalf("RecoverDeletedEntries error: %v", err)
+	}
+	want := mustTruth(t, built, "/$OrphanFiles/orphan.txt")
+	var found bool
+	for _, entry := range orphans {
+		if entry.Path() == want.Path && entry.GetEntryCluster() == want.Runs[0].Start {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("orphans = %v, want %s", orphans, want.Path)
+	}
+}
+
+func mustTruth(t *testing.T, built *xfattest.Built, path string) xfattest.EntryTruth {
+	t.Helper()
+
+	entry, ok := built.Truth.Entry(path)
+	if !ok {
+		t.Fatalf("no ground truth for %s", path)
+	}
+	return entry
+}
+
+func TestBuiltVolumeCorruptions(t *testing.T) {
+	v := sampleTestVolume()
+	v.Corruptions = []xfattest.Corruption{
+		{Kind: xfattest.CORRUPT_SET_CHECKSUM, Path: "/notes.txt"},
+		{Kind: xfattest.CORRUPT_FAT_LOOP, Path: "/split.bin"},
+		{Kind: xfattest.CORRUPT_BAD_CLUSTER, Path: "/docs/vendor.dat", Index: 0},
+	}
+	built, exfat := buildTestVolume(t, v)
+	if len(built.Truth.Corruptions) != 3 {
+		t.Fatalf("corruptions = %v, want 3 recorded", built.Truth.Corruptions)
+	}
+
+	_, diagnostics, err := exfat.ReadRootDirWithDiagnostics()
+	if err != nil {
+		t.Fatalf("ReadRootDirWithDiagnostics error: %v", err)
+	}
+	var mismatch bool
+	for _, diagnostic := range diagnostics {
+		mismatch = mismatch || diagnostic.Kind == libxfat.DIAG_CHECKSUM_MISMATCH
+	}
+	if !mismatch {
+		t.Fatalf("diagnostics = %v, want a checksum mismatch", diagnostics)
+	}
+
+	split, err := exfat.Lookup("/split.bin")
+	if err != nil {
+		t.Fatalf("Lookup error: %v", err)
+	}
+	if _, err := exfat.GetClusterRuns(split); !errors.Is(err, libxfat.ErrClusterChainLoop) {
+		t.Fatalf("GetClusterRuns error = %v, want ErrClusterChainLoop", err)
+	}
+
+	inventory, err := exfat.GetBadClusters()
+	vendor := mustTruth(t, built, "/docs/vendor.dat")
+	if err != nil || len(inventory.Clusters) != 1 || inventory.Clusters[0].Cluster != vendor.Runs[0].Start {
+		t.Fatalf("bad clusters = %+v, %v, want cluster %d", inventory.Clusters, err, vendor.Runs[0].Start)
+	}
+}
+
+func TestBuiltVolumeImageDamage(t *testing.T) {
+	v := sampleTestVolume()
+	v.Corruptions = []xfattest.Corruption{{Kind: xfattest.CORRUPT_MAIN_VBR}}
+	built, err := xfattest.Build(v)
+	if err != nil {
+		t.Fatalf("Build error: %v", err)
+	}
+	if _, err := built.Open(false); err == nil {
+		t.Fatal("Open succeeded on a damaged main boot sector")
+	}
+
+	// Cut the image where the root directory's first entry set begins.
+	v.Corruptions = nil
+	clean, _ := buildTestVolume(t, v)
+	size := int64(mustTruth(t, clean, "/notes.txt").RecordOffsets[0]) &^ 511
+	v.Corruptions = []xfattest.Corruption{{Kind: xfattest.CORRUPT_TRUNCATE, Size: size}}
+	built, exfat := buildTestVolume(t, v)
+	if built.Image.Size() != size {
+		t.Fatalf("image size = %d, want %d", built.Image.Size(), size)
+	}
+	if _, err := exfat.Lookup("/notes.txt"); err == nil {
+		t.Fatal("Lookup succeeded with the root directory cut off")
+	}
+
+	// A corruption that reaches past the cut fails the build.
+	v.Corruptions = append(v.Corruptions, xfattest.Corruption{Kind: xfattest.CORRUPT_SET_CHECKSUM, Path: "/notes.txt"})
+	if _, err := xfattest.Build(v); err == nil {
+		t.Fatal("Build succeeded breaking a checksum past the end of the image")
+	}
+}
+
+func TestNewFromImageReadOnly(t *testing.T) {
+	built, err := xfattest.Build(sampleTestVolume())
+	if err != nil {
+		t.Fatalf("Build error: %v", err)
+	}
+	exfat, err := libxfat.NewFromImage(bytes.NewReader(built.Image.Bytes()), false)
+	if err != nil {
+		t.Fatalf("NewFromImage error: %v", err)
+	}
+	if _, err := exfat.Lookup("/docs/vendor.dat"); err != nil {
+		t.Fatalf("Lookup error: %v", err)
+	}
+	if _, err := exfat.CreateDir("/new"); !errors.Is(err, libxfat.ErrReadOnlyImage) {
+		t.Fatalf("CreateDir error = %v, want ErrReadOnlyImage", err)
+	}
+}
@@ -0,0 +1,121 @@
+package libxfat
+
+import "fmt"
+
+// EXFAT_MAX_DIR_ENTRIES is the most file entry sets a directory can hold: the
+// specification caps a directory at 256 MiB and a set takes at least three
+// 32-byte records.
+const EXFAT_MAX_DIR_ENTRIES = (256 << 20) / (3 * EXFAT_DIRRECORD_SIZE)
+
+// TraversalLimits bounds the work a directory traversal may do on a hostile
+// image. A zero field disables that limit. MaxChainLength is counted in
+// clusters and applies to every FAT chain the library follows.
+type TraversalLimits struct {
+	MaxDepth         int
+	MaxEntriesPerDir int
+	MaxTotalEntries  int
+	MaxChainLength   uint32
+}
+
+// DefaultTraversalLimits are applied by New.
+var DefaultTraversalLimits = TraversalLimits{
+	MaxDepth:         1024,
+	MaxEntriesPerDir: EXFAT_MAX_DIR_ENTRIES,
+}
+
+// TraversalError reports a traversal stopped by a directory cycle or by one
+// of the TraversalLimits. Err is one of ErrDirectoryCycle, ErrMaxDepth,
+// ErrMaxEntriesPerDir, ErrMaxTotalEntries or ErrMaxChainLength, so callers
+// can test it with errors.Is. Limit holds the configured limit, or for a
+// cycle the cluster both directories start at.
+type TraversalError struct {
+	Err     error
+	Path    string
+	Cluster uint32
+	Limit   uint64
+}
+
+func (e *TraversalError) Error() string {
+	if e.Err == ErrDirectoryCycle {
+		return fmt.Sprintf("%v: %s starts at cluster %d, already visited", e.Err, e.Path, e.Cluster)
+	}
+	return fmt.Sprintf("%v: %s (limit %d)", e.Err, e.Path, e.Limit)
+}
+
+func (e *TraversalError) Unwrap() error {
+	return e.Err
+}
+
+// SetTraversalLimits replaces the limits used by every later traversal.
+func (e *ExFAT) SetTraversalLimits(limits TraversalLimits) {
+	e.limits = limits
+	e.vbr.maxChainLength = limits.MaxChainLength
+}
+
+// GetTraversalLimits returns the limits in effect.
+func (e *ExFAT) GetTraversalLimits() TraversalLimits {
+	return e.limits
+}
+
+// traversal tracks one walk over the directory tree. visited is keyed on the
+// first cluster of every directory read so far, so a directory pointing back
+// at an ancestor, or many entries sharing one directory, cannot make the walk
+// loop or explode.
+type traversal struct {
+	limits  TraversalLimits
+	visited map[uint32]string
+	total   int
+}
+
+func (e *ExFAT) newTraversal() *traversal {
+	return &traversal{
+		limits:  e.limits,
+		visited: map[uint32]string{e.vbr.rootDirCluster: "/"},
+	}
+}
+
+// enter is called before reading directory dir found at depth (entries of
+// the starting list are at depth 1).
+func (t *traversal) enter(dir Entry, depth int) error {
+	if t.limits.MaxDepth > 0 && depth > t.limits.MaxDepth {
+		return &TraversalError{Err: ErrMaxDepth, Path: dir.Path(), Cluster: dir.entryCluster, Limit: uint64(t.limits.MaxDepth)}
+	}
+	if _, ok := t.visited[dir.entryCluster]; ok {
+		return &TraversalError{Err: ErrDirectoryCycle, Path: dir.Path(), Cluster: dir.entryCluster, Limit: uint64(dir.entryCluster)}
+	}
+	t.visited[dir.entryCluster] = dir.Path()
+	return nil
+}
+
+// add counts entries returned by one directory read against the total limit.
+func (t *traversal) add(dir Entry, count int) error {
+	t.total += count
+	if t.limits.MaxTotalEntries > 0 && t.total > t.limits.MaxTotalEntries {
+		return &TraversalError{Err: ErrMaxTotalEntries, Path: dir.Path(), Cluster: dir.entryCluster, Limit: uint64(t.limits.MaxTotalEntries)}
+	}
+	return nil
+}
+
+// readDirIn reads one directory as part of traversal t. Directories that
+// cannot hold children are skipped without counting towards the limits.
+func (e *ExFAT) readDirIn(t *traversal, dir Entry, depth int) ([]Entry, error) {
+	if dir.NonParsable() {
+		return nil, nil
+	}
+	if err := t.enter(dir, depth); err != nil {
+		return nil, err
+	}
+	entries, err := e.readDir(dir)
+	if err != nil {
+		return entries, err
+	}
+	return entries, t.add(dir, len(entries))
+}
+
+// checkDirEntries enforces MaxEntriesPerDir while a directory is parsed.
+func (e *ExFAT) checkDirEntries(count int) error {
+	if e.limits.MaxEntriesPerDir > 0 && count > e.limits.MaxEntriesPerDir {
+		return &TraversalError{Err: ErrMaxEntriesPerDir, Path: e.dirPath, Cluster: e.dirCluster, Limit: uint64(e.limits.MaxEntriesPerDir)}
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package libxfat
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConflictKind names a reason a deleted entry cannot be restored in place.
+type ConflictKind int
+
+const (
+	// CONFLICT_CLUSTER_IN_USE: clusters of the entry are allocated again.
+	// Owner names the live entry holding them, if any.
+	CONFLICT_CLUSTER_IN_USE ConflictKind = iota + 1
+	// CONFLICT_CLUSTER_OUT_OF_HEAP: the allocation leaves the cluster heap.
+	CONFLICT_CLUSTER_OUT_OF_HEAP
+	// CONFLICT_NAME_IN_USE: a live entry in the directory has the same name.
+	CONFLICT_NAME_IN_USE
+	// CONFLICT_ENTRY_SET_CHANGED: the records on disk are no longer the
+	// deleted set that was read.
+	CONFLICT_ENTRY_SET_CHANGED
+)
+
+var conflictKindNames = map[ConflictKind]string{
+	CONFLICT_CLUSTER_IN_USE:      "cluster-in-use",
+	CONFLICT_CLUSTER_OUT_OF_HEAP: "cluster-out-of-heap",
+	CONFLICT_NAME_IN_USE:         "name-in-use",
+	CONFLICT_ENTRY_SET_CHANGED:   "entry-set-changed",
+}
+
+func (k ConflictKind) String() string {
+	if name, ok := conflictKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("conflict(%d)", int(k))
+}
+
+func (k ConflictKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UndeleteConflict is one reason Undelete refused. Cluster and Count give
+// the clusters involved, when that applies.
+type UndeleteConflict struct {
+	Kind    ConflictKind
+	Cluster uint32
+	Count   uint32
+	Owner   string
+	Message string
+}
+
+// UndeleteError reports every conflict that stopped Undelete, together with
+// the runs the entry would have been restored to. It unwraps to
+// ErrUndeleteConflict.
+type UndeleteError struct {
+	Path      string
+	Runs      []Run
+	Conflicts []UndeleteConflict
+}
+
+func (e *UndeleteError) Error() string {
+	messages := make([]string, len(e.Conflicts))
+	for i, conflict := range e.Conflicts {
+		messages[i] = conflict.Message
+	}
+	return fmt.Sprintf("%v: %s: %s", ErrUndeleteConflict, e.Path, strings.Join(messages, "; "))
+}
+
+func (e *UndeleteError) Unwrap() error {
+	return ErrUndeleteConflict
+}
+
+func (e *UndeleteError) add(conflict UndeleteConflict) {
+	e.Conflicts = append(e.Conflicts, conflict)
+}
+
+// Undelete restores a deleted entry in place and returns it as a live entry.
+// entry must be a deleted entry read from a live directory, as ReadDir lists
+// them; sets carved by RecoverDeletedEntries become reachable once their
+// directory is undeleted. The in-use bits of the records are set again, the
+// SetChecksum refreshed and the clusters marked allocated.
+//
+// The clusters are the FAT chain when it still ends where DataLength says,
+// otherwise the contiguous run from the first cluster, which then gets a
+// fresh FAT chain if the entry uses one. Nothing is written when any of the
+// clusters has been allocated since, when the name is taken, or when the
+// records changed; the *UndeleteError lists every such conflict. Restoring a
+// directory leaves its children deleted.
+func (e *ExFAT) Undelete(entry Entry) (Entry, error) {
+	if !entry.IsDeleted() || len(entry.recordOffsets) < 2 {
+		return Entry{}, fmt.Errorf("%w: %s is not a deleted entry set", ErrInvalidEntry, entry.Path())
+	}
+	parent, err := e.Lookup(entry.parentPath)
+	if err != nil || !parent.IsDir() || parent.IsDeleted() {
+		return Entry{}, fmt.Errorf("%w: %s is not in a live directory; undelete its directory first", ErrInvalidEntry, entry.Path())
+	}
+	slots, err := e.readDirSlots(parent)
+	if err != nil {
+		return Entry{}, err
+	}
+	if !containsOffset(slots.offsets, entry.recordOffsets[0]) {
+		return Entry{}, fmt.Errorf("%w: %s is not stored in %s", ErrInvalidEntry, entry.Path(), parent.Path())
+	}
+
+	undelete := &UndeleteError{Path: entry.Path()}
+	records, err := e.readEntrySet(entry)
+	if err != nil {
+		return Entry{}, err
+	}
+	checkUndeleteRecords(entry, records, undelete)
+
+	if err := e.checkUndeleteName(parent, entry, undelete); err != nil {
+		return Entry{}, err
+	}
+	runs, rechain := e.undeleteRuns(entry, undelete)
+	undelete.Runs = runs
+	if err := e.checkUndeleteClusters(runs, undelete); err != nil {
+		return Entry{}, err
+	}
+	if len(undelete.Conflicts) > 0 {
+		return Entry{}, undelete
+	}
+
+	err = e.update(func(a *allocator) error {
+		for _, run := range runs {
+			for cluster := run.Start; cluster < run.End(); cluster++ {
+				if err := a.set(cluster, true); err != nil {
+					return err
+				}
+			}
+		}
+		if rechain {
+			if err := e.vbr.writeChain(runs); err != nil {
+				return err
+			}
+		}
+		return a.claim(func() error {
+			for i := range records {
+				records[i][0] |= 0x80
+			}
+			writeSetChecksum(records)
+			return e.writeRecords(entry.recordOffsets, records)
+		})
+	})
+	if err != nil {
+		return Entry{}, err
+	}
+	return e.Lookup(entry.Path())
+}
+
+// checkUndeleteRecords reports records that are no longer the deleted set
+// that was read: another type in any slot, as left by a live set written over
+// part of it, or a SetChecksum matching neither the deleted nor the live form
+// of the records.
+func checkUndeleteRecords(entry Entry, records [][EXFAT_DIRRECORD_SIZE]byte, undelete *UndeleteError) {
+	for i, record := range records {
+		var ok bool
+		switch {
+		case i == 0:
+			ok = record[0] == EXFAT_DIRRECORD_DEL_FILEDIR
+		case i == 1:
+			ok = record[0] == EXFAT_DIRRECORD_DEL_STREAM_EXT
+		default:
+			ok = record[0] == EXFAT_DIRRECORD_DEL_FILENAME_EXT || record[0]&^0x1f == EXFAT_DIRRECORD_DEL_VENDOR_EXT
+		}
+		if !ok {
+			undelete.add(UndeleteConflict{
+				Kind:    CONFLICT_ENTRY_SET_CHANGED,
+				Message: fmt.Sprintf("record %d at offset %d is %#02x, not part of a deleted file set", i, entry.recordOffsets[i], record[0]),
+			})
+			return
+		}
+	}
+
+	stored := uint16(records[0][2]) | uint16(records[0][3])<<8
+	if stored != entrySetChecksum(records, false) && stored != entrySetChecksum(records, true) {
+		undelete.add(UndeleteConflict{
+			Kind:    CONFLICT_ENTRY_SET_CHANGED,
+			Message: fmt.Sprintf("SetChecksum %#04x at offset %d no longer matches the records", stored, entry.recordOffsets[0]),
+		})
+	}
+}
+
+// checkUndeleteName reports a live sibling that has taken the entry's name.
+func (e *ExFAT) checkUndeleteName(parent, entry Entry, undelete *UndeleteError) error {
+	upcase, err := e.loadUpcaseTable()
+	if err != nil {
+		return err
+	}
+	children, err := e.liveChildren(parent)
+	if err != nil {
+		return err
+	}
+	if child, ok := findChild(upcase, children, entry.Name()); ok {
+		undelete.add(UndeleteConflict{
+			Kind:    CONFLICT_NAME_IN_USE,
+			Owner:   child.Path(),
+			Message: fmt.Sprintf("name is taken by %s", child.Path()),
+		})
+	}
+	return nil
+}
+
+// undeleteRuns works out the clusters of a deleted entry. rechain is set when
+// a FAT chain has to be written for them.
+func (e *ExFAT) undeleteRuns(entry Entry, undelete *UndeleteError) (runs []Run, rechain bool) {
+	v := &e.vbr
+	if entry.dataLen == 0 {
+		return nil, false
+	}
+	count, _ := v.size2Clusters(entry.dataLen)
+	if !entry.noFatChain {
+		trace := v.traceChain(entry.entryCluster)
+		if trace.end == chainEndEOF && trace.count == count {
+			return trace.runs, false
+		}
+	}
+
+	run, err := v.contiguousRun(entry.entryCluster, count)
+	if err != nil {
+		undelete.add(UndeleteConflict{
+			Kind:    CONFLICT_CLUSTER_OUT_OF_HEAP,
+			Cluster: entry.entryCluster,
+			Count:   uint32(count),
+			Message: fmt.Sprintf("%d clusters from %d leave the cluster heap", count, entry.entryCluster),
+		})
+	}
+	if run.Length == 0 {
+		return nil, false
+	}
+	return []Run{run}, !entry.noFatChain
+}
+
+// checkUndeleteClusters reports runs of clusters that are allocated again,
+// grouped by the live entry that now owns them.
+func (e *ExFAT) checkUndeleteClusters(runs []Run, undelete *UndeleteError) error {
+	bitmap, err := e.loadBitmap()
+	if err != nil {
+		return err
+	}
+	var inUse []uint32
+	for _, run := range runs {
+		for cluster := run.Start; cluster < run.End(); cluster++ {
+			if bitmap.isAllocated(cluster) {
+				inUse = append(inUse, cluster)
+			}
+		}
+	}
+	if len(inUse) == 0 {
+		return nil
+	}
+
+	clusterMap, err := e.BuildClusterMap()
+	if err != nil {
+		return err
+	}
+	var conflicts []UndeleteConflict
+	for _, cluster := range inUse {
+		owner := ""
+		ownership, err := clusterMap.Owner(cluster)
+		if err != nil {
+			return err
+		}
+		if claim, ok := ownership.Owner(); ok {
+			owner = claim.Path
+		}
+		if n := len(conflicts); n > 0 && conflicts[n-1].Owner == owner && conflicts[n-1].Cluster+conflicts[n-1].Count == cluster {
+			conflicts[n-1].Count++
+			continue
+		}
+		conflicts = append(conflicts, UndeleteConflict{Kind: CONFLICT_CLUSTER_IN_USE, Cluster: cluster, Count: 1, Owner: owner})
+	}
+	for _, conflict := range conflicts {
+		last := conflict.Cluster + conflict.Count - 1
+		if conflict.Owner == "" {
+			conflict.Message = fmt.Sprintf("clusters %d-%d are allocated but owned by nothing", conflict.Cluster, last)
+		} else {
+			conflict.Message = fmt.Sprintf("clusters %d-%d are allocated to %s", conflict.Cluster, last, conflict.Owner)
+		}
+		undelete.add(conflict)
+	}
+	return nil
+}
+
+func containsOffset(offsets []uint64, off uint64) bool {
+	for _, o := range offsets {
+		if o == off {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package libxfat
+
+import (
+	"errors"
+	"io"
+	"unicode"
+)
+
+// upcaseTable maps every UTF-16 unit to its up-case form.
+type upcaseTable []uint16
+
+// loadUpcaseTable reads and expands the volume's up-case table. A run of
+// identity mappings is stored compressed as 0xFFFF followed by its length.
+// Units the table does not cover, or maps to zero as a blank table does, map
+// through unicode.ToUpper. The table is read once and cached.
+func (e *ExFAT) loadUpcaseTable() (upcaseTable, error) {
+	if e.upcase != nil {
+		return e.upcase, nil
+	}
+	if err := e.ensureBitmapEntry(); err != nil {
+		return nil, err
+	}
+
+	var raw []uint16
+	if e.vbr.upcaseCluster != 0 && e.vbr.upcaseLength != 0 {
+		source := Entry{entryCluster: e.vbr.upcaseCluster, dataLen: e.vbr.upcaseLength}
+		var data []byte
+		err := e.vbr.visitEntryData(source, func(_ uint32, chunk []byte) error {
+			data = append(data, chunk...)
+			return nil
+		})
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		raw = utf16leUnitsFromBytes(data, 0)
+	}
+
+	table := make(upcaseTable, 1<<16)
+	for unit := range table {
+		table[unit] = uint16(unit)
+		if upper := unicode.ToUpper(rune(unit)); upper < 1<<16 {
+			table[unit] = uint16(upper)
+		}
+	}
+	index := 0
+	for i := 0; i < len(raw) && index < len(table); i++ {
+		if raw[i] == 0xffff && i+1 < len(raw) {
+			for n := 0; n < int(raw[i+1]) && index < len(table); n++ {
+				table[index] = uint16(index)
+				index++
+			}
+			i++
+			continue
+		}
+		if raw[i] != 0 {
+			table[index] = raw[i]
+		}
+		index++
+	}
+
+	e.upcase = table
+	return table, nil
+}
+
+// upcaseUnits returns units mapped through the table.
+func (t upcaseTable) upcaseUnits(units []uint16) []uint16 {
+	upper := make([]uint16, len(units))
+	for i, unit := range units {
+		upper[i] = t[unit]
+	}
+	return upper
+}
+
+// nameHash computes the NameHash of a stream extension record over the
+// up-cased name.
+func (t upcaseTable) nameHash(units []uint16) uint16 {
+	var hash uint16
+	for _, unit := range t.upcaseUnits(units) {
+		hash = ((hash << 15) | (hash >> 1)) + (unit & 0xff)
+		hash = ((hash << 15) | (hash >> 1)) + (unit >> 8)
+	}
+	return hash
+}
+
+// equalFold reports whether two names match under the up-case table, as
+// exFAT compares names.
+func (t upcaseTable) equalFold(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if t[a[i]] != t[b[i]] {
+			return false
+		}
+	}
+	return true
+}
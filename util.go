@@ -64,33 +64,32 @@ func countBits(bitn uint32) uint32 {
 	return bitn
 }
 
-// UnicodeFromAscii returns Unicode from raw utf16 data.
-func unicodeFromAscii(raw []byte, unicodeCharCount int) string {
-	// `VolumeLabel` is a Unicode-encoded string and the character-count
-	// corresponds to the number of Unicode characters. The character-count may
-	// still include trailing NULs, so we intentionally skip over those.
-
-	decodedString := make([]rune, 0)
-	for i := 0; i < unicodeCharCount; i++ {
-		wchar1 := uint16(raw[i*2+1])
-		wchar2 := uint16(raw[i*2])
-
-		bytes := []uint16{wchar1<<8 | wchar2}
-		runes := utf16.Decode(bytes)
-
-		if runes[0] == 0 {
-			continue
-		}
+// exfatDirLiveChecksumAdd is exfatDirSetChecksumAdd over the record with its
+// in-use bit set. Deleting an entry set only clears the in-use bits and leaves
+// the SetChecksum of the live set in place.
+func exfatDirLiveChecksumAdd(accum uint16, record []byte, isFileDir bool) uint16 {
+	var live [EXFAT_DIRRECORD_SIZE]byte
+	n := copy(live[:], record)
+	if n > 0 {
+		live[0] |= 0x80
+	}
+	return exfatDirSetChecksumAdd(accum, live[:n], isFileDir)
+}
 
-		decodedString = append(decodedString, runes...)
+// exfatDirLiveSetChecksum returns the SetChecksum a set of records had before
+// it was deleted.
+func exfatDirLiveSetChecksum(set []byte) uint16 {
+	var checksum uint16
+	for off := 0; off < len(set); off += EXFAT_DIRRECORD_SIZE {
+		end := min(off+EXFAT_DIRRECORD_SIZE, len(set))
+		checksum = exfatDirLiveChecksumAdd(checksum, set[off:end], off == 0)
 	}
-
-	return string(decodedString)
+	return checksum
 }
 
 // exfatDirSetChecksumAdd updates the running 16-bit checksum for a 32-byte
 // directory record. For the first FILE directory entry in a set, the checksum
-// field (bytes 2 and 3) must be treated as zero while computing the checksum.
+// field (bytes 2 and 3) is skipped while computing the checksum.
 func exfatDirSetChecksumAdd(accum uint16, record []byte, isFileDir bool) uint16 {
 	// exFAT directory record size is fixed (32 bytes), but be defensive.
 	limit := EXFAT_DIRRECORD_SIZE
@@ -98,10 +97,10 @@ func exfatDirSetChecksumAdd(accum uint16, record []byte, isFileDir bool) uint16
 		limit = len(record)
 	}
 	for i := 0; i < limit; i++ {
-		b := record[i]
 		if isFileDir && (i == 2 || i == 3) {
-			b = 0
+			continue
 		}
+		b := record[i]
 		// Rotate right by 1 and add the byte (keep 16-bit)
 		accum = ((accum >> 1) | (accum << 15)) + uint16(b)
 	}
@@ -192,13 +191,3 @@ func humanize(b uint64) string {
 	}
 	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
 }
-
-func getRange(index uint32, count uint64) []uint32 {
-	var list []uint32
-	for count != 0 {
-		list = append(list, index)
-		count--
-		index++
-	}
-	return list
-}
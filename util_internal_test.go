@@ -0,0 +1,37 @@
+package libxfat
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// TestSetChecksumKnownVector checks exfatDirSetChecksumAdd against a
+// SetChecksum computed with the reference loop of the exFAT specification,
+// which skips bytes 2 and 3 of the primary record instead of hashing them.
+func TestSetChecksumKnownVector(t *testing.T) {
+	set, err := hex.DecodeString("" +
+		"8502abcd200000006b5a4e576b5a4e576b5a4e57000000000000000000000000" +
+		"c00300053e1f00000b0000000000000000000000050000000b00000000000000" +
+		"c10061002e007400780074000000000000000000000000000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = 0x235d
+
+	checksum := func() uint16 {
+		var sum uint16
+		for off := 0; off < len(set); off += EXFAT_DIRRECORD_SIZE {
+			sum = exfatDirSetChecksumAdd(sum, set[off:off+EXFAT_DIRRECORD_SIZE], off == 0)
+		}
+		return sum
+	}
+	if got := checksum(); got != want {
+		t.Fatalf("SetChecksum = %#04x, want %#04x", got, want)
+	}
+
+	// The stored checksum field takes no part in the result.
+	set[2], set[3] = 0, 0
+	if got := checksum(); got != want {
+		t.Fatalf("SetChecksum with a zeroed field = %#04x, want %#04x", got, want)
+	}
+}
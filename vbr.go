@@ -5,20 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
 )
 
-func parseVBR(dimage *os.File, offset uint64, optmistic bool) (VBR, error) {
+func parseVBR(dimage io.ReaderAt, offset uint64, optmistic bool) (VBR, error) {
 	var vbr VBR
 
-	seekByte := int64(offset) * int64(SECTOR_SIZE)
-	_, err := dimage.Seek(seekByte, io.SeekStart)
-	if err != nil {
-		return vbr, err
-	}
-
 	data := make([]byte, VBR_SIZE*SECTOR_SIZE)
-	_, err = io.ReadFull(dimage, data)
+	err := readFullAt(dimage, data, int64(offset)*int64(SECTOR_SIZE))
 	if err != nil {
 		return vbr, err
 	}
@@ -32,6 +25,26 @@ func parseVBR(dimage *os.File, offset uint64, optmistic bool) (VBR, error) {
 	return vbr, nil
 }
 
+// parseBackupVBR parses the backup boot sector, which starts VBR_SIZE sectors
+// into the volume. The sector size is not known yet, so every size exFAT
+// allows is tried until a boot sector declaring that size is found.
+func parseBackupVBR(dimage io.ReaderAt, offset uint64, optimistic bool) (VBR, error) {
+	var vbr VBR
+	err := errors.New("no backup boot sector found")
+	data := make([]byte, SECTOR_SIZE)
+	for shift := byte(9); shift <= 12; shift++ {
+		backup := int64(offset)*int64(SECTOR_SIZE) + VBR_SIZE<<shift
+		if readFullAt(dimage, data, backup) != nil || data[EXFAT_SECTOR_SIZE_OFFSET] != shift {
+			continue
+		}
+		vbr = VBR{dimage: dimage}
+		if err = vbr.parseVBRData(data, offset, optimistic); err == nil {
+			return vbr, nil
+		}
+	}
+	return vbr, err
+}
+
 func (v *VBR) parseVBRData(vbr []byte, offset uint64, optimistic bool) error {
 	err := checkSyncValue(vbr[SYNC_OFFSET : SYNC_OFFSET+2])
 	if err != nil {
@@ -58,11 +71,13 @@ func (v *VBR) parseVBRData(vbr []byte, offset uint64, optimistic bool) error {
 	v.volumeSize = unpackLELongLong(vbr[EXFAT_VOLSIZE_OFFSET : EXFAT_VOLSIZE_OFFSET+8])
 	v.fatOffset = unpackLELong(vbr[EXFAT_FAT1_OFFSET : EXFAT_FAT1_OFFSET+4])
 	v.fatSize = unpackLELong(vbr[EXFAT_FATSIZE_OFFSET : EXFAT_FATSIZE_OFFSET+4])
+	v.nbFats = vbr[EXFAT_NB_FATS_OFFSET]
 	v.dataRegionOffset = unpackLELong(vbr[EXFAT_DATA_OFFSET : EXFAT_DATA_OFFSET+4])
 	v.nbClusters = unpackLELong(vbr[EXFAT_NB_CLUSTERS : EXFAT_NB_CLUSTERS+4])
 	v.rootDirCluster = unpackLELong(vbr[EXFAT_ROOT_CLUSTER_OFFSET : EXFAT_ROOT_CLUSTER_OFFSET+4])
 	v.sn = vbr[EXFAT_SN_OFFSET : EXFAT_SN_OFFSET+4]
 	v.version = unpackLEShort(vbr[EXFAT_VERSION_OFFSET : EXFAT_VERSION_OFFSET+2])
+	v.volumeFlags = VolumeFlags(unpackLEShort(vbr[EXFAT_VOLUME_FLAGS_OFFSET : EXFAT_VOLUME_FLAGS_OFFSET+2]))
 	v.sectorSize = 1 << vbr[EXFAT_SECTOR_SIZE_OFFSET]
 	v.sectorsPerCluster = 1 << vbr[EXFAT_CLUSTER_SIZE_OFFSET]
 	v.clusterSize = uint64(v.sectorSize) * uint64(v.sectorsPerCluster)
@@ -0,0 +1,156 @@
+package libxfat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// SetVolumeLabel writes label to the volume label record of the root
+// directory. An empty label clears it: the record becomes a 0x03 record with
+// no characters. A root without a label record gets one.
+//
+// The record has room for EXFAT_MAX_LABEL_LENGTH UTF-16 units and the
+// specification caps its CharacterCount there, so longer labels, including
+// the 15-unit labels some tools accept, fail with ErrInvalidLabel.
+func (e *ExFAT) SetVolumeLabel(label string) error {
+	units := utf16.Encode([]rune(label))
+	if len(units) > EXFAT_MAX_LABEL_LENGTH {
+		return fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidLabel, label, EXFAT_MAX_LABEL_LENGTH)
+	}
+	for _, unit := range units {
+		if unit == 0 {
+			return fmt.Errorf("%w: %q contains NUL", ErrInvalidLabel, label)
+		}
+	}
+
+	record := VolumeLabelEntry{EntryType: EXFAT_DIRRECORD_NOLABEL}
+	if len(units) > 0 {
+		record.EntryType = EXFAT_DIRRECORD_LABEL
+		record.CharacterCount = byte(len(units))
+		copy(record.VolumeLabel[:], units)
+	}
+	err := e.update(func(a *allocator) error {
+		return e.writeRootRecord(a, record.Encode(), EXFAT_DIRRECORD_LABEL, EXFAT_DIRRECORD_NOLABEL)
+	})
+	if err != nil {
+		return err
+	}
+	e.vbr.volumeLabel = label
+	return nil
+}
+
+// GetVolumeSerial returns the VolumeSerialNumber of the boot sector.
+func (e *ExFAT) GetVolumeSerial() uint32 {
+	return binary.LittleEndian.Uint32(e.vbr.sn)
+}
+
+// SetVolumeSerial writes serial to the main and backup boot sectors and
+// recomputes the checksum sector of both boot regions. The main region is
+// written first, so an interrupted write always leaves one region whose
+// checksum matches.
+func (e *ExFAT) SetVolumeSerial(serial uint32) error {
+	v := &e.vbr
+	regionSize := uint64(VBR_SIZE) * uint64(v.sectorSize)
+	checksumSector := regionSize - uint64(v.sectorSize)
+	var raw [4]byte
+	binary.LittleEndian.PutUint32(raw[:], serial)
+
+	for _, start := range []uint64{v.vbrStart, v.vbrStart + regionSize} {
+		region := make([]byte, regionSize)
+		if err := readFullAt(v.dimage, region, int64(start)); err != nil {
+			return err
+		}
+		copy(region[EXFAT_SN_OFFSET:], raw[:])
+		checksum := bootChecksum(region[:checksumSector])
+		for off := checksumSector; off < regionSize; off += 4 {
+			binary.LittleEndian.PutUint32(region[off:], checksum)
+		}
+		if err := v.writeAt(raw[:], start+EXFAT_SN_OFFSET); err != nil {
+			return err
+		}
+		if err := v.writeAt(region[checksumSector:], start+checksumSector); err != nil {
+			return err
+		}
+	}
+	copy(v.sn, raw[:])
+	return nil
+}
+
+// GetVolumeGUID returns the GUID of the volume GUID record in the root
+// directory. ok is false when there is none.
+func (e *ExFAT) GetVolumeGUID() (guid [16]byte, ok bool, err error) {
+	slots, index, err := e.findRootRecord(EXFAT_DIRRECORD_VOLUME_GUID)
+	if err != nil || index < 0 {
+		return guid, false, err
+	}
+	var raw [EXFAT_DIRRECORD_SIZE]byte
+	if err := readFullAt(e.vbr.dimage, raw[:], int64(slots.offsets[index])); err != nil {
+		return guid, false, err
+	}
+	var record VolumeGuidEntry
+	if err := record.Decode(raw); err != nil {
+		return guid, false, err
+	}
+	return record.VolumeGuid, true, nil
+}
+
+// SetVolumeGUID writes guid to the volume GUID record of the root directory,
+// with a fresh SetChecksum, and creates the record when there is none. The
+// specification treats an all-zero GUID as no GUID, so a zero guid marks an
+// existing record deleted instead.
+func (e *ExFAT) SetVolumeGUID(guid [16]byte) error {
+	return e.update(func(a *allocator) error {
+		if guid == [16]byte{} {
+			slots, index, err := e.findRootRecord(EXFAT_DIRRECORD_VOLUME_GUID)
+			if err != nil || index < 0 {
+				return err
+			}
+			return e.vbr.writeAt([]byte{EXFAT_DIRRECORD_VOLUME_GUID &^ 0x80}, slots.offsets[index])
+		}
+
+		record := VolumeGuidEntry{EntryType: EXFAT_DIRRECORD_VOLUME_GUID, VolumeGuid: guid}
+		records := [][EXFAT_DIRRECORD_SIZE]byte{record.Encode()}
+		writeSetChecksum(records)
+		return e.writeRootRecord(a, records[0], EXFAT_DIRRECORD_VOLUME_GUID)
+	})
+}
+
+// writeRootRecord overwrites the first root directory record of one of types
+// with record, or inserts record when the root has none.
+func (e *ExFAT) writeRootRecord(a *allocator, record [EXFAT_DIRRECORD_SIZE]byte, types ...byte) error {
+	slots, index, err := e.findRootRecord(types...)
+	if err != nil {
+		return err
+	}
+	records := [][EXFAT_DIRRECORD_SIZE]byte{record}
+	if index < 0 {
+		return e.insertEntrySet(a, e.rootEntry(), records)
+	}
+	return e.writeRecords(slots.offsets[index:index+1], records)
+}
+
+// findRootRecord returns the slots of the root directory and the index of
+// the first record of one of types, or -1.
+func (e *ExFAT) findRootRecord(types ...byte) (*dirSlots, int, error) {
+	slots, err := e.readDirSlots(e.rootEntry())
+	if err != nil {
+		return nil, -1, err
+	}
+	end := slots.end
+	if end < 0 {
+		end = len(slots.offsets)
+	}
+	var entryType [1]byte
+	for i, off := range slots.offsets[:end] {
+		if err := readFullAt(e.vbr.dimage, entryType[:], int64(off)); err != nil {
+			return nil, -1, err
+		}
+		for _, t := range types {
+			if entryType[0] == t {
+				return slots, i, nil
+			}
+		}
+	}
+	return slots, -1, nil
+}
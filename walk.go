@@ -0,0 +1,63 @@
+package libxfat
+
+import (
+	"errors"
+	"io"
+)
+
+// walkTree visits every entry reachable from the root directory, depth
+// first, including virtual and special entries. onDir is called once per
+// directory read with the diagnostics and error of that read; returning nil
+// from it keeps the walk going past directories that fail to parse, that
+// close a cycle or that sit too deep. Exceeding MaxTotalEntries always ends
+// the walk.
+func (e *ExFAT) walkTree(visit func(entry Entry) error, onDir func(dir Entry, diagnostics []Diagnostic, err error) error) error {
+	rootEntries, diagnostics, err := e.ReadRootDirWithDiagnostics()
+	if err != nil {
+		return err
+	}
+	t := e.newTraversal()
+	root := Entry{name: "", entryCluster: e.vbr.rootDirCluster, entryAttr: ENTRY_ATTR_DIR_MASK}
+	if onDir != nil {
+		if err := onDir(root, diagnostics, nil); err != nil {
+			return err
+		}
+	}
+	if err := t.add(root, len(rootEntries)); err != nil {
+		return err
+	}
+	return e.walkEntries(t, rootEntries, 1, visit, onDir)
+}
+
+func (e *ExFAT) walkEntries(t *traversal, entries []Entry, depth int, visit func(entry Entry) error, onDir func(dir Entry, diagnostics []Diagnostic, err error) error) error {
+	for _, entry := range entries {
+		if err := visit(entry); err != nil {
+			return err
+		}
+		if entry.NonParsable() {
+			continue
+		}
+
+		e.diagnostics = nil
+		subentries, err := e.readDirIn(t, entry, depth)
+		diagnostics := e.takeDiagnostics()
+		if errors.Is(err, io.EOF) || errors.Is(err, ErrEOF) {
+			err = nil
+		}
+		if errors.Is(err, ErrMaxTotalEntries) {
+			return err
+		}
+		if onDir != nil {
+			if err := onDir(entry, diagnostics, err); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		if err := e.walkEntries(t, subentries, depth+1, visit, onDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,460 @@
+package libxfat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// CreateOptions sets the metadata of a new file or directory. Attributes
+// defaults to ENTRY_ATTR_ATTR_MASK (archive) for files; the directory bit is
+// managed by the create call. Zero timestamps take the current time.
+type CreateOptions struct {
+	Attributes uint16
+	Created    time.Time
+	Modified   time.Time
+	Accessed   time.Time
+}
+
+// CreateDir creates an empty directory at path. The parent must exist. The
+// directory gets one zeroed cluster, recorded as NoFatChain.
+func (e *ExFAT) CreateDir(path string, opts ...CreateOptions) (Entry, error) {
+	return e.create(path, true, nil, opts)
+}
+
+// CreateFile creates a file at path holding everything read from r. The
+// parent must exist. Clusters are taken from the start of the largest free
+// run and follow each other while they can; a contiguous file is recorded as
+// NoFatChain, a fragmented one gets a FAT chain. A nil r creates an empty
+// file.
+func (e *ExFAT) CreateFile(path string, r io.Reader, opts ...CreateOptions) (Entry, error) {
+	return e.create(path, false, r, opts)
+}
+
+// SetAttributes replaces the attributes of the file or directory at path.
+// The directory bit cannot be changed.
+func (e *ExFAT) SetAttributes(path string, attr uint16) error {
+	entry, err := e.lookupEntrySet(path)
+	if err != nil {
+		return err
+	}
+	if (attr^entry.entryAttr)&ENTRY_ATTR_DIR_MASK != 0 {
+		return fmt.Errorf("%w: the directory bit of %s cannot change", ErrInvalidAttributes, path)
+	}
+
+	return e.update(func(*allocator) error {
+		return e.updateEntrySet(entry, func(records [][EXFAT_DIRRECORD_SIZE]byte) {
+			var file FileDirectoryEntry
+			_ = file.Decode(records[0])
+			file.FileAttributes = attr
+			records[0] = file.Encode()
+		})
+	})
+}
+
+// SetTimes replaces the timestamps of the file or directory at path. A zero
+// time leaves that timestamp unchanged.
+func (e *ExFAT) SetTimes(path string, created, modified, accessed time.Time) error {
+	entry, err := e.lookupEntrySet(path)
+	if err != nil {
+		return err
+	}
+
+	return e.update(func(*allocator) error {
+		return e.updateEntrySet(entry, func(records [][EXFAT_DIRRECORD_SIZE]byte) {
+			var file FileDirectoryEntry
+			_ = file.Decode(records[0])
+			if !created.IsZero() {
+				file.CreateTimestamp, file.Create10msIncrement, file.CreateUtcOffset = encodeTimestamp(created)
+			}
+			if !modified.IsZero() {
+				file.LastModifiedTimestamp, file.LastModified10msIncrement, file.LastModifiedUtcOffset = encodeTimestamp(modified)
+			}
+			if !accessed.IsZero() {
+				file.LastAccessedTimestamp, _, file.LastAccessedUtcOffset = encodeTimestamp(accessed)
+			}
+			records[0] = file.Encode()
+		})
+	})
+}
+
+// lookupEntrySet finds the entry at path and refuses the root directory,
+// which has no entry set.
+func (e *ExFAT) lookupEntrySet(path string) (Entry, error) {
+	entry, err := e.Lookup(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	if e.isRootEntry(entry) {
+		return Entry{}, fmt.Errorf("%w: the root directory has no entry set", ErrInvalidEntry)
+	}
+	return entry, nil
+}
+
+func (e *ExFAT) create(path string, dir bool, r io.Reader, opts []CreateOptions) (Entry, error) {
+	parts := splitPath(path)
+	if len(parts) == 0 {
+		return Entry{}, fmt.Errorf("%w: %q", ErrInvalidName, path)
+	}
+	name, err := validateName(parts[len(parts)-1])
+	if err != nil {
+		return Entry{}, err
+	}
+	parent, err := e.Lookup("/" + strings.Join(parts[:len(parts)-1], "/"))
+	if err != nil {
+		return Entry{}, err
+	}
+	entries, err := e.readDirOf(parent)
+	if err != nil {
+		return Entry{}, err
+	}
+	upcase, err := e.loadUpcaseTable()
+	if err != nil {
+		return Entry{}, err
+	}
+	if _, ok := findChild(upcase, entries, parts[len(parts)-1]); ok {
+		return Entry{}, fmt.Errorf("%w: %s", ErrEntryExists, path)
+	}
+
+	spec := entrySetSpec{name: name, options: resolveCreateOptions(opts, dir)}
+	err = e.update(func(a *allocator) error {
+		var runs []Run
+		if dir {
+			cluster, err := a.next(0)
+			if err != nil {
+				return err
+			}
+			if err := e.vbr.writeAt(make([]byte, e.vbr.clusterSize), e.vbr.getClusterOffset(cluster)); err != nil {
+				return err
+			}
+			runs = []Run{{Start: cluster, Length: 1}}
+			spec.dataLen = e.vbr.clusterSize
+		} else if r != nil {
+			runs, spec.dataLen, err = e.writeData(a, r)
+			if err != nil {
+				return err
+			}
+		}
+		if len(runs) > 0 {
+			spec.cluster = runs[0].Start
+			spec.noFatChain = len(runs) == 1
+		}
+		if len(runs) > 1 {
+			if err := e.vbr.writeChain(runs); err != nil {
+				return err
+			}
+		}
+
+		return e.insertEntrySet(a, parent, buildEntrySet(upcase, spec))
+	})
+	if err != nil {
+		return Entry{}, err
+	}
+	return e.Lookup(path)
+}
+
+// update runs one write operation. The volume is flagged dirty while it runs
+// and clean again afterwards, unless it was dirty to begin with. A failed
+// operation leaves the volume dirty and its pending bitmap changes unwritten.
+// Cached views of the volume are dropped.
+func (e *ExFAT) update(op func(a *allocator) error) error {
+	a, err := e.newAllocator()
+	if err != nil {
+		return err
+	}
+	flags := e.vbr.volumeFlags
+	if !flags.Has(VOLUME_FLAG_DIRTY) {
+		if err := e.writeVolumeFlags(flags | VOLUME_FLAG_DIRTY); err != nil {
+			return err
+		}
+	}
+	e.clusterMap = nil
+
+	if err := op(a); err != nil {
+		return err
+	}
+	if err := a.flush(); err != nil {
+		return err
+	}
+	return e.writeVolumeFlags(flags)
+}
+
+// writeData copies r into newly allocated clusters, zero-padding the last
+// one, and returns the runs used and the number of bytes written.
+func (e *ExFAT) writeData(a *allocator, r io.Reader) ([]Run, uint64, error) {
+	v := &e.vbr
+	buf := make([]byte, v.clusterSize)
+	var runs []Run
+	var size uint64
+	prev := uint32(0)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			clear(buf[n:])
+			cluster, aerr := a.next(prev)
+			if aerr != nil {
+				return nil, 0, aerr
+			}
+			if werr := v.writeAt(buf, v.getClusterOffset(cluster)); werr != nil {
+				return nil, 0, werr
+			}
+			runs = appendCluster(runs, cluster)
+			size += uint64(n)
+			prev = cluster
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return runs, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// validateName checks a new file name against the exFAT naming rules and
+// returns its UTF-16 units.
+func validateName(name string) ([]uint16, error) {
+	units := utf16.Encode([]rune(name))
+	if len(units) == 0 || len(units) > EXFAT_MAX_NAME_LENGTH || name == "." || name == ".." {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	for _, unit := range units {
+		if unit == 0 || isIllegalNameUnit(unit) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidName, name)
+		}
+	}
+	return units, nil
+}
+
+func resolveCreateOptions(opts []CreateOptions, dir bool) CreateOptions {
+	var options CreateOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	now := time.Now()
+	for _, t := range []*time.Time{&options.Created, &options.Modified, &options.Accessed} {
+		if t.IsZero() {
+			*t = now
+		}
+	}
+	if dir {
+		options.Attributes |= ENTRY_ATTR_DIR_MASK
+	} else {
+		if options.Attributes == 0 {
+			options.Attributes = ENTRY_ATTR_ATTR_MASK
+		}
+		options.Attributes &^= ENTRY_ATTR_DIR_MASK
+	}
+	return options
+}
+
+// encodeTimestamp packs t into an exFAT timestamp, its 10 ms increment and
+// its UTC offset field. Dates outside 1980-2107 are clamped.
+func encodeTimestamp(t time.Time) (uint32, byte, byte) {
+	switch {
+	case t.Year() < 1980:
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, t.Location())
+	case t.Year() > 2107:
+		t = time.Date(2107, 12, 31, 23, 59, 59, 0, t.Location())
+	}
+	timestamp := uint32(t.Year()-1980)<<25 | uint32(t.Month())<<21 | uint32(t.Day())<<16 |
+		uint32(t.Hour())<<11 | uint32(t.Minute())<<5 | uint32(t.Second()/2)
+	increment := byte((t.Second()%2)*100 + t.Nanosecond()/10_000_000)
+
+	_, offset := t.Zone()
+	utcOffset := 0x80 | byte(int8(offset/(15*60)))&0x7f
+	return timestamp, increment, utcOffset
+}
+
+// entrySetSpec describes the entry set of a new file or directory.
+type entrySetSpec struct {
+	name       []uint16
+	options    CreateOptions
+	cluster    uint32
+	dataLen    uint64
+	noFatChain bool
+}
+
+// buildEntrySet encodes the file, stream and name records of a new entry with
+// its NameHash and SetChecksum.
+func buildEntrySet(upcase upcaseTable, spec entrySetSpec) [][EXFAT_DIRRECORD_SIZE]byte {
+	nameRecords := nameRecordsFor(len(spec.name))
+	file := FileDirectoryEntry{
+		EntryType:      EXFAT_DIRRECORD_FILEDIR,
+		SecondaryCount: byte(1 + nameRecords),
+		FileAttributes: spec.options.Attributes,
+	}
+	file.CreateTimestamp, file.Create10msIncrement, file.CreateUtcOffset = encodeTimestamp(spec.options.Created)
+	file.LastModifiedTimestamp, file.LastModified10msIncrement, file.LastModifiedUtcOffset = encodeTimestamp(spec.options.Modified)
+	file.LastAccessedTimestamp, _, file.LastAccessedUtcOffset = encodeTimestamp(spec.options.Accessed)
+
+	stream := StreamExtensionEntry{
+		EntryType:             EXFAT_DIRRECORD_STREAM_EXT,
+		GeneralSecondaryFlags: ALLOCATION_POSSIBLE_FLAG,
+		NameLength:            byte(len(spec.name)),
+		NameHash:              upcase.nameHash(spec.name),
+		ValidDataLength:       spec.dataLen,
+		FirstCluster:          spec.cluster,
+		DataLength:            spec.dataLen,
+	}
+	if spec.noFatChain {
+		stream.GeneralSecondaryFlags |= NOT_FAT_CHAIN_FLAG
+	}
+
+	records := [][EXFAT_DIRRECORD_SIZE]byte{file.Encode(), stream.Encode()}
+	for i := 0; i < nameRecords; i++ {
+		name := FileNameEntry{EntryType: EXFAT_DIRRECORD_FILENAME_EXT}
+		copy(name.FileName[:], spec.name[i*15:])
+		records = append(records, name.Encode())
+	}
+	writeSetChecksum(records)
+	return records
+}
+
+// writeSetChecksum stores the SetChecksum of records in the primary record.
+func writeSetChecksum(records [][EXFAT_DIRRECORD_SIZE]byte) {
+	var checksum uint16
+	for i := range records {
+		checksum = exfatDirSetChecksumAdd(checksum, records[i][:], i == 0)
+	}
+	binary.LittleEndian.PutUint16(records[0][2:4], checksum)
+}
+
+// updateEntrySet reads the records of entry's set, lets update change them,
+// then writes them back with a fresh SetChecksum.
+func (e *ExFAT) updateEntrySet(entry Entry, update func(records [][EXFAT_DIRRECORD_SIZE]byte)) error {
+	if len(entry.recordOffsets) < 2 {
+		return fmt.Errorf("%w: %s has no entry set", ErrInvalidEntry, entry.Path())
+	}
+	records, err := e.readEntrySet(entry)
+	if err != nil {
+		return err
+	}
+	update(records)
+	writeSetChecksum(records)
+	return e.writeRecords(entry.recordOffsets, records)
+}
+
+// insertEntrySet writes records into free slots at the end of dir.
+func (e *ExFAT) insertEntrySet(a *allocator, dir Entry, records [][EXFAT_DIRRECORD_SIZE]byte) error {
+	slots, err := e.readDirSlots(dir)
+	if err != nil {
+		return err
+	}
+	offsets, err := e.reserveSlots(a, slots, len(records))
+	if err != nil {
+		return err
+	}
+	return a.claim(func() error {
+		return e.writeRecords(offsets, records)
+	})
+}
+
+// dirSlots lists the record slots of a directory: their image offsets and the
+// index of the first unused (0x00) record, which ends the directory.
+type dirSlots struct {
+	dir     Entry
+	root    bool
+	runs    []Run
+	offsets []uint64
+	end     int
+}
+
+func (e *ExFAT) readDirSlots(dir Entry) (*dirSlots, error) {
+	v := &e.vbr
+	s := &dirSlots{dir: dir, root: e.isRootEntry(dir), end: -1}
+	buf := make([]byte, v.clusterSize)
+	collect := func(run Run) error {
+		s.runs = append(s.runs, run)
+		return v.visitRun(run, buf, func(cluster uint32, data []byte) error {
+			base := v.getClusterOffset(cluster)
+			for pos := 0; pos+EXFAT_DIRRECORD_SIZE <= len(data); pos += EXFAT_DIRRECORD_SIZE {
+				if s.end < 0 && data[pos] == 0x00 {
+					s.end = len(s.offsets)
+				}
+				s.offsets = append(s.offsets, base+uint64(pos))
+			}
+			return nil
+		})
+	}
+
+	var err error
+	if s.root {
+		err = v.walkChainRuns(dir.entryCluster, 0, collect)
+	} else {
+		err = v.walkEntryRuns(dir, collect)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.end < 0 {
+		s.end = len(s.offsets)
+	}
+	return s, nil
+}
+
+// reserveSlots returns the offsets of count free records at the end of the
+// directory, growing it a cluster at a time when needed. Records of deleted
+// entries are never reused, so they stay recoverable.
+func (e *ExFAT) reserveSlots(a *allocator, s *dirSlots, count int) ([]uint64, error) {
+	for len(s.offsets)-s.end < count {
+		if err := e.growDir(a, s); err != nil {
+			return nil, err
+		}
+	}
+	return s.offsets[s.end : s.end+count], nil
+}
+
+// growDir adds one zeroed cluster to a directory. A NoFatChain directory
+// stays so while the next cluster is free; otherwise it gets a FAT chain. The
+// DataLength in the parent's entry set follows.
+func (e *ExFAT) growDir(a *allocator, s *dirSlots) error {
+	v := &e.vbr
+	last := s.runs[len(s.runs)-1].End() - 1
+	cluster, err := a.next(last)
+	if err != nil {
+		return err
+	}
+	base := v.getClusterOffset(cluster)
+	if err := v.writeAt(make([]byte, v.clusterSize), base); err != nil {
+		return err
+	}
+	s.runs = appendCluster(s.runs, cluster)
+	for pos := uint64(0); pos < v.clusterSize; pos += EXFAT_DIRRECORD_SIZE {
+		s.offsets = append(s.offsets, base+pos)
+	}
+
+	switch {
+	case s.root || !s.dir.noFatChain:
+		if err := v.writeFatEntry(last, cluster); err != nil {
+			return err
+		}
+		if err := v.writeFatEntry(cluster, EXFAT_EOF_END); err != nil {
+			return err
+		}
+	case cluster != last+1:
+		if err := v.writeChain(s.runs); err != nil {
+			return err
+		}
+		s.dir.noFatChain = false
+	}
+	if s.root {
+		return nil
+	}
+
+	s.dir.dataLen += v.clusterSize
+	s.dir.validDataLen = s.dir.dataLen
+	return e.updateEntrySet(s.dir, func(records [][EXFAT_DIRRECORD_SIZE]byte) {
+		var stream StreamExtensionEntry
+		_ = stream.Decode(records[1])
+		stream.DataLength = s.dir.dataLen
+		stream.ValidDataLength = s.dir.validDataLen
+		if !s.dir.noFatChain {
+			stream.GeneralSecondaryFlags &^= NOT_FAT_CHAIN_FLAG
+		}
+		records[1] = stream.Encode()
+	})
+}
@@ -0,0 +1,61 @@
+package libxfat
+
+import (
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func TestBuildEntrySetPassesValidators(t *testing.T) {
+	e := &ExFAT{vbr: VBR{nbClusters: 16, clusterSize: 512}}
+	upcase := make(upcaseTable, 1<<16)
+	for unit := range upcase {
+		upcase[unit] = uint16(unit)
+	}
+	name := utf16.Encode([]rune("a rather long file name.txt"))
+	stamp := time.Date(2024, 5, 17, 13, 45, 31, 250_000_000, time.UTC)
+	records := buildEntrySet(upcase, entrySetSpec{
+		name:       name,
+		options:    CreateOptions{Attributes: ENTRY_ATTR_ATTR_MASK, Created: stamp, Modified: stamp, Accessed: stamp},
+		cluster:    3,
+		dataLen:    1024,
+		noFatChain: true,
+	})
+
+	if len(records) != 4 || records[0][1] != 3 {
+		t.Fatalf("records = %d, secondary count = %d, want 4 and 3", len(records), records[0][1])
+	}
+	if !e.validateFileDentry(records[0][:]) || !e.validateFileStreamDentry(records[1][:]) {
+		t.Fatal("file or stream record rejected by validators")
+	}
+	for _, record := range records[2:] {
+		if !e.validateFileNameDentry(record[:]) {
+			t.Fatal("name record rejected by validators")
+		}
+	}
+
+	var checksum uint16
+	for i := range records {
+		checksum = exfatDirSetChecksumAdd(checksum, records[i][:], i == 0)
+	}
+	var file FileDirectoryEntry
+	_ = file.Decode(records[0])
+	if file.SetChecksum != checksum {
+		t.Fatalf("SetChecksum = %#04x, want %#04x", file.SetChecksum, checksum)
+	}
+	var stream StreamExtensionEntry
+	_ = stream.Decode(records[1])
+	if !stream.NoFatChain() || stream.NameHash != upcase.nameHash(name) || int(stream.NameLength) != len(name) {
+		t.Fatalf("stream = %+v", stream)
+	}
+}
+
+func TestEncodeTimestamp(t *testing.T) {
+	stamp := time.Date(2024, 5, 17, 13, 45, 31, 250_000_000, time.FixedZone("", 2*3600))
+	timestamp, increment, utcOffset := encodeTimestamp(stamp)
+
+	want := uint32(44)<<25 | 5<<21 | 17<<16 | 13<<11 | 45<<5 | 15
+	if timestamp != want || increment != 125 || utcOffset != 0x80|8 {
+		t.Fatalf("encodeTimestamp = %#08x/%d/%#02x, want %#08x/125/0x88", timestamp, increment, utcOffset, want)
+	}
+}
@@ -0,0 +1,648 @@
+// Package xfattest builds exFAT images for tests from a declarative
+// description of the volume, and reports the ground truth a reader should
+// find in them.
+//
+// A Volume lists the tree to lay out: files with their content, forced
+// fragmentation, deleted entries, orphaned entry sets, vendor extension
+// records and timestamps. Build formats an in-memory image with
+// libxfat.Format, writes the tree, then injects the requested corruptions.
+//
+// Apart from formatting, the builder writes every structure itself: FAT
+// chains, bitmap bits, SetChecksums and NameHashes are computed here from
+// the specification rather than through libxfat's own helpers, so an image
+// built by this package can catch a bug in the code it is used to test.
+package xfattest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"path"
+	"time"
+	"unicode/utf16"
+
+	"github.com/aoiflux/libxfat"
+)
+
+// DefaultTime is the timestamp of nodes that do not set their own, so built
+// images are reproducible.
+var DefaultTime = time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC)
+
+// Volume describes an image to build.
+type Volume struct {
+	// Size is the volume size in bytes. Defaults to 4 MiB.
+	Size int64
+	// Format is passed to libxfat.Format. ClusterSize defaults to 512 bytes
+	// so small trees span several clusters; Serial and GUID default to fixed
+	// values.
+	Format libxfat.FormatOptions
+	// Root lists the contents of the root directory.
+	Root []Node
+	// Orphans are deleted entry sets left in a free cluster no directory
+	// points at, as a removed directory leaves its children.
+	Orphans []Node
+	// Corruptions are injected in order once the tree is written.
+	Corruptions []Corruption
+}
+
+// Node is a file or directory of the tree.
+type Node struct {
+	Name     string
+	Dir      bool
+	Content  []byte
+	Children []Node
+	// Attributes default to archive for files and directory for directories.
+	// The directory bit follows Dir.
+	Attributes uint16
+	// Zero timestamps take DefaultTime.
+	Created  time.Time
+	Modified time.Time
+	Accessed time.Time
+	// Fragments splits the data into runs of the given cluster counts, each
+	// followed by one free cluster, linked by a FAT chain. The counts must
+	// add up to the clusters the data needs. Without it, data is contiguous
+	// and recorded as NoFatChain.
+	Fragments []int
+	// Deleted writes the entry set with its in-use bits cleared, keeping the
+	// SetChecksum of the live set, and leaves its clusters free, as the
+	// Windows driver deletes. Children of a deleted directory are deleted too.
+	Deleted bool
+	// Vendor records are appended to the entry set after the name records.
+	Vendor []libxfat.VendorExtensionEntry
+}
+
+// Built is an image together with the ground truth it was built from.
+type Built struct {
+	Image *Image
+	Truth Truth
+}
+
+// Open parses the built image.
+func (b *Built) Open(optimistic bool) (libxfat.ExFAT, error) {
+	return libxfat.NewFromImage(b.Image, optimistic)
+}
+
+// Truth is what a reader should find in a built image.
+type Truth struct {
+	ClusterSize  uint64
+	ClusterCount uint32
+	// Allocated is the number of clusters marked in the allocation bitmap.
+	Allocated uint32
+	// Entries lists every node in the order it was written, parents first.
+	Entries     []EntryTruth
+	Corruptions []Corruption
+}
+
+// Entry returns the entry written at path.
+func (t Truth) Entry(path string) (EntryTruth, bool) {
+	for _, entry := range t.Entries {
+		if entry.Path == path {
+			return entry, true
+		}
+	}
+	return EntryTruth{}, false
+}
+
+// EntryTruth describes one written entry set. Orphan marks sets only found
+// by carving free clusters: the orphans of the Volume and everything below a
+// deleted directory. They are placed under /$OrphanFiles, where
+// libxfat.RecoverDeletedEntries reports them.
+type EntryTruth struct {
+	Path       string
+	Dir        bool
+	Deleted    bool
+	Orphan     bool
+	Content    []byte
+	DataLength uint64
+	Runs       []libxfat.Run
+	NoFatChain bool
+	Attributes uint16
+	Created    time.Time
+	Modified   time.Time
+	Accessed   time.Time
+	// RecordOffsets are the image offsets of the records of the set,
+	// primary record first.
+	RecordOffsets []uint64
+}
+
+// geometry is the layout of the formatted volume, in bytes unless noted.
+type geometry struct {
+	sectorSize    uint64
+	clusterSize   uint64
+	fatOffset     uint64
+	fatLength     uint64
+	nbFats        byte
+	heapOffset    uint64
+	clusterCount  uint32
+	rootCluster   uint32
+	bitmapCluster uint32
+}
+
+func (g geometry) clusterOffset(cluster uint32) uint64 {
+	return g.heapOffset + uint64(cluster-2)*g.clusterSize
+}
+
+type builder struct {
+	img    *Image
+	g      geometry
+	bitmap []byte
+	// upcase maps every UTF-16 unit through the up-case table Format wrote.
+	upcase []uint16
+	// cursor is the next cluster to hand out. Clusters are never reused, so
+	// deleted data stays in place.
+	cursor uint32
+	truth  Truth
+}
+
+// Build formats an image, writes the tree of v into it and injects the
+// corruptions.
+func Build(v Volume) (*Built, error) {
+	if v.Size == 0 {
+		v.Size = 4 << 20
+	}
+	if v.Format.ClusterSize == 0 {
+		v.Format.ClusterSize = 512
+	}
+	if v.Format.Serial == 0 {
+		v.Format.Serial = 0x1234abcd
+	}
+	if v.Format.GUID == [16]byte{} {
+		v.Format.GUID = [16]byte{0x78, 0x56, 0x34, 0x12, 0xcd, 0xab, 0xef, 0x4e, 0x89, 0xab, 1, 2, 3, 4, 5, 6}
+	}
+	img := NewImage(v.Size)
+	if err := libxfat.Format(img, v.Size, v.Format); err != nil {
+		return nil, err
+	}
+
+	b := &builder{img: img}
+	if err := b.readGeometry(); err != nil {
+		return nil, err
+	}
+	root := dirTarget{runs: []libxfat.Run{{Start: b.g.rootCluster, Length: 1}}, root: true}
+	next, err := b.firstUnusedRecord(b.g.rootCluster)
+	if err != nil {
+		return nil, err
+	}
+	root.next = next
+	if err := b.writeChildren(&root, "/", v.Root, false, false); err != nil {
+		return nil, err
+	}
+	if len(v.Orphans) > 0 {
+		orphans := dirTarget{}
+		if err := b.writeChildren(&orphans, "/"+libxfat.ORPHANFILES, v.Orphans, true, true); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.flushBitmap(); err != nil {
+		return nil, err
+	}
+
+	for _, c := range v.Corruptions {
+		if err := b.inject(c); err != nil {
+			return nil, err
+		}
+	}
+	return &Built{Image: img, Truth: b.truth}, nil
+}
+
+func (b *builder) readGeometry() error {
+	boot := make([]byte, 512)
+	if err := b.readAt(boot, 0); err != nil {
+		return err
+	}
+	g := &b.g
+	g.sectorSize = 1 << boot[0x6c]
+	g.clusterSize = g.sectorSize << boot[0x6d]
+	g.fatOffset = uint64(binary.LittleEndian.Uint32(boot[0x50:])) * g.sectorSize
+	g.fatLength = uint64(binary.LittleEndian.Uint32(boot[0x54:])) * g.sectorSize
+	g.nbFats = boot[0x6e]
+	g.heapOffset = uint64(binary.LittleEndian.Uint32(boot[0x58:])) * g.sectorSize
+	g.clusterCount = binary.LittleEndian.Uint32(boot[0x5c:])
+	g.rootCluster = binary.LittleEndian.Uint32(boot[0x60:])
+
+	root := make([]byte, g.clusterSize)
+	if err := b.readAt(root, g.clusterOffset(g.rootCluster)); err != nil {
+		return err
+	}
+	var upcase []byte
+	var upcaseCluster uint32
+	for off := 0; off < len(root); off += 32 {
+		switch root[off] {
+		case 0x81:
+			g.bitmapCluster = binary.LittleEndian.Uint32(root[off+20:])
+			b.bitmap = make([]byte, binary.LittleEndian.Uint64(root[off+24:]))
+		case 0x82:
+			upcaseCluster = binary.LittleEndian.Uint32(root[off+20:])
+			upcase = make([]byte, binary.LittleEndian.Uint64(root[off+24:]))
+		}
+	}
+	if b.bitmap == nil || upcase == nil {
+		return fmt.Errorf("formatted volume has no allocation bitmap or up-case table")
+	}
+	if err := b.readAt(b.bitmap, g.clusterOffset(g.bitmapCluster)); err != nil {
+		return err
+	}
+	if err := b.readAt(upcase, g.clusterOffset(upcaseCluster)); err != nil {
+		return err
+	}
+	b.upcase = expandUpcase(upcase)
+	b.cursor = g.rootCluster + 1
+	b.truth.ClusterSize = g.clusterSize
+	b.truth.ClusterCount = g.clusterCount
+	return nil
+}
+
+// firstUnusedRecord returns the index of the first 0x00 record of a cluster.
+func (b *builder) firstUnusedRecord(cluster uint32) (int, error) {
+	data := make([]byte, b.g.clusterSize)
+	if err := b.readAt(data, b.g.clusterOffset(cluster)); err != nil {
+		return 0, err
+	}
+	for off := 0; off < len(data); off += 32 {
+		if data[off] == 0 {
+			return off / 32, nil
+		}
+	}
+	return len(data) / 32, nil
+}
+
+// dirTarget is a directory receiving entry sets: its cluster runs and the
+// index of the next free record.
+type dirTarget struct {
+	runs []libxfat.Run
+	next int
+	root bool
+}
+
+// recordOffset maps a record index to its image offset.
+func (b *builder) recordOffset(d *dirTarget, index int) (uint64, error) {
+	pos := uint64(index) * 32
+	for _, run := range d.runs {
+		size := uint64(run.Length) * b.g.clusterSize
+		if pos < size {
+			return b.g.clusterOffset(run.Start) + pos, nil
+		}
+		pos -= size
+	}
+	return 0, fmt.Errorf("record %d outside the directory", index)
+}
+
+// writeChildren lays out nodes into d. A directory target without clusters,
+// as used for orphans, gets free clusters of its own.
+func (b *builder) writeChildren(d *dirTarget, parent string, nodes []Node, deleted, orphan bool) error {
+	sets := make([][][32]byte, len(nodes))
+	records := 0
+	for i, node := range nodes {
+		set, err := b.entrySet(node)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path.Join(parent, node.Name), err)
+		}
+		sets[i] = set
+		records += len(set)
+	}
+
+	capacity := 0
+	for _, run := range d.runs {
+		capacity += int(uint64(run.Length) * b.g.clusterSize / 32)
+	}
+	if need := d.next + records - capacity; need > 0 || len(d.runs) == 0 {
+		clusters := max(1, int((uint64(need)*32+b.g.clusterSize-1)/b.g.clusterSize))
+		run, err := b.alloc(clusters, !orphan)
+		if err != nil {
+			return err
+		}
+		if d.root {
+			last := d.runs[len(d.runs)-1]
+			if err := b.writeChain(append(append([]libxfat.Run(nil), last), run)); err != nil {
+				return err
+			}
+		}
+		d.runs = append(d.runs, run)
+	}
+
+	for i, node := range nodes {
+		nodeDeleted := deleted || node.Deleted
+		entry := EntryTruth{
+			Path:       path.Join(parent, node.Name),
+			Dir:        node.Dir,
+			Deleted:    nodeDeleted,
+			Orphan:     orphan,
+			Content:    node.Content,
+			Attributes: attributesOf(node),
+			Created:    timeOr(node.Created),
+			Modified:   timeOr(node.Modified),
+			Accessed:   timeOr(node.Accessed),
+		}
+
+		var child dirTarget
+		clusters := int((uint64(len(node.Content)) + b.g.clusterSize - 1) / b.g.clusterSize)
+		if node.Dir {
+			clusters = max(1, (childRecords(node.Children)*32+int(b.g.clusterSize)-1)/int(b.g.clusterSize))
+		}
+		runs, err := b.allocData(node, clusters, !nodeDeleted && !orphan)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Path, err)
+		}
+		entry.Runs = runs
+		entry.NoFatChain = len(node.Fragments) == 0
+		entry.DataLength = uint64(len(node.Content))
+		if node.Dir {
+			entry.DataLength = uint64(clusters) * b.g.clusterSize
+		}
+		if err := b.writeData(runs, node.Content); err != nil {
+			return fmt.Errorf("%s: %w", entry.Path, err)
+		}
+
+		set := sets[i]
+		var first uint32
+		if len(runs) > 0 {
+			first = runs[0].Start
+		}
+		fillStream(set, first, entry.DataLength, entry.NoFatChain)
+		setChecksum(set)
+		for r := range set {
+			if nodeDeleted {
+				set[r][0] &^= 0x80
+			}
+			off, err := b.recordOffset(d, d.next)
+			if err != nil {
+				return fmt.Errorf("%s: %w", entry.Path, err)
+			}
+			d.next++
+			if err := b.writeAt(set[r][:], off); err != nil {
+				return fmt.Errorf("%s: %w", entry.Path, err)
+			}
+			entry.RecordOffsets = append(entry.RecordOffsets, off)
+		}
+		b.truth.Entries = append(b.truth.Entries, entry)
+
+		if node.Dir {
+			child.runs = runs
+			childParent, childOrphan := entry.Path, orphan
+			if orphan || nodeDeleted {
+				childParent, childOrphan = "/"+libxfat.ORPHANFILES, true
+			}
+			if err := b.writeChildren(&child, childParent, node.Children, nodeDeleted, childOrphan); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// allocData hands out the clusters of a node, following its fragments.
+func (b *builder) allocData(node Node, clusters int, used bool) ([]libxfat.Run, error) {
+	if len(node.Fragments) == 0 {
+		if clusters == 0 {
+			return nil, nil
+		}
+		run, err := b.alloc(clusters, used)
+		if err != nil {
+			return nil, err
+		}
+		return []libxfat.Run{run}, nil
+	}
+
+	total := 0
+	var runs []libxfat.Run
+	for _, fragment := range node.Fragments {
+		if fragment <= 0 {
+			return nil, fmt.Errorf("fragment of %d clusters", fragment)
+		}
+		run, err := b.alloc(fragment, used)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+		b.cursor++
+		total += fragment
+	}
+	if total != clusters {
+		return nil, fmt.Errorf("fragments cover %d clusters, data needs %d", total, clusters)
+	}
+	if err := b.writeChain(runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// alloc hands out n contiguous clusters, marking them in the bitmap when
+// used.
+func (b *builder) alloc(n int, used bool) (libxfat.Run, error) {
+	run := libxfat.Run{Start: b.cursor, Length: uint32(n)}
+	if uint64(run.Start)+uint64(n) > uint64(b.g.clusterCount)+2 {
+		return libxfat.Run{}, fmt.Errorf("volume too small: %d clusters", b.g.clusterCount)
+	}
+	b.cursor += uint32(n)
+	if used {
+		for cluster := run.Start; cluster < run.Start+run.Length; cluster++ {
+			index := cluster - 2
+			b.bitmap[index/8] |= 1 << (index % 8)
+		}
+	}
+	return run, nil
+}
+
+// readAt fills p from the image at off.
+func (b *builder) readAt(p []byte, off uint64) error {
+	if _, err := b.img.ReadAt(p, int64(off)); err != nil {
+		return fmt.Errorf("read %d bytes at %d: %w", len(p), off, err)
+	}
+	return nil
+}
+
+// writeAt stores p in the image at off.
+func (b *builder) writeAt(p []byte, off uint64) error {
+	if _, err := b.img.WriteAt(p, int64(off)); err != nil {
+		return fmt.Errorf("write %d bytes at %d: %w", len(p), off, err)
+	}
+	return nil
+}
+
+// writeData stores content over runs; the rest of the last cluster is zeroed.
+func (b *builder) writeData(runs []libxfat.Run, content []byte) error {
+	for _, run := range runs {
+		size := uint64(run.Length) * b.g.clusterSize
+		chunk := make([]byte, size)
+		content = content[copy(chunk, content):]
+		if err := b.writeAt(chunk, b.g.clusterOffset(run.Start)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeChain points each cluster of runs at the next one, jumping from the
+// end of a run to the start of the following run, and marks the last cluster
+// as the end of the chain.
+func (b *builder) writeChain(runs []libxfat.Run) error {
+	for i, run := range runs {
+		for cluster := run.Start; cluster < run.Start+run.Length; cluster++ {
+			next := cluster + 1
+			if cluster == run.Start+run.Length-1 {
+				next = 0x0fffffff
+				if i+1 < len(runs) {
+					next = runs[i+1].Start
+				}
+			}
+			if err := b.writeFatEntry(cluster, next); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flushBitmap writes the bitmap back and refreshes PercentInUse, which the
+// boot checksum leaves out.
+func (b *builder) flushBitmap() error {
+	if err := b.writeAt(b.bitmap, b.g.clusterOffset(b.g.bitmapCluster)); err != nil {
+		return err
+	}
+	var allocated int
+	for _, bits8 := range b.bitmap {
+		allocated += bits.OnesCount8(bits8)
+	}
+	b.truth.Allocated = uint32(allocated)
+	return b.writeAt([]byte{byte(allocated * 100 / int(b.g.clusterCount))}, 0x70)
+}
+
+func childRecords(nodes []Node) int {
+	records := 0
+	for _, node := range nodes {
+		records += 2 + (len(utf16.Encode([]rune(node.Name)))+14)/15 + len(node.Vendor)
+	}
+	return records
+}
+
+func attributesOf(node Node) uint16 {
+	attr := node.Attributes
+	if attr == 0 && !node.Dir {
+		attr = 0x20
+	}
+	if node.Dir {
+		return attr | 0x10
+	}
+	return attr &^ 0x10
+}
+
+func timeOr(t time.Time) time.Time {
+	if t.IsZero() {
+		return DefaultTime
+	}
+	return t
+}
+
+// entrySet encodes the live records of a node. The stream record is
+// completed by fillStream once the data is placed.
+func (b *builder) entrySet(node Node) ([][32]byte, error) {
+	name := utf16.Encode([]rune(node.Name))
+	if len(name) == 0 || len(name) > 255 {
+		return nil, fmt.Errorf("invalid name %q", node.Name)
+	}
+	if node.Dir && len(node.Content) > 0 {
+		return nil, fmt.Errorf("directory with content")
+	}
+	if !node.Dir && len(node.Children) > 0 {
+		return nil, fmt.Errorf("file with children")
+	}
+
+	nameRecords := (len(name) + 14) / 15
+	file := libxfat.FileDirectoryEntry{
+		EntryType:      0x85,
+		SecondaryCount: byte(1 + nameRecords + len(node.Vendor)),
+		FileAttributes: attributesOf(node),
+	}
+	file.CreateTimestamp, file.Create10msIncrement, file.CreateUtcOffset = encodeTimestamp(timeOr(node.Created))
+	file.LastModifiedTimestamp, file.LastModified10msIncrement, file.LastModifiedUtcOffset = encodeTimestamp(timeOr(node.Modified))
+	file.LastAccessedTimestamp, _, file.LastAccessedUtcOffset = encodeTimestamp(timeOr(node.Accessed))
+	stream := libxfat.StreamExtensionEntry{
+		EntryType:  0xc0,
+		NameLength: byte(len(name)),
+		NameHash:   b.nameHash(name),
+	}
+
+	set := [][32]byte{file.Encode(), stream.Encode()}
+	for i := 0; i < nameRecords; i++ {
+		record := libxfat.FileNameEntry{EntryType: 0xc1}
+		copy(record.FileName[:], name[i*15:])
+		set = append(set, record.Encode())
+	}
+	for _, vendor := range node.Vendor {
+		if vendor.EntryType == 0 {
+			vendor.EntryType = 0xe0
+		}
+		set = append(set, vendor.Encode())
+	}
+	return set, nil
+}
+
+func fillStream(set [][32]byte, cluster uint32, size uint64, noFatChain bool) {
+	var stream libxfat.StreamExtensionEntry
+	_ = stream.Decode(set[1])
+	stream.GeneralSecondaryFlags = 0x01
+	if noFatChain {
+		stream.GeneralSecondaryFlags |= 0x02
+	}
+	stream.FirstCluster = cluster
+	stream.DataLength = size
+	stream.ValidDataLength = size
+	set[1] = stream.Encode()
+}
+
+// setChecksum stores the SetChecksum of a live set in its primary record.
+func setChecksum(set [][32]byte) {
+	var checksum uint16
+	for i, record := range set {
+		for j, b := range record {
+			if i == 0 && (j == 2 || j == 3) {
+				continue
+			}
+			checksum = (checksum<<15 | checksum>>1) + uint16(b)
+		}
+	}
+	binary.LittleEndian.PutUint16(set[0][2:4], checksum)
+}
+
+// expandUpcase turns a compressed up-case table into one unit per UTF-16
+// unit. Units past the end of the table map to themselves.
+func expandUpcase(table []byte) []uint16 {
+	upcase := make([]uint16, 0, 1<<16)
+	for i := 0; i+1 < len(table) && len(upcase) < 1<<16; i += 2 {
+		unit := binary.LittleEndian.Uint16(table[i:])
+		if unit == 0xffff && i+3 < len(table) {
+			for n := binary.LittleEndian.Uint16(table[i+2:]); n > 0 && len(upcase) < 1<<16; n-- {
+				upcase = append(upcase, uint16(len(upcase)))
+			}
+			i += 2
+			continue
+		}
+		upcase = append(upcase, unit)
+	}
+	for len(upcase) < 1<<16 {
+		upcase = append(upcase, uint16(len(upcase)))
+	}
+	return upcase
+}
+
+// nameHash computes the NameHash over the name up-cased through the table
+// Format wrote.
+func (b *builder) nameHash(name []uint16) uint16 {
+	var hash uint16
+	for _, unit := range name {
+		unit = b.upcase[unit]
+		hash = (hash<<15 | hash>>1) + unit&0xff
+		hash = (hash<<15 | hash>>1) + unit>>8
+	}
+	return hash
+}
+
+// encodeTimestamp packs t into an exFAT timestamp, 10 ms increment and UTC
+// offset field.
+func encodeTimestamp(t time.Time) (uint32, byte, byte) {
+	timestamp := uint32(t.Year()-1980)<<25 | uint32(t.Month())<<21 | uint32(t.Day())<<16 |
+		uint32(t.Hour())<<11 | uint32(t.Minute())<<5 | uint32(t.Second()/2)
+	increment := byte((t.Second()%2)*100 + t.Nanosecond()/10_000_000)
+	_, offset := t.Zone()
+	return timestamp, increment, 0x80 | byte(int8(offset/(15*60)))&0x7f
+}
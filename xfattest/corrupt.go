@@ -0,0 +1,193 @@
+package xfattest
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// CorruptionKind names a damage injected into a built image.
+type CorruptionKind int
+
+const (
+	// CORRUPT_SET_CHECKSUM: the SetChecksum of Path's entry set is flipped.
+	CORRUPT_SET_CHECKSUM CorruptionKind = iota + 1
+	// CORRUPT_FAT_LOOP: the FAT entry of Path's last cluster points back at
+	// its first. A NoFatChain entry is given a FAT chain first, so the loop
+	// is followed.
+	CORRUPT_FAT_LOOP
+	// CORRUPT_BAD_CLUSTER: cluster Index of Path's data is marked bad in
+	// every FAT.
+	CORRUPT_BAD_CLUSTER
+	// CORRUPT_TRUNCATE: the image is cut to Size bytes.
+	CORRUPT_TRUNCATE
+	// CORRUPT_MAIN_VBR: the main boot sector is zeroed. The backup boot
+	// region is left intact.
+	CORRUPT_MAIN_VBR
+	// CORRUPT_LOST_CLUSTERS: the clusters of Path, a deleted or orphaned
+	// entry, are marked allocated, so they become lost clusters.
+	CORRUPT_LOST_CLUSTERS
+)
+
+var corruptionKindNames = map[CorruptionKind]string{
+	CORRUPT_SET_CHECKSUM:  "set-checksum",
+	CORRUPT_FAT_LOOP:      "fat-loop",
+	CORRUPT_BAD_CLUSTER:   "bad-cluster",
+	CORRUPT_TRUNCATE:      "truncate",
+	CORRUPT_MAIN_VBR:      "main-vbr",
+	CORRUPT_LOST_CLUSTERS: "lost-clusters",
+}
+
+func (k CorruptionKind) String() string {
+	if name, ok := corruptionKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("corruption(%d)", int(k))
+}
+
+func (k CorruptionKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Corruption is one damage to inject after the volume is built. Path names
+// the entry it targets, Index a cluster of that entry's data, and Size the
+// new image size; each kind uses only the fields it needs.
+type Corruption struct {
+	Kind  CorruptionKind
+	Path  string
+	Index int
+	Size  int64
+}
+
+// inject applies c to the built image and updates the ground truth it
+// changes.
+func (b *builder) inject(c Corruption) error {
+	switch c.Kind {
+	case CORRUPT_SET_CHECKSUM:
+		entry, err := b.truthEntry(c)
+		if err != nil {
+			return err
+		}
+		var checksum [2]byte
+		if err := b.readAt(checksum[:], entry.RecordOffsets[0]+2); err != nil {
+			return fmt.Errorf("%s: %w", c.Kind, err)
+		}
+		checksum[0] ^= 0xff
+		if err := b.writeAt(checksum[:], entry.RecordOffsets[0]+2); err != nil {
+			return fmt.Errorf("%s: %w", c.Kind, err)
+		}
+	case CORRUPT_FAT_LOOP:
+		entry, err := b.truthEntry(c)
+		if err != nil {
+			return err
+		}
+		if len(entry.Runs) == 0 {
+			return fmt.Errorf("%s: %s has no clusters", c.Kind, c.Path)
+		}
+		if entry.NoFatChain {
+			if err := b.writeChain(entry.Runs); err != nil {
+				return fmt.Errorf("%s: %w", c.Kind, err)
+			}
+			err := b.rewriteSet(entry, func(records [][32]byte) {
+				records[1][1] &^= 0x02
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %w", c.Kind, err)
+			}
+			entry.NoFatChain = false
+		}
+		last := entry.Runs[len(entry.Runs)-1]
+		if err := b.writeFatEntry(last.Start+last.Length-1, entry.Runs[0].Start); err != nil {
+			return fmt.Errorf("%s: %w", c.Kind, err)
+		}
+	case CORRUPT_BAD_CLUSTER:
+		entry, err := b.truthEntry(c)
+		if err != nil {
+			return err
+		}
+		index := c.Index
+		for _, run := range entry.Runs {
+			if index < int(run.Length) {
+				if err := b.writeFatEntry(run.Start+uint32(index), 0x0ffffff7); err != nil {
+					return fmt.Errorf("%s: %w", c.Kind, err)
+				}
+				index = -1
+				break
+			}
+			index -= int(run.Length)
+		}
+		if index >= 0 {
+			return fmt.Errorf("%s: %s has no cluster %d", c.Kind, c.Path, c.Index)
+		}
+	case CORRUPT_TRUNCATE:
+		b.img.Truncate(c.Size)
+	case CORRUPT_MAIN_VBR:
+		if err := b.writeAt(make([]byte, b.g.sectorSize), 0); err != nil {
+			return fmt.Errorf("%s: %w", c.Kind, err)
+		}
+	case CORRUPT_LOST_CLUSTERS:
+		entry, err := b.truthEntry(c)
+		if err != nil {
+			return err
+		}
+		if !entry.Deleted && !entry.Orphan {
+			return fmt.Errorf("%s: %s is not deleted or orphaned", c.Kind, c.Path)
+		}
+		for _, run := range entry.Runs {
+			for cluster := run.Start; cluster < run.Start+run.Length; cluster++ {
+				index := cluster - 2
+				b.bitmap[index/8] |= 1 << (index % 8)
+			}
+		}
+		if err := b.flushBitmap(); err != nil {
+			return fmt.Errorf("%s: %w", c.Kind, err)
+		}
+	default:
+		return fmt.Errorf("unknown corruption %s", c.Kind)
+	}
+	b.truth.Corruptions = append(b.truth.Corruptions, c)
+	return nil
+}
+
+func (b *builder) truthEntry(c Corruption) (*EntryTruth, error) {
+	for i := range b.truth.Entries {
+		if b.truth.Entries[i].Path == c.Path {
+			return &b.truth.Entries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%s: no entry %s", c.Kind, c.Path)
+}
+
+// rewriteSet lets update change the live form of an entry set, then writes
+// it back with a fresh SetChecksum and the in-use bits it had.
+func (b *builder) rewriteSet(entry *EntryTruth, update func(records [][32]byte)) error {
+	records := make([][32]byte, len(entry.RecordOffsets))
+	for i, off := range entry.RecordOffsets {
+		if err := b.readAt(records[i][:], off); err != nil {
+			return err
+		}
+		records[i][0] |= 0x80
+	}
+	update(records)
+	setChecksum(records)
+	for i, off := range entry.RecordOffsets {
+		if entry.Deleted {
+			records[i][0] &^= 0x80
+		}
+		if err := b.writeAt(records[i][:], off); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFatEntry stores value for cluster in every FAT.
+func (b *builder) writeFatEntry(cluster, value uint32) error {
+	var raw [4]byte
+	binary.LittleEndian.PutUint32(raw[:], value)
+	for i := uint64(0); i < uint64(b.g.nbFats); i++ {
+		if err := b.writeAt(raw[:], b.g.fatOffset+i*b.g.fatLength+uint64(cluster)*4); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package xfattest
+
+import "io"
+
+// Image is an in-memory disk image. It implements io.ReaderAt and
+// io.WriterAt, so libxfat.Format can write it and libxfat.NewFromImage can
+// read and modify it. Writes past the end grow the image.
+type Image struct {
+	data []byte
+}
+
+// NewImage returns a zeroed image of size bytes.
+func NewImage(size int64) *Image {
+	return &Image{data: make([]byte, size)}
+}
+
+func (m *Image) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *Image) WriteAt(p []byte, off int64) (int, error) {
+	if end := off + int64(len(p)); end > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-int64(len(m.data)))...)
+	}
+	return copy(m.data[off:], p), nil
+}
+
+// Size returns the image size in bytes.
+func (m *Image) Size() int64 {
+	return int64(len(m.data))
+}
+
+// Bytes returns the image contents. The slice aliases the image.
+func (m *Image) Bytes() []byte {
+	return m.data
+}
+
+// Truncate cuts the image to size bytes, or zero-extends it.
+func (m *Image) Truncate(size int64) {
+	if size <= int64(len(m.data)) {
+		m.data = m.data[:size]
+		return
+	}
+	m.data = append(m.data, make([]byte, size-int64(len(m.data)))...)
+}